@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"embed"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"rest-srv/config"
+	"rest-srv/db"
+	"rest-srv/models"
+	"rest-srv/utility"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles are the migrations applied by the migrate command
+//
+//go:embed sql/*.sql
+var migrationFiles embed.FS
+
+var (
+	// errUsage is returned once the usage of a command has been printed
+	errUsage = errors.New("invalid usage")
+	// errAborted is returned when the user doesn't confirm
+	errAborted = errors.New("aborted")
+)
+
+// command holds the flags every administration command has
+type command struct {
+	*flag.FlagSet
+	arguments  string
+	configFile string
+	json       bool
+	yes        bool
+	cfg        *config.Config
+}
+
+// newCommand creates the flags of the command name taking arguments, e.g. "<username>".
+// A command that asks for confirmation also gets -yes.
+func newCommand(name, arguments, description string, confirms bool) *command {
+	c := &command{FlagSet: flag.NewFlagSet("rest-srv "+name, flag.ContinueOnError), arguments: arguments}
+	c.StringVar(&c.configFile, "config", "", "YAML or TOML configuration file, CONFIG_FILE by default")
+	c.BoolVar(&c.json, "json", false, "print the result as JSON")
+	if confirms {
+		c.BoolVar(&c.yes, "yes", false, "don't ask for confirmation, as needed when stdin is not a terminal")
+	}
+	c.Usage = func() {
+		fmt.Fprintf(c.Output(), "Usage: %s\n\n%s\n\nFlags:\n", strings.TrimSpace("rest-srv "+name+" [flags] "+arguments), description)
+		c.PrintDefaults()
+	}
+	return c
+}
+
+// parse parses args, which must hold exactly the arguments of the command after the flags
+func (c *command) parse(args []string, arguments int) error {
+	if err := c.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		// The flag package has printed the error and the usage
+		return errUsage
+	}
+	if c.NArg() != arguments {
+		if arguments == 0 {
+			return c.usageError("unexpected arguments: %s", strings.Join(c.Args(), " "))
+		}
+		return c.usageError("expected %s", c.arguments)
+	}
+	return nil
+}
+
+func (c *command) usageError(format string, args ...any) error {
+	fmt.Fprintf(c.Output(), format+"\n", args...)
+	c.Usage()
+	return errUsage
+}
+
+// connect loads the configuration and connects to the database
+func (c *command) connect() error {
+	// Logs go to stderr, out of the way of the output, and only when something fails
+	utility.SetupLogger(os.Stderr, "warn")
+	var args []string
+	if c.configFile != "" {
+		args = []string{"-config", c.configFile}
+	}
+	cfg, err := config.Load(args)
+	if err != nil {
+		return err
+	}
+	c.cfg = cfg
+	utility.SetJWTSettings(cfg.Auth.JWTSecret, cfg.Auth.JWTExpiresIn)
+	if err := db.ConnectDb(cfg.Database.User, cfg.Database.Password, cfg.Database.Host, cfg.Database.Port, cfg.Database.Name); err != nil {
+		return err
+	}
+	return db.Db.Ping()
+}
+
+// confirm asks the user on the terminal to confirm the action described by format, unless -yes
+// was given. Without a terminal the action needs -yes.
+func (c *command) confirm(format string, args ...any) error {
+	if c.yes {
+		return nil
+	}
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return errors.New("stdin is not a terminal, confirm with -yes")
+	}
+	fmt.Fprintf(os.Stderr, format+" [y/N] ", args...)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+		return errAborted
+	}
+	return nil
+}
+
+// print writes result as JSON with -json, or else the text of format
+func (c *command) print(result any, format string, args ...any) error {
+	if c.json {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	}
+	_, err := fmt.Printf(format+"\n", args...)
+	return err
+}
+
+// password reads a password from the first line of stdin with fromStdin, or else generates one
+func password(fromStdin bool) (password string, generated bool, err error) {
+	if !fromStdin {
+		return rand.Text(), true, nil
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", false, fmt.Errorf("reading the password from stdin: %w", err)
+	}
+	if password = strings.TrimRight(line, "\r\n"); password == "" {
+		return "", false, errors.New("the password read from stdin is empty")
+	}
+	return password, false, nil
+}
+
+func migrateCommand(args []string) error {
+	c := newCommand("migrate", "", "Applies the migrations of the sql directory that haven't been, in order.", true)
+	status := c.Bool("status", false, "only list the migrations and whether they are applied")
+	if err := c.parse(args, 0); err != nil {
+		return err
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	files, err := fs.Sub(migrationFiles, "sql")
+	if err != nil {
+		return err
+	}
+	migrations, err := db.Migrations(ctx, files)
+	if err != nil {
+		return err
+	}
+
+	var pending []string
+	for _, m := range migrations {
+		if m.AppliedAt == nil {
+			pending = append(pending, m.Name)
+		}
+	}
+	if *status {
+		lines := make([]string, len(migrations))
+		for i, m := range migrations {
+			state := "pending"
+			if m.AppliedAt != nil {
+				state = "applied " + m.AppliedAt.Format(time.RFC3339)
+			}
+			lines[i] = fmt.Sprintf("%-40s %s", m.Name, state)
+		}
+		return c.print(migrations, "%s", strings.Join(lines, "\n"))
+	}
+
+	applied := []string{}
+	if len(pending) > 0 {
+		if err := c.confirm("Apply %s to database %s on %s?", strings.Join(pending, ", "), c.cfg.Database.Name, c.cfg.Database.Host); err != nil {
+			return err
+		}
+		for _, name := range pending {
+			if err := db.Migrate(ctx, files, name); err != nil {
+				return err
+			}
+			applied = append(applied, name)
+		}
+	}
+	return c.print(map[string][]string{"applied": applied}, "%d migrations applied", len(applied))
+}
+
+func execCreateCommand(args []string) error {
+	c := newCommand("exec create", "", "Creates an exec, e.g. the first admin, which can then create the others through the API.\nThe password is generated and printed unless it is read from stdin.", false)
+	exec := models.Exec{}
+	c.StringVar(&exec.Username, "username", "", "login name (required)")
+	c.StringVar(&exec.Email, "email", "", "email address (required)")
+	c.StringVar(&exec.FirstName, "first-name", "", "first name (required)")
+	c.StringVar(&exec.LastName, "last-name", "", "last name (required)")
+	c.StringVar(&exec.Role, "role", "admin", "admin, manager or exec")
+	passwordStdin := c.Bool("password-stdin", false, "read the password from stdin")
+	if err := c.parse(args, 0); err != nil {
+		return err
+	}
+	for _, required := range [][2]string{{"username", exec.Username}, {"email", exec.Email}, {"first-name", exec.FirstName}, {"last-name", exec.LastName}} {
+		if required[1] == "" {
+			return c.usageError("-%s is required", required[0])
+		}
+	}
+
+	plain, generated, err := password(*passwordStdin)
+	if err != nil {
+		return err
+	}
+	exec.Password = plain
+	if err := exec.Validate(); err != nil {
+		return err
+	}
+	if exec.Password, err = utility.HashPassword(plain); err != nil {
+		return err
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+	added, err := db.AddExecs(context.Background(), []models.Exec{exec})
+	if err != nil {
+		return err
+	}
+
+	result := map[string]any{"id": added[0].ID, "username": added[0].Username, "email": added[0].Email, "role": added[0].Role}
+	text := fmt.Sprintf("Created %s %s with id %d", added[0].Role, added[0].Username, added[0].ID)
+	if generated {
+		result["generated_password"] = plain
+		text += "\nPassword: " + plain
+	}
+	return c.print(result, "%s", text)
+}
+
+func execResetPasswordCommand(args []string) error {
+	c := newCommand("exec reset-password", "<username>", "Sets a new password for an exec, without the current one.\nThe password is generated and printed unless it is read from stdin.", true)
+	passwordStdin := c.Bool("password-stdin", false, "read the password from stdin")
+	if err := c.parse(args, 1); err != nil {
+		return err
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	exec, err := db.GetExecByUsername(ctx, c.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := c.confirm("Set a new password for %s (%s)?", exec.Username, exec.Email); err != nil {
+		return err
+	}
+	plain, generated, err := password(*passwordStdin)
+	if err != nil {
+		return err
+	}
+	if _, err := db.SetExecPassword(ctx, exec.ID, plain); err != nil {
+		return err
+	}
+
+	result := map[string]any{"id": exec.ID, "username": exec.Username}
+	text := "Password of " + exec.Username + " changed"
+	if generated {
+		result["generated_password"] = plain
+		text += "\nPassword: " + plain
+	}
+	return c.print(result, "%s", text)
+}
+
+func execDeactivateCommand(args []string) error {
+	c := newCommand("exec deactivate", "<username>", "Deactivates an exec, which can no longer log in. Its sessions end when their token expires.", true)
+	if err := c.parse(args, 1); err != nil {
+		return err
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	exec, err := db.GetExecByUsername(ctx, c.Arg(0))
+	if err != nil {
+		return err
+	}
+	result := map[string]any{"id": exec.ID, "username": exec.Username, "inactive_status": true}
+	if exec.InactiveStatus {
+		return c.print(result, "%s is already inactive", exec.Username)
+	}
+	if err := c.confirm("Deactivate %s %s (%s)?", exec.Role, exec.Username, exec.Email); err != nil {
+		return err
+	}
+	if _, err := db.PatchExec(ctx, exec.ID, map[string]any{"inactive_status": true}); err != nil {
+		return err
+	}
+	return c.print(result, "%s deactivated", exec.Username)
+}
+
+func execResetMFACommand(args []string) error {
+	c := newCommand("exec reset-mfa", "<username>", "Removes the second factor of an exec who lost it, e.g. the only admin.\nWhen the role of the exec requires one, they enroll again at their next login.", true)
+	if err := c.parse(args, 1); err != nil {
+		return err
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	exec, err := db.GetExecByUsername(ctx, c.Arg(0))
+	if err != nil {
+		return err
+	}
+	result := map[string]any{"id": exec.ID, "username": exec.Username, "mfa": false}
+	if _, err := db.GetExecMFA(ctx, exec.ID); err != nil {
+		if err.Error() == "mfa not found" {
+			return c.print(result, "%s has no second factor", exec.Username)
+		}
+		return err
+	}
+	if err := c.confirm("Remove the second factor of %s %s (%s)?", exec.Role, exec.Username, exec.Email); err != nil {
+		return err
+	}
+	if err := db.DeleteExecMFA(ctx, exec.ID); err != nil {
+		return err
+	}
+	return c.print(result, "second factor of %s removed", exec.Username)
+}
+
+// Sample data of the seed command; every student belongs to the class of a teacher
+var (
+	seedTeachers = []models.Teacher{
+		{FirstName: "Ada", LastName: "Lovelace", Email: "ada.lovelace@example.com", Class: "9A", Subject: "Mathematics"},
+		{FirstName: "Marie", LastName: "Curie", Email: "marie.curie@example.com", Class: "9B", Subject: "Chemistry"},
+		{FirstName: "Alan", LastName: "Turing", Email: "alan.turing@example.com", Class: "10A", Subject: "Computer Science"},
+	}
+	seedStudents = []models.Student{
+		{FirstName: "Liam", LastName: "Smith", Email: "liam.smith@example.com", Class: "9A"},
+		{FirstName: "Emma", LastName: "Jones", Email: "emma.jones@example.com", Class: "9A"},
+		{FirstName: "Noah", LastName: "Brown", Email: "noah.brown@example.com", Class: "9A"},
+		{FirstName: "Olivia", LastName: "Taylor", Email: "olivia.taylor@example.com", Class: "9B"},
+		{FirstName: "Lucas", LastName: "Wilson", Email: "lucas.wilson@example.com", Class: "9B"},
+		{FirstName: "Mia", LastName: "Davies", Email: "mia.davies@example.com", Class: "9B"},
+		{FirstName: "Leo", LastName: "Evans", Email: "leo.evans@example.com", Class: "10A"},
+		{FirstName: "Ava", LastName: "Thomas", Email: "ava.thomas@example.com", Class: "10A"},
+		{FirstName: "Ethan", LastName: "Roberts", Email: "ethan.roberts@example.com", Class: "10A"},
+	}
+)
+
+func seedCommand(args []string) error {
+	c := newCommand("seed", "", "Fills an empty database with sample teachers and students, for development.", true)
+	if err := c.parse(args, 0); err != nil {
+		return err
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	existing, err := db.GetTeachers(ctx, nil, nil, []string{"id"})
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		return fmt.Errorf("the database already has %d teachers, seed only fills an empty one", len(existing))
+	}
+	if err := c.confirm("Insert %d teachers and %d students into database %s on %s?", len(seedTeachers), len(seedStudents), c.cfg.Database.Name, c.cfg.Database.Host); err != nil {
+		return err
+	}
+	teachers, err := db.AddTeachers(ctx, seedTeachers)
+	if err != nil {
+		return err
+	}
+	students, err := db.AddStudents(ctx, seedStudents)
+	if err != nil {
+		return err
+	}
+	result := map[string]int{"teachers": len(teachers), "students": len(students)}
+	return c.print(result, "Inserted %d teachers and %d students", len(teachers), len(students))
+}
+
+func tokenIssueCommand(args []string) error {
+	c := newCommand("token issue", "<username>", "Issues a session token for an exec, e.g. for a script calling the API with the Bearer cookie.", false)
+	expiresIn := c.Duration("expires-in", 0, "lifetime of the token, auth.jwt_expires_in by default")
+	if err := c.parse(args, 1); err != nil {
+		return err
+	}
+	if err := c.connect(); err != nil {
+		return err
+	}
+	if *expiresIn > 0 {
+		utility.SetJWTSettings(c.cfg.Auth.JWTSecret, *expiresIn)
+	} else {
+		*expiresIn = c.cfg.Auth.JWTExpiresIn
+	}
+	exec, err := db.GetExecByUsername(context.Background(), c.Arg(0))
+	if err != nil {
+		return err
+	}
+	if exec.InactiveStatus {
+		return fmt.Errorf("%s is inactive", exec.Username)
+	}
+	expiresAt := time.Now().Add(*expiresIn)
+	token, err := utility.SignToken(strconv.Itoa(exec.ID), exec.Username, exec.Role)
+	if err != nil {
+		return err
+	}
+	result := map[string]any{"token": token, "expires_at": expiresAt.Format(time.RFC3339)}
+	return c.print(result, "%s", token)
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"rest-srv/authz"
+	"rest-srv/db"
+	"rest-srv/models"
+	"rest-srv/utility"
+)
+
+// validateAPIKeyScopes reports the scopes that are not an action on a resource of the
+// permission matrix
+func validateAPIKeyScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return utility.ValidationErrors{{Field: "scopes", Message: "is required"}}
+	}
+	var errs utility.ValidationErrors
+	for i, scope := range scopes {
+		if !authz.ValidScope(scope) {
+			errs = append(errs, utility.FieldError{Field: "scopes[" + strconv.Itoa(i) + "]", Message: "must be a scope such as students:read"})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func GetAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	exec, ok := execFromPath(w, r)
+	if !ok {
+		return
+	}
+	keys, err := db.GetAPIKeysByExec(r.Context(), exec.ID)
+	if err != nil {
+		http.Error(w, "unable to retrieve api keys", http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		Status string          `json:"status"`
+		Count  int             `json:"count"`
+		Data   []models.APIKey `json:"data"`
+	}{Status: "success", Count: len(keys), Data: keys}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// AddAPIKeyHandler creates an API key acting as the exec within its scopes. The key is
+// returned in this response only.
+func AddAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	exec, ok := execFromPath(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		writeValidationError(w, utility.ValidationErrors{{Field: "expires_at", Message: "must be in the future"}})
+		return
+	}
+
+	key, prefix, hash := utility.NewAPIKey()
+	apiKey := models.APIKey{
+		ExecID:    exec.ID,
+		Name:      req.Name,
+		Prefix:    prefix,
+		KeyHash:   hash,
+		Scopes:    req.Scopes,
+		ExpiresAt: req.ExpiresAt,
+	}
+	if err := apiKey.Validate(); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	if err := validateAPIKeyScopes(apiKey.Scopes); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	apiKey, err := db.AddAPIKey(r.Context(), apiKey)
+	if err != nil {
+		http.Error(w, "unable to add api key", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(struct {
+		models.APIKey
+		Key string `json:"key"`
+	}{APIKey: apiKey, Key: key})
+}
+
+// RevokeAPIKeyHandler revokes an API key, refused from the next request made with it
+func RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	execID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || execID == 0 {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	id, err := strconv.Atoi(r.PathValue("keyId"))
+	if err != nil || id == 0 {
+		http.Error(w, "invalid api key id", http.StatusBadRequest)
+		return
+	}
+	key, err := db.RevokeAPIKey(r.Context(), execID, id)
+	if err != nil {
+		if err.Error() == "api key not found" {
+			http.Error(w, "api key not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "unable to revoke api key", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(key)
+}
@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"rest-srv/db"
+	"rest-srv/utility"
+)
+
+const maxBatchOperations = 100
+
+// References to earlier results look like ${0} (the whole body of operation 0)
+// or ${0/0/id} (a JSON Pointer into that body)
+var batchReference = regexp.MustCompile(`\$\{(\d+)(/[^}]*)?\}`)
+
+type batchOperation struct {
+	Method      string          `json:"method"`
+	Path        string          `json:"path"`
+	ContentType string          `json:"content_type,omitempty"`
+	Body        json.RawMessage `json:"body,omitempty"`
+}
+
+type batchResult struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Status int    `json:"status"`
+	Body   any    `json:"body,omitempty"`
+}
+
+// batchResponseWriter buffers the response of a single batch operation
+type batchResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *batchResponseWriter) Header() http.Header { return w.header }
+
+func (w *batchResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(b)
+}
+
+func (w *batchResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+// BatchHandler runs a list of sub-requests against router inside a single database
+// transaction. Either every operation succeeds and the transaction is committed, or the
+// first failing operation stops the batch and everything is rolled back. Operations on the
+// routes that are unbatchable fail with 400. The bodies of the operations are left for router
+// to sanitize, once their references are resolved.
+func BatchHandler(router http.Handler, unbatchable func(*http.Request) bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Operations []batchOperation `json:"operations"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		if len(req.Operations) == 0 {
+			http.Error(w, "operations are required", http.StatusBadRequest)
+			return
+		}
+		if len(req.Operations) > maxBatchOperations {
+			http.Error(w, fmt.Sprintf("a batch may contain at most %d operations", maxBatchOperations), http.StatusBadRequest)
+			return
+		}
+
+		tx, err := db.Db.BeginTx(r.Context(), nil)
+		if err != nil {
+			http.Error(w, utility.ErrorHandlerContext(r.Context(), err, "database error").Error(), http.StatusInternalServerError)
+			return
+		}
+		committed := false
+		defer func() {
+			if !committed {
+				tx.Rollback()
+			}
+		}()
+		ctx := db.WithTx(r.Context(), tx)
+
+		results := make([]batchResult, 0, len(req.Operations))
+		for i, op := range req.Operations {
+			result, err := runBatchOperation(router, unbatchable, r.WithContext(ctx), op, results)
+			if err != nil {
+				result = batchResult{Method: op.Method, Path: op.Path, Status: http.StatusBadRequest, Body: err.Error()}
+			}
+			results = append(results, result)
+			if result.Status >= http.StatusBadRequest {
+				writeBatchResponse(w, result.Status, "error", &i, results)
+				return
+			}
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			http.Error(w, utility.ErrorHandlerContext(r.Context(), err, "database error").Error(), http.StatusInternalServerError)
+			return
+		}
+		committed = true
+		writeBatchResponse(w, http.StatusOK, "success", nil, results)
+	}
+}
+
+func runBatchOperation(router http.Handler, unbatchable func(*http.Request) bool, parent *http.Request, op batchOperation, results []batchResult) (batchResult, error) {
+	method := strings.ToUpper(op.Method)
+	resolvedPath, err := resolveBatchString(op.Path, results)
+	if err != nil {
+		return batchResult{}, err
+	}
+	pathStr := fmt.Sprint(resolvedPath)
+	if !strings.HasPrefix(pathStr, "/") {
+		return batchResult{}, fmt.Errorf("invalid path %q", op.Path)
+	}
+
+	var body []byte
+	if len(op.Body) > 0 {
+		var decoded any
+		if err := json.Unmarshal(op.Body, &decoded); err != nil {
+			return batchResult{}, fmt.Errorf("invalid body: %v", err)
+		}
+		decoded, err = resolveBatchReferences(decoded, results)
+		if err != nil {
+			return batchResult{}, err
+		}
+		body, err = json.Marshal(decoded)
+		if err != nil {
+			return batchResult{}, err
+		}
+	}
+
+	subRequest, err := http.NewRequestWithContext(parent.Context(), method, pathStr, bytes.NewReader(body))
+	if err != nil {
+		return batchResult{}, fmt.Errorf("invalid operation: %v", err)
+	}
+	if unbatchable(subRequest) {
+		return batchResult{}, fmt.Errorf("%s %s cannot run in a batch", method, subRequest.URL.Path)
+	}
+	contentType := op.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	subRequest.Header.Set("Content-Type", contentType)
+	subRequest.RemoteAddr = parent.RemoteAddr
+	for _, cookie := range parent.Cookies() {
+		subRequest.AddCookie(cookie)
+	}
+
+	recorder := &batchResponseWriter{header: make(http.Header)}
+	router.ServeHTTP(recorder, subRequest)
+	if recorder.status == 0 {
+		recorder.status = http.StatusOK
+	}
+
+	result := batchResult{Method: method, Path: pathStr, Status: recorder.status}
+	if recorder.body.Len() > 0 {
+		var decoded any
+		if err := json.Unmarshal(recorder.body.Bytes(), &decoded); err == nil {
+			result.Body = decoded
+		} else {
+			result.Body = strings.TrimSpace(recorder.body.String())
+		}
+	}
+	return result, nil
+}
+
+// resolveBatchReferences replaces ${n/pointer} references in every string of a decoded body
+func resolveBatchReferences(value any, results []batchResult) (any, error) {
+	switch v := value.(type) {
+	case string:
+		return resolveBatchString(v, results)
+	case map[string]any:
+		for key, item := range v {
+			resolved, err := resolveBatchReferences(item, results)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = resolved
+		}
+		return v, nil
+	case []any:
+		for i, item := range v {
+			resolved, err := resolveBatchReferences(item, results)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = resolved
+		}
+		return v, nil
+	default:
+		return v, nil
+	}
+}
+
+// resolveBatchString resolves references in s. A string that is exactly one reference is
+// replaced by the referenced value so numbers stay numbers; otherwise values are inlined as text.
+func resolveBatchString(s string, results []batchResult) (any, error) {
+	if match := batchReference.FindStringSubmatch(s); match != nil && match[0] == s {
+		return lookupBatchReference(match, results)
+	}
+	var lookupErr error
+	resolved := batchReference.ReplaceAllStringFunc(s, func(ref string) string {
+		value, err := lookupBatchReference(batchReference.FindStringSubmatch(ref), results)
+		if err != nil {
+			lookupErr = err
+			return ref
+		}
+		if str, ok := value.(string); ok {
+			return str
+		}
+		encoded, _ := json.Marshal(value)
+		return string(encoded)
+	})
+	if lookupErr != nil {
+		return nil, lookupErr
+	}
+	return resolved, nil
+}
+
+func lookupBatchReference(match []string, results []batchResult) (any, error) {
+	index, err := strconv.Atoi(match[1])
+	if err != nil || index >= len(results) {
+		return nil, fmt.Errorf("reference %s points to an operation that has not run", match[0])
+	}
+	value, err := utility.JSONPointerGet(results[index].Body, match[2])
+	if err != nil {
+		return nil, fmt.Errorf("reference %s not found", match[0])
+	}
+	return value, nil
+}
+
+func writeBatchResponse(w http.ResponseWriter, status int, result string, failed *int, results []batchResult) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Status          string        `json:"status"`
+		FailedOperation *int          `json:"failed_operation,omitempty"`
+		Results         []batchResult `json:"results"`
+	}{Status: result, FailedOperation: failed, Results: results})
+}
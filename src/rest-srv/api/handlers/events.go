@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"rest-srv/authz"
+	"rest-srv/events"
+	"rest-srv/utility"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const eventStreamHeartbeat = 15 * time.Second
+
+var streamEntities = []string{"student", "teacher", "exec"}
+
+// EventStreamHandler streams entity changes as Server-Sent Events, filtered by
+// ?entity=student,teacher and ?class=9A. A client reconnecting with Last-Event-ID gets the
+// events it missed, or a "reset" event when they are no longer buffered and it must refetch.
+func EventStreamHandler(broker *events.Broker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming not supported", http.StatusInternalServerError)
+			return
+		}
+
+		// Only the changes to the resources the principal may read are streamed
+		readable := slices.DeleteFunc(slices.Clone(streamEntities), func(entity string) bool {
+			return !authz.AllowedContext(r.Context(), entity+"s", authz.Read)
+		})
+		entities := splitQueryList(r.URL.Query().Get("entity"))
+		for _, entity := range entities {
+			if !slices.Contains(streamEntities, entity) {
+				http.Error(w, fmt.Sprintf("unknown entity %s", entity), http.StatusBadRequest)
+				return
+			}
+			if !slices.Contains(readable, entity) {
+				utility.WriteProblem(w, r, http.StatusForbidden, fmt.Sprintf("your role may not read %ss", entity))
+				return
+			}
+		}
+		if len(entities) == 0 {
+			if len(readable) == 0 {
+				utility.WriteProblem(w, r, http.StatusForbidden, "your role may not read any entity")
+				return
+			}
+			entities = readable
+		}
+		classes := splitQueryList(r.URL.Query().Get("class"))
+
+		// EventSource sends the header on reconnect; the query parameter allows resuming a new connection
+		lastEventIDStr := r.Header.Get("Last-Event-ID")
+		if lastEventIDStr == "" {
+			lastEventIDStr = r.URL.Query().Get("lastEventId")
+		}
+		var lastEventID int64 = -1
+		if lastEventIDStr != "" {
+			id, err := strconv.ParseInt(lastEventIDStr, 10, 64)
+			if err != nil || id < 0 {
+				http.Error(w, "invalid Last-Event-ID", http.StatusBadRequest)
+				return
+			}
+			lastEventID = id
+		}
+
+		stream, replay, complete, unsubscribe := broker.Subscribe(max(lastEventID, 0))
+		defer unsubscribe()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "retry: 3000\n\n")
+
+		if lastEventID >= 0 {
+			if !complete {
+				fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+			}
+			for _, event := range replay {
+				writeStreamEvent(w, event, entities, classes)
+			}
+		}
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(eventStreamHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case event, ok := <-stream:
+				if !ok {
+					return
+				}
+				writeStreamEvent(w, event, entities, classes)
+				flusher.Flush()
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": ping\n\n")
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+func writeStreamEvent(w http.ResponseWriter, event events.Event, entities []string, classes []string) {
+	if !event.Matches(entities, classes) {
+		return
+	}
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Payload)
+}
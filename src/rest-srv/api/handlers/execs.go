@@ -8,17 +8,38 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
 	"time"
 
 	"rest-srv/db"
+	"rest-srv/metrics"
 	"rest-srv/models"
+	"rest-srv/revocation"
 	"rest-srv/utility"
 )
 
+// execFromPath returns the exec of the {id} path value of the /execs/{id}/... routes
+func execFromPath(w http.ResponseWriter, r *http.Request) (models.Exec, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id == 0 {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return models.Exec{}, false
+	}
+	exec, err := db.GetExecById(r.Context(), id)
+	if err != nil {
+		if err.Error() == "exec not found" {
+			http.Error(w, "exec not found", http.StatusNotFound)
+			return models.Exec{}, false
+		}
+		http.Error(w, "unable to retrieve exec", http.StatusInternalServerError)
+		return models.Exec{}, false
+	}
+	return exec, true
+}
+
 func GetExecHandler(w http.ResponseWriter, r *http.Request) {
 	idStr := r.PathValue("id")
 	id, err := strconv.Atoi(idStr)
@@ -26,8 +47,13 @@ func GetExecHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid id", http.StatusBadRequest)
 		return
 	}
-	exec, err := db.GetExecById(id)
+	fields := requestedFields(r)
+	exec, err := db.GetExecByIdFields(r.Context(), id, fields)
 	if err != nil {
+		if isFieldsError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		if err.Error() == "exec not found" {
 			http.Error(w, "exec not found", http.StatusNotFound)
 			return
@@ -35,8 +61,18 @@ func GetExecHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "unable to retrieve exec", http.StatusInternalServerError)
 		return
 	}
+	if len(fields) == 0 {
+		json.NewEncoder(w).Encode(exec)
+		w.Header().Set("Content-Type", "application/json")
+		return
+	}
 
-	json.NewEncoder(w).Encode(exec)
+	shaped, err := projectFields(exec, fields)
+	if err != nil {
+		http.Error(w, "unable to retrieve exec", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(shaped)
 	w.Header().Set("Content-Type", "application/json")
 }
 
@@ -58,17 +94,31 @@ func GetExecsHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	execsList, err := db.GetExecs(filters, sortByParams)
+	fields := requestedFields(r)
+	execsList, err := db.GetExecs(r.Context(), filters, sortByParams, fields)
 	if err != nil {
+		if isFieldsError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, "unable to retrieve execs", http.StatusInternalServerError)
 		return
 	}
 
+	var data any = execsList
+	if len(fields) > 0 {
+		data, err = shapeItems(execsList, fields, nil)
+		if err != nil {
+			http.Error(w, "unable to retrieve execs", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	response := struct {
-		Status string        `json:"status"`
-		Count  int           `json:"count"`
-		Data   []models.Exec `json:"data"`
-	}{Status: "success", Count: len(execsList), Data: execsList}
+		Status string `json:"status"`
+		Count  int    `json:"count"`
+		Data   any    `json:"data"`
+	}{Status: "success", Count: len(execsList), Data: data}
 	json.NewEncoder(w).Encode(response)
 	w.Header().Set("Content-Type", "application/json")
 }
@@ -81,31 +131,26 @@ func AddExecHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	err = validateEach(len(newExecs), func(i int) error { return newExecs[i].Validate() })
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
 	currentTime := time.Now().Format("2006-01-02 15:04:05")
 	for i := range newExecs {
 		newExecs[i].UserCreatedAt = utility.NullString{NullString: sql.NullString{String: currentTime, Valid: true}}
-		fmt.Println("Validating exec: ", newExecs[i])
-		err = newExecs[i].Validate()
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		if newExecs[i].Password == "" {
-			http.Error(w, utility.ErrorHandler(errors.New("password is required"), "error adding exec").Error(), http.StatusBadRequest)
-			return
-		}
 
 		encodedHash, err := utility.HashPassword(newExecs[i].Password)
 		if err != nil {
-			http.Error(w, utility.ErrorHandler(err, "error adding exec").Error(), http.StatusInternalServerError)
+			http.Error(w, utility.ErrorHandlerContext(r.Context(), err, "error adding exec").Error(), http.StatusInternalServerError)
 			return
 		}
 		newExecs[i].Password = encodedHash
 	}
 
-	addedExecs, err := db.AddExecs(newExecs)
+	addedExecs, err := db.AddExecs(r.Context(), newExecs)
 	if err != nil {
-		fmt.Println(err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -135,10 +180,10 @@ func UpdateExecHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	err = updatedExec.Validate()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeValidationError(w, err)
 		return
 	}
-	updatedExec, err = db.UpdateExec(id, updatedExec)
+	updatedExec, err = db.UpdateExec(r.Context(), id, updatedExec)
 	if err != nil {
 		if err.Error() == "exec not found" {
 			http.Error(w, "exec not found", http.StatusNotFound)
@@ -164,19 +209,33 @@ func PatchExecHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if mediaType := patchMediaType(r); mediaType != "" {
+		patchExecDocument(w, r, id, mediaType)
+		return
+	}
+
 	var updatedFields map[string]any
 	err = json.NewDecoder(r.Body).Decode(&updatedFields)
 	if err != nil {
 		http.Error(w, "invalid request body", http.StatusBadRequest)
 		return
 	}
+	err = utility.ValidatePartial(models.Exec{}, updatedFields)
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
 
-	updatedExec, err := db.PatchExec(id, updatedFields)
+	updatedExec, err := db.PatchExec(r.Context(), id, updatedFields)
 	if err != nil {
 		if err.Error() == "exec not found" {
 			http.Error(w, "exec not found", http.StatusNotFound)
 			return
 		}
+		if isValidationError(err) {
+			writeValidationError(w, err)
+			return
+		}
 		http.Error(w, "unable to update exec", http.StatusInternalServerError)
 		return
 	}
@@ -186,19 +245,33 @@ func PatchExecHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func PatchExecsHandler(w http.ResponseWriter, r *http.Request) {
+	if mediaType := patchMediaType(r); mediaType != "" {
+		patchExecsDocuments(w, r, mediaType)
+		return
+	}
+
 	var updates []map[string]any
 	err := json.NewDecoder(r.Body).Decode(&updates)
 	if err != nil {
 		http.Error(w, "invalid request body", http.StatusBadRequest)
 		return
 	}
+	err = validateEach(len(updates), func(i int) error { return utility.ValidatePartial(models.Exec{}, updates[i]) })
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
 
-	updatedExecs, err := db.PatchExecs(updates)
+	updatedExecs, err := db.PatchExecs(r.Context(), updates)
 	if err != nil {
 		if err.Error() == "exec not found" || strings.Contains(err.Error(), "exec not found") {
 			http.Error(w, "exec not found", http.StatusNotFound)
 			return
 		}
+		if isValidationError(err) {
+			writeValidationError(w, err)
+			return
+		}
 		http.Error(w, "unable to update execs", http.StatusInternalServerError)
 		return
 	}
@@ -219,7 +292,7 @@ func DeleteExecHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	deletedExec, err := db.DeleteExec(id)
+	deletedExec, err := db.DeleteExec(r.Context(), id)
 	if err != nil {
 		if err.Error() == "exec not found" {
 			http.Error(w, "exec not found", http.StatusNotFound)
@@ -247,7 +320,7 @@ func DeleteExecsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	deletedExecs, err := db.DeleteExecs(ids)
+	deletedExecs, err := db.DeleteExecs(r.Context(), ids)
 	if err != nil {
 		if strings.Contains(err.Error(), "exec not found") {
 			http.Error(w, "exec not found", http.StatusNotFound)
@@ -284,13 +357,15 @@ func LoginExecHandler(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
 	// Search for exec by username
-	exec, err := db.GetExecByUsername(loginData.Username)
+	exec, err := db.GetExecByUsername(r.Context(), loginData.Username)
 	if err != nil {
+		metrics.AuthFailures.Inc("invalid_credentials")
 		http.Error(w, "invalid username or password", http.StatusUnauthorized)
 		return
 	}
 	// is user active?
 	if exec.InactiveStatus {
+		metrics.AuthFailures.Inc("inactive_user")
 		http.Error(w, "user is inactive", http.StatusUnauthorized)
 		return
 	}
@@ -298,30 +373,62 @@ func LoginExecHandler(w http.ResponseWriter, r *http.Request) {
 	// verify password
 	valid, err := utility.ComparePassword(exec.Password, loginData.Password)
 	if err != nil {
+		metrics.AuthFailures.Inc("invalid_credentials")
 		http.Error(w, "invalid username or password", http.StatusUnauthorized)
 		return
 	}
 	if !valid {
+		metrics.AuthFailures.Inc("invalid_credentials")
 		http.Error(w, "invalid username or password", http.StatusUnauthorized)
 		return
 	}
-	// generate token
-	token, err := utility.SignToken(strconv.Itoa(exec.ID), exec.Username, exec.Role)
+	// With a second factor, the password only earns a challenge to answer with a TOTP code
+	mfa, err := execMFA(r.Context(), exec.ID)
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	if mfa.Enabled() || mfaRequired(exec) {
+		writeMFAChallenge(w, exec, mfa.Enabled())
+		return
+	}
+	// generate the access token and the refresh token renewing it
+	token, refreshToken, err := startSession(w, r, exec)
 	if err != nil {
 		http.Error(w, "internal server error", http.StatusInternalServerError)
 		return
 	}
-	// return token
+	// return tokens
 	w.Header().Set("Content-Type", "application/json")
-	http.SetCookie(w, &http.Cookie{Name: "Bearer", Value: token, Path: "/", HttpOnly: true, Secure: true, Expires: time.Now().Add(24 * time.Hour), SameSite: http.SameSiteStrictMode})
 	json.NewEncoder(w).Encode(struct {
-		Status string `json:"status"`
-		Token  string `json:"token"`
-	}{Status: "success", Token: token})
+		Status       string `json:"status"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}{Status: "success", Token: token, RefreshToken: refreshToken})
 }
 
+// LogoutExecHandler ends the session: the access token of the Bearer cookie and the family of
+// the refresh token presented, in the body or the cookie, are revoked
 func LogoutExecHandler(w http.ResponseWriter, r *http.Request) {
-	http.SetCookie(w, &http.Cookie{Name: "Bearer", Value: "", Path: "/", HttpOnly: true, Secure: true, Expires: time.Now().Add(-1 * time.Hour), SameSite: http.SameSiteStrictMode})
+	presented, err := presentedRefreshToken(r)
+	if err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+	if err := revokeAccessToken(r); err != nil {
+		http.Error(w, "unable to log out", http.StatusInternalServerError)
+		return
+	}
+	if presented != "" {
+		if stored, err := db.GetRefreshTokenByHash(r.Context(), hashRefreshToken(presented)); err == nil {
+			if err := db.RevokeRefreshTokenFamily(r.Context(), stored.FamilyID); err != nil {
+				http.Error(w, "unable to log out", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+	clearSessionCookies(w)
 	json.NewEncoder(w).Encode(struct {
 		Status  string `json:"status"`
 		Message string `json:"message"`
@@ -329,6 +436,34 @@ func LogoutExecHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 }
 
+// LogoutAllExecHandler ends every session of the exec logged in, on every device
+func LogoutAllExecHandler(w http.ResponseWriter, r *http.Request) {
+	principal, ok := utility.PrincipalFromContext(r.Context())
+	if !ok || principal.Kind != utility.PrincipalUser {
+		utility.WriteProblem(w, r, http.StatusForbidden, "only execs have sessions to log out of")
+		return
+	}
+	id, err := strconv.Atoi(principal.ID)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	if err := db.RevokeExecRefreshTokens(r.Context(), id); err != nil {
+		http.Error(w, "unable to log out", http.StatusInternalServerError)
+		return
+	}
+	if err := revocation.RevokeSessions(r.Context(), principal.ID); err != nil {
+		http.Error(w, "unable to log out", http.StatusInternalServerError)
+		return
+	}
+	clearSessionCookies(w)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	}{Status: "success", Message: "Logged out of every session"})
+}
+
 func UpdateExecPasswordHandler(w http.ResponseWriter, r *http.Request) {
 	type UpdateExecPasswordRequest struct {
 		OldPassword string `json:"oldpassword"`
@@ -354,23 +489,34 @@ func UpdateExecPasswordHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid id", http.StatusBadRequest)
 		return
 	}
-	exec, err := db.UpdateExecPassword(id, updateExecPasswordRequest.OldPassword, updateExecPasswordRequest.NewPassword)
+	exec, err := db.UpdateExecPassword(r.Context(), id, updateExecPasswordRequest.OldPassword, updateExecPasswordRequest.NewPassword)
 	if err != nil {
 		http.Error(w, "unable to update exec password", http.StatusInternalServerError)
 		return
 	}
-	token, err := utility.SignToken(strconv.Itoa(id), exec.Username, exec.Role)
-	if err != nil {
+	// The change ended every session, this one continues in a new one
+	if _, _, err := startSession(w, r, exec); err != nil {
 		http.Error(w, "unable to sign token", http.StatusInternalServerError)
 		return
 	}
-	http.SetCookie(w, &http.Cookie{Name: "Bearer", Value: token, Path: "/", HttpOnly: true, Secure: true, Expires: time.Now().Add(24 * time.Hour), SameSite: http.SameSiteStrictMode})
 	json.NewEncoder(w).Encode(struct {
 		Status  string `json:"status"`
 		Message string `json:"message"`
 	}{Status: "success", Message: "Exec password updated successfully"})
 }
 
+// resetTokenExpiresIn and exposePort are set from the configuration at startup
+var (
+	resetTokenExpiresIn time.Duration
+	exposePort          int
+)
+
+// SetPasswordResetSettings sets the lifetime of reset links and the port they point to
+func SetPasswordResetSettings(expiresIn time.Duration, port int) {
+	resetTokenExpiresIn = expiresIn
+	exposePort = port
+}
+
 func ForgotExecPasswordHandler(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Email string `json:"email"`
@@ -378,7 +524,7 @@ func ForgotExecPasswordHandler(w http.ResponseWriter, r *http.Request) {
 	err := json.NewDecoder(r.Body).Decode(&req)
 	defer r.Body.Close()
 	if err != nil {
-		fmt.Println(err)
+		utility.Logger(r.Context()).Debug("invalid forgot password request body", "error", err)
 		http.Error(w, "invalid request body", http.StatusBadRequest)
 		return
 	}
@@ -387,7 +533,7 @@ func ForgotExecPasswordHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	exec, err := db.GetExecByEmail(req.Email)
+	exec, err := db.GetExecByEmail(r.Context(), req.Email)
 	if err != nil {
 		http.Error(w, "unable to retrieve exec", http.StatusInternalServerError)
 		return
@@ -396,17 +542,7 @@ func ForgotExecPasswordHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "exec not found", http.StatusNotFound)
 		return
 	}
-	resetTokenExpiresIn := os.Getenv("RESET_TOKEN_EXPIRES_IN")
-	if resetTokenExpiresIn == "" {
-		http.Error(w, "reset token expires in is not set", http.StatusInternalServerError)
-		return
-	}
-	resetTokenExpiresInDuration, err := time.ParseDuration(resetTokenExpiresIn)
-	if err != nil {
-		http.Error(w, "invalid reset token expires in", http.StatusInternalServerError)
-		return
-	}
-	expiry := time.Now().Add(resetTokenExpiresInDuration)
+	expiry := time.Now().Add(resetTokenExpiresIn)
 	tokenBytes := make([]byte, 32)
 	rand.Read(tokenBytes)
 	token := hex.EncodeToString(tokenBytes)
@@ -415,15 +551,15 @@ func ForgotExecPasswordHandler(w http.ResponseWriter, r *http.Request) {
 
 	exec.PasswordResetToken = utility.NullString{NullString: sql.NullString{String: hashedTokenString, Valid: true}}
 	exec.PasswordTokenExpires = utility.NullString{NullString: sql.NullString{String: expiry.Format(time.RFC3339), Valid: true}}
-	_, err = db.UpdateExec(exec.ID, exec)
+	_, err = db.UpdateExec(r.Context(), exec.ID, exec)
 	if err != nil {
 		http.Error(w, "unable to update exec password reset token", http.StatusInternalServerError)
 		return
 	}
 
-	resetPasswordURL := fmt.Sprintf("<a href='https://localhost:%s/execs/reset-password/reset/%s'>Reset Password</a>", os.Getenv("EXPOSE_PORT"), token)
-	message := fmt.Sprintf("Click the link to reset your password: %s", resetPasswordURL)
-	err = utility.SendMail(exec.Email, "Reset Password", message)
+	resetPasswordURL := fmt.Sprintf("https://localhost:%d/v1/execs/reset-password/reset/%s", exposePort, token)
+	message := fmt.Sprintf("To reset your password, POST it as {\"newpassword\": \"...\"} to %s within %s.", resetPasswordURL, resetTokenExpiresIn)
+	err = utility.SendMail(r.Context(), exec.Email, "Reset Password", message)
 	if err != nil {
 		http.Error(w, "unable to send reset password email", http.StatusInternalServerError)
 		return
@@ -435,48 +571,139 @@ func ForgotExecPasswordHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 }
 
+// ResetExecPasswordHandler sets the password sent with a token from the reset email. The
+// token can be used once, and the sessions started with the old password end.
 func ResetExecPasswordHandler(w http.ResponseWriter, r *http.Request) {
-	token := r.PathValue("token")
-	if token == "" {
-		http.Error(w, "token is required", http.StatusBadRequest)
-		return
+	var req struct {
+		NewPassword string `json:"newpassword"`
 	}
-	tokenBytes, err := hex.DecodeString(token)
+	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.NewPassword == "" {
+		http.Error(w, "new password is required", http.StatusBadRequest)
+		return
+	}
+	tokenBytes, err := hex.DecodeString(r.PathValue("token"))
+	if err != nil || len(tokenBytes) == 0 {
 		http.Error(w, "invalid token", http.StatusBadRequest)
 		return
 	}
 	hashedToken := sha256.Sum256(tokenBytes)
-	hashedTokenString := hex.EncodeToString(hashedToken[:])
-	exec, err := db.GetExecByPasswordResetToken(hashedTokenString)
+
+	_, err = db.ResetExecPassword(r.Context(), hex.EncodeToString(hashedToken[:]), req.NewPassword)
 	if err != nil {
-		http.Error(w, "unable to retrieve exec", http.StatusInternalServerError)
+		if err.Error() == "exec not found" {
+			http.Error(w, "invalid or expired token", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "unable to update exec password", http.StatusInternalServerError)
 		return
 	}
-	if exec == (models.Exec{}) {
-		http.Error(w, "exec not found", http.StatusNotFound)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	}{Status: "success", Message: "Exec password updated successfully"})
+}
+
+// applyExecPatch applies a merge patch or JSON patch to exec and validates the result
+func applyExecPatch(exec models.Exec, mediaType string, patch []byte) (models.Exec, error) {
+	patched, err := applyPatch(exec, mediaType, patch)
+	if err != nil {
+		return models.Exec{}, err
+	}
+	if patched.ID != 0 && patched.ID != exec.ID {
+		return models.Exec{}, utility.ValidationErrors{{Field: "id", Message: "cannot be changed"}}
+	}
+	patched.ID = exec.ID
+	if patched.Password != "" {
+		return models.Exec{}, utility.ValidationErrors{{Field: "password", Message: "cannot be patched, use update-password"}}
+	}
+	// Fields that are not part of the exec document are carried over unchanged
+	patched.Password = exec.Password
+	patched.UserCreatedAt = exec.UserCreatedAt
+	// The others are read-only as on a plain PATCH: password_changed_at decides which
+	// sessions are valid and the reset token is only set by forgot-password
+	err = utility.CheckUnpatched(exec, patched)
+	if err != nil {
+		return models.Exec{}, err
+	}
+	err = patched.Validate()
+	if err != nil {
+		return models.Exec{}, err
+	}
+	return patched, nil
+}
+
+// patchExecDocument handles application/merge-patch+json and application/json-patch+json bodies for PATCH /execs/{id}
+func patchExecDocument(w http.ResponseWriter, r *http.Request, id int, mediaType string) {
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	newPassword := "123456"
-	encodedHash, err := utility.HashPassword(newPassword)
+	updatedExecs, err := db.PatchExecDocuments(r.Context(), []int{id}, func(execs []models.Exec) ([]models.Exec, error) {
+		patched, err := applyExecPatch(execs[0], mediaType, patch)
+		return []models.Exec{patched}, err
+	})
 	if err != nil {
-		http.Error(w, "unable to hash password", http.StatusInternalServerError)
+		if err.Error() == "exec not found" {
+			http.Error(w, "exec not found", http.StatusNotFound)
+			return
+		}
+		if isPatchError(err) {
+			writePatchError(w, err)
+			return
+		}
+		http.Error(w, "unable to update exec", http.StatusInternalServerError)
 		return
 	}
-	exec.Password = encodedHash
-	exec.PasswordChangedAt = utility.NullString{NullString: sql.NullString{String: time.Now().Format(time.RFC3339), Valid: true}}
-	exec.PasswordResetToken = utility.NullString{NullString: sql.NullString{String: "", Valid: false}}
-	exec.PasswordTokenExpires = utility.NullString{NullString: sql.NullString{String: "", Valid: false}}
-	_, err = db.UpdateExec(exec.ID, exec)
+
+	json.NewEncoder(w).Encode(updatedExecs[0])
+	w.Header().Set("Content-Type", "application/json")
+}
+
+// patchExecsDocuments handles bulk merge patch and JSON patch bodies for PATCH /execs
+func patchExecsDocuments(w http.ResponseWriter, r *http.Request, mediaType string) {
+	patches, err := decodeBulkPatches(r.Body, mediaType)
 	if err != nil {
-		http.Error(w, "unable to update exec password", http.StatusInternalServerError)
+		http.Error(w, "invalid request body", http.StatusBadRequest)
 		return
 	}
-	json.NewEncoder(w).Encode(struct {
-		Status  string `json:"status"`
-		Message string `json:"message"`
-	}{Status: "success", Message: "Exec password updated successfully"})
+
+	ids := make([]int, len(patches))
+	for i := range patches {
+		ids[i] = patches[i].ID
+	}
+	updatedExecs, err := db.PatchExecDocuments(r.Context(), ids, func(execs []models.Exec) ([]models.Exec, error) {
+		patched := make([]models.Exec, len(execs))
+		err := validateEach(len(execs), func(i int) error {
+			var err error
+			patched[i], err = applyExecPatch(execs[i], mediaType, patches[i].Patch)
+			if errors.Is(err, utility.ErrInvalidPatch) || errors.Is(err, utility.ErrPatchConflict) {
+				return fmt.Errorf("[%d] %w", i, err)
+			}
+			return err
+		})
+		return patched, err
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "exec not found") {
+			http.Error(w, "exec not found", http.StatusNotFound)
+			return
+		}
+		if isPatchError(err) {
+			writePatchError(w, err)
+			return
+		}
+		http.Error(w, "unable to update execs", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(updatedExecs)
 	w.Header().Set("Content-Type", "application/json")
-	http.SetCookie(w, &http.Cookie{Name: "Bearer", Value: token, Path: "/", HttpOnly: true, Secure: true, Expires: time.Now().Add(24 * time.Hour), SameSite: http.SameSiteStrictMode})
 }
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// requestedFields parses the sparse fieldset in ?fields=id,first_name,email
+func requestedFields(r *http.Request) []string {
+	return splitQueryList(r.URL.Query().Get("fields"))
+}
+
+// requestedIncludes parses ?include=students and rejects relations not in allowed
+func requestedIncludes(r *http.Request, allowed ...string) ([]string, error) {
+	includes := splitQueryList(r.URL.Query().Get("include"))
+	for _, include := range includes {
+		if !slices.Contains(allowed, include) {
+			return nil, fmt.Errorf("unknown include %s", include)
+		}
+	}
+	return includes, nil
+}
+
+func splitQueryList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// withField adds field to a non-empty sparse fieldset so related resources can be joined on it
+func withField(fields []string, field string) []string {
+	if len(fields) == 0 || slices.Contains(fields, field) {
+		return fields
+	}
+	return append(slices.Clone(fields), field)
+}
+
+// isFieldsError reports whether err comes from an unknown field in a sparse fieldset
+func isFieldsError(err error) bool {
+	return strings.HasPrefix(err.Error(), "unknown field")
+}
+
+// projectFields returns the JSON object form of v reduced to fields (every field when empty)
+func projectFields(v any, fields []string) (map[string]any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var object map[string]any
+	err = json.Unmarshal(data, &object)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return object, nil
+	}
+	for key := range object {
+		if !slices.Contains(fields, key) {
+			delete(object, key)
+		}
+	}
+	return object, nil
+}
+
+// shapeItems projects every item to fields and lets extend attach related resources
+func shapeItems[T any](items []T, fields []string, extend func(item T, object map[string]any)) ([]map[string]any, error) {
+	shaped := make([]map[string]any, len(items))
+	for i, item := range items {
+		object, err := projectFields(item, fields)
+		if err != nil {
+			return nil, err
+		}
+		if extend != nil {
+			extend(item, object)
+		}
+		shaped[i] = object
+	}
+	return shaped, nil
+}
@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"rest-srv/graphql"
+)
+
+// GraphQLHandler executes a GraphQL request body {"query", "operationName", "variables"}.
+// Requests that fail before execution get a 400; field errors are reported in a 200 response.
+func GraphQLHandler(schema *graphql.Schema) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req graphql.Request
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil || req.Query == "" {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		response, executed := schema.Execute(r.Context(), req)
+		w.Header().Set("Content-Type", "application/json")
+		if !executed {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		json.NewEncoder(w).Encode(response)
+	}
+}
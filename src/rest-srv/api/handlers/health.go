@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"rest-srv/db"
+	"rest-srv/utility"
+	"sync/atomic"
+	"time"
+)
+
+const readinessCheckTimeout = 2 * time.Second
+
+type healthStatus struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// HealthzHandler reports that the process is alive. It checks no dependency, so an outage
+// of the database doesn't get the server restarted.
+func HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(healthStatus{Status: "ok"})
+}
+
+// Readiness tells whether the server should receive traffic. Once draining it reports the
+// server as unavailable, so load balancers stop routing to it while it shuts down.
+type Readiness struct {
+	draining atomic.Bool
+}
+
+func (rd *Readiness) Drain() {
+	rd.draining.Store(true)
+}
+
+// ReadyzHandler checks the database and the mail server. The reasons for a failing check
+// are logged rather than returned, since the endpoint is public.
+func (rd *Readiness) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessCheckTimeout)
+	defer cancel()
+
+	response := healthStatus{Status: "ok", Checks: make(map[string]string)}
+	if rd.draining.Load() {
+		response.Status = "unavailable"
+		response.Checks["server"] = "shutting down"
+	}
+	checks := map[string]func(context.Context) error{
+		"database": db.Ping,
+		"mail":     utility.CheckMailServer,
+	}
+	for name, check := range checks {
+		if err := check(ctx); err != nil {
+			utility.Logger(r.Context()).WarnContext(r.Context(), "readiness check failed", "check", name, "error", err)
+			response.Status = "unavailable"
+			response.Checks[name] = "unavailable"
+			continue
+		}
+		response.Checks[name] = "ok"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if response.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"rest-srv/utility"
+	"strings"
+)
+
+type logLevel struct {
+	Level string `json:"level"`
+}
+
+func GetLogLevelHandler(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(logLevel{Level: strings.ToLower(utility.LogLevel().String())})
+	w.Header().Set("Content-Type", "application/json")
+}
+
+// SetLogLevelHandler changes the level of every logger while the server runs
+func SetLogLevelHandler(w http.ResponseWriter, r *http.Request) {
+	var req logLevel
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := utility.SetLogLevel(req.Level); err != nil {
+		http.Error(w, "level must be one of debug, info, warn, error", http.StatusBadRequest)
+		return
+	}
+	utility.Logger(r.Context()).WarnContext(r.Context(), "log level changed", "level", utility.LogLevel().String())
+
+	json.NewEncoder(w).Encode(logLevel{Level: strings.ToLower(utility.LogLevel().String())})
+	w.Header().Set("Content-Type", "application/json")
+}
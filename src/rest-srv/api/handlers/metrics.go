@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"rest-srv/metrics"
+	"strings"
+)
+
+// MetricsHandler serves the Prometheus metrics to scrapers sending token as a bearer token.
+// Without a token the metrics are only served by the separate metrics listener.
+func MetricsHandler(token string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			http.NotFound(w, r)
+			return
+		}
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			metrics.AuthFailures.Inc("invalid_metrics_token")
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		metrics.Handler().ServeHTTP(w, r)
+	}
+}
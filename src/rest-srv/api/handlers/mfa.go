@@ -0,0 +1,528 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"rest-srv/db"
+	"rest-srv/metrics"
+	"rest-srv/models"
+	"rest-srv/revocation"
+	"rest-srv/utility"
+)
+
+// mfaRequiredRoles, mfaIssuer and mfaChallengeExpiresIn are set from the configuration at startup
+var (
+	mfaRequiredRoles      []string
+	mfaIssuer             string
+	mfaChallengeExpiresIn time.Duration
+)
+
+// SetMFASettings sets the roles that must log in with a TOTP code, the issuer shown by
+// authenticator apps and the time left to give the code after the password
+func SetMFASettings(requiredRoles []string, issuer string, challengeExpiresIn time.Duration) {
+	mfaRequiredRoles = requiredRoles
+	mfaIssuer = issuer
+	mfaChallengeExpiresIn = challengeExpiresIn
+}
+
+// maxMFAAttempts is how many codes, TOTP or recovery, may be tried within mfaAttemptWindow,
+// at login or to manage the second factor, before the exec must wait; at login the challenge
+// is revoked too. The count is kept per exec, so that new challenges, other addresses or other
+// routes do not bring more attempts.
+const (
+	maxMFAAttempts   = 5
+	mfaAttemptWindow = 15 * time.Minute
+)
+
+// recoveryCodeCount is how many recovery codes an exec gets, each usable once instead of a
+// TOTP code
+const recoveryCodeCount = 10
+
+// newRecoveryCodes returns random recovery codes such as "k3x9q-7mz2a", and their hashes to store
+func newRecoveryCodes() ([]string, []string) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		text := strings.ToLower(rand.Text()[:10])
+		codes[i] = text[:5] + "-" + text[5:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	return codes, hashes
+}
+
+// hashRecoveryCode hashes a recovery code whatever the case and dashes it was typed with
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	hash := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(hash[:])
+}
+
+// countMFAAttempt counts an attempt of a code of the exec before the code is verified, so that
+// concurrent requests cannot try more codes than allowed. It returns the attempts within the
+// window, and whether this one may still be tried.
+func countMFAAttempt(ctx context.Context, execID int) (int, bool, error) {
+	attempts, err := db.CountMFAAttempt(ctx, execID, mfaAttemptWindow)
+	if err != nil {
+		return 0, false, err
+	}
+	return attempts, attempts <= maxMFAAttempts, nil
+}
+
+func writeTooManyMFAAttempts(w http.ResponseWriter) {
+	metrics.AuthFailures.Inc("too_many_mfa_attempts")
+	http.Error(w, "too many invalid codes, try again later", http.StatusTooManyRequests)
+}
+
+func mfaRequired(exec models.Exec) bool {
+	return slices.Contains(mfaRequiredRoles, exec.Role)
+}
+
+// execMFA returns the second factor of an exec, the zero value when there is none
+func execMFA(ctx context.Context, execID int) (models.ExecMFA, error) {
+	mfa, err := db.GetExecMFA(ctx, execID)
+	if err != nil && err.Error() == "mfa not found" {
+		return models.ExecMFA{}, nil
+	}
+	return mfa, err
+}
+
+// verifySecondFactor reports whether code is a TOTP code, or else a recovery code, of an
+// exec whose second factor is enabled. Either is accepted once.
+func verifySecondFactor(ctx context.Context, mfa models.ExecMFA, code string) (bool, error) {
+	if step, ok := utility.VerifyTOTP(mfa.Secret, code, time.Now()); ok {
+		return db.UseTOTPStep(ctx, mfa.ExecID, step)
+	}
+	return db.UseRecoveryCode(ctx, mfa.ExecID, hashRecoveryCode(code))
+}
+
+// confirmMFA enables the pending second factor of an exec when code is a TOTP code of its
+// secret, and returns the recovery codes, shown this once
+func confirmMFA(ctx context.Context, mfa models.ExecMFA, code string) ([]string, bool, error) {
+	step, ok := utility.VerifyTOTP(mfa.Secret, code, time.Now())
+	if !ok {
+		return nil, false, nil
+	}
+	codes, hashes := newRecoveryCodes()
+	confirmed, err := db.ConfirmMFA(ctx, mfa.ExecID, step, hashes)
+	if err != nil || !confirmed {
+		return nil, false, err
+	}
+	return codes, true, nil
+}
+
+// startMFAEnrollment generates the TOTP secret of exec, to confirm with a code of the
+// authenticator app it is added to
+func startMFAEnrollment(w http.ResponseWriter, r *http.Request, exec models.Exec) {
+	secret := utility.NewTOTPSecret()
+	started, err := db.StartMFAEnrollment(r.Context(), exec.ID, secret)
+	if err != nil {
+		http.Error(w, "unable to enroll mfa", http.StatusInternalServerError)
+		return
+	}
+	if !started {
+		http.Error(w, "mfa is already enabled", http.StatusConflict)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Status     string `json:"status"`
+		Secret     string `json:"secret"`
+		OTPAuthURI string `json:"otpauth_uri"`
+	}{Status: "success", Secret: secret, OTPAuthURI: utility.TOTPURI(mfaIssuer, exec.Username, secret)})
+}
+
+// writeMFAChallenge answers a login with the right password by the token to exchange, along
+// with a TOTP code, for a session. An exec whose role requires a second factor and who has
+// none enrolls one first.
+func writeMFAChallenge(w http.ResponseWriter, exec models.Exec, enabled bool) {
+	token, err := utility.SignMFAChallenge(strconv.Itoa(exec.ID), mfaChallengeExpiresIn)
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	status := "mfa_required"
+	if !enabled {
+		status = "mfa_enrollment_required"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Status   string `json:"status"`
+		MFAToken string `json:"mfa_token"`
+	}{Status: status, MFAToken: token})
+}
+
+// challengedExec returns the exec of an MFA challenge token that is neither expired nor used
+func challengedExec(w http.ResponseWriter, r *http.Request, token string) (models.Exec, bool) {
+	claims, err := utility.VerifyMFAChallenge(token)
+	if err != nil {
+		metrics.AuthFailures.Inc("invalid_mfa_token")
+		http.Error(w, "invalid mfa token", http.StatusUnauthorized)
+		return models.Exec{}, false
+	}
+	execID, _ := claims["uid"].(string)
+	jti, _ := claims["jti"].(string)
+	issuedAt, err := claims.GetIssuedAt()
+	if execID == "" || jti == "" || err != nil || issuedAt == nil {
+		metrics.AuthFailures.Inc("invalid_mfa_token")
+		http.Error(w, "invalid mfa token", http.StatusUnauthorized)
+		return models.Exec{}, false
+	}
+	revoked, err := revocation.Revoked(r.Context(), jti, execID, issuedAt.Time)
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return models.Exec{}, false
+	}
+	if revoked {
+		metrics.AuthFailures.Inc("revoked_mfa_token")
+		http.Error(w, "invalid mfa token", http.StatusUnauthorized)
+		return models.Exec{}, false
+	}
+	id, err := strconv.Atoi(execID)
+	if err != nil {
+		http.Error(w, "invalid mfa token", http.StatusUnauthorized)
+		return models.Exec{}, false
+	}
+	exec, err := db.GetExecById(r.Context(), id)
+	if err != nil {
+		http.Error(w, "invalid mfa token", http.StatusUnauthorized)
+		return models.Exec{}, false
+	}
+	if exec.InactiveStatus {
+		metrics.AuthFailures.Inc("inactive_user")
+		http.Error(w, "user is inactive", http.StatusUnauthorized)
+		return models.Exec{}, false
+	}
+	return exec, true
+}
+
+// useMFAChallenge revokes an MFA challenge token once answered
+func useMFAChallenge(ctx context.Context, token string) error {
+	claims, err := utility.VerifyMFAChallenge(token)
+	if err != nil {
+		return err
+	}
+	jti, _ := claims["jti"].(string)
+	expiresAt, err := claims.GetExpirationTime()
+	if err != nil || expiresAt == nil {
+		return err
+	}
+	return revocation.RevokeToken(ctx, jti, expiresAt.Time)
+}
+
+// LoginMFAEnrollHandler starts the enrollment of an exec who logged in with the password
+// and whose role requires a second factor
+func LoginMFAEnrollHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		MFAToken string `json:"mfa_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+	exec, ok := challengedExec(w, r, req.MFAToken)
+	if !ok {
+		return
+	}
+	startMFAEnrollment(w, r, exec)
+}
+
+// LoginMFAHandler completes a login by exchanging the MFA challenge token and a TOTP code,
+// or a recovery code, for a session. The first code of an exec enrolling at login confirms
+// the enrollment, and the recovery codes are returned along with the session.
+func LoginMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		MFAToken string `json:"mfa_token"`
+		Code     string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+	if req.Code == "" {
+		http.Error(w, "code is required", http.StatusBadRequest)
+		return
+	}
+	exec, ok := challengedExec(w, r, req.MFAToken)
+	if !ok {
+		return
+	}
+	mfa, err := execMFA(r.Context(), exec.ID)
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if mfa.Secret == "" {
+		http.Error(w, "mfa enrollment is required", http.StatusConflict)
+		return
+	}
+	attempts, allowed, err := countMFAAttempt(r.Context(), exec.ID)
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		if err := useMFAChallenge(r.Context(), req.MFAToken); err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		writeTooManyMFAAttempts(w)
+		return
+	}
+
+	code := strings.TrimSpace(req.Code)
+	var recoveryCodes []string
+	switch {
+	case mfa.Enabled():
+		ok, err = verifySecondFactor(r.Context(), mfa, code)
+	default:
+		recoveryCodes, ok, err = confirmMFA(r.Context(), mfa, code)
+	}
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		metrics.AuthFailures.Inc("invalid_mfa_code")
+		// The last attempt allowed ends the challenge
+		if attempts == maxMFAAttempts {
+			if err := useMFAChallenge(r.Context(), req.MFAToken); err != nil {
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+				return
+			}
+		}
+		http.Error(w, "invalid code", http.StatusUnauthorized)
+		return
+	}
+	// The challenge is answered once
+	if err := useMFAChallenge(r.Context(), req.MFAToken); err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	if err := db.ResetMFAAttempts(r.Context(), exec.ID); err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	token, refreshToken, err := startSession(w, r, exec)
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Status        string   `json:"status"`
+		Token         string   `json:"token"`
+		RefreshToken  string   `json:"refresh_token"`
+		RecoveryCodes []string `json:"recovery_codes,omitempty"`
+	}{Status: "success", Token: token, RefreshToken: refreshToken, RecoveryCodes: recoveryCodes})
+}
+
+// EnrollMFAHandler starts the enrollment of the second factor of the exec logged in
+func EnrollMFAHandler(w http.ResponseWriter, r *http.Request) {
+	exec, ok := execFromPath(w, r)
+	if !ok {
+		return
+	}
+	startMFAEnrollment(w, r, exec)
+}
+
+// ConfirmMFAHandler enables the second factor being enrolled with a code of the
+// authenticator app, and returns the recovery codes, shown this once
+func ConfirmMFAHandler(w http.ResponseWriter, r *http.Request) {
+	mfa, code, ok := mfaRequestFromPath(w, r)
+	if !ok {
+		return
+	}
+	if mfa.Enabled() {
+		http.Error(w, "mfa is already enabled", http.StatusConflict)
+		return
+	}
+	if mfa.Secret == "" {
+		http.Error(w, "no mfa enrollment to confirm", http.StatusConflict)
+		return
+	}
+	_, allowed, err := countMFAAttempt(r.Context(), mfa.ExecID)
+	if err != nil {
+		http.Error(w, "unable to confirm mfa", http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		writeTooManyMFAAttempts(w)
+		return
+	}
+	recoveryCodes, ok, err := confirmMFA(r.Context(), mfa, code)
+	if err != nil {
+		http.Error(w, "unable to confirm mfa", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		metrics.AuthFailures.Inc("invalid_mfa_code")
+		http.Error(w, "invalid code", http.StatusBadRequest)
+		return
+	}
+	if err := db.ResetMFAAttempts(r.Context(), mfa.ExecID); err != nil {
+		http.Error(w, "unable to confirm mfa", http.StatusInternalServerError)
+		return
+	}
+	writeRecoveryCodes(w, recoveryCodes)
+}
+
+// RegenerateRecoveryCodesHandler replaces the recovery codes of the exec logged in, used or
+// not, given a code of the second factor
+func RegenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	mfa, code, ok := mfaRequestFromPath(w, r)
+	if !ok {
+		return
+	}
+	if !mfa.Enabled() {
+		http.Error(w, "mfa is not enabled", http.StatusConflict)
+		return
+	}
+	_, allowed, err := countMFAAttempt(r.Context(), mfa.ExecID)
+	if err != nil {
+		http.Error(w, "unable to regenerate recovery codes", http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		writeTooManyMFAAttempts(w)
+		return
+	}
+	valid, err := verifySecondFactor(r.Context(), mfa, code)
+	if err != nil {
+		http.Error(w, "unable to regenerate recovery codes", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		metrics.AuthFailures.Inc("invalid_mfa_code")
+		http.Error(w, "invalid code", http.StatusBadRequest)
+		return
+	}
+	if err := db.ResetMFAAttempts(r.Context(), mfa.ExecID); err != nil {
+		http.Error(w, "unable to regenerate recovery codes", http.StatusInternalServerError)
+		return
+	}
+	recoveryCodes, hashes := newRecoveryCodes()
+	if err := db.ReplaceRecoveryCodes(r.Context(), mfa.ExecID, hashes); err != nil {
+		http.Error(w, "unable to regenerate recovery codes", http.StatusInternalServerError)
+		return
+	}
+	writeRecoveryCodes(w, recoveryCodes)
+}
+
+// DisableMFAHandler removes the second factor of the exec logged in, given a code of it,
+// unless their role requires one
+func DisableMFAHandler(w http.ResponseWriter, r *http.Request) {
+	exec, ok := execFromPath(w, r)
+	if !ok {
+		return
+	}
+	if mfaRequired(exec) {
+		utility.WriteProblem(w, r, http.StatusForbidden, "mfa is required for the "+exec.Role+" role")
+		return
+	}
+	mfa, code, ok := mfaRequest(w, r, exec)
+	if !ok {
+		return
+	}
+	if !mfa.Enabled() {
+		http.Error(w, "mfa is not enabled", http.StatusConflict)
+		return
+	}
+	_, allowed, err := countMFAAttempt(r.Context(), mfa.ExecID)
+	if err != nil {
+		http.Error(w, "unable to disable mfa", http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		writeTooManyMFAAttempts(w)
+		return
+	}
+	valid, err := verifySecondFactor(r.Context(), mfa, code)
+	if err != nil {
+		http.Error(w, "unable to disable mfa", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		metrics.AuthFailures.Inc("invalid_mfa_code")
+		http.Error(w, "invalid code", http.StatusBadRequest)
+		return
+	}
+	if err := db.DeleteExecMFA(r.Context(), exec.ID); err != nil {
+		http.Error(w, "unable to disable mfa", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	}{Status: "success", Message: "MFA disabled"})
+}
+
+// ResetMFAHandler removes the second factor of an exec who lost it. When their role requires
+// one, they enroll again at their next login.
+func ResetMFAHandler(w http.ResponseWriter, r *http.Request) {
+	exec, ok := execFromPath(w, r)
+	if !ok {
+		return
+	}
+	if err := db.DeleteExecMFA(r.Context(), exec.ID); err != nil {
+		http.Error(w, "unable to reset mfa", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	}{Status: "success", Message: "MFA reset"})
+}
+
+// mfaRequestFromPath returns the second factor of the exec of the path, and the code of the body
+func mfaRequestFromPath(w http.ResponseWriter, r *http.Request) (models.ExecMFA, string, bool) {
+	exec, ok := execFromPath(w, r)
+	if !ok {
+		return models.ExecMFA{}, "", false
+	}
+	return mfaRequest(w, r, exec)
+}
+
+// mfaRequest returns the second factor of exec, and the code of the body
+func mfaRequest(w http.ResponseWriter, r *http.Request, exec models.Exec) (models.ExecMFA, string, bool) {
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return models.ExecMFA{}, "", false
+	}
+	defer r.Body.Close()
+	if req.Code == "" {
+		http.Error(w, "code is required", http.StatusBadRequest)
+		return models.ExecMFA{}, "", false
+	}
+	mfa, err := execMFA(r.Context(), exec.ID)
+	if err != nil {
+		http.Error(w, "unable to retrieve mfa", http.StatusInternalServerError)
+		return models.ExecMFA{}, "", false
+	}
+	return mfa, strings.TrimSpace(req.Code), true
+}
+
+func writeRecoveryCodes(w http.ResponseWriter, recoveryCodes []string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Status        string   `json:"status"`
+		RecoveryCodes []string `json:"recovery_codes"`
+	}{Status: "success", RecoveryCodes: recoveryCodes})
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"rest-srv/openapi"
+	"sync"
+)
+
+// OpenAPIHandler serves the OpenAPI document of the API. The document is encoded on the
+// first request, once every route has been registered.
+func OpenAPIHandler(doc *openapi.Document) http.HandlerFunc {
+	var once sync.Once
+	var body []byte
+	var err error
+	return func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() { body, err = json.Marshal(doc) })
+		if err != nil {
+			http.Error(w, "unable to encode the OpenAPI document", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}
+}
+
+// DocsHandler serves the interactive documentation page under /docs/
+func DocsHandler() http.HandlerFunc {
+	return http.StripPrefix("/docs/", http.FileServerFS(openapi.Docs)).ServeHTTP
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"rest-srv/utility"
+)
+
+// patchMediaType returns the patch format of a PATCH request body, or "" for the plain field map
+func patchMediaType(r *http.Request) string {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == utility.MergePatchContentType || mediaType == utility.JSONPatchContentType {
+		return mediaType
+	}
+	return ""
+}
+
+// applyPatch applies a merge patch or JSON patch to the JSON form of current and decodes the
+// resulting document into a new T, rejecting fields that T does not have
+func applyPatch[T any](current T, mediaType string, patch []byte) (T, error) {
+	var result T
+	doc, err := json.Marshal(current)
+	if err != nil {
+		return result, err
+	}
+
+	var patched []byte
+	if mediaType == utility.JSONPatchContentType {
+		patched, err = utility.ApplyJSONPatch(doc, patch)
+	} else {
+		patched, err = utility.ApplyMergePatch(doc, patch)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&result)
+	if err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return result, utility.ValidationErrors{{Field: typeErr.Field, Message: "must be of type " + typeErr.Type.String()}}
+		}
+		if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+			return result, utility.ValidationErrors{{Field: strings.Trim(field, `"`), Message: "unknown field"}}
+		}
+		return result, utility.ValidationErrors{{Field: "", Message: err.Error()}}
+	}
+	return result, nil
+}
+
+// bulkPatch is one element of a bulk PATCH body. For merge patches the element itself is the
+// patch and carries the id; for JSON patches the operations are under "patch".
+type bulkPatch struct {
+	ID    int
+	Patch json.RawMessage
+}
+
+func decodeBulkPatches(body io.Reader, mediaType string) ([]bulkPatch, error) {
+	var elements []json.RawMessage
+	if err := json.NewDecoder(body).Decode(&elements); err != nil {
+		return nil, err
+	}
+	patches := make([]bulkPatch, len(elements))
+	for i, element := range elements {
+		var item struct {
+			ID    int             `json:"id"`
+			Patch json.RawMessage `json:"patch"`
+		}
+		if err := json.Unmarshal(element, &item); err != nil {
+			return nil, err
+		}
+		if item.ID == 0 {
+			return nil, errors.New("id is required")
+		}
+		patches[i].ID = item.ID
+		if mediaType == utility.JSONPatchContentType {
+			patches[i].Patch = item.Patch
+		} else {
+			patches[i].Patch = element
+		}
+	}
+	return patches, nil
+}
+
+// isPatchError reports whether err comes from applying a patch document rather than from
+// the database
+func isPatchError(err error) bool {
+	return errors.Is(err, utility.ErrInvalidPatch) || errors.Is(err, utility.ErrPatchConflict) || isValidationError(err)
+}
+
+// writePatchError maps errors from applying a patch document to a response
+func writePatchError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, utility.ErrPatchConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, utility.ErrInvalidPatch):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		writeValidationError(w, err)
+	}
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"rest-srv/db"
+	"rest-srv/metrics"
+	"rest-srv/models"
+	"rest-srv/revocation"
+	"rest-srv/utility"
+)
+
+// refreshTokenExpiresIn is set from the configuration at startup
+var refreshTokenExpiresIn time.Duration
+
+// SetRefreshTokenSettings sets the lifetime of the refresh tokens
+func SetRefreshTokenSettings(expiresIn time.Duration) {
+	refreshTokenExpiresIn = expiresIn
+}
+
+// refreshCookie is the cookie holding the refresh token, next to the Bearer cookie of the
+// access token
+const refreshCookie = "Refresh"
+
+// newRefreshToken returns a random refresh token of the family, and its record to store.
+// An empty family starts a new one.
+func newRefreshToken(execID int, familyID string) (string, models.RefreshToken) {
+	if familyID == "" {
+		familyID = rand.Text()
+	}
+	token := rand.Text() + rand.Text()
+	return token, models.RefreshToken{
+		TokenHash: hashRefreshToken(token),
+		FamilyID:  familyID,
+		ExecID:    execID,
+		ExpiresAt: time.Now().Add(refreshTokenExpiresIn),
+	}
+}
+
+func hashRefreshToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// setSessionCookies sets the access token cookie, and the refresh token cookie when
+// refreshToken is not empty
+func setSessionCookies(w http.ResponseWriter, accessToken string, refreshToken string) {
+	http.SetCookie(w, &http.Cookie{Name: "Bearer", Value: accessToken, Path: "/", HttpOnly: true, Secure: true, Expires: time.Now().Add(utility.TokenExpiresIn()), SameSite: http.SameSiteStrictMode})
+	if refreshToken != "" {
+		http.SetCookie(w, &http.Cookie{Name: refreshCookie, Value: refreshToken, Path: "/", HttpOnly: true, Secure: true, Expires: time.Now().Add(refreshTokenExpiresIn), SameSite: http.SameSiteStrictMode})
+	}
+}
+
+func clearSessionCookies(w http.ResponseWriter) {
+	for _, name := range []string{"Bearer", refreshCookie} {
+		http.SetCookie(w, &http.Cookie{Name: name, Value: "", Path: "/", HttpOnly: true, Secure: true, Expires: time.Now().Add(-1 * time.Hour), SameSite: http.SameSiteStrictMode})
+	}
+}
+
+// startSession signs an access token for exec and stores the refresh token of a new family
+func startSession(w http.ResponseWriter, r *http.Request, exec models.Exec) (string, string, error) {
+	if _, err := db.DeleteExpiredRefreshTokens(r.Context(), exec.ID); err != nil {
+		utility.Logger(r.Context()).Warn("unable to delete expired refresh tokens", "exec_id", exec.ID, "error", err)
+	}
+	accessToken, err := utility.SignToken(strconv.Itoa(exec.ID), exec.Username, exec.Role)
+	if err != nil {
+		return "", "", err
+	}
+	refreshToken, record := newRefreshToken(exec.ID, "")
+	if err := db.AddRefreshToken(r.Context(), record); err != nil {
+		return "", "", err
+	}
+	setSessionCookies(w, accessToken, refreshToken)
+	return accessToken, refreshToken, nil
+}
+
+// presentedRefreshToken returns the refresh token of the refresh_token field of the body,
+// or else of the cookie. The body is optional.
+func presentedRefreshToken(r *http.Request) (string, error) {
+	var req struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	if req.RefreshToken != "" {
+		return req.RefreshToken, nil
+	}
+	if cookie, err := r.Cookie(refreshCookie); err == nil {
+		return cookie.Value, nil
+	}
+	return "", nil
+}
+
+// revokeAccessToken revokes the access token of the Bearer cookie until it expires. A
+// missing or invalid token has nothing to revoke.
+func revokeAccessToken(r *http.Request) error {
+	cookie, err := r.Cookie("Bearer")
+	if err != nil {
+		return nil
+	}
+	claims, err := utility.VerifyToken(cookie.Value)
+	if err != nil {
+		return nil
+	}
+	id, _ := claims["jti"].(string)
+	expiresAt, err := claims.GetExpirationTime()
+	if id == "" || err != nil || expiresAt == nil {
+		return nil
+	}
+	return revocation.RevokeToken(r.Context(), id, expiresAt.Time)
+}
+
+// revokeRefreshTokenFamily revokes the family of a refresh token that must not be used any
+// more, logging why: its session ends for whoever holds one of its tokens
+func revokeRefreshTokenFamily(r *http.Request, token models.RefreshToken, reason string) {
+	utility.Logger(r.Context()).Warn("revoking refresh token family", "reason", reason, "exec_id", token.ExecID, "family_id", token.FamilyID)
+	metrics.AuthFailures.Inc(reason)
+	if err := db.RevokeRefreshTokenFamily(r.Context(), token.FamilyID); err != nil {
+		utility.Logger(r.Context()).Error("unable to revoke refresh token family", "family_id", token.FamilyID, "error", err)
+	}
+}
+
+// RefreshTokenHandler exchanges a refresh token for a new access token and the next refresh
+// token of its family. A refresh token is used once: when a used token comes back, either it
+// or the token it was rotated to is in the wrong hands, so the whole family is revoked.
+func RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	presented, err := presentedRefreshToken(r)
+	if err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+	if presented == "" {
+		metrics.AuthFailures.Inc("missing_refresh_token")
+		http.Error(w, "refresh token is required", http.StatusUnauthorized)
+		return
+	}
+
+	stored, err := db.GetRefreshTokenByHash(r.Context(), hashRefreshToken(presented))
+	if err != nil {
+		metrics.AuthFailures.Inc("invalid_refresh_token")
+		http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case stored.RevokedAt != nil, time.Now().After(stored.ExpiresAt):
+		metrics.AuthFailures.Inc("invalid_refresh_token")
+		http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+		return
+	case stored.UsedAt != nil:
+		revokeRefreshTokenFamily(r, stored, "refresh_token_reuse")
+		http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	// The role is read again, so a changed role applies from the next refresh
+	exec, err := db.GetExecById(r.Context(), stored.ExecID)
+	if err != nil {
+		http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	if exec.InactiveStatus {
+		revokeRefreshTokenFamily(r, stored, "inactive_user")
+		http.Error(w, "user is inactive", http.StatusUnauthorized)
+		return
+	}
+
+	refreshToken, next := newRefreshToken(exec.ID, stored.FamilyID)
+	rotated, err := db.RotateRefreshToken(r.Context(), stored, next)
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !rotated {
+		// Another request used the token since it was read
+		revokeRefreshTokenFamily(r, stored, "refresh_token_reuse")
+		http.Error(w, "invalid refresh token", http.StatusUnauthorized)
+		return
+	}
+	accessToken, err := utility.SignToken(strconv.Itoa(exec.ID), exec.Username, exec.Role)
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	setSessionCookies(w, accessToken, refreshToken)
+	json.NewEncoder(w).Encode(struct {
+		Status       string `json:"status"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}{Status: "success", Token: accessToken, RefreshToken: refreshToken})
+}
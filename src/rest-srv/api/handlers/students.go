@@ -2,10 +2,13 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"rest-srv/db"
 	"rest-srv/models"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -19,8 +22,23 @@ func GetStudentHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid id", http.StatusBadRequest)
 		return
 	}
-	student, err := db.GetStudentById(id)
+	fields := requestedFields(r)
+	includes, err := requestedIncludes(r, "teacher")
 	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	queryFields := fields
+	if len(includes) > 0 {
+		queryFields = withField(fields, "class")
+	}
+
+	student, err := db.GetStudentByIdFields(r.Context(), id, queryFields)
+	if err != nil {
+		if isFieldsError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		if err.Error() == "student not found" {
 			http.Error(w, "student not found", http.StatusNotFound)
 			return
@@ -28,11 +46,46 @@ func GetStudentHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "unable to retrieve student", http.StatusInternalServerError)
 		return
 	}
+	if len(fields) == 0 && len(includes) == 0 {
+		json.NewEncoder(w).Encode(student)
+		w.Header().Set("Content-Type", "application/json")
+		return
+	}
 
-	json.NewEncoder(w).Encode(student)
+	shaped, err := shapeStudents(r, []models.Student{student}, fields, includes)
+	if err != nil {
+		http.Error(w, "unable to retrieve student", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(shaped[0])
 	w.Header().Set("Content-Type", "application/json")
 }
 
+// shapeStudents applies a sparse fieldset to students and attaches each student's
+// teacher when requested, loading all teachers in one query
+func shapeStudents(r *http.Request, students []models.Student, fields []string, includes []string) ([]map[string]any, error) {
+	if !slices.Contains(includes, "teacher") {
+		return shapeItems(students, fields, nil)
+	}
+	classes := make([]string, 0, len(students))
+	for _, student := range students {
+		if !slices.Contains(classes, student.Class) {
+			classes = append(classes, student.Class)
+		}
+	}
+	teachersByClass, err := db.GetTeachersByClasses(r.Context(), classes)
+	if err != nil {
+		return nil, err
+	}
+	return shapeItems(students, fields, func(student models.Student, object map[string]any) {
+		if teacher, ok := teachersByClass[student.Class]; ok {
+			object["teacher"] = teacher
+		} else {
+			object["teacher"] = nil
+		}
+	})
+}
+
 func GetStudentsHandler(w http.ResponseWriter, r *http.Request) {
 	limit, page := utility.GetPaginationParams(r)
 	sortByParams := r.URL.Query()["sortBy"]
@@ -52,19 +105,43 @@ func GetStudentsHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	studentsList, totalCount, err := db.GetStudents(filters, sortByParams, limit, page)
+	fields := requestedFields(r)
+	includes, err := requestedIncludes(r, "teacher")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	queryFields := fields
+	if len(includes) > 0 {
+		queryFields = withField(fields, "class")
+	}
+
+	studentsList, totalCount, err := db.GetStudents(r.Context(), filters, sortByParams, limit, page, queryFields)
 	if err != nil {
+		if isFieldsError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, "unable to retrieve students", http.StatusInternalServerError)
 		return
 	}
 
+	var data any = studentsList
+	if len(fields) > 0 || len(includes) > 0 {
+		data, err = shapeStudents(r, studentsList, fields, includes)
+		if err != nil {
+			http.Error(w, "unable to retrieve students", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	response := struct {
-		Status string           `json:"status"`
-		Count  int              `json:"count"`
-		Data   []models.Student `json:"data"`
-		Page   int              `json:"page"`
-		Limit  int              `json:"limit"`
-	}{Status: "success", Count: totalCount, Data: studentsList, Page: page, Limit: limit}
+		Status string `json:"status"`
+		Count  int    `json:"count"`
+		Data   any    `json:"data"`
+		Page   int    `json:"page"`
+		Limit  int    `json:"limit"`
+	}{Status: "success", Count: totalCount, Data: data, Page: page, Limit: limit}
 	json.NewEncoder(w).Encode(response)
 	w.Header().Set("Content-Type", "application/json")
 }
@@ -77,17 +154,14 @@ func AddStudentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	for _, student := range newStudents {
-		err = student.Validate()
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
+	err = validateEach(len(newStudents), func(i int) error { return newStudents[i].Validate() })
+	if err != nil {
+		writeValidationError(w, err)
+		return
 	}
 
-	addedStudents, err := db.AddStudents(newStudents)
+	addedStudents, err := db.AddStudents(r.Context(), newStudents)
 	if err != nil {
-		fmt.Println(err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -117,10 +191,10 @@ func UpdateStudentHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	err = updatedStudent.Validate()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeValidationError(w, err)
 		return
 	}
-	updatedStudent, err = db.UpdateStudent(id, updatedStudent)
+	updatedStudent, err = db.UpdateStudent(r.Context(), id, updatedStudent)
 	if err != nil {
 		if err.Error() == "student not found" {
 			http.Error(w, "student not found", http.StatusNotFound)
@@ -146,19 +220,33 @@ func PatchStudentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if mediaType := patchMediaType(r); mediaType != "" {
+		patchStudentDocument(w, r, id, mediaType)
+		return
+	}
+
 	var updatedFields map[string]any
 	err = json.NewDecoder(r.Body).Decode(&updatedFields)
 	if err != nil {
 		http.Error(w, "invalid request body", http.StatusBadRequest)
 		return
 	}
+	err = utility.ValidatePartial(models.Student{}, updatedFields)
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
 
-	updatedStudent, err := db.PatchStudent(id, updatedFields)
+	updatedStudent, err := db.PatchStudent(r.Context(), id, updatedFields)
 	if err != nil {
 		if err.Error() == "student not found" {
 			http.Error(w, "student not found", http.StatusNotFound)
 			return
 		}
+		if isValidationError(err) {
+			writeValidationError(w, err)
+			return
+		}
 		http.Error(w, "unable to update student", http.StatusInternalServerError)
 		return
 	}
@@ -168,19 +256,33 @@ func PatchStudentHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func PatchStudentsHandler(w http.ResponseWriter, r *http.Request) {
+	if mediaType := patchMediaType(r); mediaType != "" {
+		patchStudentsDocuments(w, r, mediaType)
+		return
+	}
+
 	var updates []map[string]any
 	err := json.NewDecoder(r.Body).Decode(&updates)
 	if err != nil {
 		http.Error(w, "invalid request body", http.StatusBadRequest)
 		return
 	}
+	err = validateEach(len(updates), func(i int) error { return utility.ValidatePartial(models.Student{}, updates[i]) })
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
 
-	updatedStudents, err := db.PatchStudents(updates)
+	updatedStudents, err := db.PatchStudents(r.Context(), updates)
 	if err != nil {
 		if err.Error() == "student not found" || strings.Contains(err.Error(), "student not found") {
 			http.Error(w, "student not found", http.StatusNotFound)
 			return
 		}
+		if isValidationError(err) {
+			writeValidationError(w, err)
+			return
+		}
 		http.Error(w, "unable to update students", http.StatusInternalServerError)
 		return
 	}
@@ -201,7 +303,7 @@ func DeleteStudentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	deletedStudent, err := db.DeleteStudent(id)
+	deletedStudent, err := db.DeleteStudent(r.Context(), id)
 	if err != nil {
 		if err.Error() == "student not found" {
 			http.Error(w, "student not found", http.StatusNotFound)
@@ -229,7 +331,7 @@ func DeleteStudentsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	deletedStudents, err := db.DeleteStudents(ids)
+	deletedStudents, err := db.DeleteStudents(r.Context(), ids)
 	if err != nil {
 		if strings.Contains(err.Error(), "student not found") {
 			http.Error(w, "student not found", http.StatusNotFound)
@@ -251,3 +353,90 @@ func DeleteStudentsHandler(w http.ResponseWriter, r *http.Request) {
 	}{Status: "success", Message: "Students deleted successfully", DeletedIDs: deletedIDs})
 	w.Header().Set("Content-Type", "application/json")
 }
+
+// applyStudentPatch applies a merge patch or JSON patch to student and validates the result
+func applyStudentPatch(student models.Student, mediaType string, patch []byte) (models.Student, error) {
+	patched, err := applyPatch(student, mediaType, patch)
+	if err != nil {
+		return models.Student{}, err
+	}
+	if patched.ID != 0 && patched.ID != student.ID {
+		return models.Student{}, utility.ValidationErrors{{Field: "id", Message: "cannot be changed"}}
+	}
+	patched.ID = student.ID
+	err = patched.Validate()
+	if err != nil {
+		return models.Student{}, err
+	}
+	return patched, nil
+}
+
+// patchStudentDocument handles application/merge-patch+json and application/json-patch+json bodies for PATCH /students/{id}
+func patchStudentDocument(w http.ResponseWriter, r *http.Request, id int, mediaType string) {
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	updatedStudents, err := db.PatchStudentDocuments(r.Context(), []int{id}, func(students []models.Student) ([]models.Student, error) {
+		patched, err := applyStudentPatch(students[0], mediaType, patch)
+		return []models.Student{patched}, err
+	})
+	if err != nil {
+		if err.Error() == "student not found" {
+			http.Error(w, "student not found", http.StatusNotFound)
+			return
+		}
+		if isPatchError(err) {
+			writePatchError(w, err)
+			return
+		}
+		http.Error(w, "unable to update student", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(updatedStudents[0])
+	w.Header().Set("Content-Type", "application/json")
+}
+
+// patchStudentsDocuments handles bulk merge patch and JSON patch bodies for PATCH /students
+func patchStudentsDocuments(w http.ResponseWriter, r *http.Request, mediaType string) {
+	patches, err := decodeBulkPatches(r.Body, mediaType)
+	if err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	ids := make([]int, len(patches))
+	for i := range patches {
+		ids[i] = patches[i].ID
+	}
+	updatedStudents, err := db.PatchStudentDocuments(r.Context(), ids, func(students []models.Student) ([]models.Student, error) {
+		patched := make([]models.Student, len(students))
+		err := validateEach(len(students), func(i int) error {
+			var err error
+			patched[i], err = applyStudentPatch(students[i], mediaType, patches[i].Patch)
+			if errors.Is(err, utility.ErrInvalidPatch) || errors.Is(err, utility.ErrPatchConflict) {
+				return fmt.Errorf("[%d] %w", i, err)
+			}
+			return err
+		})
+		return patched, err
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "student not found") {
+			http.Error(w, "student not found", http.StatusNotFound)
+			return
+		}
+		if isPatchError(err) {
+			writePatchError(w, err)
+			return
+		}
+		http.Error(w, "unable to update students", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(updatedStudents)
+	w.Header().Set("Content-Type", "application/json")
+}
@@ -2,10 +2,14 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"rest-srv/db"
 	"rest-srv/models"
 	"rest-srv/utility"
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -17,8 +21,19 @@ func GetTeacherHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid id", http.StatusBadRequest)
 		return
 	}
-	teacher, err := db.GetTeacherById(id)
+	fields := requestedFields(r)
+	includes, err := requestedIncludes(r, "students")
 	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	teacher, err := db.GetTeacherByIdFields(r.Context(), id, fields)
+	if err != nil {
+		if isFieldsError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		if err.Error() == "teacher not found" {
 			http.Error(w, "teacher not found", http.StatusNotFound)
 			return
@@ -26,10 +41,44 @@ func GetTeacherHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "unable to retrieve teacher", http.StatusInternalServerError)
 		return
 	}
+	if len(fields) == 0 && len(includes) == 0 {
+		json.NewEncoder(w).Encode(teacher)
+		w.Header().Set("Content-Type", "application/json")
+		return
+	}
 
-	json.NewEncoder(w).Encode(teacher)
+	shaped, err := shapeTeachers(r, []models.Teacher{teacher}, fields, includes)
+	if err != nil {
+		http.Error(w, "unable to retrieve teacher", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(shaped[0])
 	w.Header().Set("Content-Type", "application/json")
+}
 
+// shapeTeachers applies a sparse fieldset to teachers and attaches the students of each
+// teacher's class when requested, loading all of them in one query
+func shapeTeachers(r *http.Request, teachers []models.Teacher, fields []string, includes []string) ([]map[string]any, error) {
+	if !slices.Contains(includes, "students") {
+		return shapeItems(teachers, fields, nil)
+	}
+	classes := make([]string, 0, len(teachers))
+	for _, teacher := range teachers {
+		if !slices.Contains(classes, teacher.Class) {
+			classes = append(classes, teacher.Class)
+		}
+	}
+	studentsByClass, err := db.GetStudentsByClasses(r.Context(), classes)
+	if err != nil {
+		return nil, err
+	}
+	return shapeItems(teachers, fields, func(teacher models.Teacher, object map[string]any) {
+		students := studentsByClass[teacher.Class]
+		if students == nil {
+			students = []models.Student{}
+		}
+		object["students"] = students
+	})
 }
 
 func GetTeachersHandler(w http.ResponseWriter, r *http.Request) {
@@ -50,17 +99,37 @@ func GetTeachersHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	teachersList, err := db.GetTeachers(filters, sortByParams)
+	fields := requestedFields(r)
+	includes, err := requestedIncludes(r, "students")
 	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	teachersList, err := db.GetTeachers(r.Context(), filters, sortByParams, fields)
+	if err != nil {
+		if isFieldsError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, "unable to retrieve teachers", http.StatusInternalServerError)
 		return
 	}
 
+	var data any = teachersList
+	if len(fields) > 0 || len(includes) > 0 {
+		data, err = shapeTeachers(r, teachersList, fields, includes)
+		if err != nil {
+			http.Error(w, "unable to retrieve teachers", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	response := struct {
-		Status string           `json:"status"`
-		Count  int              `json:"count"`
-		Data   []models.Teacher `json:"data"`
-	}{Status: "success", Count: len(teachersList), Data: teachersList}
+		Status string `json:"status"`
+		Count  int    `json:"count"`
+		Data   any    `json:"data"`
+	}{Status: "success", Count: len(teachersList), Data: data}
 	json.NewEncoder(w).Encode(response)
 	w.Header().Set("Content-Type", "application/json")
 }
@@ -73,15 +142,13 @@ func AddTeacherHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	for _, teacher := range newTeachers {
-		err = teacher.Validate()
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
+	err = validateEach(len(newTeachers), func(i int) error { return newTeachers[i].Validate() })
+	if err != nil {
+		writeValidationError(w, err)
+		return
 	}
 
-	addedTeachers, err := db.AddTeachers(newTeachers)
+	addedTeachers, err := db.AddTeachers(r.Context(), newTeachers)
 	if err != nil {
 		http.Error(w, "unable to add teachers", http.StatusInternalServerError)
 		return
@@ -112,10 +179,10 @@ func UpdateTeacherHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	err = updatedTeacher.Validate()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeValidationError(w, err)
 		return
 	}
-	updatedTeacher, err = db.UpdateTeacher(id, updatedTeacher)
+	updatedTeacher, err = db.UpdateTeacher(r.Context(), id, updatedTeacher)
 	if err != nil {
 		if err.Error() == "teacher not found" {
 			http.Error(w, "teacher not found", http.StatusNotFound)
@@ -141,19 +208,33 @@ func PatchTeacherHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if mediaType := patchMediaType(r); mediaType != "" {
+		patchTeacherDocument(w, r, id, mediaType)
+		return
+	}
+
 	var updatedFields map[string]any
 	err = json.NewDecoder(r.Body).Decode(&updatedFields)
 	if err != nil {
 		http.Error(w, "invalid request body", http.StatusBadRequest)
 		return
 	}
+	err = utility.ValidatePartial(models.Teacher{}, updatedFields)
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
 
-	updatedTeacher, err := db.PatchTeacher(id, updatedFields)
+	updatedTeacher, err := db.PatchTeacher(r.Context(), id, updatedFields)
 	if err != nil {
 		if err.Error() == "teacher not found" {
 			http.Error(w, "teacher not found", http.StatusNotFound)
 			return
 		}
+		if isValidationError(err) {
+			writeValidationError(w, err)
+			return
+		}
 		http.Error(w, "unable to update teacher", http.StatusInternalServerError)
 		return
 	}
@@ -163,19 +244,33 @@ func PatchTeacherHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func PatchTeachersHandler(w http.ResponseWriter, r *http.Request) {
+	if mediaType := patchMediaType(r); mediaType != "" {
+		patchTeachersDocuments(w, r, mediaType)
+		return
+	}
+
 	var updates []map[string]any
 	err := json.NewDecoder(r.Body).Decode(&updates)
 	if err != nil {
 		http.Error(w, "invalid request body", http.StatusBadRequest)
 		return
 	}
+	err = validateEach(len(updates), func(i int) error { return utility.ValidatePartial(models.Teacher{}, updates[i]) })
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
 
-	updatedTeachers, err := db.PatchTeachers(updates)
+	updatedTeachers, err := db.PatchTeachers(r.Context(), updates)
 	if err != nil {
 		if err.Error() == "teacher not found" || strings.Contains(err.Error(), "teacher not found") {
 			http.Error(w, "teacher not found", http.StatusNotFound)
 			return
 		}
+		if isValidationError(err) {
+			writeValidationError(w, err)
+			return
+		}
 		http.Error(w, "unable to update teachers", http.StatusInternalServerError)
 		return
 	}
@@ -196,7 +291,7 @@ func DeleteTeacherHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	deletedTeacher, err := db.DeleteTeacher(id)
+	deletedTeacher, err := db.DeleteTeacher(r.Context(), id)
 	if err != nil {
 		if err.Error() == "teacher not found" {
 			http.Error(w, "teacher not found", http.StatusNotFound)
@@ -224,7 +319,7 @@ func DeleteTeachersHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	deletedTeachers, err := db.DeleteTeachers(ids)
+	deletedTeachers, err := db.DeleteTeachers(r.Context(), ids)
 	if err != nil {
 		if strings.Contains(err.Error(), "teacher not found") {
 			http.Error(w, "teacher not found", http.StatusNotFound)
@@ -254,38 +349,40 @@ func GetTeacherStudentsHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid id", http.StatusBadRequest)
 		return
 	}
-	students, err := db.GetTeacherStudents(id)
+	fields := requestedFields(r)
+	students, err := db.GetTeacherStudents(r.Context(), id, fields)
 	if err != nil {
+		if isFieldsError(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, "unable to retrieve students", http.StatusInternalServerError)
 		return
 	}
+	var data any = students
+	if len(fields) > 0 {
+		data, err = shapeItems(students, fields, nil)
+		if err != nil {
+			http.Error(w, "unable to retrieve students", http.StatusInternalServerError)
+			return
+		}
+	}
 	json.NewEncoder(w).Encode(struct {
-		Status string           `json:"status"`
-		Count  int              `json:"count"`
-		Data   []models.Student `json:"data"`
-	}{Status: "success", Count: len(students), Data: students})
+		Status string `json:"status"`
+		Count  int    `json:"count"`
+		Data   any    `json:"data"`
+	}{Status: "success", Count: len(students), Data: data})
 	w.Header().Set("Content-Type", "application/json")
 }
 
 func GetTeacherStudentsCountHandler(w http.ResponseWriter, r *http.Request) {
-	allowedRoles := []string{"admin", "exec", "manager"}
-	authorized, err := utility.AuthorizeUser(r.Context().Value(utility.ContextKey("role")).(string), allowedRoles...)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
-		return
-	}
-	if !authorized {
-		http.Error(w, "unauthorized", http.StatusUnauthorized)
-		return
-	}
-
 	idStr := r.PathValue("id")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
 		http.Error(w, "invalid id", http.StatusBadRequest)
 		return
 	}
-	count, err := db.GetTeacherStudentsCount(id)
+	count, err := db.GetTeacherStudentsCount(r.Context(), id)
 	if err != nil {
 		http.Error(w, "unable to retrieve students count", http.StatusInternalServerError)
 		return
@@ -296,3 +393,90 @@ func GetTeacherStudentsCountHandler(w http.ResponseWriter, r *http.Request) {
 	}{Status: "success", Count: count})
 	w.Header().Set("Content-Type", "application/json")
 }
+
+// applyTeacherPatch applies a merge patch or JSON patch to teacher and validates the result
+func applyTeacherPatch(teacher models.Teacher, mediaType string, patch []byte) (models.Teacher, error) {
+	patched, err := applyPatch(teacher, mediaType, patch)
+	if err != nil {
+		return models.Teacher{}, err
+	}
+	if patched.ID != 0 && patched.ID != teacher.ID {
+		return models.Teacher{}, utility.ValidationErrors{{Field: "id", Message: "cannot be changed"}}
+	}
+	patched.ID = teacher.ID
+	err = patched.Validate()
+	if err != nil {
+		return models.Teacher{}, err
+	}
+	return patched, nil
+}
+
+// patchTeacherDocument handles application/merge-patch+json and application/json-patch+json bodies for PATCH /teachers/{id}
+func patchTeacherDocument(w http.ResponseWriter, r *http.Request, id int, mediaType string) {
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	updatedTeachers, err := db.PatchTeacherDocuments(r.Context(), []int{id}, func(teachers []models.Teacher) ([]models.Teacher, error) {
+		patched, err := applyTeacherPatch(teachers[0], mediaType, patch)
+		return []models.Teacher{patched}, err
+	})
+	if err != nil {
+		if err.Error() == "teacher not found" {
+			http.Error(w, "teacher not found", http.StatusNotFound)
+			return
+		}
+		if isPatchError(err) {
+			writePatchError(w, err)
+			return
+		}
+		http.Error(w, "unable to update teacher", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(updatedTeachers[0])
+	w.Header().Set("Content-Type", "application/json")
+}
+
+// patchTeachersDocuments handles bulk merge patch and JSON patch bodies for PATCH /teachers
+func patchTeachersDocuments(w http.ResponseWriter, r *http.Request, mediaType string) {
+	patches, err := decodeBulkPatches(r.Body, mediaType)
+	if err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	ids := make([]int, len(patches))
+	for i := range patches {
+		ids[i] = patches[i].ID
+	}
+	updatedTeachers, err := db.PatchTeacherDocuments(r.Context(), ids, func(teachers []models.Teacher) ([]models.Teacher, error) {
+		patched := make([]models.Teacher, len(teachers))
+		err := validateEach(len(teachers), func(i int) error {
+			var err error
+			patched[i], err = applyTeacherPatch(teachers[i], mediaType, patches[i].Patch)
+			if errors.Is(err, utility.ErrInvalidPatch) || errors.Is(err, utility.ErrPatchConflict) {
+				return fmt.Errorf("[%d] %w", i, err)
+			}
+			return err
+		})
+		return patched, err
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "teacher not found") {
+			http.Error(w, "teacher not found", http.StatusNotFound)
+			return
+		}
+		if isPatchError(err) {
+			writePatchError(w, err)
+			return
+		}
+		http.Error(w, "unable to update teachers", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(updatedTeachers)
+	w.Header().Set("Content-Type", "application/json")
+}
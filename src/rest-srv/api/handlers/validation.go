@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"rest-srv/utility"
+)
+
+// writeValidationError responds with 400 and, for validation failures, the full list of violations
+func writeValidationError(w http.ResponseWriter, err error) {
+	var validationErrors utility.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(struct {
+		Status string                   `json:"status"`
+		Errors utility.ValidationErrors `json:"errors"`
+	}{Status: "error", Errors: validationErrors})
+}
+
+// isValidationError reports whether err lists violations, for writeValidationError to answer
+func isValidationError(err error) bool {
+	var validationErrors utility.ValidationErrors
+	return errors.As(err, &validationErrors)
+}
+
+// validateEach validates every item of a list and returns the violations with their index in the path
+func validateEach(n int, validate func(i int) error) error {
+	var all utility.ValidationErrors
+	for i := 0; i < n; i++ {
+		err := validate(i)
+		if err == nil {
+			continue
+		}
+		var validationErrors utility.ValidationErrors
+		if !errors.As(err, &validationErrors) {
+			return err
+		}
+		all = append(all, validationErrors.AtIndex(i)...)
+	}
+	if len(all) > 0 {
+		return all
+	}
+	return nil
+}
@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"rest-srv/db"
+	"rest-srv/models"
+	"rest-srv/utility"
+	"strconv"
+)
+
+// webhookIdFromPath parses the {id} path value of the /webhooks routes
+func webhookIdFromPath(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id == 0 {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+func deliveryIdFromPath(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("deliveryId"), 10, 64)
+	if err != nil || id == 0 {
+		http.Error(w, "invalid delivery id", http.StatusBadRequest)
+		return 0, false
+	}
+	return id, true
+}
+
+func newWebhookSecret() string {
+	secretBytes := make([]byte, 32)
+	rand.Read(secretBytes)
+	return "whsec_" + hex.EncodeToString(secretBytes)
+}
+
+func GetWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	subscriptions, err := db.GetWebhookSubscriptions(r.Context(), false)
+	if err != nil {
+		http.Error(w, "unable to retrieve webhooks", http.StatusInternalServerError)
+		return
+	}
+	// The secret is only shown when the subscription is created
+	for i := range subscriptions {
+		subscriptions[i].Secret = ""
+	}
+
+	response := struct {
+		Status string                       `json:"status"`
+		Count  int                          `json:"count"`
+		Data   []models.WebhookSubscription `json:"data"`
+	}{Status: "success", Count: len(subscriptions), Data: subscriptions}
+	json.NewEncoder(w).Encode(response)
+	w.Header().Set("Content-Type", "application/json")
+}
+
+func GetWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookIdFromPath(w, r)
+	if !ok {
+		return
+	}
+	subscription, err := db.GetWebhookSubscriptionById(r.Context(), id)
+	if err != nil {
+		if err.Error() == "webhook not found" {
+			http.Error(w, "webhook not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "unable to retrieve webhook", http.StatusInternalServerError)
+		return
+	}
+	subscription.Secret = ""
+	json.NewEncoder(w).Encode(subscription)
+	w.Header().Set("Content-Type", "application/json")
+}
+
+// AddWebhookHandler registers a subscription. The signing secret is generated unless one is
+// given and is returned in this response only.
+func AddWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	subscription := models.WebhookSubscription{Active: true}
+	err := json.NewDecoder(r.Body).Decode(&subscription)
+	if err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+	if subscription.EventTypes == "" {
+		subscription.EventTypes = "*"
+	}
+	if subscription.Secret == "" {
+		subscription.Secret = newWebhookSecret()
+	}
+	err = subscription.Validate()
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	subscription, err = db.AddWebhookSubscription(r.Context(), subscription)
+	if err != nil {
+		http.Error(w, "unable to add webhook", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(subscription)
+}
+
+// PatchWebhookHandler applies a merge patch (or JSON patch) to a subscription. The secret
+// is kept unless the patch sets a new one.
+func PatchWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookIdFromPath(w, r)
+	if !ok {
+		return
+	}
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	subscription, err := db.GetWebhookSubscriptionById(r.Context(), id)
+	if err != nil {
+		if err.Error() == "webhook not found" {
+			http.Error(w, "webhook not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "unable to retrieve webhook", http.StatusInternalServerError)
+		return
+	}
+	secret := subscription.Secret
+	subscription.Secret = ""
+
+	mediaType := patchMediaType(r)
+	if mediaType == "" {
+		mediaType = utility.MergePatchContentType
+	}
+	patched, err := applyPatch(subscription, mediaType, patch)
+	if err != nil {
+		writePatchError(w, err)
+		return
+	}
+	if patched.ID != 0 && patched.ID != id {
+		writeValidationError(w, utility.ValidationErrors{{Field: "id", Message: "cannot be changed"}})
+		return
+	}
+	if patched.Secret == "" {
+		patched.Secret = secret
+	}
+	if patched.EventTypes == "" {
+		patched.EventTypes = "*"
+	}
+	err = patched.Validate()
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	updated, err := db.UpdateWebhookSubscription(r.Context(), id, patched)
+	if err != nil {
+		if err.Error() == "webhook not found" {
+			http.Error(w, "webhook not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "unable to update webhook", http.StatusInternalServerError)
+		return
+	}
+	updated.Secret = ""
+	json.NewEncoder(w).Encode(updated)
+	w.Header().Set("Content-Type", "application/json")
+}
+
+func DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookIdFromPath(w, r)
+	if !ok {
+		return
+	}
+	err := db.DeleteWebhookSubscription(r.Context(), id)
+	if err != nil {
+		if err.Error() == "webhook not found" {
+			http.Error(w, "webhook not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "unable to delete webhook", http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+		ID      int    `json:"id"`
+	}{Status: "success", Message: "Webhook deleted successfully", ID: id}
+	json.NewEncoder(w).Encode(response)
+	w.Header().Set("Content-Type", "application/json")
+}
+
+// GetWebhookDeliveriesHandler lists the latest deliveries of a subscription (?limit=, default 50)
+func GetWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookIdFromPath(w, r)
+	if !ok {
+		return
+	}
+	limit := 50
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed < 1 || parsed > 500 {
+			http.Error(w, "limit must be between 1 and 500", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	_, err := db.GetWebhookSubscriptionById(r.Context(), id)
+	if err != nil {
+		if err.Error() == "webhook not found" {
+			http.Error(w, "webhook not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "unable to retrieve webhook", http.StatusInternalServerError)
+		return
+	}
+	deliveries, err := db.GetWebhookDeliveries(r.Context(), id, limit)
+	if err != nil {
+		http.Error(w, "unable to retrieve deliveries", http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		Status string                   `json:"status"`
+		Count  int                      `json:"count"`
+		Data   []models.WebhookDelivery `json:"data"`
+	}{Status: "success", Count: len(deliveries), Data: deliveries}
+	json.NewEncoder(w).Encode(response)
+	w.Header().Set("Content-Type", "application/json")
+}
+
+// GetWebhookDeliveryAttemptsHandler returns the delivery log of one delivery
+func GetWebhookDeliveryAttemptsHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookIdFromPath(w, r)
+	if !ok {
+		return
+	}
+	deliveryId, ok := deliveryIdFromPath(w, r)
+	if !ok {
+		return
+	}
+	attempts, err := db.GetWebhookDeliveryAttempts(r.Context(), id, deliveryId)
+	if err != nil {
+		http.Error(w, "unable to retrieve delivery attempts", http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		Status string                          `json:"status"`
+		Count  int                             `json:"count"`
+		Data   []models.WebhookDeliveryAttempt `json:"data"`
+	}{Status: "success", Count: len(attempts), Data: attempts}
+	json.NewEncoder(w).Encode(response)
+	w.Header().Set("Content-Type", "application/json")
+}
+
+// RetryWebhookDeliveryHandler requeues a dead-lettered delivery
+func RetryWebhookDeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := webhookIdFromPath(w, r)
+	if !ok {
+		return
+	}
+	deliveryId, ok := deliveryIdFromPath(w, r)
+	if !ok {
+		return
+	}
+	err := db.RetryWebhookDelivery(r.Context(), id, deliveryId)
+	if err != nil {
+		if err.Error() == "delivery not found" {
+			http.Error(w, "dead-lettered delivery not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "unable to retry delivery", http.StatusInternalServerError)
+		return
+	}
+
+	response := struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	}{Status: "success", Message: "Delivery queued for retry"}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(response)
+}
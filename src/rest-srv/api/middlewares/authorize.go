@@ -0,0 +1,48 @@
+package middlewares
+
+import (
+	"net/http"
+	"rest-srv/authz"
+	"rest-srv/metrics"
+	"rest-srv/utility"
+)
+
+// Authorize lets through the principals whose role may take action on resource, and the
+// others with a 403 problem. With own, a principal may also act on their own record.
+func Authorize(resource string, action authz.Action, own bool) utility.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := utility.PrincipalFromContext(r.Context())
+			if ok && (authz.Allowed(principal, resource, action) || own && isOwn(r, principal)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			metrics.AuthFailures.Inc("forbidden")
+			utility.WriteProblem(w, r, http.StatusForbidden, "your role may not "+string(action)+" "+resource)
+		})
+	}
+}
+
+// RequireOwn lets through the principals acting on their own record only, whatever their
+// role, and the others with a 403 problem
+func RequireOwn(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := utility.PrincipalFromContext(r.Context())
+		if ok && isOwn(r, principal) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		metrics.AuthFailures.Inc("forbidden")
+		utility.WriteProblem(w, r, http.StatusForbidden, "only the exec concerned may do this")
+	})
+}
+
+// isOwn reports whether r is about the exec of principal: the exec of the {id} of the path,
+// or themselves when the path has none
+func isOwn(r *http.Request, principal utility.Principal) bool {
+	if principal.Kind != utility.PrincipalUser {
+		return false
+	}
+	id := r.PathValue("id")
+	return id == "" || id == principal.ID
+}
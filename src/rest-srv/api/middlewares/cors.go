@@ -3,25 +3,36 @@ package middlewares
 import (
 	"net/http"
 	"slices"
+	"sync/atomic"
 )
 
-// Allowed origins
-var allowedOrigins = []string{
-	"https://localhost:3000",
+// Allowed origins, replaced when the configuration is reloaded
+var allowedOrigins atomic.Pointer[[]string]
+
+func SetAllowedOrigins(origins []string) {
+	allowedOrigins.Store(&origins)
 }
 
+// Cors lets the allowed origins call the API from a browser and refuses the others. Requests
+// without an Origin don't come from a page, as those of API keys, services and the Go client,
+// and pass through without CORS headers.
 func Cors(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		origin := r.Header.Get("Origin")
-		if !slices.Contains(allowedOrigins, origin) {
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		origins := allowedOrigins.Load()
+		if origins == nil || !slices.Contains(*origins, origin) {
 			http.Error(w, "Origin not allowed", http.StatusForbidden)
 			return
 		}
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
 		w.Header().Set("Access-Control-Allow-Origin", origin)
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-		w.Header().Set("Access-Control-Expose-Headers", "Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, Idempotency-Key, X-Request-ID, traceparent")
+		w.Header().Set("Access-Control-Expose-Headers", "Authorization, X-Request-ID, Deprecation, Sunset, Link")
 		w.Header().Set("Access-Control-Max-Age", "86400")
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -2,19 +2,18 @@ package middlewares
 
 import (
 	"net/http"
-	"strings"
 )
 
-func ExcludeRoutes(middlewareFunc func(http.Handler) http.Handler, excludeRoutes ...string) func(http.Handler) http.Handler {
+// ExcludeRoutes applies middlewareFunc to every request but those for which excluded is true
+func ExcludeRoutes(middlewareFunc func(http.Handler) http.Handler, excluded func(*http.Request) bool) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
+		handler := middlewareFunc(next)
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			for _, route := range excludeRoutes {
-				if strings.HasPrefix(r.URL.Path, route) {
-					next.ServeHTTP(w, r)
-					return
-				}
+			if excluded(r) {
+				next.ServeHTTP(w, r)
+				return
 			}
-			middlewareFunc(next).ServeHTTP(w, r)
+			handler.ServeHTTP(w, r)
 		})
 	}
 }
@@ -0,0 +1,187 @@
+package middlewares
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"rest-srv/db"
+	"rest-srv/models"
+	"rest-srv/utility"
+)
+
+const (
+	idempotencyHeader   = "Idempotency-Key"
+	maxIdempotencyKey   = 255
+	inFlightWaitTimeout = 5 * time.Second
+	inFlightPollEvery   = 100 * time.Millisecond
+)
+
+type idempotency struct {
+	ttl  time.Duration
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewIdempotency stores the responses of POST requests carrying an Idempotency-Key header
+// for ttl and replays them when the same request is retried
+func NewIdempotency(ttl time.Duration) *idempotency {
+	i := &idempotency{ttl: ttl, stop: make(chan struct{}), done: make(chan struct{})}
+	go i.purgeExpiredKeys()
+	return i
+}
+
+func (i *idempotency) purgeExpiredKeys() {
+	defer close(i.done)
+	for {
+		select {
+		case <-i.stop:
+			return
+		case <-time.After(time.Hour):
+		}
+		db.DeleteExpiredIdempotencyKeys(context.Background())
+	}
+}
+
+// Stop ends the goroutine purging expired keys, waiting for it until ctx is done
+func (i *idempotency) Stop(ctx context.Context) error {
+	close(i.stop)
+	select {
+	case <-i.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (i *idempotency) IdempotencyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyHeader)
+		if r.Method != http.MethodPost || key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKey {
+			http.Error(w, "Idempotency-Key is too long", http.StatusBadRequest)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "invalid request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		requestHash := sha256.Sum256(body)
+		requestHashString := hex.EncodeToString(requestHash[:])
+
+		// Keys are scoped to the caller and the endpoint so different users can't collide
+		userId, _ := r.Context().Value(utility.ContextKey("userId")).(string)
+		scope := sha256.Sum256([]byte(fmt.Sprintf("%s\n%s %s\n%s", userId, r.Method, r.URL.Path, key)))
+		id := hex.EncodeToString(scope[:])
+
+		reserved, err := db.ReserveIdempotencyKey(r.Context(), id, requestHashString, time.Now().Add(i.ttl))
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !reserved {
+			if !i.replay(w, r, id, requestHashString) {
+				return
+			}
+			// the stored key had expired, so this request starts over with it
+			reserved, err = db.ReserveIdempotencyKey(r.Context(), id, requestHashString, time.Now().Add(i.ttl))
+			if err != nil {
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+				return
+			}
+			if !reserved {
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, "a request with this Idempotency-Key is still being processed", http.StatusConflict)
+				return
+			}
+		}
+
+		recorder := &recordingResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		// Server errors are not stored so the client can retry with the same key
+		if recorder.status >= http.StatusInternalServerError {
+			db.DeleteIdempotencyKey(context.WithoutCancel(r.Context()), id)
+			return
+		}
+		db.CompleteIdempotencyKey(context.WithoutCancel(r.Context()), id, recorder.status, recorder.Header().Get("Content-Type"), recorder.body.Bytes())
+	})
+}
+
+// replay answers a request whose key was already used, waiting briefly if the first
+// request with that key is still in flight. It returns true without writing a response
+// if the stored key had expired and was released.
+func (i *idempotency) replay(w http.ResponseWriter, r *http.Request, id string, requestHash string) bool {
+	deadline := time.Now().Add(inFlightWaitTimeout)
+	for {
+		record, err := db.GetIdempotencyRecord(r.Context(), id)
+		if err != nil {
+			if err.Error() == "idempotency key not found" {
+				// the first request failed and released the key
+				http.Error(w, "a previous request with this Idempotency-Key failed, retry the request", http.StatusConflict)
+				return false
+			}
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return false
+		}
+		if record.ExpiresAt.Before(time.Now()) {
+			if err := db.DeleteIdempotencyKey(r.Context(), id); err != nil {
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+				return false
+			}
+			return true
+		}
+		if record.RequestHash != requestHash {
+			http.Error(w, "Idempotency-Key was already used with a different request body", http.StatusConflict)
+			return false
+		}
+		if record.Status == models.IdempotencyCompleted {
+			if record.ResponseContentType != "" {
+				w.Header().Set("Content-Type", record.ResponseContentType)
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(record.ResponseCode)
+			w.Write(record.ResponseBody)
+			return false
+		}
+
+		if time.Now().After(deadline) {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "a request with this Idempotency-Key is still being processed", http.StatusConflict)
+			return false
+		}
+		select {
+		case <-r.Context().Done():
+			return false
+		case <-time.After(inFlightPollEvery):
+		}
+	}
+}
+
+// recordingResponseWriter passes the response through while keeping a copy of it
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rw *recordingResponseWriter) WriteHeader(status int) {
+	rw.status = status
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *recordingResponseWriter) Write(b []byte) (int, error) {
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
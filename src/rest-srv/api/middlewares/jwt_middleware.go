@@ -2,28 +2,184 @@ package middlewares
 
 import (
 	"context"
+	"crypto/subtle"
 	"net/http"
+	"rest-srv/certs"
+	"rest-srv/db"
+	"rest-srv/metrics"
+	"rest-srv/revocation"
 	"rest-srv/utility"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
 )
 
+// Services that may authenticate with a client certificate instead of a JWT
+var serviceAccounts atomic.Pointer[certs.ServiceMap]
+
+func SetServiceAccounts(services certs.ServiceMap) {
+	serviceAccounts.Store(&services)
+}
+
+// JwtMiddleware authenticates the request by a client certificate mapped to a service, by
+// an API key, or else by the JWT in the Bearer cookie, and puts the principal in the request
+// context. A JWT is refused once revoked, when it predates the last password change of its
+// exec, and when the exec is inactive.
 func JwtMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if principal, ok := servicePrincipal(r); ok {
+			next.ServeHTTP(w, r.WithContext(utility.WithPrincipal(r.Context(), principal)))
+			return
+		}
+		if key, ok := presentedAPIKey(r); ok {
+			principal, reason, err := apiKeyPrincipal(r.Context(), key)
+			if err != nil {
+				http.Error(w, "internal server error", http.StatusInternalServerError)
+				return
+			}
+			if reason != "" {
+				metrics.AuthFailures.Inc(reason)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(utility.WithPrincipal(r.Context(), principal)))
+			return
+		}
+
 		cookie, err := r.Cookie("Bearer")
 		if err != nil {
+			metrics.AuthFailures.Inc("missing_token")
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 		tokenClaims, err := utility.VerifyToken(cookie.Value)
 		if err != nil {
+			metrics.AuthFailures.Inc("invalid_token")
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), utility.ContextKey("role"), tokenClaims["role"])
-		ctx = context.WithValue(r.Context(), utility.ContextKey("exp"), tokenClaims["exp"])
-		ctx = context.WithValue(r.Context(), utility.ContextKey("username"), tokenClaims["user"])
-		ctx = context.WithValue(r.Context(), utility.ContextKey("userId"), tokenClaims["uid"])
-		r = r.WithContext(ctx)
-		next.ServeHTTP(w, r)
+		principal := utility.Principal{Kind: utility.PrincipalUser}
+		principal.ID, _ = tokenClaims["uid"].(string)
+		principal.Name, _ = tokenClaims["user"].(string)
+		principal.Role, _ = tokenClaims["role"].(string)
+		reason, err := refusedSession(r.Context(), principal.ID, tokenClaims)
+		if err != nil {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		if reason != "" {
+			metrics.AuthFailures.Inc(reason)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(utility.WithPrincipal(r.Context(), principal)))
 	})
 }
+
+// presentedAPIKey returns the key of the X-API-Key header, or else the bearer token of the
+// Authorization header, which only carries API keys
+func presentedAPIKey(r *http.Request) (string, bool) {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key, true
+	}
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token), true
+	}
+	return "", false
+}
+
+// apiKeyPrincipal returns the principal of an API key, acting as its exec within its scopes,
+// or why the key must be refused
+func apiKeyPrincipal(ctx context.Context, key string) (utility.Principal, string, error) {
+	prefix, ok := utility.ParseAPIKey(key)
+	if !ok {
+		return utility.Principal{}, "invalid_api_key", nil
+	}
+	stored, exec, err := db.GetAPIKeyByPrefix(ctx, prefix)
+	if err != nil && err.Error() == "api key not found" {
+		return utility.Principal{}, "invalid_api_key", nil
+	}
+	if err != nil {
+		return utility.Principal{}, "", err
+	}
+	if subtle.ConstantTimeCompare([]byte(stored.KeyHash), []byte(utility.HashAPIKey(key))) != 1 {
+		return utility.Principal{}, "invalid_api_key", nil
+	}
+	switch {
+	case stored.RevokedAt != nil:
+		return utility.Principal{}, "revoked_api_key", nil
+	case !stored.Active():
+		return utility.Principal{}, "expired_api_key", nil
+	case exec.InactiveStatus:
+		return utility.Principal{}, "inactive_user", nil
+	}
+	if err := db.TouchAPIKey(ctx, stored.ID); err != nil {
+		utility.Logger(ctx).WarnContext(ctx, "unable to record the use of an api key", "api_key", stored.Prefix, "error", err)
+	}
+	return utility.Principal{
+		Kind:   utility.PrincipalAPIKey,
+		ID:     strconv.Itoa(exec.ID),
+		Name:   exec.Username,
+		Role:   exec.Role,
+		Scopes: stored.Scopes,
+	}, "", nil
+}
+
+// refusedSession returns why the session token of the exec must be refused, empty when it
+// is still valid
+func refusedSession(ctx context.Context, execID string, claims jwt.MapClaims) (string, error) {
+	id, _ := claims["jti"].(string)
+	issuedAt, err := claims.GetIssuedAt()
+	if id == "" || err != nil || issuedAt == nil {
+		// Tokens signed before they could be revoked are refused, their sessions start again
+		return "invalid_token", nil
+	}
+	revoked, err := revocation.Revoked(ctx, id, execID, issuedAt.Time)
+	if err != nil {
+		return "", err
+	}
+	if revoked {
+		return "revoked_token", nil
+	}
+
+	numericID, err := strconv.Atoi(execID)
+	if err != nil {
+		return "invalid_token", nil
+	}
+	passwordChangedAt, inactive, err := db.GetExecSessionState(ctx, numericID)
+	switch {
+	case err != nil && err.Error() == "exec not found":
+		return "invalid_token", nil
+	case err != nil:
+		return "", err
+	case inactive:
+		return "inactive_user", nil
+	// Tokens are issued in whole seconds, so the change is compared at that precision: a
+	// token signed in the second of the change, as the one updating the password returns,
+	// is still valid
+	case issuedAt.Time.Before(passwordChangedAt.Truncate(time.Second)):
+		return "password_changed", nil
+	}
+	return "", nil
+}
+
+// servicePrincipal identifies the service of a client certificate verified during the TLS
+// handshake. A certificate of no known service falls back to the JWT.
+func servicePrincipal(r *http.Request) (utility.Principal, bool) {
+	services := serviceAccounts.Load()
+	if services == nil || r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return utility.Principal{}, false
+	}
+	service, role, ok := services.Identify(r.TLS.VerifiedChains[0][0])
+	if !ok {
+		utility.Logger(r.Context()).WarnContext(r.Context(), "client certificate of no known service",
+			"subject", r.TLS.VerifiedChains[0][0].Subject.String())
+		return utility.Principal{}, false
+	}
+	return utility.Principal{Kind: utility.PrincipalService, ID: "service:" + service, Name: service, Role: role}, true
+}
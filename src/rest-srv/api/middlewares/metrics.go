@@ -0,0 +1,30 @@
+package middlewares
+
+import (
+	"net/http"
+	"rest-srv/metrics"
+	"rest-srv/utility"
+	"strings"
+	"time"
+)
+
+// MetricsMiddleware counts and times requests by the route pattern of mux that serves them.
+// Using the pattern rather than the path keeps ids out of the labels.
+func MetricsMiddleware(mux *http.ServeMux) utility.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			route := "unmatched"
+			if _, pattern := mux.Handler(r); pattern != "" {
+				// the method is a label of its own
+				_, route, _ = strings.Cut(pattern, " ")
+			}
+
+			wrappedWriter := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(wrappedWriter, r)
+
+			metrics.HTTPRequests.Inc(route, r.Method, metrics.StatusClass(wrappedWriter.status))
+			metrics.HTTPRequestDuration.Observe(time.Since(start).Seconds(), route, r.Method)
+		})
+	}
+}
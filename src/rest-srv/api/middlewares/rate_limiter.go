@@ -1,9 +1,11 @@
 package middlewares
 
 import (
-	"fmt"
+	"context"
 	"net"
 	"net/http"
+	"rest-srv/metrics"
+	"rest-srv/utility"
 	"sync"
 	"time"
 )
@@ -13,6 +15,8 @@ type rateLimiter struct {
 	visitors  map[string]int
 	limit     int
 	resetTime time.Duration
+	stop      chan struct{}
+	done      chan struct{}
 }
 
 func NewRateLimiter(limit int, resetTime time.Duration) *rateLimiter {
@@ -20,20 +24,50 @@ func NewRateLimiter(limit int, resetTime time.Duration) *rateLimiter {
 		limit:     limit,
 		resetTime: resetTime,
 		visitors:  make(map[string]int),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
 	}
 	go rl.resetVisitorCount()
 	return rl
 }
 
 func (rl *rateLimiter) resetVisitorCount() {
+	defer close(rl.done)
 	for {
-		time.Sleep(rl.resetTime)
+		rl.mu.Lock()
+		resetTime := rl.resetTime
+		rl.mu.Unlock()
+		select {
+		case <-rl.stop:
+			return
+		case <-time.After(resetTime):
+		}
 		rl.mu.Lock()
 		rl.visitors = make(map[string]int)
 		rl.mu.Unlock()
 	}
 }
 
+// SetLimit changes the requests allowed per client and window; the new window starts after
+// the current one
+func (rl *rateLimiter) SetLimit(limit int, resetTime time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.limit = limit
+	rl.resetTime = resetTime
+}
+
+// Stop ends the goroutine resetting the counts, waiting for it until ctx is done
+func (rl *rateLimiter) Stop(ctx context.Context) error {
+	close(rl.stop)
+	select {
+	case <-rl.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func (rl *rateLimiter) RateLimiterMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Extract IP address from RemoteAddr (removes port)
@@ -42,12 +76,16 @@ func (rl *rateLimiter) RateLimiterMiddleware(next http.Handler) http.Handler {
 			// If SplitHostPort fails, use RemoteAddr as-is (fallback)
 			ip = r.RemoteAddr
 		}
+		// The lock only guards the counter; holding it while serving would block
+		// every other request behind long-lived ones such as event streams
 		rl.mu.Lock()
-		defer rl.mu.Unlock()
 		count := rl.visitors[ip]
 		rl.visitors[ip] = count + 1
-		fmt.Printf("IP: %s, Count: %d\n", ip, rl.visitors[ip])
-		if count >= rl.limit {
+		limit := rl.limit
+		rl.mu.Unlock()
+		if count >= limit {
+			metrics.RateLimitRejections.Inc()
+			utility.Logger(r.Context()).WarnContext(r.Context(), "rate limit exceeded", "ip", ip, "count", count+1)
 			http.Error(w, "Too many requests", http.StatusTooManyRequests)
 			return
 		}
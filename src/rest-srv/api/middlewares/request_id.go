@@ -0,0 +1,38 @@
+package middlewares
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	"rest-srv/utility"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// Request ids from clients are kept only when they are short and can't forge log lines
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestIDMiddleware tags the request with the X-Request-ID it came with, or a new one, and
+// echoes it in the response. The logger in the request context carries the id, so every
+// entry logged while serving the request, down to the db calls, can be correlated.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(requestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = newRequestID()
+		}
+		r.Header.Set(requestIDHeader, requestID)
+		w.Header().Set(requestIDHeader, requestID)
+
+		ctx := utility.WithRequestID(r.Context(), requestID)
+		ctx = utility.WithLogger(ctx, utility.Logger(ctx).With("request_id", requestID))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func newRequestID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,29 @@
+package middlewares
+
+import (
+	"mime"
+	"net/http"
+	"slices"
+)
+
+// RequireJSON rejects requests whose body isn't JSON. Requests without a body, such as GETs,
+// need no Content-Type.
+func RequireJSON(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hasBody(r) && !isJSON(r) {
+			http.Error(w, "Content-Type not supported", http.StatusUnsupportedMediaType)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// hasBody reports whether r has a body; a chunked body has an unknown length
+func hasBody(r *http.Request) bool {
+	return r.Body != nil && r.Body != http.NoBody && r.ContentLength != 0
+}
+
+func isJSON(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return slices.Contains(jsonMediaTypes, mediaType)
+}
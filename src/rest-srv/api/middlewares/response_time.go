@@ -1,8 +1,8 @@
 package middlewares
 
 import (
-	"fmt"
 	"net/http"
+	"rest-srv/utility"
 	"time"
 )
 
@@ -15,7 +15,13 @@ func ResponseTimMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(wrappedWriter, r)
 		duration := time.Since(start)
 		// Log request details and response time
-		fmt.Printf("Request: %s %s, Status: %d, Response Time: %s, \n", r.Method, r.URL.Path, wrappedWriter.status, duration)
+		utility.Logger(r.Context()).InfoContext(r.Context(), "request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", wrappedWriter.status,
+			"duration_ms", float64(duration.Microseconds())/1000,
+			"remote_addr", r.RemoteAddr,
+		)
 	})
 }
 
@@ -29,3 +35,14 @@ func (rw *responseWriter) WriteHeader(status int) {
 	rw.status = status
 	rw.ResponseWriter.WriteHeader(status)
 }
+
+// Flush lets streaming handlers (Server-Sent Events) push data through the wrapper
+func (rw *responseWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
@@ -1,16 +1,23 @@
 package middlewares
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"rest-srv/utility"
 	"strings"
-
-	"github.com/microcosm-cc/bluemonday"
 )
 
+// Content types whose bodies are sanitized as JSON
+var jsonMediaTypes = []string{
+	"application/json",
+	"application/merge-patch+json",
+	"application/json-patch+json",
+}
+
 func XSSMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
@@ -44,12 +51,10 @@ func XSSMiddleware(next http.Handler) http.Handler {
 		}
 		r.URL.RawQuery = url.Values(sanitizedQuery).Encode()
 
-		//sanitize request body
-		if r.Header.Get("Content-Type") != "application/json" {
-			http.Error(w, "Content-Type not supported", http.StatusUnsupportedMediaType)
-			return
-		}
-		if r.Body != nil {
+		// Only JSON bodies are sanitized; the routes of the API reject others with RequireJSON.
+		// The operations of a batch go through this middleware each on its own, so their
+		// paths and bodies are sanitized once, after their references are resolved.
+		if hasBody(r) && isJSON(r) && !strings.HasSuffix(r.URL.Path, "/batch") {
 			bodyBytes, err := io.ReadAll(r.Body)
 			defer r.Body.Close()
 			if err != nil {
@@ -58,12 +63,31 @@ func XSSMiddleware(next http.Handler) http.Handler {
 			}
 			bodyString := strings.TrimSpace(string(bodyBytes))
 			if len(bodyString) != 0 {
-				sanitizedBody, err := clean(bodyString)
+				// sanitize the decoded values so the JSON structure itself stays intact
+				var body any
+				if err := json.Unmarshal([]byte(bodyString), &body); err != nil {
+					http.Error(w, "invalid request body", http.StatusBadRequest)
+					return
+				}
+				// A GraphQL document is code, not data: escaping its quotes would break it,
+				// so the GraphQL executor sanitizes its string literals instead
+				graphqlRequest, isGraphQL := body.(map[string]any)
+				var graphqlQuery any
+				if isGraphQL = isGraphQL && strings.HasSuffix(r.URL.Path, "/graphql"); isGraphQL {
+					graphqlQuery = graphqlRequest["query"]
+				}
+				body = sanitizeValue(body)
+				if isGraphQL {
+					graphqlRequest["query"] = graphqlQuery
+				}
+				sanitizedBody, err := json.Marshal(body)
 				if err != nil {
 					http.Error(w, err.Error(), http.StatusInternalServerError)
 					return
 				}
-				r.Body = io.NopCloser(strings.NewReader(sanitizedBody.(string)))
+				r.Body = io.NopCloser(bytes.NewReader(sanitizedBody))
+			} else {
+				r.Body = io.NopCloser(strings.NewReader(""))
 			}
 		}
 		next.ServeHTTP(w, r)
@@ -109,5 +133,5 @@ func sanitizeValue(data any) any {
 }
 
 func sanitizeString(data string) string {
-	return bluemonday.UGCPolicy().Sanitize(data)
+	return utility.SanitizeString(data)
 }
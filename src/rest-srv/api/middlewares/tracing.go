@@ -0,0 +1,57 @@
+package middlewares
+
+import (
+	"net/http"
+	"rest-srv/tracing"
+	"rest-srv/utility"
+	"strconv"
+	"strings"
+)
+
+// TracingMiddleware starts the server span of the request, named after the route pattern of
+// mux that serves it, as a child of the caller's span when the request has a traceparent.
+// The trace id is added to the request logger so log entries can be matched with the trace.
+func TracingMiddleware(mux *http.ServeMux) utility.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			name, route := r.Method, ""
+			if _, pattern := mux.Handler(r); pattern != "" {
+				name = pattern
+				_, route, _ = strings.Cut(pattern, " ")
+			}
+
+			ctx, span := tracing.Start(tracing.Extract(r.Context(), r.Header), name, tracing.KindServer,
+				tracing.String("http.request.method", r.Method),
+				tracing.String("url.path", r.URL.Path),
+				tracing.String("http.route", route),
+				tracing.String("user_agent.original", r.UserAgent()),
+				tracing.String("client.address", r.RemoteAddr),
+			)
+			defer span.End()
+			if span.IsRecording() {
+				ctx = utility.WithLogger(ctx, utility.Logger(ctx).With("trace_id", span.SpanContext().TraceID().String()))
+			}
+
+			wrappedWriter := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(wrappedWriter, r.WithContext(ctx))
+
+			span.SetAttributes(tracing.Int("http.response.status_code", wrappedWriter.status))
+			// Client errors are the client's; only server errors fail the span
+			if wrappedWriter.status >= 500 {
+				span.SetStatus(tracing.StatusError, strconv.Itoa(wrappedWriter.status))
+			}
+		})
+	}
+}
+
+// Traced wraps middleware in a span named name, covering it and everything it calls
+func Traced(name string, middleware utility.Middleware) utility.Middleware {
+	return func(next http.Handler) http.Handler {
+		handler := middleware(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, span := tracing.Start(r.Context(), name, tracing.KindInternal)
+			defer span.End()
+			handler.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,11 @@
+package router
+
+import (
+	"rest-srv/api/handlers"
+)
+
+func registerAdminRoutes(mux *routes) {
+	mux = mux.on("settings")
+	mux.HandleFunc("GET /admin/log-level", handlers.GetLogLevelHandler)
+	mux.HandleFunc("PUT /admin/log-level", handlers.SetLogLevelHandler)
+}
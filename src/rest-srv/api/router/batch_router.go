@@ -0,0 +1,13 @@
+package router
+
+import (
+	"rest-srv/api/handlers"
+	"rest-srv/utility"
+)
+
+func registerBatchRoutes(mux *routes, sanitize utility.Middleware) {
+	// Each operation is cleaned up by sanitize and goes through the authorization of its
+	// route, unless the route is excluded from batches
+	unbatchable := excludes(mux.ServeMux, mux.excluded, ExcludeBatch)
+	mux.group("", ExcludeBatch).delegated().HandleFunc("POST /batch", handlers.BatchHandler(sanitize(mux.ServeMux), unbatchable))
+}
@@ -0,0 +1,11 @@
+package router
+
+import (
+	"rest-srv/api/handlers"
+	"rest-srv/openapi"
+)
+
+func registerDocsRoutes(mux *routes, doc *openapi.Document) {
+	mux.HandleFunc("GET /openapi.json", handlers.OpenAPIHandler(doc))
+	mux.HandleFunc("GET /docs/", handlers.DocsHandler())
+}
@@ -0,0 +1,12 @@
+package router
+
+import (
+	"rest-srv/api/handlers"
+	"rest-srv/events"
+)
+
+func registerEventRoutes(mux *routes, broker *events.Broker) {
+	mux = mux.on("events")
+	// The stream never ends, so it can't be an operation of a batch
+	mux.group("", ExcludeBatch).HandleFunc("GET /events/stream", handlers.EventStreamHandler(broker))
+}
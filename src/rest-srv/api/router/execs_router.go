@@ -1,27 +1,52 @@
 package router
 
 import (
-	"net/http"
 	"rest-srv/api/handlers"
+	"rest-srv/utility"
 )
 
-func registerExecsRoutes(mux *http.ServeMux) {
+func registerExecsRoutes(mux *routes, authLimit utility.Middleware) {
+	mux = mux.on("execs")
 	mux.HandleFunc("GET /execs", handlers.GetExecsHandler)
 	mux.HandleFunc("GET /execs/", handlers.GetExecHandler)
 	mux.HandleFunc("POST /execs", handlers.AddExecHandler)
 	mux.HandleFunc("POST /execs/", handlers.AddExecHandler)
-	mux.HandleFunc("PATCH /execs", handlers.PatchExecHandler)
-	mux.HandleFunc("PATCH /execs/", handlers.PatchExecHandler)
+	mux.HandleFunc("PATCH /execs", handlers.PatchExecsHandler)
+	mux.HandleFunc("PATCH /execs/", handlers.PatchExecsHandler)
 	mux.HandleFunc("DELETE /execs", handlers.DeleteExecHandler)
 	mux.HandleFunc("DELETE /execs/", handlers.DeleteExecHandler)
 
-	mux.HandleFunc("GET /execs/{id}", handlers.GetExecHandler)
+	// An exec may read their own record whatever their role, and change their own password only
+	mux.orSelf().HandleFunc("GET /execs/{id}", handlers.GetExecHandler)
 	mux.HandleFunc("PATCH /execs/{id}", handlers.PatchExecHandler)
 	mux.HandleFunc("DELETE /execs/{id}", handlers.DeleteExecHandler)
-	mux.HandleFunc("POST /execs/{id}/update-password", handlers.UpdateExecPasswordHandler)
+	mux.selfOnly().HandleFunc("POST /execs/{id}/update-password", handlers.UpdateExecPasswordHandler)
+	mux.selfOnly().HandleFunc("POST /execs/logout-all", handlers.LogoutAllExecHandler)
 
-	mux.HandleFunc("POST /execs/login", handlers.LoginExecHandler)
-	mux.HandleFunc("POST /execs/logout", handlers.LogoutExecHandler)
-	mux.HandleFunc("POST /execs/forgot-password", handlers.ForgotExecPasswordHandler)
-	mux.HandleFunc("GET /execs/reset-password/reset/{token}", handlers.ResetExecPasswordHandler)
+	// Responses carrying a secret, recovery codes or tokens are never stored for an
+	// Idempotency-Key: they are shown once, and the store keeps them in plain text. Nor are
+	// they run in a batch, whose response is stored.
+	secrets := mux.group("", ExcludeIdempotency, ExcludeBatch)
+
+	// An exec manages their own second factor; admins reset that of an exec who lost it
+	secrets.selfOnly().HandleFunc("POST /execs/{id}/mfa/enroll", handlers.EnrollMFAHandler)
+	secrets.selfOnly().HandleFunc("POST /execs/{id}/mfa/confirm", handlers.ConfirmMFAHandler)
+	secrets.selfOnly().HandleFunc("POST /execs/{id}/mfa/recovery-codes", handlers.RegenerateRecoveryCodesHandler)
+	mux.selfOnly().HandleFunc("POST /execs/{id}/mfa/disable", handlers.DisableMFAHandler)
+	mux.HandleFunc("DELETE /execs/{id}/mfa", handlers.ResetMFAHandler)
+
+	keys := mux.on("api_keys")
+	keys.HandleFunc("GET /execs/{id}/api-keys", handlers.GetAPIKeysHandler)
+	secrets.on("api_keys").HandleFunc("POST /execs/{id}/api-keys", handlers.AddAPIKeyHandler)
+	keys.HandleFunc("DELETE /execs/{id}/api-keys/{keyId}", handlers.RevokeAPIKeyHandler)
+
+	// Logging in and renewing the session answer with tokens, to callers not yet identified
+	public := secrets.group("", ExcludeAuth)
+	public.HandleFunc("POST /execs/login", handlers.LoginExecHandler, authLimit)
+	public.HandleFunc("POST /execs/login/mfa", handlers.LoginMFAHandler, authLimit)
+	public.HandleFunc("POST /execs/login/mfa/enroll", handlers.LoginMFAEnrollHandler, authLimit)
+	public.HandleFunc("POST /execs/token/refresh", handlers.RefreshTokenHandler)
+	public.HandleFunc("POST /execs/logout", handlers.LogoutExecHandler)
+	public.HandleFunc("POST /execs/forgot-password", handlers.ForgotExecPasswordHandler, authLimit)
+	public.HandleFunc("POST /execs/reset-password/reset/{token}", handlers.ResetExecPasswordHandler, authLimit)
 }
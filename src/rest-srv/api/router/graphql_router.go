@@ -0,0 +1,13 @@
+package router
+
+import (
+	"rest-srv/api/handlers"
+	"rest-srv/graphql"
+)
+
+func registerGraphQLRoutes(mux *routes) {
+	// Each field is authorized by the permission matrix as it resolves
+	// A query runs operations of its own, and its document is not sanitized as JSON: it is
+	// never run in a batch
+	mux.group("", ExcludeBatch).delegated().HandleFunc("POST /graphql", handlers.GraphQLHandler(graphql.NewSchema()))
+}
@@ -0,0 +1,10 @@
+package router
+
+import (
+	"rest-srv/api/handlers"
+)
+
+func registerHealthRoutes(mux *routes, readiness *handlers.Readiness) {
+	mux.HandleFunc("GET /healthz", handlers.HealthzHandler)
+	mux.HandleFunc("GET /readyz", readiness.ReadyzHandler)
+}
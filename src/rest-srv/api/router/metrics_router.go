@@ -0,0 +1,9 @@
+package router
+
+import (
+	"rest-srv/api/handlers"
+)
+
+func registerMetricsRoutes(mux *routes, token string) {
+	mux.HandleFunc("GET /metrics", handlers.MetricsHandler(token))
+}
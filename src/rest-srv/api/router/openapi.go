@@ -0,0 +1,655 @@
+package router
+
+import (
+	"net/http"
+	"strconv"
+
+	"rest-srv/models"
+	"rest-srv/openapi"
+	"rest-srv/utility"
+)
+
+// apiDocument describes every route of the API. TestRoutesDocumented fails when a registered
+// route has no entry here, so new routes have to be documented as they are added.
+func apiDocument() *openapi.Document {
+	doc := openapi.New("rest-srv API", "1.0.0", "Manage students, teachers and execs. Authenticate with POST /v1/execs/login, which sets the Bearer cookie, or with an API key. "+
+		"The unversioned paths are deprecated aliases of /v1 and answer with Deprecation and Sunset headers, and with errors in plain text rather than as problems.")
+	doc.Components.SecuritySchemes["cookieAuth"] = &openapi.SecurityScheme{Type: "apiKey", In: "cookie", Name: "Bearer", Description: "JWT set by POST /v1/execs/login"}
+	doc.Components.SecuritySchemes["mutualTLS"] = &openapi.SecurityScheme{Type: "mutualTLS", Description: "Client certificate of a service listed in mtls.services"}
+	doc.Components.SecuritySchemes["apiKeyHeader"] = &openapi.SecurityScheme{Type: "apiKey", In: "header", Name: "X-API-Key", Description: "API key created with POST /v1/execs/{id}/api-keys"}
+	doc.Components.SecuritySchemes["apiKeyBearer"] = &openapi.SecurityScheme{Type: "http", Scheme: "bearer", Description: "API key created with POST /v1/execs/{id}/api-keys"}
+	doc.Security = []openapi.Requirement{{"cookieAuth": {}}, {"apiKeyHeader": {}}, {"apiKeyBearer": {}}, {"mutualTLS": {}}}
+
+	doc.Component("Student", models.Student{})
+	doc.Component("Teacher", models.Teacher{})
+	doc.Component("Exec", models.Exec{})
+	doc.Components.Schemas["Exec"].Properties["password"].WriteOnly = true
+	doc.Component("WebhookSubscription", models.WebhookSubscription{})
+	doc.Component("WebhookDelivery", models.WebhookDelivery{})
+	doc.Component("WebhookDeliveryAttempt", models.WebhookDeliveryAttempt{})
+	doc.Component("FieldError", utility.FieldError{})
+	doc.Components.Schemas["ValidationError"] = openapi.Object(map[string]*openapi.Schema{
+		"status": {Type: "string", Enum: []any{"error"}},
+		"errors": openapi.ArrayOf(openapi.Ref("FieldError")),
+	})
+	doc.Component("Problem", utility.Problem{})
+	doc.Component("APIKey", models.APIKey{})
+	doc.Component("CreatedAPIKey", models.APIKey{})
+	doc.Components.Schemas["CreatedAPIKey"].Properties["key"] = &openapi.Schema{Type: "string", Description: "The API key, shown only once"}
+
+	// The operations of the API, mounted under the prefix of every version below. Only its
+	// paths are used; the components are those of doc.
+	api := openapi.New(doc.Info.Title, doc.Info.Version, "")
+	documentResource(api, resource{
+		name: "student", plural: "students", schema: "Student", paginated: true, include: "teacher", put: true,
+		filters: []string{"id", "first_name", "last_name", "email", "class"},
+	})
+	documentResource(api, resource{
+		name: "teacher", plural: "teachers", schema: "Teacher", include: "students", put: true,
+		filters: []string{"id", "first_name", "last_name", "email", "class", "subject"},
+	})
+	documentResource(api, resource{
+		name: "exec", plural: "execs", schema: "Exec",
+		filters: []string{"id", "first_name", "last_name", "email", "username", "role"},
+	})
+
+	api.Add("GET /teachers/{id}/students", &openapi.Operation{
+		Tags: []string{"teachers"}, Summary: "List the students of a teacher's class", OperationID: "getTeacherStudents",
+		Parameters: []*openapi.Parameter{idParameter},
+		Responses:  responses(http.StatusOK, listResponse(openapi.Ref("Student"), false), http.StatusBadRequest, http.StatusNotFound),
+	})
+	api.Add("GET /teachers/{id}/studentsCount", &openapi.Operation{
+		Tags: []string{"teachers"}, Summary: "Count the students of a teacher's class", OperationID: "getTeacherStudentsCount",
+		Parameters: []*openapi.Parameter{idParameter},
+		Responses: responses(http.StatusOK, jsonResponse("Number of students", openapi.Object(map[string]*openapi.Schema{
+			"status": {Type: "string"},
+			"count":  {Type: "integer"},
+		})), http.StatusBadRequest, http.StatusNotFound),
+	})
+
+	documentExecAccountRoutes(api)
+	documentAPIKeyRoutes(api)
+	documentWebhookRoutes(api)
+
+	api.Add("GET /events/stream", &openapi.Operation{
+		Tags: []string{"events"}, Summary: "Stream entity changes as Server-Sent Events", OperationID: "streamEvents",
+		Description: "Events are named after the change (student.created, teacher.updated, ...). A client that reconnects with Last-Event-ID gets the events it missed, or a reset event when it must refetch.",
+		Parameters: []*openapi.Parameter{
+			listParameter("entity", "Only stream changes of these entities: student, teacher, exec"),
+			listParameter("class", "Only stream changes to students and teachers of these classes"),
+			{Name: "lastEventId", In: "query", Description: "Resume after this event", Schema: &openapi.Schema{Type: "integer", Format: "int64"}},
+			{Name: "Last-Event-ID", In: "header", Description: "Resume after this event; sent by EventSource on reconnect", Schema: &openapi.Schema{Type: "integer", Format: "int64"}},
+		},
+		Responses: responses(http.StatusOK, &openapi.Response{
+			Description: "Event stream",
+			Content:     map[string]*openapi.MediaType{"text/event-stream": {Schema: &openapi.Schema{Type: "string"}}},
+		}, http.StatusBadRequest),
+	})
+
+	api.Add("POST /graphql", &openapi.Operation{
+		Tags: []string{"graphql"}, Summary: "Execute a GraphQL query or mutation", OperationID: "graphql",
+		Description: "The schema can be introspected. Field errors are reported in a 200 response next to the partial data. " +
+			"Operations nested deeper than 15 fields or costing more than 1000 are refused with a 400; a field costs 1 for every item it is resolved on, a list counting as its limit argument or as 10 items.",
+		RequestBody: jsonBody(openapi.Object(map[string]*openapi.Schema{
+			"query":         {Type: "string"},
+			"operationName": {Type: []string{"string", "null"}},
+			"variables":     {Type: []string{"object", "null"}},
+		})),
+		Responses: map[string]*openapi.Response{
+			"200": jsonResponse("Result of the operation", graphQLResponse()),
+			"400": jsonResponse("The request could not be executed", graphQLResponse()),
+			"401": textResponse("Not logged in"),
+		},
+	})
+
+	batchResult := openapi.Object(map[string]*openapi.Schema{
+		"method": {Type: "string"},
+		"path":   {Type: "string"},
+		"status": {Type: "integer"},
+		"body":   {},
+	})
+	batchResult.Required = []string{"method", "path", "status"}
+	batchOperation := openapi.Object(map[string]*openapi.Schema{
+		"method":       {Type: "string", Enum: []any{"POST", "PUT", "PATCH", "DELETE"}},
+		"path":         {Type: "string", Description: "May reference earlier results as ${0} or ${0/0/id}"},
+		"content_type": {Type: "string"},
+		"body":         {},
+	})
+	batchOperation.Required = []string{"method", "path"}
+	batchResponse := openapi.Object(map[string]*openapi.Schema{
+		"status":           {Type: "string", Enum: []any{"success", "error"}},
+		"failed_operation": {Type: "integer"},
+		"results":          openapi.ArrayOf(batchResult),
+	})
+	batchResponse.Required = []string{"status", "results"}
+	maxOperations := 100
+	api.Add("POST /batch", &openapi.Operation{
+		Tags: []string{"batch"}, Summary: "Run several write operations in one transaction", OperationID: "batch",
+		Description: "Either every operation succeeds or the first failing one stops the batch and everything is rolled back. The event stream, GraphQL, batches and the routes answering with tokens or secrets cannot be operations of a batch.",
+		RequestBody: jsonBody(openapi.Object(map[string]*openapi.Schema{
+			"operations": {Type: "array", Items: batchOperation, MaxItems: &maxOperations},
+		})),
+		Responses: map[string]*openapi.Response{
+			"200":     jsonResponse("Every operation succeeded", batchResponse),
+			"default": jsonResponse("The status of the failed operation", batchResponse),
+		},
+	})
+
+	logLevel := openapi.Object(map[string]*openapi.Schema{
+		"level": {Type: "string", Enum: []any{"debug", "info", "warn", "error"}},
+	})
+	api.Add("GET /admin/log-level", &openapi.Operation{
+		Tags: []string{"admin"}, Summary: "Get the log level", OperationID: "getLogLevel",
+		Responses: responses(http.StatusOK, jsonResponse("The current level", logLevel)),
+	})
+	api.Add("PUT /admin/log-level", &openapi.Operation{
+		Tags: []string{"admin"}, Summary: "Change the log level while the server runs", OperationID: "setLogLevel",
+		RequestBody: jsonBody(logLevel),
+		Responses:   responses(http.StatusOK, jsonResponse("The new level", logLevel), http.StatusBadRequest),
+	})
+
+	for _, v := range versions {
+		doc.Mount(v.prefix, api, v.operationSuffix, v.deprecated())
+		if v.shapeOperation == nil {
+			continue
+		}
+		for path := range api.Paths {
+			for _, op := range *doc.Paths[v.prefix+path] {
+				v.shapeOperation(op)
+			}
+		}
+	}
+
+	doc.Components.SecuritySchemes["metricsToken"] = &openapi.SecurityScheme{Type: "http", Scheme: "bearer", Description: "The METRICS_TOKEN of the server"}
+	doc.Add("GET /metrics", &openapi.Operation{
+		Tags: []string{"admin"}, Summary: "Prometheus metrics", OperationID: "getMetrics",
+		Description: "Only served when the server has a METRICS_TOKEN. The metrics can also be served by a separate listener on METRICS_ADDR.",
+		Security:    []openapi.Requirement{{"metricsToken": {}}},
+		Responses: map[string]*openapi.Response{
+			"200": {
+				Description: "Metrics in the Prometheus text format",
+				Content:     map[string]*openapi.MediaType{"text/plain": {Schema: &openapi.Schema{Type: "string"}}},
+			},
+			"401": errorResponse(http.StatusUnauthorized),
+			"404": textResponse("The server has no METRICS_TOKEN"),
+		},
+	})
+
+	healthStatus := openapi.Object(map[string]*openapi.Schema{
+		"status": {Type: "string", Enum: []any{"ok", "unavailable"}},
+		"checks": {Type: "object", AdditionalProperties: &openapi.Schema{Type: "string", Enum: []any{"ok", "unavailable", "shutting down"}}},
+	})
+	healthStatus.Required = []string{"status"}
+	doc.Add("GET /healthz", &openapi.Operation{
+		Tags: []string{"health"}, Summary: "Liveness probe", OperationID: "getHealthz", Public: true,
+		Description: "Succeeds while the process serves requests; no dependency is checked.",
+		Responses:   map[string]*openapi.Response{"200": jsonResponse("The server is alive", healthStatus)},
+	})
+	doc.Add("GET /readyz", &openapi.Operation{
+		Tags: []string{"health"}, Summary: "Readiness probe", OperationID: "getReadyz", Public: true,
+		Description: "Checks the database and the mail server. Fails once the server starts shutting down.",
+		Responses: map[string]*openapi.Response{
+			"200": jsonResponse("The server can take traffic", healthStatus),
+			"503": jsonResponse("A dependency is unavailable or the server is shutting down", healthStatus),
+		},
+	})
+
+	doc.Add("GET /openapi.json", &openapi.Operation{
+		Tags: []string{"docs"}, Summary: "This OpenAPI document", OperationID: "getOpenAPI", Public: true,
+		Responses: map[string]*openapi.Response{"200": jsonResponse("OpenAPI 3.1 document", &openapi.Schema{Type: "object"})},
+	})
+	doc.Add("GET /docs/", &openapi.Operation{
+		Tags: []string{"docs"}, Summary: "Interactive documentation", OperationID: "getDocs", Public: true,
+		Responses: map[string]*openapi.Response{"200": {
+			Description: "Documentation page",
+			Content:     map[string]*openapi.MediaType{"text/html": {Schema: &openapi.Schema{Type: "string"}}},
+		}},
+	})
+
+	return doc
+}
+
+// resource describes the CRUD routes shared by students, teachers and execs
+type resource struct {
+	name, plural, schema string
+	filters              []string
+	paginated            bool
+	include              string
+	put                  bool
+}
+
+func documentResource(doc *openapi.Document, res resource) {
+	tags := []string{res.plural}
+	item := openapi.Ref(res.schema)
+
+	list := []*openapi.Parameter{
+		{Name: "sortBy", In: "query", Description: `Sort order as "field:asc" or "field:desc", repeatable`, Schema: openapi.ArrayOf(&openapi.Schema{Type: "string"})},
+		listParameter("fields", "Only return these fields"),
+	}
+	for _, filter := range res.filters {
+		list = append(list, &openapi.Parameter{Name: filter, In: "query", Description: "Filter by " + filter, Schema: &openapi.Schema{Type: "string"}})
+	}
+	get := []*openapi.Parameter{idParameter, listParameter("fields", "Only return these fields")}
+	if res.paginated {
+		list = append(list,
+			&openapi.Parameter{Name: "limit", In: "query", Description: "Page size", Schema: &openapi.Schema{Type: "integer"}},
+			&openapi.Parameter{Name: "page", In: "query", Description: "Page number, starting at 1", Schema: &openapi.Schema{Type: "integer"}},
+		)
+	}
+	if res.include != "" {
+		list = append(list, listParameter("include", "Embed related resources: "+res.include))
+		get = append(get, listParameter("include", "Embed related resources: "+res.include))
+	}
+
+	doc.Add("GET /"+res.plural, &openapi.Operation{
+		Tags: tags, Summary: "List " + res.plural, OperationID: "list" + res.schema + "s",
+		Parameters: list,
+		Responses:  responses(http.StatusOK, listResponse(item, res.paginated), http.StatusBadRequest),
+	})
+	doc.Add("POST /"+res.plural, &openapi.Operation{
+		Tags: tags, Summary: "Create " + res.plural, OperationID: "add" + res.schema + "s",
+		Parameters:  []*openapi.Parameter{idempotencyKeyParameter},
+		RequestBody: jsonBody(openapi.ArrayOf(item)),
+		Responses:   responses(http.StatusOK, jsonResponse("The created "+res.plural, openapi.ArrayOf(item)), http.StatusBadRequest, http.StatusConflict),
+	})
+	doc.Add("PATCH /"+res.plural, &openapi.Operation{
+		Tags: tags, Summary: "Update several " + res.plural, OperationID: "patch" + res.schema + "s",
+		Description: "Takes a list of partial objects with their id, or with application/merge-patch+json and application/json-patch+json a list of {id, patch} documents.",
+		RequestBody: patchBody(openapi.ArrayOf(&openapi.Schema{Type: "object", Required: []string{"id"}})),
+		Responses:   responses(http.StatusOK, jsonResponse("The updated "+res.plural, openapi.ArrayOf(item)), http.StatusBadRequest, http.StatusNotFound),
+	})
+	doc.Add("DELETE /"+res.plural, &openapi.Operation{
+		Tags: tags, Summary: "Delete several " + res.plural, OperationID: "delete" + res.schema + "s",
+		RequestBody: jsonBody(openapi.ArrayOf(&openapi.Schema{Type: "integer"})),
+		Responses: responses(http.StatusOK, jsonResponse("The deleted ids", openapi.Object(map[string]*openapi.Schema{
+			"status":      {Type: "string"},
+			"message":     {Type: "string"},
+			"deleted_ids": openapi.ArrayOf(&openapi.Schema{Type: "integer"}),
+		})), http.StatusBadRequest, http.StatusNotFound),
+	})
+
+	doc.Add("GET /"+res.plural+"/{id}", &openapi.Operation{
+		Tags: tags, Summary: "Get a " + res.name, OperationID: "get" + res.schema,
+		Parameters: get,
+		Responses:  responses(http.StatusOK, jsonResponse("The "+res.name, item), http.StatusBadRequest, http.StatusNotFound),
+	})
+	if res.put {
+		doc.Add("PUT /"+res.plural+"/{id}", &openapi.Operation{
+			Tags: tags, Summary: "Replace a " + res.name, OperationID: "update" + res.schema,
+			Parameters:  []*openapi.Parameter{idParameter},
+			RequestBody: jsonBody(item),
+			Responses:   responses(http.StatusOK, jsonResponse("The updated "+res.name, item), http.StatusBadRequest, http.StatusNotFound),
+		})
+	}
+	doc.Add("PATCH /"+res.plural+"/{id}", &openapi.Operation{
+		Tags: tags, Summary: "Update a " + res.name, OperationID: "patch" + res.schema,
+		Description: "Takes a partial object, a JSON merge patch (application/merge-patch+json) or a JSON patch (application/json-patch+json).",
+		Parameters:  []*openapi.Parameter{idParameter},
+		RequestBody: patchBody(&openapi.Schema{Type: "object"}),
+		Responses:   responses(http.StatusOK, jsonResponse("The updated "+res.name, item), http.StatusBadRequest, http.StatusNotFound, http.StatusConflict),
+	})
+	doc.Add("DELETE /"+res.plural+"/{id}", &openapi.Operation{
+		Tags: tags, Summary: "Delete a " + res.name, OperationID: "delete" + res.schema,
+		Parameters: []*openapi.Parameter{idParameter},
+		Responses: responses(http.StatusOK, jsonResponse("The deleted id", openapi.Object(map[string]*openapi.Schema{
+			"status":  {Type: "string"},
+			"message": {Type: "string"},
+			"id":      {Type: "integer"},
+		})), http.StatusBadRequest, http.StatusNotFound),
+	})
+}
+
+func documentExecAccountRoutes(doc *openapi.Document) {
+	tags := []string{"execs"}
+	message := jsonResponse("Done", openapi.Object(map[string]*openapi.Schema{
+		"status":  {Type: "string"},
+		"message": {Type: "string"},
+	}))
+
+	doc.Add("POST /execs/{id}/update-password", &openapi.Operation{
+		Tags: tags, Summary: "Change the password of an exec", OperationID: "updateExecPassword",
+		Parameters: []*openapi.Parameter{idParameter},
+		RequestBody: jsonBody(openapi.Object(map[string]*openapi.Schema{
+			"oldpassword": {Type: "string"},
+			"newpassword": {Type: "string"},
+		})),
+		Responses: responses(http.StatusOK, message, http.StatusBadRequest, http.StatusNotFound),
+	})
+	sessionCookies := map[string]*openapi.Header{"Set-Cookie": {Description: "The Bearer access token cookie and the Refresh token cookie", Schema: &openapi.Schema{Type: "string"}}}
+	sessionSchema := openapi.Object(map[string]*openapi.Schema{
+		"status":        {Type: "string"},
+		"token":         {Type: "string"},
+		"refresh_token": {Type: "string"},
+	})
+	session := &openapi.Response{
+		Description: "The access token and the refresh token renewing it",
+		Headers:     sessionCookies,
+		Content:     map[string]*openapi.MediaType{"application/json": {Schema: sessionSchema}},
+	}
+	challenge := openapi.Object(map[string]*openapi.Schema{
+		"status":    {Type: "string", Enum: []any{"mfa_required", "mfa_enrollment_required"}},
+		"mfa_token": {Type: "string"},
+	})
+	code := jsonBody(openapi.Object(map[string]*openapi.Schema{
+		"code": {Type: "string", Description: "A TOTP code of the authenticator app, or a recovery code"},
+	}))
+	enrollment := jsonResponse("The TOTP secret, to add to an authenticator app and confirm with a code", openapi.Object(map[string]*openapi.Schema{
+		"status":      {Type: "string"},
+		"secret":      {Type: "string"},
+		"otpauth_uri": {Type: "string", Format: "uri"},
+	}))
+	recoveryCodes := jsonResponse("The recovery codes, each usable once instead of a TOTP code and shown only in this response", openapi.Object(map[string]*openapi.Schema{
+		"status":         {Type: "string"},
+		"recovery_codes": openapi.ArrayOf(&openapi.Schema{Type: "string"}),
+	}))
+	refreshToken := &openapi.RequestBody{Description: "The refresh token, read from the Refresh cookie when there is no body", Content: map[string]*openapi.MediaType{"application/json": {Schema: openapi.Object(map[string]*openapi.Schema{
+		"refresh_token": {Type: "string"},
+	})}}}
+
+	doc.Add("POST /execs/login", &openapi.Operation{
+		Tags: tags, Summary: "Log in and receive the session cookies", OperationID: "loginExec", Public: true,
+		Description: "An exec with a second factor, or whose role requires one, receives an MFA challenge token instead, " +
+			"to exchange for the session with POST /execs/login/mfa.",
+		RequestBody: jsonBody(openapi.Object(map[string]*openapi.Schema{
+			"username": {Type: "string"},
+			"password": {Type: "string"},
+		})),
+		Responses: map[string]*openapi.Response{
+			"200": {
+				Description: "The session, or the MFA challenge",
+				Headers:     sessionCookies,
+				Content:     map[string]*openapi.MediaType{"application/json": {Schema: &openapi.Schema{OneOf: []*openapi.Schema{sessionSchema, challenge}}}},
+			},
+			"400": errorResponse(http.StatusBadRequest),
+			"401": textResponse("Invalid username or password, or the account is inactive"),
+			"429": textResponse("Too many attempts, retry later"),
+		},
+	})
+	doc.Add("POST /execs/login/mfa", &openapi.Operation{
+		Tags: tags, Summary: "Complete a login with a TOTP code or a recovery code", OperationID: "loginExecMFA", Public: true,
+		Description: "The first code of an exec enrolling at login confirms the enrollment, and the recovery codes come along with the session. " +
+			"An exec may try 5 codes within 15 minutes: the challenge is revoked after the last one.",
+		RequestBody: jsonBody(openapi.Object(map[string]*openapi.Schema{
+			"mfa_token": {Type: "string"},
+			"code":      {Type: "string", Description: "A TOTP code of the authenticator app, or a recovery code"},
+		})),
+		Responses: map[string]*openapi.Response{
+			"200": jsonResponse("The session", openapi.Object(map[string]*openapi.Schema{
+				"status":         {Type: "string"},
+				"token":          {Type: "string"},
+				"refresh_token":  {Type: "string"},
+				"recovery_codes": openapi.ArrayOf(&openapi.Schema{Type: "string"}),
+			})),
+			"400": errorResponse(http.StatusBadRequest),
+			"401": textResponse("Invalid, expired or used MFA token, or invalid code"),
+			"409": textResponse("The exec has to enroll with POST /execs/login/mfa/enroll first"),
+			"429": textResponse("Too many attempts from the address, or too many invalid codes for the exec: the challenge is revoked, log in again later"),
+			"500": errorResponse(http.StatusInternalServerError),
+		},
+	})
+	doc.Add("POST /execs/login/mfa/enroll", &openapi.Operation{
+		Tags: tags, Summary: "Enroll a second factor while logging in, when the role requires one", OperationID: "enrollExecMFAAtLogin", Public: true,
+		RequestBody: jsonBody(openapi.Object(map[string]*openapi.Schema{"mfa_token": {Type: "string"}})),
+		Responses: map[string]*openapi.Response{
+			"200": enrollment,
+			"400": errorResponse(http.StatusBadRequest),
+			"401": textResponse("Invalid, expired or used MFA token"),
+			"409": textResponse("The second factor is already enabled"),
+			"429": textResponse("Too many attempts, retry later"),
+			"500": errorResponse(http.StatusInternalServerError),
+		},
+	})
+	doc.Add("POST /execs/{id}/mfa/enroll", &openapi.Operation{
+		Tags: tags, Summary: "Start the enrollment of a TOTP second factor", OperationID: "enrollExecMFA",
+		Parameters: []*openapi.Parameter{idParameter},
+		Responses:  responses(http.StatusOK, enrollment, http.StatusBadRequest, http.StatusNotFound, http.StatusConflict),
+	})
+	doc.Add("POST /execs/{id}/mfa/confirm", &openapi.Operation{
+		Tags: tags, Summary: "Enable the second factor being enrolled with a TOTP code", OperationID: "confirmExecMFA",
+		Description: mfaAttemptsDescription,
+		Parameters:  []*openapi.Parameter{idParameter},
+		RequestBody: code,
+		Responses:   responses(http.StatusOK, recoveryCodes, http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusTooManyRequests),
+	})
+	doc.Add("POST /execs/{id}/mfa/recovery-codes", &openapi.Operation{
+		Tags: tags, Summary: "Replace the recovery codes", OperationID: "regenerateExecRecoveryCodes",
+		Description: mfaAttemptsDescription,
+		Parameters:  []*openapi.Parameter{idParameter},
+		RequestBody: code,
+		Responses:   responses(http.StatusOK, recoveryCodes, http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusTooManyRequests),
+	})
+	doc.Add("POST /execs/{id}/mfa/disable", &openapi.Operation{
+		Tags: tags, Summary: "Disable the second factor, unless the role requires one", OperationID: "disableExecMFA",
+		Description: mfaAttemptsDescription,
+		Parameters:  []*openapi.Parameter{idParameter},
+		RequestBody: code,
+		Responses:   responses(http.StatusOK, message, http.StatusBadRequest, http.StatusNotFound, http.StatusConflict, http.StatusTooManyRequests),
+	})
+	doc.Add("DELETE /execs/{id}/mfa", &openapi.Operation{
+		Tags: tags, Summary: "Reset the second factor of an exec who lost it", OperationID: "resetExecMFA",
+		Description: "When the role of the exec requires a second factor, they enroll again at their next login.",
+		Parameters:  []*openapi.Parameter{idParameter},
+		Responses:   responses(http.StatusOK, message, http.StatusBadRequest, http.StatusNotFound),
+	})
+	doc.Add("POST /execs/token/refresh", &openapi.Operation{
+		Tags: tags, Summary: "Exchange a refresh token for a new access token and refresh token", OperationID: "refreshExecToken", Public: true,
+		RequestBody: refreshToken,
+		Responses: map[string]*openapi.Response{
+			"200": session,
+			"400": errorResponse(http.StatusBadRequest),
+			"401": textResponse("Missing, invalid, expired or reused refresh token; a reused token revokes its whole session"),
+			"500": errorResponse(http.StatusInternalServerError),
+		},
+	})
+	doc.Add("POST /execs/logout", &openapi.Operation{
+		Tags: tags, Summary: "Log out by revoking the session tokens and clearing the session cookies", OperationID: "logoutExec", Public: true,
+		RequestBody: refreshToken,
+		Responses: map[string]*openapi.Response{
+			"200": message,
+			"400": errorResponse(http.StatusBadRequest),
+			"500": errorResponse(http.StatusInternalServerError),
+		},
+	})
+	doc.Add("POST /execs/logout-all", &openapi.Operation{
+		Tags: tags, Summary: "Log out of every session, revoking all the tokens of the exec", OperationID: "logoutAllExec",
+		Responses: responses(http.StatusOK, message),
+	})
+	doc.Add("POST /execs/forgot-password", &openapi.Operation{
+		Tags: tags, Summary: "Email a password reset link", OperationID: "forgotExecPassword", Public: true,
+		RequestBody: jsonBody(openapi.Object(map[string]*openapi.Schema{"email": {Type: "string", Format: "email"}})),
+		Responses: map[string]*openapi.Response{
+			"200": message,
+			"400": errorResponse(http.StatusBadRequest),
+			"404": errorResponse(http.StatusNotFound),
+			"429": textResponse("Too many requests, retry later"),
+			"500": errorResponse(http.StatusInternalServerError),
+		},
+	})
+	doc.Add("POST /execs/reset-password/reset/{token}", &openapi.Operation{
+		Tags: tags, Summary: "Set a new password with the token from the reset email", OperationID: "resetExecPassword", Public: true,
+		Description: "The token can be used once. The sessions of the exec end, as with any change of password.",
+		Parameters:  []*openapi.Parameter{{Name: "token", In: "path", Required: true, Schema: &openapi.Schema{Type: "string"}}},
+		RequestBody: jsonBody(openapi.Object(map[string]*openapi.Schema{"newpassword": {Type: "string", Format: "password"}})),
+		Responses: map[string]*openapi.Response{
+			"200": message,
+			"400": errorResponse(http.StatusBadRequest),
+			"404": textResponse("Invalid, expired or already used token"),
+			"429": textResponse("Too many requests, retry later"),
+			"500": errorResponse(http.StatusInternalServerError),
+		},
+	})
+}
+
+func documentAPIKeyRoutes(doc *openapi.Document) {
+	tags := []string{"api keys"}
+	key := openapi.Ref("APIKey")
+	keyID := &openapi.Parameter{Name: "keyId", In: "path", Required: true, Schema: &openapi.Schema{Type: "integer"}}
+
+	doc.Add("GET /execs/{id}/api-keys", &openapi.Operation{
+		Tags: tags, Summary: "List the API keys of an exec, revoked and expired ones included", OperationID: "listAPIKeys",
+		Parameters: []*openapi.Parameter{idParameter},
+		Responses:  responses(http.StatusOK, listResponse(key, false), http.StatusBadRequest, http.StatusNotFound),
+	})
+	doc.Add("POST /execs/{id}/api-keys", &openapi.Operation{
+		Tags: tags, Summary: "Create an API key acting as an exec within its scopes", OperationID: "addAPIKey",
+		Description: "Scopes name an action on a resource, such as students:read, and are checked on top of the role of the exec. " +
+			"The key is returned only in this response; send it in the X-API-Key header or as Authorization: Bearer.",
+		Parameters: []*openapi.Parameter{idParameter},
+		RequestBody: jsonBody(openapi.Object(map[string]*openapi.Schema{
+			"name":       {Type: "string"},
+			"scopes":     openapi.ArrayOf(&openapi.Schema{Type: "string"}),
+			"expires_at": {Type: "string", Format: "date-time"},
+		})),
+		Responses: responses(http.StatusCreated, jsonResponse("The API key, with the key itself", openapi.Ref("CreatedAPIKey")), http.StatusBadRequest, http.StatusNotFound),
+	})
+	doc.Add("DELETE /execs/{id}/api-keys/{keyId}", &openapi.Operation{
+		Tags: tags, Summary: "Revoke an API key, refused from the next request made with it", OperationID: "revokeAPIKey",
+		Parameters: []*openapi.Parameter{idParameter, keyID},
+		Responses:  responses(http.StatusOK, jsonResponse("The revoked API key", key), http.StatusBadRequest, http.StatusNotFound),
+	})
+}
+
+func documentWebhookRoutes(doc *openapi.Document) {
+	tags := []string{"webhooks"}
+	subscription := openapi.Ref("WebhookSubscription")
+	deliveryID := &openapi.Parameter{Name: "deliveryId", In: "path", Required: true, Schema: &openapi.Schema{Type: "integer", Format: "int64"}}
+
+	doc.Add("GET /webhooks", &openapi.Operation{
+		Tags: tags, Summary: "List webhook subscriptions", OperationID: "listWebhooks",
+		Responses: responses(http.StatusOK, listResponse(subscription, false)),
+	})
+	doc.Add("POST /webhooks", &openapi.Operation{
+		Tags: tags, Summary: "Subscribe to change events", OperationID: "addWebhook",
+		Description: "The generated secret is returned only in this response, so it is never replayed for an Idempotency-Key. Deliveries are signed with X-Webhook-Signature: sha256=HMAC(secret, timestamp + \".\" + body).",
+		RequestBody: jsonBody(subscription),
+		Responses:   responses(http.StatusCreated, jsonResponse("The subscription, with its secret", subscription), http.StatusBadRequest),
+	})
+	doc.Add("GET /webhooks/{id}", &openapi.Operation{
+		Tags: tags, Summary: "Get a webhook subscription", OperationID: "getWebhook",
+		Parameters: []*openapi.Parameter{idParameter},
+		Responses:  responses(http.StatusOK, jsonResponse("The subscription", subscription), http.StatusBadRequest, http.StatusNotFound),
+	})
+	doc.Add("PATCH /webhooks/{id}", &openapi.Operation{
+		Tags: tags, Summary: "Update a webhook subscription", OperationID: "patchWebhook",
+		Parameters:  []*openapi.Parameter{idParameter},
+		RequestBody: patchBody(&openapi.Schema{Type: "object"}),
+		Responses:   responses(http.StatusOK, jsonResponse("The updated subscription", subscription), http.StatusBadRequest, http.StatusNotFound),
+	})
+	doc.Add("DELETE /webhooks/{id}", &openapi.Operation{
+		Tags: tags, Summary: "Delete a webhook subscription", OperationID: "deleteWebhook",
+		Parameters: []*openapi.Parameter{idParameter},
+		Responses: responses(http.StatusOK, jsonResponse("The deleted id", openapi.Object(map[string]*openapi.Schema{
+			"status":  {Type: "string"},
+			"message": {Type: "string"},
+			"id":      {Type: "integer"},
+		})), http.StatusBadRequest, http.StatusNotFound),
+	})
+	doc.Add("GET /webhooks/{id}/deliveries", &openapi.Operation{
+		Tags: tags, Summary: "List the latest deliveries of a subscription", OperationID: "listWebhookDeliveries",
+		Parameters: []*openapi.Parameter{
+			idParameter,
+			{Name: "limit", In: "query", Description: "Between 1 and 500, 50 by default", Schema: &openapi.Schema{Type: "integer"}},
+		},
+		Responses: responses(http.StatusOK, listResponse(openapi.Ref("WebhookDelivery"), false), http.StatusBadRequest, http.StatusNotFound),
+	})
+	doc.Add("GET /webhooks/{id}/deliveries/{deliveryId}/attempts", &openapi.Operation{
+		Tags: tags, Summary: "List the attempts of a delivery", OperationID: "listWebhookDeliveryAttempts",
+		Parameters: []*openapi.Parameter{idParameter, deliveryID},
+		Responses:  responses(http.StatusOK, listResponse(openapi.Ref("WebhookDeliveryAttempt"), false), http.StatusBadRequest, http.StatusNotFound),
+	})
+	doc.Add("POST /webhooks/{id}/deliveries/{deliveryId}/retry", &openapi.Operation{
+		Tags: tags, Summary: "Retry a dead-lettered delivery", OperationID: "retryWebhookDelivery",
+		Parameters: []*openapi.Parameter{idParameter, deliveryID},
+		Responses: responses(http.StatusAccepted, jsonResponse("Queued for retry", openapi.Object(map[string]*openapi.Schema{
+			"status":  {Type: "string"},
+			"message": {Type: "string"},
+		})), http.StatusBadRequest, http.StatusNotFound),
+	})
+}
+
+// mfaAttemptsDescription documents the limit of the codes an exec may try
+const mfaAttemptsDescription = "An exec may try 5 codes within 15 minutes, counted along with those given at login."
+
+var idParameter = &openapi.Parameter{Name: "id", In: "path", Required: true, Schema: &openapi.Schema{Type: "integer"}}
+
+var idempotencyKeyParameter = &openapi.Parameter{
+	Name: "Idempotency-Key", In: "header",
+	Description: "Retrying with the same key replays the first response instead of repeating the request",
+	Schema:      &openapi.Schema{Type: "string"},
+}
+
+// listParameter is a comma separated list in the query
+func listParameter(name, description string) *openapi.Parameter {
+	explode := false
+	return &openapi.Parameter{Name: name, In: "query", Description: description, Explode: &explode, Schema: openapi.ArrayOf(&openapi.Schema{Type: "string"})}
+}
+
+func jsonBody(schema *openapi.Schema) *openapi.RequestBody {
+	return &openapi.RequestBody{Required: true, Content: map[string]*openapi.MediaType{"application/json": {Schema: schema}}}
+}
+
+func patchBody(schema *openapi.Schema) *openapi.RequestBody {
+	body := jsonBody(schema)
+	body.Content[utility.MergePatchContentType] = &openapi.MediaType{Schema: schema}
+	body.Content[utility.JSONPatchContentType] = &openapi.MediaType{Schema: openapi.ArrayOf(&openapi.Schema{Type: "object"})}
+	return body
+}
+
+func jsonResponse(description string, schema *openapi.Schema) *openapi.Response {
+	return &openapi.Response{Description: description, Content: map[string]*openapi.MediaType{"application/json": {Schema: schema}}}
+}
+
+func textResponse(description string) *openapi.Response {
+	return &openapi.Response{Description: description, Content: map[string]*openapi.MediaType{"text/plain": {Schema: &openapi.Schema{Type: "string"}}}}
+}
+
+// errorResponse is the plain text error written by http.Error; a 400 may also be a list of validation errors
+func errorResponse(status int) *openapi.Response {
+	response := textResponse(http.StatusText(status))
+	switch status {
+	case http.StatusBadRequest:
+		response.Content["application/json"] = &openapi.MediaType{Schema: openapi.Ref("ValidationError")}
+	case http.StatusForbidden:
+		// The role of the principal may not take the action
+		response = &openapi.Response{Description: http.StatusText(status), Content: map[string]*openapi.MediaType{utility.ProblemContentType: {Schema: openapi.Ref("Problem")}}}
+	}
+	return response
+}
+
+// responses is the success response plus the given errors, a 401, a 403 and a 500
+func responses(status int, success *openapi.Response, errors ...int) map[string]*openapi.Response {
+	all := map[string]*openapi.Response{strconv.Itoa(status): success}
+	for _, errorStatus := range append(errors, http.StatusUnauthorized, http.StatusForbidden, http.StatusInternalServerError) {
+		all[strconv.Itoa(errorStatus)] = errorResponse(errorStatus)
+	}
+	return all
+}
+
+func listResponse(item *openapi.Schema, paginated bool) *openapi.Response {
+	properties := map[string]*openapi.Schema{
+		"status": {Type: "string"},
+		"count":  {Type: "integer"},
+		"data":   openapi.ArrayOf(item),
+	}
+	if paginated {
+		properties["count"].Description = "Total number of matches across all pages"
+		properties["page"] = &openapi.Schema{Type: "integer"}
+		properties["limit"] = &openapi.Schema{Type: "integer"}
+	}
+	return jsonResponse("The matching items", openapi.Object(properties))
+}
+
+func graphQLResponse() *openapi.Schema {
+	graphQLError := openapi.Object(map[string]*openapi.Schema{
+		"message":    {Type: "string"},
+		"path":       openapi.ArrayOf(&openapi.Schema{Type: "string"}),
+		"extensions": {Type: "object"},
+	})
+	graphQLError.Required = []string{"message"}
+	response := openapi.Object(map[string]*openapi.Schema{
+		"data":   {Type: []string{"object", "null"}},
+		"errors": openapi.ArrayOf(graphQLError),
+	})
+	response.Required = nil
+	return response
+}
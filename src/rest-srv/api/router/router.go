@@ -1,15 +1,230 @@
 package router
 
 import (
+	"fmt"
 	"net/http"
+	"rest-srv/api/handlers"
+	"rest-srv/api/middlewares"
+	"rest-srv/authz"
+	"rest-srv/events"
+	"rest-srv/openapi"
+	"rest-srv/tracing"
+	"rest-srv/utility"
+	"slices"
+	"strings"
 )
 
-func MainRouter() *http.ServeMux {
-	mux := http.NewServeMux()
+// Exclusion names a middleware of the server that a group of routes is served without
+type Exclusion string
 
-	registerStudentRoutes(mux)
-	registerTeacherRoutes(mux)
-	registerExecsRoutes(mux)
+const (
+	// ExcludeAuth serves the routes without a session, e.g. to log in
+	ExcludeAuth Exclusion = "auth"
+	// ExcludeCORS serves the routes to requests without an allowed Origin
+	ExcludeCORS Exclusion = "cors"
+	// ExcludeRateLimit serves the routes however often they are called
+	ExcludeRateLimit Exclusion = "rate_limit"
+	// ExcludeIdempotency serves the routes without storing their responses to replay them
+	// for an Idempotency-Key, as those answering with tokens or secrets
+	ExcludeIdempotency Exclusion = "idempotency"
+	// ExcludeBatch serves the routes only on their own, never as an operation of a batch
+	ExcludeBatch Exclusion = "batch"
+)
+
+// Router is the ServeMux of every route, with the middlewares each route is excluded from
+type Router struct {
+	*http.ServeMux
+	excluded map[string][]Exclusion
+}
+
+// Excludes returns whether the route serving a request is excluded from the middleware.
+// Routes are matched by their pattern, so a path merely starting like an excluded route is
+// not excluded.
+func (rt *Router) Excludes(exclusion Exclusion) func(*http.Request) bool {
+	return excludes(rt.ServeMux, rt.excluded, exclusion)
+}
+
+func excludes(mux *http.ServeMux, excluded map[string][]Exclusion, exclusion Exclusion) func(*http.Request) bool {
+	return func(r *http.Request) bool {
+		_, pattern := mux.Handler(r)
+		return slices.Contains(excluded[pattern], exclusion)
+	}
+}
+
+// registry records the pattern of every registered route, so the OpenAPI document can be
+// checked against them, the exclusions of the group it was registered in, the permission it
+// requires, and the routes needing a session that have no permission
+type registry struct {
+	*http.ServeMux
+	patterns     []string
+	excluded     map[string][]Exclusion
+	permissions  map[string]string
+	unauthorized []string
+}
+
+// The permissions of routes that the permission matrix does not authorize
+const (
+	permissionNone      = "none"
+	permissionOwn       = "own"
+	permissionDelegated = "delegated"
+)
+
+// routes is a group of routes sharing a path prefix, the middlewares they are excluded from
+// and a stack of middlewares of their own. Groups nest: a group of a group adds to both.
+type routes struct {
+	*registry
+	prefix     string
+	exclusions []Exclusion
+	stack      []utility.Middleware
+
+	// The routes act on resource, authorized by the permission matrix for action, or for
+	// the action of their method when empty. Own routes also serve the principal's own
+	// record, and ownOnly routes only that. Delegating routes authorize each operation they
+	// run instead.
+	resource   string
+	action     authz.Action
+	own        bool
+	ownOnly    bool
+	delegating bool
+}
+
+// group returns the routes under prefix, relative to those of r, that are also excluded
+// from the given middlewares
+func (r *routes) group(prefix string, exclusions ...Exclusion) *routes {
+	g := *r
+	g.prefix = r.prefix + prefix
+	g.exclusions = append(slices.Clone(r.exclusions), exclusions...)
+	g.stack = slices.Clone(r.stack)
+	return &g
+}
+
+// on returns the routes of r acting on resource of the permission matrix
+func (r *routes) on(resource string) *routes {
+	g := r.group("")
+	g.resource = resource
+	return g
+}
+
+// as returns the routes of r taking action, whatever their method
+func (r *routes) as(action authz.Action) *routes {
+	g := r.group("")
+	g.action = action
+	return g
+}
+
+// orSelf returns the routes of r that a principal may also use on their own record, such as
+// an exec reading their own record
+func (r *routes) orSelf() *routes {
+	g := r.group("")
+	g.own = true
+	return g
+}
+
+// selfOnly returns the routes of r that a principal may only use on their own record, such
+// as an exec changing their own password
+func (r *routes) selfOnly() *routes {
+	g := r.group("")
+	g.ownOnly = true
+	return g
+}
+
+// delegated returns the routes of r running other operations, each authorized on its own
+func (r *routes) delegated() *routes {
+	g := r.group("")
+	g.delegating = true
+	return g
+}
+
+// with returns the routes of r that also run through stack, inside the middlewares of r
+func (r *routes) with(stack ...utility.Middleware) *routes {
+	g := r.group("")
+	g.stack = append(g.stack, stack...)
+	return g
+}
+
+// HandleFunc registers handler for the pattern "METHOD /path" under the prefix of the group.
+// The handler runs through the stack of the group, the authorization of the route and then
+// through stack, the first middleware being the outermost, and is traced in a span of its own.
+func (r *routes) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request), stack ...utility.Middleware) {
+	method, path, _ := strings.Cut(pattern, " ")
+	pattern = method + " " + r.prefix + path
+	r.patterns = append(r.patterns, pattern)
+	r.excluded[pattern] = r.exclusions
+
+	var served http.Handler = http.HandlerFunc(handler)
+	all := slices.Clone(r.stack)
+	switch {
+	case slices.Contains(r.exclusions, ExcludeAuth):
+		r.permissions[pattern] = permissionNone
+	case r.delegating:
+		r.permissions[pattern] = permissionDelegated
+	case r.ownOnly:
+		r.permissions[pattern] = permissionOwn
+		all = append(all, middlewares.RequireOwn)
+	case authz.Known(r.resource):
+		action := r.action
+		if action == "" {
+			action = authz.ActionOf(method)
+		}
+		r.permissions[pattern] = authz.Scope(r.resource, action)
+		if r.own {
+			r.permissions[pattern] += " or " + permissionOwn
+		}
+		all = append(all, middlewares.Authorize(r.resource, action, r.own))
+	default:
+		r.unauthorized = append(r.unauthorized, pattern)
+	}
+	all = append(all, stack...)
+	for i := len(all) - 1; i >= 0; i-- {
+		served = all[i](served)
+	}
+	r.ServeMux.Handle(pattern, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx, span := tracing.Start(req.Context(), "handler "+pattern, tracing.KindInternal)
+		defer span.End()
+		served.ServeHTTP(w, req.WithContext(ctx))
+	}))
+}
+
+// MainRouter registers every route. It fails when a route needs a session but has no
+// permission; TestRoutesDocumented checks that every route has an entry in the OpenAPI document.
+// The API is registered once per version in versions; the probes, metrics and documentation
+// are not versioned.
+// GET /metrics is only served with metricsToken as bearer token; it is 404 when the token is empty.
+// GET /readyz reports the server unavailable once readiness is draining.
+// authLimit throttles logging in and requesting a password reset on top of the server-wide limit.
+// sanitize cleans up the operations of a batch, as the middlewares of the server clean up requests.
+func MainRouter(broker *events.Broker, metricsToken string, readiness *handlers.Readiness, authLimit, sanitize utility.Middleware) (*Router, error) {
+	mux := register(apiDocument(), broker, metricsToken, readiness, authLimit, sanitize)
+	if len(mux.unauthorized) > 0 {
+		return nil, fmt.Errorf("routes without a permission: %s", strings.Join(mux.unauthorized, ", "))
+	}
+	return &Router{ServeMux: mux.ServeMux, excluded: mux.excluded}, nil
+}
+
+// register registers every route in a new registry, documented in doc
+func register(doc *openapi.Document, broker *events.Broker, metricsToken string, readiness *handlers.Readiness, authLimit, sanitize utility.Middleware) *registry {
+	mux := &routes{registry: &registry{ServeMux: http.NewServeMux(), permissions: map[string]string{}, excluded: map[string][]Exclusion{
+		// A request no route serves gets the 404, or the 405 listing the allowed methods in
+		// Allow, rather than being asked to log in
+		"": {ExcludeAuth},
+	}}}
 
-	return mux
+	for _, v := range versions {
+		// Request bodies of the API are JSON, sanitized by the XSS middleware
+		api := mux.group(v.prefix).with(v.wrap, middlewares.RequireJSON)
+		registerStudentRoutes(api)
+		registerTeacherRoutes(api)
+		registerExecsRoutes(api, authLimit)
+		registerWebhookRoutes(api)
+		registerEventRoutes(api, broker)
+		registerGraphQLRoutes(api)
+		registerBatchRoutes(api, sanitize)
+		registerAdminRoutes(api)
+	}
+	// Scrapers and probes come from monitoring and orchestrators, without a session or an
+	// Origin, and must not be throttled
+	registerMetricsRoutes(mux.group("", ExcludeAuth, ExcludeCORS, ExcludeRateLimit), metricsToken)
+	registerHealthRoutes(mux.group("", ExcludeAuth, ExcludeCORS, ExcludeRateLimit), readiness)
+	registerDocsRoutes(mux.group("", ExcludeAuth), doc)
+	return mux.registry
 }
@@ -0,0 +1,216 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"rest-srv/api/handlers"
+	"rest-srv/events"
+	"rest-srv/utility"
+)
+
+func identity(next http.Handler) http.Handler { return next }
+
+func testRegistry() *registry {
+	return register(apiDocument(), (*events.Broker)(nil), "", &handlers.Readiness{}, identity, identity)
+}
+
+func TestRoutesDocumented(t *testing.T) {
+	doc := apiDocument()
+	reg := register(doc, (*events.Broker)(nil), "", &handlers.Readiness{}, identity, identity)
+	if err := doc.Check(reg.patterns); err != nil {
+		t.Error(err)
+	}
+}
+
+// apiPermissions is the permission each route of the API requires, by its pattern without
+// the version prefix
+var apiPermissions = map[string]string{
+	"GET /students":         "students:read",
+	"GET /students/":        "students:read",
+	"POST /students":        "students:create",
+	"POST /students/":       "students:create",
+	"PATCH /students":       "students:update",
+	"PATCH /students/":      "students:update",
+	"DELETE /students":      "students:delete",
+	"DELETE /students/":     "students:delete",
+	"GET /students/{id}":    "students:read",
+	"PUT /students/{id}":    "students:update",
+	"PATCH /students/{id}":  "students:update",
+	"DELETE /students/{id}": "students:delete",
+
+	"GET /teachers":                    "teachers:read",
+	"GET /teachers/":                   "teachers:read",
+	"POST /teachers":                   "teachers:create",
+	"POST /teachers/":                  "teachers:create",
+	"PATCH /teachers":                  "teachers:update",
+	"PATCH /teachers/":                 "teachers:update",
+	"DELETE /teachers":                 "teachers:delete",
+	"DELETE /teachers/":                "teachers:delete",
+	"GET /teachers/{id}":               "teachers:read",
+	"PUT /teachers/{id}":               "teachers:update",
+	"PATCH /teachers/{id}":             "teachers:update",
+	"DELETE /teachers/{id}":            "teachers:delete",
+	"GET /teachers/{id}/students":      "teachers:read",
+	"GET /teachers/{id}/studentsCount": "teachers:read",
+
+	"GET /execs":                               "execs:read",
+	"GET /execs/":                              "execs:read",
+	"POST /execs":                              "execs:create",
+	"POST /execs/":                             "execs:create",
+	"PATCH /execs":                             "execs:update",
+	"PATCH /execs/":                            "execs:update",
+	"DELETE /execs":                            "execs:delete",
+	"DELETE /execs/":                           "execs:delete",
+	"GET /execs/{id}":                          "execs:read or own",
+	"PATCH /execs/{id}":                        "execs:update",
+	"DELETE /execs/{id}":                       "execs:delete",
+	"POST /execs/{id}/update-password":         "own",
+	"POST /execs/logout-all":                   "own",
+	"POST /execs/{id}/mfa/enroll":              "own",
+	"POST /execs/{id}/mfa/confirm":             "own",
+	"POST /execs/{id}/mfa/recovery-codes":      "own",
+	"POST /execs/{id}/mfa/disable":             "own",
+	"DELETE /execs/{id}/mfa":                   "execs:delete",
+	"GET /execs/{id}/api-keys":                 "api_keys:read",
+	"POST /execs/{id}/api-keys":                "api_keys:create",
+	"DELETE /execs/{id}/api-keys/{keyId}":      "api_keys:delete",
+	"POST /execs/login":                        "none",
+	"POST /execs/login/mfa":                    "none",
+	"POST /execs/login/mfa/enroll":             "none",
+	"POST /execs/token/refresh":                "none",
+	"POST /execs/logout":                       "none",
+	"POST /execs/forgot-password":              "none",
+	"POST /execs/reset-password/reset/{token}": "none",
+
+	"GET /webhooks":                 "webhooks:read",
+	"POST /webhooks":                "webhooks:create",
+	"GET /webhooks/{id}":            "webhooks:read",
+	"PATCH /webhooks/{id}":          "webhooks:update",
+	"DELETE /webhooks/{id}":         "webhooks:delete",
+	"GET /webhooks/{id}/deliveries": "webhooks:read",
+	"GET /webhooks/{id}/deliveries/{deliveryId}/attempts": "webhooks:read",
+	"POST /webhooks/{id}/deliveries/{deliveryId}/retry":   "webhooks:update",
+
+	"GET /events/stream": "events:read",
+	"POST /graphql":      "delegated",
+	"POST /batch":        "delegated",
+
+	"GET /admin/log-level": "settings:read",
+	"PUT /admin/log-level": "settings:update",
+}
+
+// unversionedPermissions is the permission of the routes served outside the API versions
+var unversionedPermissions = map[string]string{
+	"GET /metrics":      "none",
+	"GET /healthz":      "none",
+	"GET /readyz":       "none",
+	"GET /openapi.json": "none",
+	"GET /docs/":        "none",
+}
+
+func TestRoutePermissions(t *testing.T) {
+	reg := testRegistry()
+
+	want := map[string]string{}
+	for pattern, permission := range unversionedPermissions {
+		want[pattern] = permission
+	}
+	for _, v := range versions {
+		for pattern, permission := range apiPermissions {
+			method, path, _ := strings.Cut(pattern, " ")
+			want[method+" "+v.prefix+path] = permission
+		}
+	}
+
+	for _, pattern := range reg.patterns {
+		permission, ok := want[pattern]
+		if !ok {
+			t.Errorf("%s is not listed in the test, requiring %q", pattern, reg.permissions[pattern])
+			continue
+		}
+		if reg.permissions[pattern] != permission {
+			t.Errorf("%s requires %q, want %q", pattern, reg.permissions[pattern], permission)
+		}
+	}
+	for pattern := range want {
+		if !slices.Contains(reg.patterns, pattern) {
+			t.Errorf("%s is not registered", pattern)
+		}
+	}
+	if len(reg.unauthorized) > 0 {
+		t.Errorf("routes without a permission: %v", reg.unauthorized)
+	}
+}
+
+var pathValue = regexp.MustCompile(`\{[^}]+\}`)
+
+// TestRoutesForbidden requests every route needing a permission with principals that may
+// take no action of the permission matrix: an API key without scopes, and an exec without a
+// role about the record of another exec
+func TestRoutesForbidden(t *testing.T) {
+	reg := testRegistry()
+	key := utility.Principal{Kind: utility.PrincipalAPIKey, ID: "1"}
+	user := utility.Principal{Kind: utility.PrincipalUser, ID: "1"}
+
+	for _, pattern := range reg.patterns {
+		switch reg.permissions[pattern] {
+		case permissionNone, permissionDelegated:
+			continue
+		}
+		method, path, _ := strings.Cut(pattern, " ")
+		principals := []utility.Principal{key}
+		// Without an {id}, a route of the exec's own record is about themselves
+		if strings.Contains(path, "{id}") {
+			principals = append(principals, user)
+		}
+		for _, principal := range principals {
+			req := httptest.NewRequest(method, pathValue.ReplaceAllString(path, "2"), nil)
+			req = req.WithContext(utility.WithPrincipal(req.Context(), principal))
+			w := httptest.NewRecorder()
+			reg.ServeHTTP(w, req)
+			if w.Code != http.StatusForbidden {
+				t.Errorf("%s as %s answered %d, want %d", pattern, principal.Kind, w.Code, http.StatusForbidden)
+			}
+		}
+	}
+}
+
+func TestExclusions(t *testing.T) {
+	rt, err := MainRouter((*events.Broker)(nil), "token", &handlers.Readiness{}, identity, identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unmonitored := []Exclusion{ExcludeAuth, ExcludeCORS, ExcludeRateLimit}
+	tests := []struct {
+		method   string
+		path     string
+		excluded []Exclusion
+	}{
+		{http.MethodGet, "/metrics", unmonitored},
+		{http.MethodGet, "/healthz", unmonitored},
+		{http.MethodGet, "/readyz", unmonitored},
+		{http.MethodGet, "/openapi.json", []Exclusion{ExcludeAuth}},
+		{http.MethodGet, "/v1/students", nil},
+		{http.MethodPost, "/v1/students", nil},
+		{http.MethodPost, "/v1/execs/login", []Exclusion{ExcludeAuth, ExcludeIdempotency}},
+		{http.MethodPost, "/v1/execs/token/refresh", []Exclusion{ExcludeAuth, ExcludeIdempotency}},
+		{http.MethodPost, "/v1/execs/2/mfa/confirm", []Exclusion{ExcludeIdempotency}},
+		{http.MethodPost, "/v1/execs/2/api-keys", []Exclusion{ExcludeIdempotency}},
+		{http.MethodPost, "/v1/webhooks", []Exclusion{ExcludeIdempotency}},
+		{http.MethodPost, "/v1/execs/2/update-password", nil},
+	}
+	all := []Exclusion{ExcludeAuth, ExcludeCORS, ExcludeRateLimit, ExcludeIdempotency}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		for _, exclusion := range all {
+			if got, want := rt.Excludes(exclusion)(req), slices.Contains(tt.excluded, exclusion); got != want {
+				t.Errorf("%s %s excluded from %s = %t, want %t", tt.method, tt.path, exclusion, got, want)
+			}
+		}
+	}
+}
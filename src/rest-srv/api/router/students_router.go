@@ -1,11 +1,11 @@
 package router
 
 import (
-	"net/http"
 	"rest-srv/api/handlers"
 )
 
-func registerStudentRoutes(mux *http.ServeMux) {
+func registerStudentRoutes(mux *routes) {
+	mux = mux.on("students")
 	mux.HandleFunc("GET /students", handlers.GetStudentsHandler)
 	mux.HandleFunc("GET /students/", handlers.GetStudentsHandler)
 	mux.HandleFunc("POST /students", handlers.AddStudentHandler)
@@ -1,11 +1,11 @@
 package router
 
 import (
-	"net/http"
 	"rest-srv/api/handlers"
 )
 
-func registerTeacherRoutes(mux *http.ServeMux) {
+func registerTeacherRoutes(mux *routes) {
+	mux = mux.on("teachers")
 	mux.HandleFunc("GET /teachers", handlers.GetTeachersHandler)
 	mux.HandleFunc("GET /teachers/", handlers.GetTeachersHandler)
 	mux.HandleFunc("POST /teachers", handlers.AddTeacherHandler)
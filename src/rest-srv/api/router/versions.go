@@ -0,0 +1,144 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"rest-srv/openapi"
+	"rest-srv/utility"
+	"strings"
+	"time"
+)
+
+// version is a version of the API, served under its prefix. Versions share the handlers;
+// a version whose responses differ from them shapes them on the way out.
+type version struct {
+	prefix string
+	// operationSuffix keeps the operation ids of the OpenAPI document unique across versions
+	operationSuffix string
+	// shape adapts the responses of the handlers to the version, nil when they already match,
+	// and shapeOperation documents how
+	shape          utility.Middleware
+	shapeOperation func(*openapi.Operation)
+
+	// An old version is deprecated from deprecation and removed at sunset, both zero while
+	// it is supported. Its responses point to the same route of successor.
+	deprecation time.Time
+	sunset      time.Time
+	successor   string
+}
+
+// versions are the versions of the API, the current one first
+var versions = []*version{
+	{prefix: "/v1"},
+	// The routes from before versioning stay as aliases of v1 until clients have moved, with
+	// the plain text errors they answered with before v1 had problem responses
+	{
+		prefix:          "",
+		operationSuffix: "Unversioned",
+		shape:           plainTextErrors,
+		shapeOperation:  documentPlainTextErrors,
+		deprecation:     time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC),
+		sunset:          time.Date(2027, time.April, 19, 0, 0, 0, 0, time.UTC),
+		successor:       "/v1",
+	},
+}
+
+func (v *version) deprecated() bool {
+	return !v.deprecation.IsZero()
+}
+
+// wrap is the middleware serving handler as a route of v: shaped, and with the Deprecation
+// (RFC 9745), Sunset (RFC 8594) and successor Link headers once v is deprecated
+func (v *version) wrap(handler http.Handler) http.Handler {
+	if v.shape != nil {
+		handler = v.shape(handler)
+	}
+	if !v.deprecated() {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", fmt.Sprintf("@%d", v.deprecation.Unix()))
+		w.Header().Set("Sunset", v.sunset.Format(http.TimeFormat))
+		successor := v.successor + strings.TrimPrefix(r.URL.Path, v.prefix)
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", successor))
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// plainTextErrors answers the problems of the handlers with their detail in plain text, as
+// http.Error writes it. Other responses, streamed ones included, pass through as they are.
+func plainTextErrors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pw := &problemWriter{ResponseWriter: w}
+		next.ServeHTTP(pw, r)
+		if !pw.problem {
+			return
+		}
+		var problem utility.Problem
+		json.Unmarshal(pw.body.Bytes(), &problem)
+		if problem.Detail == "" {
+			problem.Detail = http.StatusText(pw.status)
+		}
+		http.Error(w, problem.Detail, pw.status)
+	})
+}
+
+// problemWriter holds back a problem response until it is complete, and writes any other
+// response through
+type problemWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+	problem     bool
+	status      int
+	body        bytes.Buffer
+}
+
+func (w *problemWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if w.Header().Get("Content-Type") == utility.ProblemContentType {
+		w.problem = true
+		w.status = status
+		return
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *problemWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.problem {
+		return w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *problemWriter) Flush() {
+	if w.problem {
+		return
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *problemWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// documentPlainTextErrors documents the problem responses of op as the plain text errors
+// plainTextErrors turns them into
+func documentPlainTextErrors(op *openapi.Operation) {
+	op.Responses = maps.Clone(op.Responses)
+	for status, response := range op.Responses {
+		if _, ok := response.Content[utility.ProblemContentType]; ok {
+			op.Responses[status] = textResponse(response.Description)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"rest-srv/utility"
+)
+
+func TestVersionShaping(t *testing.T) {
+	reg := testRegistry()
+	forbidden := utility.Principal{Kind: utility.PrincipalUser, ID: "1"}
+
+	tests := []struct {
+		path        string
+		contentType string
+		body        string
+		deprecated  bool
+	}{
+		{"/v1/students", utility.ProblemContentType, `"detail":"your role may not read students"`, false},
+		{"/students", "text/plain; charset=utf-8", "your role may not read students\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req = req.WithContext(utility.WithPrincipal(req.Context(), forbidden))
+			w := httptest.NewRecorder()
+			reg.ServeHTTP(w, req)
+
+			if w.Code != http.StatusForbidden {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusForbidden)
+			}
+			if got := w.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.contentType)
+			}
+			if !strings.Contains(w.Body.String(), tt.body) {
+				t.Errorf("body = %q, want it to contain %q", w.Body.String(), tt.body)
+			}
+			if deprecated := w.Header().Get("Deprecation") != ""; deprecated != tt.deprecated {
+				t.Errorf("Deprecation header %q, want deprecated %t", w.Header().Get("Deprecation"), tt.deprecated)
+			}
+		})
+	}
+}
+
+func TestVersionShapingDocumented(t *testing.T) {
+	doc := apiDocument()
+	current := (*doc.Paths["/v1/students"])["get"].Responses["403"]
+	if _, ok := current.Content[utility.ProblemContentType]; !ok {
+		t.Errorf("GET /v1/students documents its 403 as %v, want a problem", current.Content)
+	}
+	legacy := (*doc.Paths["/students"])["get"].Responses["403"]
+	if _, ok := legacy.Content["text/plain"]; !ok || len(legacy.Content) != 1 {
+		t.Errorf("GET /students documents its 403 as %v, want plain text", legacy.Content)
+	}
+}
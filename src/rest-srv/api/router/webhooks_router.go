@@ -0,0 +1,21 @@
+package router
+
+import (
+	"rest-srv/api/handlers"
+	"rest-srv/authz"
+)
+
+func registerWebhookRoutes(mux *routes) {
+	mux = mux.on("webhooks")
+	mux.HandleFunc("GET /webhooks", handlers.GetWebhooksHandler)
+	// The response shows the signing secret, which is not stored for an Idempotency-Key, in
+	// the response of a batch either
+	mux.group("", ExcludeIdempotency, ExcludeBatch).HandleFunc("POST /webhooks", handlers.AddWebhookHandler)
+	mux.HandleFunc("GET /webhooks/{id}", handlers.GetWebhookHandler)
+	mux.HandleFunc("PATCH /webhooks/{id}", handlers.PatchWebhookHandler)
+	mux.HandleFunc("DELETE /webhooks/{id}", handlers.DeleteWebhookHandler)
+
+	mux.HandleFunc("GET /webhooks/{id}/deliveries", handlers.GetWebhookDeliveriesHandler)
+	mux.HandleFunc("GET /webhooks/{id}/deliveries/{deliveryId}/attempts", handlers.GetWebhookDeliveryAttemptsHandler)
+	mux.as(authz.Update).HandleFunc("POST /webhooks/{id}/deliveries/{deliveryId}/retry", handlers.RetryWebhookDeliveryHandler)
+}
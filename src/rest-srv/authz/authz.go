@@ -0,0 +1,94 @@
+// Package authz decides what a principal may do. The permission matrix grants each role its
+// actions on each resource; routes about the principal's own record also let through the
+// principal it concerns.
+package authz
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+
+	"rest-srv/utility"
+)
+
+type Action string
+
+const (
+	Read   Action = "read"
+	Create Action = "create"
+	Update Action = "update"
+	Delete Action = "delete"
+)
+
+var everything = []Action{Read, Create, Update, Delete}
+
+// matrix grants the actions of each role on each resource. A role missing from a resource
+// may not act on it at all.
+var matrix = map[string]map[string][]Action{
+	"students": {"admin": everything, "manager": everything, "exec": {Read, Create, Update}},
+	"teachers": {"admin": everything, "manager": everything, "exec": {Read}},
+	"execs":    {"admin": everything, "manager": {Read}},
+	"webhooks": {"admin": everything, "manager": {Read}},
+	"events":   {"admin": {Read}, "manager": {Read}, "exec": {Read}},
+	"settings": {"admin": everything, "manager": {Read}},
+	"api_keys": {"admin": everything},
+}
+
+// Known reports whether resource is part of the permission matrix
+func Known(resource string) bool {
+	_, ok := matrix[resource]
+	return ok
+}
+
+// Allowed reports whether the role of p may take action on resource. An API key is also
+// limited to its scopes.
+func Allowed(p utility.Principal, resource string, action Action) bool {
+	if !slices.Contains(matrix[resource][p.Role], action) {
+		return false
+	}
+	return p.Kind != utility.PrincipalAPIKey || slices.Contains(p.Scopes, Scope(resource, action))
+}
+
+// Scope is the scope of an API key allowing action on resource, such as "students:read"
+func Scope(resource string, action Action) string {
+	return resource + ":" + string(action)
+}
+
+// ValidScope reports whether scope names an action on a resource of the permission matrix.
+// No scope lets an API key manage API keys, which could then outlive or outscope it.
+func ValidScope(scope string) bool {
+	resource, action, ok := strings.Cut(scope, ":")
+	return ok && Known(resource) && resource != "api_keys" && slices.Contains(everything, Action(action))
+}
+
+// AllowedContext reports whether the principal of ctx may take action on resource
+func AllowedContext(ctx context.Context, resource string, action Action) bool {
+	p, ok := utility.PrincipalFromContext(ctx)
+	return ok && Allowed(p, resource, action)
+}
+
+// ActionOf returns the action of a request by its method
+func ActionOf(method string) Action {
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		return Read
+	case http.MethodPost:
+		return Create
+	case http.MethodDelete:
+		return Delete
+	}
+	return Update
+}
+
+// Roles returns the roles allowed to take action on resource, for documentation
+func Roles(resource string, action Action) []string {
+	var roles []string
+	for role, actions := range matrix[resource] {
+		if slices.Contains(actions, action) {
+			roles = append(roles, role)
+		}
+	}
+	slices.Sort(roles)
+	return roles
+}
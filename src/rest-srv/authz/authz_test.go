@@ -0,0 +1,125 @@
+package authz
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+
+	"rest-srv/utility"
+)
+
+func TestAllowed(t *testing.T) {
+	user := func(role string) utility.Principal {
+		return utility.Principal{Kind: utility.PrincipalUser, ID: "1", Role: role}
+	}
+	key := func(role string, scopes ...string) utility.Principal {
+		return utility.Principal{Kind: utility.PrincipalAPIKey, ID: "1", Role: role, Scopes: scopes}
+	}
+
+	tests := []struct {
+		name      string
+		principal utility.Principal
+		resource  string
+		action    Action
+		want      bool
+	}{
+		{"admin deletes execs", user("admin"), "execs", Delete, true},
+		{"admin manages api keys", user("admin"), "api_keys", Create, true},
+		{"manager deletes students", user("manager"), "students", Delete, true},
+		{"manager reads execs", user("manager"), "execs", Read, true},
+		{"manager updates execs", user("manager"), "execs", Update, false},
+		{"manager changes settings", user("manager"), "settings", Update, false},
+		{"manager reads api keys", user("manager"), "api_keys", Read, false},
+		{"exec updates students", user("exec"), "students", Update, true},
+		{"exec deletes students", user("exec"), "students", Delete, false},
+		{"exec reads teachers", user("exec"), "teachers", Read, true},
+		{"exec creates teachers", user("exec"), "teachers", Create, false},
+		{"exec reads execs", user("exec"), "execs", Read, false},
+		{"exec reads webhooks", user("exec"), "webhooks", Read, false},
+		{"exec reads events", user("exec"), "events", Read, true},
+		{"unknown role", user("root"), "students", Read, false},
+		{"no role", user(""), "events", Read, false},
+		{"unknown resource", user("admin"), "grades", Read, false},
+		{"key with the scope", key("admin", "students:read"), "students", Read, true},
+		{"key without the scope", key("admin", "students:read"), "students", Delete, false},
+		{"key of another resource", key("admin", "teachers:read"), "students", Read, false},
+		{"key scoped beyond its role", key("exec", "students:delete"), "students", Delete, false},
+		{"key without scopes", key("admin"), "students", Read, false},
+		{"service", utility.Principal{Kind: utility.PrincipalService, Role: "manager"}, "students", Read, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Allowed(tt.principal, tt.resource, tt.action); got != tt.want {
+				t.Errorf("Allowed(%s, %s) = %t, want %t", tt.resource, tt.action, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowedContext(t *testing.T) {
+	if AllowedContext(context.Background(), "events", Read) {
+		t.Error("AllowedContext without a principal = true")
+	}
+	ctx := utility.WithPrincipal(context.Background(), utility.Principal{Kind: utility.PrincipalUser, Role: "exec"})
+	if !AllowedContext(ctx, "events", Read) || AllowedContext(ctx, "execs", Read) {
+		t.Error("AllowedContext does not follow the permission matrix")
+	}
+}
+
+func TestValidScope(t *testing.T) {
+	tests := []struct {
+		scope string
+		want  bool
+	}{
+		{"students:read", true},
+		{"execs:delete", true},
+		{"settings:update", true},
+		{"api_keys:read", false},
+		{"students:write", false},
+		{"grades:read", false},
+		{"students", false},
+		{":read", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := ValidScope(tt.scope); got != tt.want {
+			t.Errorf("ValidScope(%q) = %t, want %t", tt.scope, got, tt.want)
+		}
+	}
+}
+
+func TestActionOf(t *testing.T) {
+	tests := map[string]Action{
+		http.MethodGet:    Read,
+		http.MethodHead:   Read,
+		http.MethodPost:   Create,
+		http.MethodPut:    Update,
+		http.MethodPatch:  Update,
+		http.MethodDelete: Delete,
+	}
+	for method, want := range tests {
+		if got := ActionOf(method); got != want {
+			t.Errorf("ActionOf(%s) = %s, want %s", method, got, want)
+		}
+	}
+}
+
+func TestRoles(t *testing.T) {
+	tests := []struct {
+		resource string
+		action   Action
+		want     []string
+	}{
+		{"students", Read, []string{"admin", "exec", "manager"}},
+		{"students", Delete, []string{"admin", "manager"}},
+		{"execs", Update, []string{"admin"}},
+		{"api_keys", Read, []string{"admin"}},
+		{"grades", Read, nil},
+	}
+	for _, tt := range tests {
+		if got := Roles(tt.resource, tt.action); !slices.Equal(got, tt.want) {
+			t.Errorf("Roles(%s, %s) = %v, want %v", tt.resource, tt.action, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package certs
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// LoadClientCAs reads the PEM bundle of the CAs allowed to issue client certificates
+func LoadClientCAs(file string) (*x509.CertPool, error) {
+	bundle, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bundle) {
+		return nil, errors.New("no certificate found in client CA bundle")
+	}
+	return pool, nil
+}
+
+// ServiceMap maps the identity carried by a client certificate to the role of that service
+type ServiceMap map[string]string
+
+// ParseServiceMap reads "identity=role" entries, where identity is a URI, DNS name or email
+// address of the certificate's SANs, or its subject common name
+func ParseServiceMap(entries []string) (ServiceMap, error) {
+	services := make(ServiceMap, len(entries))
+	for _, entry := range entries {
+		// URIs may contain "=", the role never does
+		i := strings.LastIndex(entry, "=")
+		if i <= 0 || i == len(entry)-1 {
+			return nil, fmt.Errorf("service %q must be identity=role", entry)
+		}
+		services[strings.TrimSpace(entry[:i])] = strings.TrimSpace(entry[i+1:])
+	}
+	return services, nil
+}
+
+// Identify returns the service and role of a verified client certificate. The SANs are
+// preferred to the common name, which is only looked at when none of them is known.
+func (m ServiceMap) Identify(cert *x509.Certificate) (service, role string, ok bool) {
+	var identities []string
+	for _, uri := range cert.URIs {
+		identities = append(identities, uri.String())
+	}
+	identities = append(identities, cert.DNSNames...)
+	identities = append(identities, cert.EmailAddresses...)
+	identities = append(identities, cert.Subject.CommonName)
+	for _, identity := range identities {
+		if role, ok := m[identity]; ok && identity != "" {
+			return identity, role, true
+		}
+	}
+	return "", "", false
+}
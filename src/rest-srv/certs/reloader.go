@@ -0,0 +1,139 @@
+// Package certs serves the TLS certificate of the server from files that are watched for
+// changes, so a rotated certificate is picked up without a restart.
+package certs
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"rest-srv/metrics"
+)
+
+// Reloader holds the certificate loaded from a certificate and a key file, and loads them
+// again whenever either file changes
+type Reloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+	current  atomic.Pointer[tls.Certificate]
+	// the files as last loaded, to notice a change even when the modification time doesn't
+	certPEM, keyPEM []byte
+	// the files as last rejected, so an invalid pair is reported once rather than at every check
+	rejectedCertPEM, rejectedKeyPEM []byte
+	stop                            chan struct{}
+	done                            chan struct{}
+}
+
+// NewReloader loads the certificate and checks the files for changes every interval. It
+// fails when the initial certificate is unusable.
+func NewReloader(certFile, keyFile string, interval time.Duration) (*Reloader, error) {
+	r := &Reloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	metrics.Default.NewGaugeFunc("tls_certificate_expiry_timestamp_seconds",
+		"Unix time at which the served TLS certificate expires", func() float64 {
+			return float64(r.current.Load().Leaf.NotAfter.Unix())
+		})
+	go r.watch()
+	return r, nil
+}
+
+// GetCertificate is the tls.Config callback serving the current certificate
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.current.Load(), nil
+}
+
+func (r *Reloader) watch() {
+	defer close(r.done)
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-time.After(r.interval):
+		}
+		changed, err := r.reload()
+		if err != nil {
+			// The certificate being served stays until the files are fixed
+			slog.Error("TLS certificate not reloaded", "cert_file", r.certFile, "key_file", r.keyFile, "error", err)
+			continue
+		}
+		if changed {
+			leaf := r.current.Load().Leaf
+			slog.Info("TLS certificate reloaded", "subject", leaf.Subject.String(), "not_after", leaf.NotAfter)
+		}
+	}
+}
+
+// reload reads both files and, if they changed, swaps in their certificate once it is valid
+func (r *Reloader) reload() (changed bool, err error) {
+	certPEM, err := os.ReadFile(r.certFile)
+	if err != nil {
+		return false, err
+	}
+	keyPEM, err := os.ReadFile(r.keyFile)
+	if err != nil {
+		return false, err
+	}
+	if bytes.Equal(certPEM, r.certPEM) && bytes.Equal(keyPEM, r.keyPEM) ||
+		bytes.Equal(certPEM, r.rejectedCertPEM) && bytes.Equal(keyPEM, r.rejectedKeyPEM) {
+		return false, nil
+	}
+
+	cert, err := Parse(certPEM, keyPEM)
+	if err != nil {
+		// A certificate and a key written one after the other can mismatch for a moment;
+		// the files are read again at the next check
+		r.rejectedCertPEM, r.rejectedKeyPEM = certPEM, keyPEM
+		return false, err
+	}
+	r.certPEM, r.keyPEM = certPEM, keyPEM
+	r.current.Store(cert)
+	return true, nil
+}
+
+// Parse loads a PEM certificate chain and its key, checking that they match and that the
+// certificate is valid now
+func Parse(certPEM, keyPEM []byte) (*tls.Certificate, error) {
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if now.Before(leaf.NotBefore) {
+		return nil, fmt.Errorf("certificate is not valid before %s", leaf.NotBefore)
+	}
+	if now.After(leaf.NotAfter) {
+		return nil, fmt.Errorf("certificate expired at %s", leaf.NotAfter)
+	}
+	cert.Leaf = leaf
+	return &cert, nil
+}
+
+// Stop ends the watch of the files, waiting for it until ctx is done
+func (r *Reloader) Stop(ctx context.Context) error {
+	close(r.stop)
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,362 @@
+// Package client is a typed Go client for the rest-srv API.
+//
+//	c, err := client.New("https://localhost:3000", client.WithCredentials("manager", "secret"))
+//	students, err := c.Students.List(ctx, client.Filter{"class": "9A"}, client.Sort{"last_name:asc"}, client.Page{Number: 1, Size: 50})
+//
+// The session is the Bearer and Refresh cookies set by POST /v1/execs/login and is kept in a
+// cookie jar. When the access token expires, the client renews it with the refresh token.
+// With WithCredentials the client logs in on its own, and logs in again when the session
+// cannot be renewed, unless the exec logs in with a TOTP code as admins do. Services of the
+// server's mTLS configuration authenticate with WithClientCertificate instead, and machine
+// clients with WithAPIKey. Requests rejected with 429 or 503 are retried with exponential
+// backoff.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	mathrand "math/rand/v2"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"rest-srv/models"
+	"rest-srv/tracing"
+	"rest-srv/utility"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// apiPrefix is the version of the API the client is written against
+const apiPrefix = "/v1"
+
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	maxRetries int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	clientCert *tls.Certificate
+	apiKey     string
+
+	// credentials used to log in again when the session expires
+	mu       sync.Mutex
+	username string
+	password string
+
+	// renewing serializes the renewals of the session, as a refresh token is used only once
+	renewing sync.Mutex
+
+	Students *StudentsService
+	Teachers *TeachersService
+	Execs    *ExecsService
+}
+
+type Option func(*Client)
+
+// WithHTTPClient sends requests with httpClient, e.g. one trusting a self-signed certificate.
+// A cookie jar is added when it has none.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithRetries retries requests rejected with 429 or 503 up to maxRetries times, waiting
+// between minBackoff and maxBackoff unless the server sends Retry-After
+func WithRetries(maxRetries int, minBackoff, maxBackoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.minBackoff = minBackoff
+		c.maxBackoff = maxBackoff
+	}
+}
+
+// WithCredentials logs in as username before the first request that needs a session and
+// again whenever the session has expired
+func WithCredentials(username, password string) Option {
+	return func(c *Client) {
+		c.username = username
+		c.password = password
+	}
+}
+
+// WithClientCertificate authenticates as a service by presenting cert during the TLS
+// handshake, rather than logging in
+func WithClientCertificate(cert tls.Certificate) Option {
+	return func(c *Client) {
+		c.clientCert = &cert
+	}
+}
+
+// WithAPIKey authenticates every request with key, created with Execs.CreateAPIKey, rather
+// than logging in
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// New creates a client for the API at baseURL, e.g. "https://localhost:3000"
+func New(baseURL string, options ...Option) (*Client, error) {
+	parsed, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base url: %w", err)
+	}
+	if parsed.Scheme == "" || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid base url %q", baseURL)
+	}
+
+	c := &Client{
+		baseURL:    parsed,
+		maxRetries: 3,
+		minBackoff: 500 * time.Millisecond,
+		maxBackoff: 30 * time.Second,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	if c.httpClient == nil {
+		c.httpClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	if c.clientCert != nil {
+		if err := c.useClientCertificate(); err != nil {
+			return nil, err
+		}
+	}
+	if c.httpClient.Jar == nil {
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			return nil, err
+		}
+		c.httpClient.Jar = jar
+	}
+
+	c.Students = &StudentsService{resource[models.Student]{c: c, path: apiPrefix + "/students"}}
+	c.Teachers = &TeachersService{resource[models.Teacher]{c: c, path: apiPrefix + "/teachers"}}
+	c.Execs = &ExecsService{resource[models.Exec]{c: c, path: apiPrefix + "/execs"}}
+	return c, nil
+}
+
+// useClientCertificate adds the client certificate to the TLS settings of the transport,
+// keeping the rest of them, such as trusted roots
+func (c *Client) useClientCertificate() error {
+	var transport *http.Transport
+	switch t := c.httpClient.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = t.Clone()
+	default:
+		return errors.New("WithClientCertificate needs an *http.Transport")
+	}
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	transport.TLSClientConfig.Certificates = []tls.Certificate{*c.clientCert}
+	httpClient := *c.httpClient
+	httpClient.Transport = transport
+	c.httpClient = &httpClient
+	return nil
+}
+
+// request is a single API call. Its body is kept encoded so it can be sent again on retry.
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	body   []byte
+	// public requests never trigger a login
+	public bool
+}
+
+func (c *Client) newRequest(method, path string, query url.Values, body any) (*request, error) {
+	req := &request{method: method, path: path, query: query}
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		req.body = encoded
+	}
+	return req, nil
+}
+
+// do sends req and decodes a successful JSON response into out, which may be nil
+func (c *Client) do(ctx context.Context, req *request, out any) error {
+	refreshToken := c.refreshToken()
+	res, err := c.send(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusUnauthorized && !req.public && (refreshToken != "" || c.hasCredentials()) {
+		// The session expired or was never started: renew it and try once more
+		res.Body.Close()
+		if err := c.renew(ctx, refreshToken); err != nil {
+			return err
+		}
+		if res, err = c.send(ctx, req); err != nil {
+			return err
+		}
+		defer res.Body.Close()
+	}
+
+	if res.StatusCode >= http.StatusBadRequest {
+		return decodeError(res)
+	}
+	if out == nil || res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("decoding %s %s response: %w", req.method, req.path, err)
+	}
+	return nil
+}
+
+// send sends req, retrying 429 and 503 responses with backoff
+func (c *Client) send(ctx context.Context, req *request) (*http.Response, error) {
+	target := *c.baseURL
+	target.Path += req.path
+	target.RawQuery = req.query.Encode()
+
+	// An Idempotency-Key makes retrying a POST safe: the server replays the first response
+	var idempotencyKey string
+	if req.method == http.MethodPost {
+		idempotencyKey = newIdempotencyKey()
+	}
+
+	for attempt := 0; ; attempt++ {
+		httpReq, err := http.NewRequestWithContext(ctx, req.method, target.String(), bytes.NewReader(req.body))
+		if err != nil {
+			return nil, err
+		}
+		// The server expects a JSON Content-Type on every request, including those without a body
+		httpReq.Header.Set("Content-Type", "application/json")
+		httpReq.Header.Set("Accept", "application/json")
+		if idempotencyKey != "" {
+			httpReq.Header.Set("Idempotency-Key", idempotencyKey)
+		}
+		if c.apiKey != "" {
+			httpReq.Header.Set("X-API-Key", c.apiKey)
+		}
+		// Calls made while serving a request carry its id, so both services log the same one
+		if requestID := utility.RequestID(ctx); requestID != "" {
+			httpReq.Header.Set("X-Request-ID", requestID)
+		}
+
+		res, err := c.roundTrip(ctx, httpReq, attempt)
+		if err != nil {
+			return nil, err
+		}
+		if (res.StatusCode != http.StatusTooManyRequests && res.StatusCode != http.StatusServiceUnavailable) || attempt >= c.maxRetries {
+			return res, nil
+		}
+		res.Body.Close()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(c.backoff(attempt, res.Header.Get("Retry-After"))):
+		}
+	}
+}
+
+// roundTrip sends a single attempt in a client span whose traceparent goes along with the request
+func (c *Client) roundTrip(ctx context.Context, httpReq *http.Request, attempt int) (*http.Response, error) {
+	ctx, span := tracing.Start(ctx, httpReq.Method, tracing.KindClient,
+		tracing.String("http.request.method", httpReq.Method),
+		tracing.String("server.address", httpReq.URL.Host),
+		tracing.String("url.path", httpReq.URL.Path),
+		tracing.Int("http.request.resend_count", attempt),
+	)
+	defer span.End()
+	tracing.Inject(ctx, httpReq.Header)
+
+	res, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+	span.SetAttributes(tracing.Int("http.response.status_code", res.StatusCode))
+	if res.StatusCode >= 500 {
+		span.SetStatus(tracing.StatusError, res.Status)
+	}
+	return res, nil
+}
+
+// backoff is the Retry-After of the response when given, otherwise exponential with jitter
+func (c *Client) backoff(attempt int, retryAfter string) time.Duration {
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+		return min(time.Duration(seconds)*time.Second, c.maxBackoff)
+	}
+	if at, err := http.ParseTime(retryAfter); err == nil {
+		return min(max(time.Until(at), 0), c.maxBackoff)
+	}
+	delay := min(float64(c.minBackoff)*math.Pow(2, float64(attempt)), float64(c.maxBackoff))
+	// Full jitter keeps clients that were rejected together from retrying together
+	return time.Duration(mathrand.Float64() * delay)
+}
+
+func (c *Client) hasCredentials() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.username != ""
+}
+
+// refreshToken returns the refresh token of the session, empty without one
+func (c *Client) refreshToken() string {
+	if c.httpClient.Jar == nil {
+		return ""
+	}
+	for _, cookie := range c.httpClient.Jar.Cookies(c.baseURL) {
+		if cookie.Name == "Refresh" {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+// renew renews the session after a request sent with refreshToken was rejected: with the
+// refresh token, or else by logging in again. When the session was renewed meanwhile by
+// another request, there is nothing left to do.
+func (c *Client) renew(ctx context.Context, refreshToken string) error {
+	c.renewing.Lock()
+	defer c.renewing.Unlock()
+	current := c.refreshToken()
+	if current != refreshToken {
+		return nil
+	}
+	if current != "" {
+		_, err := c.Execs.refresh(ctx)
+		if err == nil || !c.hasCredentials() {
+			return err
+		}
+	}
+	return c.login(ctx)
+}
+
+func (c *Client) login(ctx context.Context) error {
+	c.mu.Lock()
+	username, password := c.username, c.password
+	c.mu.Unlock()
+	_, err := c.Execs.login(ctx, username, password)
+	return err
+}
+
+func newIdempotencyKey() string {
+	key := make([]byte, 16)
+	rand.Read(key)
+	return hex.EncodeToString(key)
+}
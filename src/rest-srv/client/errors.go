@@ -0,0 +1,118 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"rest-srv/utility"
+)
+
+// Error is a response with a 4xx or 5xx status. Problem details (RFC 9457), validation error
+// lists and the plain text errors of the API are all decoded into it.
+type Error struct {
+	StatusCode int
+	Type       string
+	Title      string
+	Detail     string
+	Instance   string
+	// Errors lists the invalid fields of a validation failure
+	Errors []utility.FieldError
+}
+
+func (e *Error) Error() string {
+	message := e.Detail
+	if message == "" {
+		message = e.Title
+	}
+	if len(e.Errors) > 0 {
+		message = utility.ValidationErrors(e.Errors).Error()
+	}
+	return fmt.Sprintf("rest-srv: %d %s", e.StatusCode, message)
+}
+
+// StatusCode returns the HTTP status of an *Error in err's chain, or 0
+func StatusCode(err error) int {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+// MFARequiredError is returned by Login when the exec completes the login with a TOTP code,
+// given to Execs.LoginMFA along with Token
+type MFARequiredError struct {
+	// Token is the MFA challenge token, valid for a few minutes
+	Token string
+	// EnrollmentRequired is set when the role of the exec requires a second factor that was
+	// not enrolled yet: Execs.EnrollMFAAtLogin returns the secret of the authenticator app
+	EnrollmentRequired bool
+}
+
+func (e *MFARequiredError) Error() string {
+	if e.EnrollmentRequired {
+		return "rest-srv: mfa enrollment required"
+	}
+	return "rest-srv: mfa required"
+}
+
+// IsNotFound reports whether err is a 404 response
+func IsNotFound(err error) bool {
+	return StatusCode(err) == http.StatusNotFound
+}
+
+// IsUnauthorized reports whether err is a 401 response
+func IsUnauthorized(err error) bool {
+	return StatusCode(err) == http.StatusUnauthorized
+}
+
+// IsForbidden reports whether err is a 403 response: the role may not take the action
+func IsForbidden(err error) bool {
+	return StatusCode(err) == http.StatusForbidden
+}
+
+func decodeError(res *http.Response) error {
+	apiErr := &Error{StatusCode: res.StatusCode, Title: http.StatusText(res.StatusCode)}
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return apiErr
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/problem+json":
+		var problem struct {
+			Type     string               `json:"type"`
+			Title    string               `json:"title"`
+			Detail   string               `json:"detail"`
+			Instance string               `json:"instance"`
+			Errors   []utility.FieldError `json:"errors"`
+		}
+		if json.Unmarshal(body, &problem) == nil {
+			apiErr.Type = problem.Type
+			apiErr.Detail = problem.Detail
+			apiErr.Instance = problem.Instance
+			apiErr.Errors = problem.Errors
+			if problem.Title != "" {
+				apiErr.Title = problem.Title
+			}
+			return apiErr
+		}
+	case "application/json":
+		var validation struct {
+			Errors []utility.FieldError `json:"errors"`
+		}
+		if json.Unmarshal(body, &validation) == nil && len(validation.Errors) > 0 {
+			apiErr.Errors = validation.Errors
+			apiErr.Detail = "validation failed"
+			return apiErr
+		}
+	}
+	apiErr.Detail = strings.TrimSpace(string(body))
+	return apiErr
+}
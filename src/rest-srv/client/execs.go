@@ -0,0 +1,259 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"rest-srv/models"
+)
+
+type ExecsService struct {
+	resource[models.Exec]
+}
+
+// List fetches the execs matching filter
+func (s *ExecsService) List(ctx context.Context, filter Filter, sort Sort) ([]models.Exec, error) {
+	response, err := s.list(ctx, listQuery(filter, sort, Page{}))
+	return response.Data, err
+}
+
+// Login starts a session and returns its token. The credentials are kept so the client can
+// log in again when the session expires. An exec with a second factor gets an
+// *MFARequiredError instead, to complete the login with LoginMFA.
+func (s *ExecsService) Login(ctx context.Context, username, password string) (string, error) {
+	token, err := s.login(ctx, username, password)
+	if err != nil {
+		return "", err
+	}
+	s.c.mu.Lock()
+	s.c.username, s.c.password = username, password
+	s.c.mu.Unlock()
+	return token, nil
+}
+
+func (s *ExecsService) login(ctx context.Context, username, password string) (string, error) {
+	var response struct {
+		Status   string `json:"status"`
+		Token    string `json:"token"`
+		MFAToken string `json:"mfa_token"`
+	}
+	req, err := s.c.newRequest(http.MethodPost, s.path+"/login", nil, map[string]string{"username": username, "password": password})
+	if err != nil {
+		return "", err
+	}
+	req.public = true
+	if err := s.c.do(ctx, req, &response); err != nil {
+		return "", err
+	}
+	if response.MFAToken != "" {
+		return "", &MFARequiredError{Token: response.MFAToken, EnrollmentRequired: response.Status == "mfa_enrollment_required"}
+	}
+	return response.Token, nil
+}
+
+// MFAEnrollment is the TOTP secret of a second factor being enrolled, to add to an
+// authenticator app, e.g. by showing OTPAuthURI as a QR code
+type MFAEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+// LoginMFA completes a login with the token of the *MFARequiredError of Login and a TOTP code
+// or a recovery code, and returns the session token. The recovery codes are returned when the
+// code confirmed an enrollment made at login.
+func (s *ExecsService) LoginMFA(ctx context.Context, mfaToken, code string) (string, []string, error) {
+	var response struct {
+		Token         string   `json:"token"`
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	req, err := s.c.newRequest(http.MethodPost, s.path+"/login/mfa", nil, map[string]string{"mfa_token": mfaToken, "code": code})
+	if err != nil {
+		return "", nil, err
+	}
+	req.public = true
+	err = s.c.do(ctx, req, &response)
+	return response.Token, response.RecoveryCodes, err
+}
+
+// EnrollMFAAtLogin starts the enrollment required by the role of an exec logging in, with the
+// token of the *MFARequiredError of Login. LoginMFA then confirms it with a first code.
+func (s *ExecsService) EnrollMFAAtLogin(ctx context.Context, mfaToken string) (MFAEnrollment, error) {
+	var response MFAEnrollment
+	req, err := s.c.newRequest(http.MethodPost, s.path+"/login/mfa/enroll", nil, map[string]string{"mfa_token": mfaToken})
+	if err != nil {
+		return MFAEnrollment{}, err
+	}
+	req.public = true
+	err = s.c.do(ctx, req, &response)
+	return response, err
+}
+
+// EnrollMFA starts the enrollment of a second factor for the exec logged in, with id, to
+// confirm with ConfirmMFA
+func (s *ExecsService) EnrollMFA(ctx context.Context, id int) (MFAEnrollment, error) {
+	var response MFAEnrollment
+	req, err := s.c.newRequest(http.MethodPost, s.itemPath(id)+"/mfa/enroll", nil, nil)
+	if err != nil {
+		return MFAEnrollment{}, err
+	}
+	err = s.c.do(ctx, req, &response)
+	return response, err
+}
+
+// ConfirmMFA enables the second factor being enrolled with a TOTP code, and returns the
+// recovery codes
+func (s *ExecsService) ConfirmMFA(ctx context.Context, id int, code string) ([]string, error) {
+	return s.recoveryCodes(ctx, s.itemPath(id)+"/mfa/confirm", code)
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes, given a TOTP code or a recovery code
+func (s *ExecsService) RegenerateRecoveryCodes(ctx context.Context, id int, code string) ([]string, error) {
+	return s.recoveryCodes(ctx, s.itemPath(id)+"/mfa/recovery-codes", code)
+}
+
+func (s *ExecsService) recoveryCodes(ctx context.Context, path, code string) ([]string, error) {
+	var response struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	req, err := s.c.newRequest(http.MethodPost, path, nil, map[string]string{"code": code})
+	if err != nil {
+		return nil, err
+	}
+	err = s.c.do(ctx, req, &response)
+	return response.RecoveryCodes, err
+}
+
+// DisableMFA removes the second factor of the exec logged in, given a TOTP code or a
+// recovery code
+func (s *ExecsService) DisableMFA(ctx context.Context, id int, code string) error {
+	req, err := s.c.newRequest(http.MethodPost, s.itemPath(id)+"/mfa/disable", nil, map[string]string{"code": code})
+	if err != nil {
+		return err
+	}
+	return s.c.do(ctx, req, nil)
+}
+
+// ResetMFA removes the second factor of an exec who lost it
+func (s *ExecsService) ResetMFA(ctx context.Context, id int) error {
+	req, err := s.c.newRequest(http.MethodDelete, s.itemPath(id)+"/mfa", nil, nil)
+	if err != nil {
+		return err
+	}
+	return s.c.do(ctx, req, nil)
+}
+
+// Refresh renews the session with its refresh token and returns the new access token. The
+// client does so on its own when the access token has expired.
+func (s *ExecsService) Refresh(ctx context.Context) (string, error) {
+	s.c.renewing.Lock()
+	defer s.c.renewing.Unlock()
+	return s.refresh(ctx)
+}
+
+func (s *ExecsService) refresh(ctx context.Context) (string, error) {
+	var response struct {
+		Token string `json:"token"`
+	}
+	// The refresh token goes along in the Refresh cookie of the jar
+	req, err := s.c.newRequest(http.MethodPost, s.path+"/token/refresh", nil, nil)
+	if err != nil {
+		return "", err
+	}
+	req.public = true
+	err = s.c.do(ctx, req, &response)
+	return response.Token, err
+}
+
+// Logout ends the session and forgets the credentials
+func (s *ExecsService) Logout(ctx context.Context) error {
+	s.c.mu.Lock()
+	s.c.username, s.c.password = "", ""
+	s.c.mu.Unlock()
+
+	req, err := s.c.newRequest(http.MethodPost, s.path+"/logout", nil, nil)
+	if err != nil {
+		return err
+	}
+	req.public = true
+	return s.c.do(ctx, req, nil)
+}
+
+// LogoutAll ends every session of the exec logged in, on every device, and forgets the
+// credentials
+func (s *ExecsService) LogoutAll(ctx context.Context) error {
+	req, err := s.c.newRequest(http.MethodPost, s.path+"/logout-all", nil, nil)
+	if err != nil {
+		return err
+	}
+	if err := s.c.do(ctx, req, nil); err != nil {
+		return err
+	}
+	s.c.mu.Lock()
+	s.c.username, s.c.password = "", ""
+	s.c.mu.Unlock()
+	return nil
+}
+
+// UpdatePassword changes the password of the exec with id
+func (s *ExecsService) UpdatePassword(ctx context.Context, id int, oldPassword, newPassword string) error {
+	req, err := s.c.newRequest(http.MethodPost, s.itemPath(id)+"/update-password", nil, map[string]string{"oldpassword": oldPassword, "newpassword": newPassword})
+	if err != nil {
+		return err
+	}
+	return s.c.do(ctx, req, nil)
+}
+
+// ForgotPassword emails a password reset link to the exec with email
+func (s *ExecsService) ForgotPassword(ctx context.Context, email string) error {
+	req, err := s.c.newRequest(http.MethodPost, s.path+"/forgot-password", nil, map[string]string{"email": email})
+	if err != nil {
+		return err
+	}
+	req.public = true
+	return s.c.do(ctx, req, nil)
+}
+
+// CreateAPIKey creates an API key acting as the exec with id within scopes, such as
+// "students:read", until expiresAt unless it is zero. The key is returned this once.
+func (s *ExecsService) CreateAPIKey(ctx context.Context, id int, name string, scopes []string, expiresAt time.Time) (models.APIKey, string, error) {
+	body := struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	}{Name: name, Scopes: scopes}
+	if !expiresAt.IsZero() {
+		body.ExpiresAt = &expiresAt
+	}
+	var response struct {
+		models.APIKey
+		Key string `json:"key"`
+	}
+	req, err := s.c.newRequest(http.MethodPost, s.itemPath(id)+"/api-keys", nil, body)
+	if err != nil {
+		return models.APIKey{}, "", err
+	}
+	err = s.c.do(ctx, req, &response)
+	return response.APIKey, response.Key, err
+}
+
+// ListAPIKeys fetches the API keys of the exec with id, revoked and expired ones included
+func (s *ExecsService) ListAPIKeys(ctx context.Context, id int) ([]models.APIKey, error) {
+	var response listResponse[models.APIKey]
+	req, err := s.c.newRequest(http.MethodGet, s.itemPath(id)+"/api-keys", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = s.c.do(ctx, req, &response)
+	return response.Data, err
+}
+
+// RevokeAPIKey revokes the API key keyID of the exec with id
+func (s *ExecsService) RevokeAPIKey(ctx context.Context, id int, keyID int) error {
+	req, err := s.c.newRequest(http.MethodDelete, s.itemPath(id)+"/api-keys/"+strconv.Itoa(keyID), nil, nil)
+	if err != nil {
+		return err
+	}
+	return s.c.do(ctx, req, nil)
+}
@@ -0,0 +1,231 @@
+package client
+
+import (
+	"context"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"rest-srv/models"
+)
+
+// Filter matches fields exactly, e.g. Filter{"class": "9A"}
+type Filter map[string]string
+
+// Sort orders a list by fields, e.g. Sort{"last_name:asc", "first_name:desc"}
+type Sort []string
+
+// Page selects a page of a paginated list. Number starts at 1; zero values use the server defaults.
+type Page struct {
+	Number int
+	Size   int
+}
+
+// List is one page of a paginated list
+type List[T any] struct {
+	Items []T
+	// Total is the number of matches across all pages
+	Total int
+	Page  int
+	Limit int
+}
+
+type listResponse[T any] struct {
+	Count int `json:"count"`
+	Data  []T `json:"data"`
+	Page  int `json:"page"`
+	Limit int `json:"limit"`
+}
+
+// resource implements the operations students, teachers and execs have in common
+type resource[T any] struct {
+	c    *Client
+	path string
+}
+
+func (r resource[T]) itemPath(id int) string {
+	return r.path + "/" + strconv.Itoa(id)
+}
+
+func listQuery(filter Filter, sort Sort, page Page) url.Values {
+	query := url.Values{}
+	for field, value := range filter {
+		query.Set(field, value)
+	}
+	for _, order := range sort {
+		query.Add("sortBy", order)
+	}
+	if page.Number > 0 {
+		query.Set("page", strconv.Itoa(page.Number))
+	}
+	if page.Size > 0 {
+		query.Set("limit", strconv.Itoa(page.Size))
+	}
+	return query
+}
+
+func (r resource[T]) list(ctx context.Context, query url.Values) (listResponse[T], error) {
+	var response listResponse[T]
+	req, err := r.c.newRequest(http.MethodGet, r.path, query, nil)
+	if err != nil {
+		return response, err
+	}
+	err = r.c.do(ctx, req, &response)
+	return response, err
+}
+
+// Get fetches one item by id
+func (r resource[T]) Get(ctx context.Context, id int) (T, error) {
+	var item T
+	req, err := r.c.newRequest(http.MethodGet, r.itemPath(id), nil, nil)
+	if err != nil {
+		return item, err
+	}
+	err = r.c.do(ctx, req, &item)
+	return item, err
+}
+
+// Add creates items and returns them with their ids
+func (r resource[T]) Add(ctx context.Context, items ...T) ([]T, error) {
+	var added []T
+	req, err := r.c.newRequest(http.MethodPost, r.path, nil, items)
+	if err != nil {
+		return nil, err
+	}
+	err = r.c.do(ctx, req, &added)
+	return added, err
+}
+
+// Patch sets the given fields of one item, e.g. map[string]any{"email": "new@example.com"}
+func (r resource[T]) Patch(ctx context.Context, id int, fields map[string]any) (T, error) {
+	var patched T
+	req, err := r.c.newRequest(http.MethodPatch, r.itemPath(id), nil, fields)
+	if err != nil {
+		return patched, err
+	}
+	err = r.c.do(ctx, req, &patched)
+	return patched, err
+}
+
+// PatchMany sets fields of several items in one transaction. Every update must contain the "id" of its item.
+func (r resource[T]) PatchMany(ctx context.Context, updates []map[string]any) ([]T, error) {
+	var patched []T
+	req, err := r.c.newRequest(http.MethodPatch, r.path, nil, updates)
+	if err != nil {
+		return nil, err
+	}
+	err = r.c.do(ctx, req, &patched)
+	return patched, err
+}
+
+// Delete deletes one item
+func (r resource[T]) Delete(ctx context.Context, id int) error {
+	req, err := r.c.newRequest(http.MethodDelete, r.itemPath(id), nil, nil)
+	if err != nil {
+		return err
+	}
+	return r.c.do(ctx, req, nil)
+}
+
+// DeleteMany deletes several items in one transaction and returns the deleted ids
+func (r resource[T]) DeleteMany(ctx context.Context, ids ...int) ([]int, error) {
+	var response struct {
+		DeletedIDs []int `json:"deleted_ids"`
+	}
+	req, err := r.c.newRequest(http.MethodDelete, r.path, nil, ids)
+	if err != nil {
+		return nil, err
+	}
+	err = r.c.do(ctx, req, &response)
+	return response.DeletedIDs, err
+}
+
+func (r resource[T]) update(ctx context.Context, id int, item T) (T, error) {
+	var updated T
+	req, err := r.c.newRequest(http.MethodPut, r.itemPath(id), nil, item)
+	if err != nil {
+		return updated, err
+	}
+	err = r.c.do(ctx, req, &updated)
+	return updated, err
+}
+
+type StudentsService struct {
+	resource[models.Student]
+}
+
+// List fetches one page of the students matching filter
+func (s *StudentsService) List(ctx context.Context, filter Filter, sort Sort, page Page) (*List[models.Student], error) {
+	response, err := s.list(ctx, listQuery(filter, sort, page))
+	if err != nil {
+		return nil, err
+	}
+	return &List[models.Student]{Items: response.Data, Total: response.Count, Page: response.Page, Limit: response.Limit}, nil
+}
+
+// All iterates over every student matching filter, fetching pageSize students at a time.
+// Iteration stops at the first error, which is yielded with a zero student.
+func (s *StudentsService) All(ctx context.Context, filter Filter, sort Sort, pageSize int) iter.Seq2[models.Student, error] {
+	return func(yield func(models.Student, error) bool) {
+		for number := 1; ; number++ {
+			page, err := s.List(ctx, filter, sort, Page{Number: number, Size: pageSize})
+			if err != nil {
+				yield(models.Student{}, err)
+				return
+			}
+			for _, student := range page.Items {
+				if !yield(student, nil) {
+					return
+				}
+			}
+			if len(page.Items) == 0 || page.Page*page.Limit >= page.Total {
+				return
+			}
+		}
+	}
+}
+
+// Update replaces every field of the student with id
+func (s *StudentsService) Update(ctx context.Context, id int, student models.Student) (models.Student, error) {
+	return s.update(ctx, id, student)
+}
+
+type TeachersService struct {
+	resource[models.Teacher]
+}
+
+// List fetches the teachers matching filter
+func (s *TeachersService) List(ctx context.Context, filter Filter, sort Sort) ([]models.Teacher, error) {
+	response, err := s.list(ctx, listQuery(filter, sort, Page{}))
+	return response.Data, err
+}
+
+// Update replaces every field of the teacher with id
+func (s *TeachersService) Update(ctx context.Context, id int, teacher models.Teacher) (models.Teacher, error) {
+	return s.update(ctx, id, teacher)
+}
+
+// Students fetches the students of the teacher's class
+func (s *TeachersService) Students(ctx context.Context, id int) ([]models.Student, error) {
+	var response listResponse[models.Student]
+	req, err := s.c.newRequest(http.MethodGet, s.itemPath(id)+"/students", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = s.c.do(ctx, req, &response)
+	return response.Data, err
+}
+
+// StudentsCount counts the students of the teacher's class
+func (s *TeachersService) StudentsCount(ctx context.Context, id int) (int, error) {
+	var response struct {
+		Count int `json:"count"`
+	}
+	req, err := s.c.newRequest(http.MethodGet, s.itemPath(id)+"/studentsCount", nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	err = s.c.do(ctx, req, &response)
+	return response.Count, err
+}
@@ -0,0 +1,281 @@
+// Package config loads the settings of the server from defaults, a YAML or TOML file, the
+// environment and command line flags, in increasing order of precedence.
+//
+// Every setting has a dotted key, used in the file and as flag name (-database.host), and an
+// environment variable (DB_HOST). Secrets can also be read from the file named by the
+// variable with a _FILE suffix (DB_PASSWORD_FILE), as mounted by Docker or Kubernetes.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	Server      ServerConfig      `key:"server"`
+	Database    DatabaseConfig    `key:"database"`
+	Auth        AuthConfig        `key:"auth"`
+	Log         LogConfig         `key:"log"`
+	MTLS        MTLSConfig        `key:"mtls"`
+	Metrics     MetricsConfig     `key:"metrics"`
+	Mail        MailConfig        `key:"mail"`
+	Webhooks    WebhooksConfig    `key:"webhooks"`
+	Events      EventsConfig      `key:"events"`
+	Idempotency IdempotencyConfig `key:"idempotency"`
+	CORS        CORSConfig        `key:"cors"`
+	RateLimit   RateLimitConfig   `key:"rate_limit"`
+	HPP         HPPConfig         `key:"hpp"`
+	Tracing     TracingConfig     `key:"tracing"`
+}
+
+type ServerConfig struct {
+	Port int `key:"port" env:"SERVER_PORT" help:"port of the HTTPS server"`
+	// ExposePort is the port clients reach the server on, used in links sent by email
+	ExposePort         int           `key:"expose_port" env:"EXPOSE_PORT" help:"port the server is reachable on from outside, defaults to server.port"`
+	CertFile           string        `key:"cert_file" env:"CERT_FILE" help:"TLS certificate file, reloaded when it changes"`
+	KeyFile            string        `key:"key_file" env:"KEY_FILE" help:"TLS private key file, reloaded when it changes"`
+	CertReloadInterval time.Duration `key:"cert_reload_interval" env:"CERT_RELOAD_INTERVAL" help:"how often the certificate files are checked for changes"`
+	SelfSigned         bool          `key:"self_signed" env:"TLS_SELF_SIGNED" help:"generate a self-signed certificate for development when the files don't exist"`
+	RedirectPort       int           `key:"redirect_port" env:"HTTP_REDIRECT_PORT" help:"port of a plain HTTP listener redirecting to HTTPS, 0 for none"`
+	ShutdownTimeout    time.Duration `key:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" help:"time given to in-flight requests on shutdown"`
+}
+
+type DatabaseConfig struct {
+	Host     string `key:"host" env:"DB_HOST" help:"MySQL host"`
+	Port     int    `key:"port" env:"DB_PORT" help:"MySQL port"`
+	User     string `key:"user" env:"DB_USER" help:"MySQL user"`
+	Password string `key:"password" env:"DB_PASSWORD" secret:"true" help:"MySQL password"`
+	Name     string `key:"name" env:"DB_NAME" help:"MySQL database"`
+}
+
+type AuthConfig struct {
+	JWTSecret    string        `key:"jwt_secret" env:"JWT_SECRET" secret:"true" help:"HMAC key signing the session tokens"`
+	JWTExpiresIn time.Duration `key:"jwt_expires_in" env:"JWT_EXPIRES_IN" help:"lifetime of a session token, renewed with a refresh token"`
+	// A session lasts as long as its refresh token is used before it expires
+	RefreshTokenExpiresIn time.Duration `key:"refresh_token_expires_in" env:"REFRESH_TOKEN_EXPIRES_IN" help:"lifetime of a refresh token"`
+	ResetTokenExpiresIn   time.Duration `key:"reset_token_expires_in" env:"RESET_TOKEN_EXPIRES_IN" help:"lifetime of a password reset link"`
+	// The memory store only suits a single instance, and forgets the revocations on restart
+	RevocationStore string `key:"revocation_store" env:"REVOCATION_STORE" help:"where revoked session tokens are kept: sql or memory"`
+	// Execs of these roles without a second factor have to enroll one at their next login
+	MFARequiredRoles      []string      `key:"mfa_required_roles" env:"MFA_REQUIRED_ROLES" help:"comma separated roles that must log in with a TOTP code"`
+	MFAIssuer             string        `key:"mfa_issuer" env:"MFA_ISSUER" help:"name of the service shown by authenticator apps"`
+	MFAChallengeExpiresIn time.Duration `key:"mfa_challenge_expires_in" env:"MFA_CHALLENGE_EXPIRES_IN" help:"time left to give the TOTP code after the password"`
+}
+
+type LogConfig struct {
+	Level string `key:"level" env:"LOG_LEVEL" reload:"true" help:"debug, info, warn or error"`
+}
+
+type MTLSConfig struct {
+	ClientCAFile string   `key:"client_ca_file" env:"MTLS_CLIENT_CA_FILE" help:"PEM bundle of the CAs issuing client certificates, enables mutual TLS"`
+	Services     []string `key:"services" env:"MTLS_SERVICES" help:"comma separated identity=role of the services authenticating by client certificate"`
+}
+
+type MetricsConfig struct {
+	Addr  string `key:"addr" env:"METRICS_ADDR" help:"address of a separate plain HTTP metrics listener"`
+	Token string `key:"token" env:"METRICS_TOKEN" secret:"true" help:"bearer token serving /metrics on the main server"`
+}
+
+type MailConfig struct {
+	Host     string `key:"host" env:"MAIL_HOST" help:"SMTP host"`
+	Port     int    `key:"port" env:"MAIL_PORT" help:"SMTP port"`
+	Username string `key:"username" env:"MAIL_USERNAME" help:"SMTP user, if the server needs authentication"`
+	Password string `key:"password" env:"MAIL_PASSWORD" secret:"true" help:"SMTP password"`
+	From     string `key:"from" env:"MAIL_FROM" help:"sender address of the emails"`
+}
+
+type WebhooksConfig struct {
+	PollInterval time.Duration `key:"poll_interval" env:"WEBHOOK_POLL_INTERVAL" help:"how often due deliveries are sent"`
+	MaxAttempts  int           `key:"max_attempts" env:"WEBHOOK_MAX_ATTEMPTS" help:"attempts before a delivery is dead-lettered"`
+}
+
+type EventsConfig struct {
+	BufferSize   int           `key:"buffer_size" env:"EVENTS_BUFFER_SIZE" help:"events kept for streams resuming with Last-Event-ID"`
+	PollInterval time.Duration `key:"poll_interval" env:"EVENTS_POLL_INTERVAL" help:"how often the outbox is tailed"`
+}
+
+type IdempotencyConfig struct {
+	TTL time.Duration `key:"ttl" env:"IDEMPOTENCY_TTL" help:"how long responses are kept for replay"`
+}
+
+type CORSConfig struct {
+	AllowedOrigins []string `key:"allowed_origins" env:"CORS_ALLOWED_ORIGINS" reload:"true" help:"comma separated origins allowed to call the API"`
+}
+
+type RateLimitConfig struct {
+	Requests int           `key:"requests" env:"RATE_LIMIT_REQUESTS" reload:"true" help:"requests allowed per client and window"`
+	Window   time.Duration `key:"window" env:"RATE_LIMIT_WINDOW" reload:"true" help:"length of a rate limit window"`
+	// Logging in and requesting a password reset are limited further, against guessing
+	// passwords and flooding mailboxes
+	AuthRequests int           `key:"auth_requests" env:"RATE_LIMIT_AUTH_REQUESTS" reload:"true" help:"login and password reset requests allowed per client and auth window"`
+	AuthWindow   time.Duration `key:"auth_window" env:"RATE_LIMIT_AUTH_WINDOW" reload:"true" help:"length of an auth rate limit window"`
+}
+
+type HPPConfig struct {
+	Whitelist []string `key:"whitelist" env:"HPP_WHITELIST" help:"comma separated parameters that may be repeated"`
+}
+
+// TracingConfig is also set by the standard variables of the OpenTelemetry SDKs
+type TracingConfig struct {
+	Exporter    string `key:"exporter" env:"OTEL_TRACES_EXPORTER" help:"where spans go: otlp, console (stderr) or none"`
+	Endpoint    string `key:"endpoint" env:"OTEL_EXPORTER_OTLP_ENDPOINT" help:"OTLP/HTTP collector the otlp exporter posts spans to"`
+	ServiceName string `key:"service_name" env:"OTEL_SERVICE_NAME" help:"service name the spans are reported under"`
+}
+
+// Default returns the settings used when no source sets them
+func Default() *Config {
+	return &Config{
+		Server:   ServerConfig{Port: 3000, ShutdownTimeout: 20 * time.Second, CertReloadInterval: 30 * time.Second},
+		Database: DatabaseConfig{Port: 3306},
+		Auth: AuthConfig{JWTExpiresIn: 15 * time.Minute, RefreshTokenExpiresIn: 7 * 24 * time.Hour, ResetTokenExpiresIn: 10 * time.Minute, RevocationStore: "sql",
+			MFARequiredRoles: []string{"admin"}, MFAIssuer: "rest-srv", MFAChallengeExpiresIn: 5 * time.Minute},
+		Log:         LogConfig{Level: "info"},
+		Mail:        MailConfig{Host: "mailhog", Port: 1025, From: "your-email@example.com"},
+		Webhooks:    WebhooksConfig{PollInterval: 5 * time.Second, MaxAttempts: 8},
+		Events:      EventsConfig{BufferSize: 1000, PollInterval: time.Second},
+		Idempotency: IdempotencyConfig{TTL: 24 * time.Hour},
+		CORS:        CORSConfig{AllowedOrigins: []string{"https://localhost:3000"}},
+		RateLimit:   RateLimitConfig{Requests: 10, Window: 2 * time.Second, AuthRequests: 5, AuthWindow: time.Minute},
+		HPP: HPPConfig{Whitelist: []string{
+			"name", "age", "address", "sortBy", "sortOrder", "id", "first_name", "last_name", "email",
+			"class", "subject", "limit", "page", "fields", "include", "entity",
+		}},
+		Tracing: TracingConfig{Exporter: "none", Endpoint: "http://localhost:4318", ServiceName: "rest-srv"},
+	}
+}
+
+// Load reads the configuration. The file is named by the -config flag or CONFIG_FILE; its
+// format follows its extension (.yaml, .yml or .toml). The problems of the sources, or else
+// those found by the validation, are reported all at once rather than one per run.
+func Load(args []string) (*Config, error) {
+	cfg := Default()
+	if err := newLoader(cfg).load(args); err != nil {
+		return nil, err
+	}
+	if cfg.Server.ExposePort == 0 {
+		cfg.Server.ExposePort = cfg.Server.Port
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate checks that the required settings are set and every value is usable
+func (c *Config) Validate() error {
+	var errs []error
+	required := func(key, value string) {
+		if value == "" {
+			errs = append(errs, fmt.Errorf("%s is required (%s)", key, envOf(key)))
+		}
+	}
+	port := func(key string, value int) {
+		if value < 1 || value > 65535 {
+			errs = append(errs, fmt.Errorf("%s must be a port between 1 and 65535, got %d", key, value))
+		}
+	}
+	positive := func(key string, value int64) {
+		if value <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", key))
+		}
+	}
+
+	port("server.port", c.Server.Port)
+	port("server.expose_port", c.Server.ExposePort)
+	required("server.cert_file", c.Server.CertFile)
+	required("server.key_file", c.Server.KeyFile)
+	positive("server.cert_reload_interval", int64(c.Server.CertReloadInterval))
+	if c.Server.RedirectPort != 0 {
+		port("server.redirect_port", c.Server.RedirectPort)
+	}
+	positive("server.shutdown_timeout", int64(c.Server.ShutdownTimeout))
+
+	required("database.host", c.Database.Host)
+	port("database.port", c.Database.Port)
+	required("database.user", c.Database.User)
+	required("database.password", c.Database.Password)
+	required("database.name", c.Database.Name)
+
+	required("auth.jwt_secret", c.Auth.JWTSecret)
+	positive("auth.jwt_expires_in", int64(c.Auth.JWTExpiresIn))
+	positive("auth.refresh_token_expires_in", int64(c.Auth.RefreshTokenExpiresIn))
+	positive("auth.reset_token_expires_in", int64(c.Auth.ResetTokenExpiresIn))
+	if !slices.Contains([]string{"sql", "memory"}, c.Auth.RevocationStore) {
+		errs = append(errs, fmt.Errorf("auth.revocation_store must be sql or memory, got %q", c.Auth.RevocationStore))
+	}
+	for _, role := range c.Auth.MFARequiredRoles {
+		if !slices.Contains([]string{"admin", "manager", "exec"}, role) {
+			errs = append(errs, fmt.Errorf("auth.mfa_required_roles: %q must be admin, manager or exec", role))
+		}
+	}
+	required("auth.mfa_issuer", c.Auth.MFAIssuer)
+	positive("auth.mfa_challenge_expires_in", int64(c.Auth.MFAChallengeExpiresIn))
+
+	if len(c.MTLS.Services) > 0 && c.MTLS.ClientCAFile == "" {
+		errs = append(errs, errors.New("mtls.services needs mtls.client_ca_file (MTLS_CLIENT_CA_FILE)"))
+	}
+	for _, service := range c.MTLS.Services {
+		i := strings.LastIndex(service, "=")
+		if i <= 0 || !slices.Contains([]string{"admin", "manager", "exec"}, service[i+1:]) {
+			errs = append(errs, fmt.Errorf("mtls.services: %q must be identity=role with role admin, manager or exec", service))
+		}
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		errs = append(errs, fmt.Errorf("log.level must be one of debug, info, warn, error, got %q", c.Log.Level))
+	}
+
+	required("mail.host", c.Mail.Host)
+	port("mail.port", c.Mail.Port)
+	required("mail.from", c.Mail.From)
+
+	positive("webhooks.poll_interval", int64(c.Webhooks.PollInterval))
+	positive("webhooks.max_attempts", int64(c.Webhooks.MaxAttempts))
+	positive("events.buffer_size", int64(c.Events.BufferSize))
+	positive("events.poll_interval", int64(c.Events.PollInterval))
+	positive("idempotency.ttl", int64(c.Idempotency.TTL))
+
+	for _, origin := range c.CORS.AllowedOrigins {
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" {
+			errs = append(errs, fmt.Errorf("cors.allowed_origins: %q is not an origin such as https://example.com", origin))
+		}
+	}
+	positive("rate_limit.requests", int64(c.RateLimit.Requests))
+	positive("rate_limit.window", int64(c.RateLimit.Window))
+	positive("rate_limit.auth_requests", int64(c.RateLimit.AuthRequests))
+	positive("rate_limit.auth_window", int64(c.RateLimit.AuthWindow))
+
+	if !slices.Contains([]string{"otlp", "console", "none"}, c.Tracing.Exporter) {
+		errs = append(errs, fmt.Errorf("tracing.exporter must be otlp, console or none, got %q", c.Tracing.Exporter))
+	}
+	if u, err := url.Parse(c.Tracing.Endpoint); c.Tracing.Exporter == "otlp" && (err != nil || u.Scheme == "" || u.Host == "") {
+		errs = append(errs, fmt.Errorf("tracing.endpoint: %q is not a URL such as http://localhost:4318", c.Tracing.Endpoint))
+	}
+	required("tracing.service_name", c.Tracing.ServiceName)
+
+	return errors.Join(errs...)
+}
+
+// Reload returns c with the settings tagged reloadable taken from next, and the keys of the
+// other settings that differ, which only take effect after a restart
+func (c *Config) Reload(next *Config) (reloaded *Config, needRestart []string) {
+	reloaded = new(Config)
+	*reloaded = *c
+	for _, s := range settingsOf(reloaded) {
+		nextValue := settingByKey(next, s.key).value
+		if s.reload {
+			s.value.Set(nextValue)
+			continue
+		}
+		if !equal(s.value, nextValue) {
+			needRestart = append(needRestart, s.key)
+		}
+	}
+	return reloaded, needRestart
+}
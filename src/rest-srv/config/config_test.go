@@ -0,0 +1,334 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []entry
+	}{
+		{
+			name: "nested keys and scalars",
+			data: "server:\n  port: 3000\n  self_signed: true\nlog:\n  level: debug # comment\n",
+			want: []entry{
+				{key: "server.port", value: "3000", line: 2},
+				{key: "server.self_signed", value: "true", line: 3},
+				{key: "log.level", value: "debug", line: 5},
+			},
+		},
+		{
+			name: "quoted scalars",
+			data: "database:\n  password: \" secret \"\n  name: 'classes'\n",
+			want: []entry{
+				{key: "database.password", value: " secret ", line: 2},
+				{key: "database.name", value: "classes", line: 3},
+			},
+		},
+		{
+			name: "block and flow sequences",
+			data: "cors:\n  allowed_origins:\n    - https://a.example\n    - https://b.example\nauth:\n  mfa_required_roles: [admin, manager]\n",
+			want: []entry{
+				{key: "cors.allowed_origins", value: []string{"https://a.example", "https://b.example"}, line: 2},
+				{key: "auth.mfa_required_roles", value: []string{"admin", "manager"}, line: 6},
+			},
+		},
+		{
+			name: "null and empty list",
+			data: "metrics:\n  addr:\nmtls:\n  services: []\n",
+			want: []entry{
+				{key: "metrics.addr", value: "", line: 2},
+				{key: "mtls.services", value: []string{}, line: 4},
+			},
+		},
+		{
+			name: "anchors",
+			data: "x: &window 2s\nrate_limit:\n  window: *window\n",
+			want: []entry{
+				{key: "x", value: "2s", line: 1},
+				{key: "rate_limit.window", value: "2s", line: 3},
+			},
+		},
+		{
+			name: "empty document",
+			data: "# nothing set\n",
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseYAML(tt.data)
+			if err != nil {
+				t.Fatalf("parseYAML: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseYAML = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"tab indentation", "server:\n\tport: 3000\n"},
+		{"list at the top", "- a\n- b\n"},
+		{"nested list items", "mtls:\n  services:\n    - [a, b]\n"},
+		{"unterminated quote", "log:\n  level: \"debug\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseYAML(tt.data); err == nil {
+				t.Errorf("parseYAML(%q) succeeded, want an error", tt.data)
+			}
+		})
+	}
+}
+
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []entry
+	}{
+		{
+			name: "tables and scalars",
+			data: "[server]\nport = 3000\nself_signed = true\n\n[log]\nlevel = \"debug\" # comment\n",
+			want: []entry{
+				{key: "log.level", value: "debug"},
+				{key: "server.port", value: "3000"},
+				{key: "server.self_signed", value: "true"},
+			},
+		},
+		{
+			name: "dotted and quoted keys, literal strings",
+			data: "database.name = 'classes'\n\"database\".password = ' secret '\n",
+			want: []entry{
+				{key: "database.name", value: "classes"},
+				{key: "database.password", value: " secret "},
+			},
+		},
+		{
+			name: "arrays over several lines",
+			data: "[cors]\nallowed_origins = [\n  \"https://a.example\",\n  \"https://b.example\",\n]\n",
+			want: []entry{
+				{key: "cors.allowed_origins", value: []string{"https://a.example", "https://b.example"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTOML(tt.data)
+			if err != nil {
+				t.Fatalf("parseTOML: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseTOML = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"missing value", "[server]\nport =\n"},
+		{"unterminated array", "[cors]\nallowed_origins = [\"a\"\n"},
+		{"array of tables", "[[server]]\nport = 1\n"},
+		{"array of arrays", "[mtls]\nservices = [[\"a\"]]\n"},
+		{"datetime", "[log]\nlevel = 2024-01-01T00:00:00Z\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseTOML(tt.data); err == nil {
+				t.Errorf("parseTOML(%q) succeeded, want an error", tt.data)
+			}
+		})
+	}
+}
+
+// requiredSettings are the settings without a default, given by every test loading a config
+var requiredSettings = []string{
+	"-server.cert_file=cert.pem", "-server.key_file=key.pem",
+	"-database.host=db", "-database.user=user", "-database.password=pw", "-database.name=classes",
+	"-auth.jwt_secret=secret",
+}
+
+func writeFile(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, "config.yaml", "server:\n  port: 4000\nlog:\n  level: warn\nrate_limit:\n  requests: 20\n")
+	t.Setenv("LOG_LEVEL", "error")
+	t.Setenv("RATE_LIMIT_REQUESTS", "30")
+
+	cfg, err := Load(append([]string{"-config", path, "-rate_limit.requests=40"}, requiredSettings...))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	// The file overrides the defaults, the environment the file and the flags everything
+	if cfg.Server.Port != 4000 {
+		t.Errorf("server.port = %d, want 4000 from the file", cfg.Server.Port)
+	}
+	if cfg.Log.Level != "error" {
+		t.Errorf("log.level = %q, want error from the environment", cfg.Log.Level)
+	}
+	if cfg.RateLimit.Requests != 40 {
+		t.Errorf("rate_limit.requests = %d, want 40 from the flag", cfg.RateLimit.Requests)
+	}
+	if cfg.Server.ExposePort != 4000 {
+		t.Errorf("server.expose_port = %d, want server.port", cfg.Server.ExposePort)
+	}
+	if cfg.Events.PollInterval != time.Second {
+		t.Errorf("events.poll_interval = %v, want the default", cfg.Events.PollInterval)
+	}
+}
+
+func TestLoadFormats(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": "auth:\n  mfa_required_roles: [admin, manager]\n  jwt_expires_in: 20m\n",
+		"config.yml":  "auth:\n  mfa_required_roles:\n    - admin\n    - manager\n  jwt_expires_in: 20m\n",
+		"config.toml": "[auth]\nmfa_required_roles = [\"admin\", \"manager\"]\njwt_expires_in = \"20m\"\n",
+	}
+	for name, data := range files {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := Load(append([]string{"-config", writeFile(t, name, data)}, requiredSettings...))
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if !slices.Equal(cfg.Auth.MFARequiredRoles, []string{"admin", "manager"}) {
+				t.Errorf("auth.mfa_required_roles = %v", cfg.Auth.MFARequiredRoles)
+			}
+			if cfg.Auth.JWTExpiresIn != 20*time.Minute {
+				t.Errorf("auth.jwt_expires_in = %v", cfg.Auth.JWTExpiresIn)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		data string
+		want []string
+	}{
+		{"unknown setting", "config.yaml", "server:\n  prot: 3000\n", []string{`config.yaml:2: unknown setting "server.prot"`}},
+		{"invalid value", "config.yaml", "server:\n  port: many\n", []string{`config.yaml:2: invalid server.port: "many" is not an integer`}},
+		{"list for a single value", "config.toml", "[log]\nlevel = [\"info\"]\n", []string{"config.toml: invalid log.level: a list was given for a single value"}},
+		{"unknown format", "config.json", "{}", []string{`unknown format ".json"`}},
+		{"every problem at once", "config.yaml", "server:\n  port: x\nevents:\n  poll_interval: soon\n", []string{"invalid server.port", "invalid events.poll_interval"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(append([]string{"-config", writeFile(t, tt.file, tt.data)}, requiredSettings...))
+			if err == nil {
+				t.Fatal("Load succeeded, want an error")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Load error %q does not mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadSecretFile(t *testing.T) {
+	t.Setenv("JWT_SECRET_FILE", writeFile(t, "jwt_secret", "from-file\n"))
+	args := slices.DeleteFunc(slices.Clone(requiredSettings), func(arg string) bool { return strings.HasPrefix(arg, "-auth.jwt_secret") })
+	cfg, err := Load(args)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Auth.JWTSecret != "from-file" {
+		t.Errorf("auth.jwt_secret = %q, want the file without its newline", cfg.Auth.JWTSecret)
+	}
+
+	t.Setenv("JWT_SECRET", "from-env")
+	if _, err := Load(args); err == nil || !strings.Contains(err.Error(), "JWT_SECRET and JWT_SECRET_FILE are both set") {
+		t.Errorf("Load with both set = %v, want an error", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*Config)
+		want   string
+	}{
+		{"valid", func(*Config) {}, ""},
+		{"missing secret", func(c *Config) { c.Auth.JWTSecret = "" }, "auth.jwt_secret is required (JWT_SECRET)"},
+		{"port out of range", func(c *Config) { c.Server.Port = 70000 }, "server.port must be a port between 1 and 65535"},
+		{"non positive duration", func(c *Config) { c.Idempotency.TTL = 0 }, "idempotency.ttl must be positive"},
+		{"revocation store", func(c *Config) { c.Auth.RevocationStore = "redis" }, "auth.revocation_store must be sql or memory"},
+		{"mfa role", func(c *Config) { c.Auth.MFARequiredRoles = []string{"root"} }, `"root" must be admin, manager or exec`},
+		{"mtls without ca", func(c *Config) { c.MTLS.Services = []string{"svc=admin"} }, "mtls.services needs mtls.client_ca_file"},
+		{"mtls role", func(c *Config) { c.MTLS.ClientCAFile = "ca.pem"; c.MTLS.Services = []string{"svc"} }, `"svc" must be identity=role`},
+		{"log level", func(c *Config) { c.Log.Level = "loud" }, "log.level must be one of"},
+		{"origin", func(c *Config) { c.CORS.AllowedOrigins = []string{"https://a.example/path"} }, "is not an origin"},
+		{"trace exporter", func(c *Config) { c.Tracing.Exporter = "jaeger" }, "tracing.exporter must be otlp, console or none"},
+		{"trace endpoint", func(c *Config) { c.Tracing.Exporter = "otlp"; c.Tracing.Endpoint = "localhost" }, "tracing.endpoint"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.Server.ExposePort = cfg.Server.Port
+			cfg.Server.CertFile, cfg.Server.KeyFile = "cert.pem", "key.pem"
+			cfg.Database.Host, cfg.Database.User, cfg.Database.Password, cfg.Database.Name = "db", "user", "pw", "classes"
+			cfg.Auth.JWTSecret = "secret"
+			tt.change(cfg)
+
+			err := cfg.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("Validate = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReload(t *testing.T) {
+	current := Default()
+	next := Default()
+	next.Log.Level = "debug"
+	next.RateLimit.Requests = 99
+	next.Server.Port = 4000
+
+	reloaded, needRestart := current.Reload(next)
+	if reloaded.Log.Level != "debug" || reloaded.RateLimit.Requests != 99 {
+		t.Errorf("reloadable settings were not taken: log.level %q, rate_limit.requests %d", reloaded.Log.Level, reloaded.RateLimit.Requests)
+	}
+	if reloaded.Server.Port != current.Server.Port {
+		t.Errorf("server.port = %d, want it unchanged until a restart", reloaded.Server.Port)
+	}
+	if !slices.Equal(needRestart, []string{"server.port"}) {
+		t.Errorf("needRestart = %v, want [server.port]", needRestart)
+	}
+	if current.Log.Level != "info" {
+		t.Errorf("Reload changed the current config")
+	}
+}
@@ -0,0 +1,237 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// setting is a field of Config with the metadata of its tags
+type setting struct {
+	key    string
+	env    string
+	help   string
+	secret bool
+	reload bool
+	value  reflect.Value
+}
+
+// settingsOf lists the settings of cfg in declaration order; their values are addressable
+func settingsOf(cfg *Config) []setting {
+	var settings []setting
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		for i := range v.NumField() {
+			field := v.Type().Field(i)
+			key := prefix + field.Tag.Get("key")
+			if field.Type.Kind() == reflect.Struct {
+				walk(v.Field(i), key+".")
+				continue
+			}
+			settings = append(settings, setting{
+				key:    key,
+				env:    field.Tag.Get("env"),
+				help:   field.Tag.Get("help"),
+				secret: field.Tag.Get("secret") == "true",
+				reload: field.Tag.Get("reload") == "true",
+				value:  v.Field(i),
+			})
+		}
+	}
+	walk(reflect.ValueOf(cfg).Elem(), "")
+	return settings
+}
+
+func settingByKey(cfg *Config, key string) setting {
+	for _, s := range settingsOf(cfg) {
+		if s.key == key {
+			return s
+		}
+	}
+	panic("config: no setting " + key)
+}
+
+// envOf returns the environment variable of the setting with key
+func envOf(key string) string {
+	return settingByKey(new(Config), key).env
+}
+
+func equal(a, b reflect.Value) bool {
+	return reflect.DeepEqual(a.Interface(), b.Interface())
+}
+
+// parse sets v from its text form. Lists are comma separated.
+func parse(v reflect.Value, raw string) error {
+	if v.Kind() == reflect.String {
+		// Strings are kept as given; a secret may well start or end with a space
+		v.SetString(raw)
+		return nil
+	}
+	raw = strings.TrimSpace(raw)
+	switch {
+	case v.Type() == reflect.TypeFor[time.Duration]():
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration such as 30s or 5m", raw)
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", raw)
+		}
+		v.SetInt(int64(n))
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", raw)
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		panic("config: unsupported setting type " + v.Type().String())
+	}
+	return nil
+}
+
+// entry is a setting read from a file, with a string or []string value and the line of its
+// key when the format tells it
+type entry struct {
+	key   string
+	value any
+	line  int
+}
+
+type loader struct {
+	settings map[string]setting
+	errs     []error
+}
+
+func newLoader(cfg *Config) *loader {
+	l := &loader{settings: make(map[string]setting)}
+	for _, s := range settingsOf(cfg) {
+		l.settings[s.key] = s
+	}
+	return l
+}
+
+func (l *loader) errorf(format string, args ...any) {
+	l.errs = append(l.errs, fmt.Errorf(format, args...))
+}
+
+func (l *loader) set(key, raw, source string) {
+	if err := parse(l.settings[key].value, raw); err != nil {
+		l.errorf("%s: invalid %s: %v", source, key, err)
+	}
+}
+
+func (l *loader) load(args []string) error {
+	flags := flag.NewFlagSet("rest-srv", flag.ContinueOnError)
+	configFile := flags.String("config", os.Getenv("CONFIG_FILE"), "YAML or TOML configuration file (CONFIG_FILE)")
+	// Flags are applied last, so they are only collected while parsing
+	var flagValues [][2]string
+	for _, s := range settingsOf(new(Config)) {
+		flags.Func(s.key, fmt.Sprintf("%s (%s)", s.help, s.env), func(value string) error {
+			flagValues = append(flagValues, [2]string{s.key, value})
+			return nil
+		})
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+
+	if *configFile != "" {
+		l.loadFile(*configFile)
+	}
+	l.loadEnv()
+	for _, fv := range flagValues {
+		l.set(fv[0], fv[1], "flag -"+fv[0])
+	}
+	return errors.Join(l.errs...)
+}
+
+func (l *loader) loadFile(path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		l.errorf("reading config file: %v", err)
+		return
+	}
+	var entries []entry
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		entries, err = parseYAML(string(data))
+	case ".toml":
+		entries, err = parseTOML(string(data))
+	default:
+		err = fmt.Errorf("unknown format %q, use .yaml, .yml or .toml", ext)
+	}
+	if err != nil {
+		l.errorf("%s: %v", path, err)
+		return
+	}
+
+	for _, e := range entries {
+		source := path
+		if e.line > 0 {
+			source = fmt.Sprintf("%s:%d", path, e.line)
+		}
+		s, ok := l.settings[e.key]
+		if !ok {
+			l.errorf("%s: unknown setting %q", source, e.key)
+			continue
+		}
+		switch value := e.value.(type) {
+		case string:
+			l.set(e.key, value, source)
+		case []string:
+			if s.value.Kind() != reflect.Slice {
+				l.errorf("%s: invalid %s: a list was given for a single value", source, e.key)
+				continue
+			}
+			s.value.Set(reflect.ValueOf(value))
+		}
+	}
+}
+
+func (l *loader) loadEnv() {
+	for _, s := range settingsOf(new(Config)) {
+		value := os.Getenv(s.env)
+		if value != "" {
+			l.set(s.key, value, s.env)
+		}
+		if !s.secret {
+			continue
+		}
+		path := os.Getenv(s.env + "_FILE")
+		if path == "" {
+			continue
+		}
+		if value != "" {
+			l.errorf("%s and %s_FILE are both set, use one", s.env, s.env)
+			continue
+		}
+		secret, err := os.ReadFile(path)
+		if err != nil {
+			l.errorf("%s_FILE: %v", s.env, err)
+			continue
+		}
+		// Files written by editors and echo end with a newline that isn't part of the secret
+		l.set(s.key, strings.TrimRight(string(secret), "\r\n"), s.env+"_FILE")
+	}
+}
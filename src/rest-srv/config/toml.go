@@ -0,0 +1,68 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/BurntSushi/toml"
+)
+
+// parseTOML reads a TOML configuration: tables whose values are strings, numbers, booleans
+// or arrays of those. TOML doesn't tell the line of a key, so entries have none.
+func parseTOML(data string) ([]entry, error) {
+	var doc map[string]any
+	if _, err := toml.Decode(data, &doc); err != nil {
+		return nil, err
+	}
+	var entries []entry
+	if err := tomlEntries(doc, "", &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// tomlEntries appends the entries of a table, its keys prefixed with prefix
+func tomlEntries(table map[string]any, prefix string, entries *[]entry) error {
+	keys := make([]string, 0, len(table))
+	for key := range table {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, name := range keys {
+		key := prefix + name
+		switch value := table[name].(type) {
+		case map[string]any:
+			if err := tomlEntries(value, key+".", entries); err != nil {
+				return err
+			}
+		case []any:
+			items := make([]string, 0, len(value))
+			for _, item := range value {
+				scalar, ok := tomlScalar(item)
+				if !ok {
+					return fmt.Errorf("the items of %s must be strings, numbers or booleans", key)
+				}
+				items = append(items, scalar)
+			}
+			*entries = append(*entries, entry{key: key, value: items})
+		default:
+			scalar, ok := tomlScalar(value)
+			if !ok {
+				return fmt.Errorf("%s must be a string, number, boolean or array of those", key)
+			}
+			*entries = append(*entries, entry{key: key, value: scalar})
+		}
+	}
+	return nil
+}
+
+// tomlScalar returns the text form of a string, number or boolean
+func tomlScalar(value any) (string, bool) {
+	switch value := value.(type) {
+	case string:
+		return value, true
+	case int64, float64, bool:
+		return fmt.Sprint(value), true
+	}
+	return "", false
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// parseYAML reads a YAML configuration: nested mappings whose values are scalars or lists
+// of scalars. A key with no value is null, which sets the setting to its zero value.
+func parseYAML(data string) ([]entry, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(data), &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	var entries []entry
+	if err := yamlEntries(doc.Content[0], "", &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// yamlEntries appends the entries of a mapping, its keys prefixed with prefix
+func yamlEntries(node *yaml.Node, prefix string, entries *[]entry) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("line %d: expected keys", node.Line)
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode, value := node.Content[i], node.Content[i+1]
+		for value.Kind == yaml.AliasNode {
+			value = value.Alias
+		}
+		key := prefix + keyNode.Value
+		switch value.Kind {
+		case yaml.MappingNode:
+			if err := yamlEntries(value, key+".", entries); err != nil {
+				return err
+			}
+		case yaml.SequenceNode:
+			items := make([]string, 0, len(value.Content))
+			for _, item := range value.Content {
+				if item.Kind != yaml.ScalarNode {
+					return fmt.Errorf("line %d: the items of %s must be scalars", item.Line, key)
+				}
+				items = append(items, item.Value)
+			}
+			*entries = append(*entries, entry{key: key, value: items, line: keyNode.Line})
+		default:
+			scalar := value.Value
+			if value.Tag == "!!null" {
+				scalar = ""
+			}
+			*entries = append(*entries, entry{key: key, value: scalar, line: keyNode.Line})
+		}
+	}
+	return nil
+}
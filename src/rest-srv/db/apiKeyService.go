@@ -0,0 +1,120 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"rest-srv/models"
+	"rest-srv/utility"
+)
+
+// apiKeyLastUsedPrecision is how stale the last use of a key may be, so that a busy key is
+// not written on every request
+const apiKeyLastUsedPrecision = time.Minute
+
+const apiKeyColumns = "k.id, k.exec_id, k.name, k.prefix, k.key_hash, k.scopes, k.created_at, k.expires_at, k.last_used_at, k.revoked_at"
+
+func scanAPIKey(scan func(dest ...any) error, extra ...any) (models.APIKey, error) {
+	var key models.APIKey
+	var scopes string
+	var expiresAt, lastUsedAt, revokedAt sql.NullTime
+	dest := append([]any{&key.ID, &key.ExecID, &key.Name, &key.Prefix, &key.KeyHash, &scopes, &key.CreatedAt, &expiresAt, &lastUsedAt, &revokedAt}, extra...)
+	if err := scan(dest...); err != nil {
+		return models.APIKey{}, err
+	}
+	key.Scopes = strings.Split(scopes, ",")
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return key, nil
+}
+
+func AddAPIKey(ctx context.Context, key models.APIKey) (models.APIKey, error) {
+	res, err := conn(ctx).ExecContext(ctx, "INSERT INTO api_keys (exec_id, name, prefix, key_hash, scopes, expires_at) VALUES (?, ?, ?, ?, ?, ?)", key.ExecID, key.Name, key.Prefix, key.KeyHash, strings.Join(key.Scopes, ","), key.ExpiresAt)
+	if err != nil {
+		return models.APIKey{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	lastID, err := res.LastInsertId()
+	if err != nil {
+		return models.APIKey{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	key.ID = int(lastID)
+	key.CreatedAt = time.Now()
+	return key, nil
+}
+
+// GetAPIKeysByExec lists the keys of an exec, revoked and expired ones included
+func GetAPIKeysByExec(ctx context.Context, execID int) ([]models.APIKey, error) {
+	rows, err := conn(ctx).QueryContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys k WHERE k.exec_id = ? ORDER BY k.id", execID)
+	if err != nil {
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	defer rows.Close()
+	keys := []models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows.Scan)
+		if err != nil {
+			return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	return keys, nil
+}
+
+// GetAPIKeyByPrefix returns the key starting with prefix and the exec it acts as, with the
+// username, role and status the key is authorized by
+func GetAPIKeyByPrefix(ctx context.Context, prefix string) (models.APIKey, models.Exec, error) {
+	var exec models.Exec
+	row := conn(ctx).QueryRowContext(ctx, "SELECT "+apiKeyColumns+", e.username, e.role, e.inactive_status FROM api_keys k JOIN execs e ON e.id = k.exec_id WHERE k.prefix = ?", prefix)
+	key, err := scanAPIKey(row.Scan, &exec.Username, &exec.Role, &exec.InactiveStatus)
+	if err == sql.ErrNoRows {
+		return models.APIKey{}, models.Exec{}, utility.ErrorHandlerContext(ctx, err, "api key not found")
+	}
+	if err != nil {
+		return models.APIKey{}, models.Exec{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	exec.ID = key.ExecID
+	return key, exec, nil
+}
+
+// RevokeAPIKey revokes the key id of an exec. It takes effect on the next request made with it.
+func RevokeAPIKey(ctx context.Context, execID int, id int) (models.APIKey, error) {
+	row := conn(ctx).QueryRowContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys k WHERE k.id = ? AND k.exec_id = ?", id, execID)
+	key, err := scanAPIKey(row.Scan)
+	if err == sql.ErrNoRows {
+		return models.APIKey{}, utility.ErrorHandlerContext(ctx, err, "api key not found")
+	}
+	if err != nil {
+		return models.APIKey{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	if key.RevokedAt != nil {
+		return key, nil
+	}
+	now := time.Now()
+	if _, err := conn(ctx).ExecContext(ctx, "UPDATE api_keys SET revoked_at = ? WHERE id = ?", now, id); err != nil {
+		return models.APIKey{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	key.RevokedAt = &now
+	return key, nil
+}
+
+// TouchAPIKey records that the key id was just used
+func TouchAPIKey(ctx context.Context, id int) error {
+	now := time.Now()
+	_, err := conn(ctx).ExecContext(ctx, "UPDATE api_keys SET last_used_at = ? WHERE id = ? AND (last_used_at IS NULL OR last_used_at < ?)", now, id, now.Add(-apiKeyLastUsedPrecision))
+	if err != nil {
+		return utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"rest-srv/utility"
+)
+
+// modelColumns returns the db column names of a model in field order
+func modelColumns(model any) []string {
+	modelType := reflect.TypeOf(model)
+	var columns []string
+	for i := 0; i < modelType.NumField(); i++ {
+		dbTag := modelType.Field(i).Tag.Get("db")
+		if dbTag == "" {
+			continue
+		}
+		columns = append(columns, strings.Split(dbTag, ",")[0])
+	}
+	return columns
+}
+
+// resolveColumns returns the columns to select for a sparse fieldset. An empty fields list
+// selects every column in all; otherwise each field must be one of all, and id plus any
+// required columns are always selected.
+func resolveColumns(all []string, fields []string, required ...string) ([]string, error) {
+	if len(fields) == 0 {
+		return all, nil
+	}
+	for _, field := range fields {
+		if !slices.Contains(all, field) {
+			return nil, fmt.Errorf("unknown field %s", field)
+		}
+	}
+	columns := make([]string, 0, len(all))
+	for _, column := range all {
+		if column == "id" || slices.Contains(fields, column) || slices.Contains(required, column) {
+			columns = append(columns, column)
+		}
+	}
+	return columns, nil
+}
+
+// scanTargets returns pointers to the fields of dest (a pointer to a model) matching columns, in order
+func scanTargets(dest any, columns []string) []any {
+	destValue := reflect.ValueOf(dest).Elem()
+	destType := destValue.Type()
+	targets := make([]any, len(columns))
+	for i := 0; i < destType.NumField(); i++ {
+		columnName := strings.Split(destType.Field(i).Tag.Get("db"), ",")[0]
+		if index := slices.Index(columns, columnName); index >= 0 {
+			targets[index] = destValue.Field(i).Addr().Interface()
+		}
+	}
+	return targets
+}
+
+// inPlaceholders returns "?, ?, ?" for n values
+func inPlaceholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// lockOrder returns the indexes of ids sorted by id, the order in which rows are locked so
+// that two transactions locking some of the same rows do not deadlock
+func lockOrder(ids []int) []int {
+	order := make([]int, len(ids))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int { return ids[a] - ids[b] })
+	return order
+}
+
+// atIndex prefixes the violations in err with the index of the record in a list, as the
+// handlers report those of a list. Other errors are returned as they are.
+func atIndex(err error, index int) error {
+	var violations utility.ValidationErrors
+	if errors.As(err, &violations) {
+		return violations.AtIndex(index)
+	}
+	return err
+}
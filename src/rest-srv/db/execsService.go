@@ -1,10 +1,12 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -50,56 +52,106 @@ func getExecStructValues(model any) []any {
 	return values
 }
 
-func GetExecById(id int) (models.Exec, error) {
-	row := Db.QueryRow("SELECT id, first_name, last_name, email, username, password, password_changed_at, user_created_at, password_reset_token, inactive_status, role FROM execs WHERE id = ?", id)
+// Columns selected for execs by default. The password can't be requested as a sparse field.
+var execColumns = []string{"id", "first_name", "last_name", "email", "username", "password", "password_changed_at", "user_created_at", "password_reset_token", "password_token_expires", "inactive_status", "role"}
+
+func resolveExecColumns(fields []string) ([]string, error) {
+	if slices.Contains(fields, "password") {
+		return nil, errors.New("unknown field password")
+	}
+	return resolveColumns(execColumns, fields)
+}
+
+func GetExecById(ctx context.Context, id int) (models.Exec, error) {
+	return GetExecByIdFields(ctx, id, nil)
+}
+
+// GetExecByIdFields retrieves an exec selecting only the given fields (all fields when empty)
+func GetExecByIdFields(ctx context.Context, id int, fields []string) (models.Exec, error) {
+	columns, err := resolveExecColumns(fields)
+	if err != nil {
+		return models.Exec{}, err
+	}
+	row := conn(ctx).QueryRowContext(ctx, fmt.Sprintf("SELECT %s FROM execs WHERE id = ?", strings.Join(columns, ", ")), id)
 	var exec models.Exec
-	err := row.Scan(&exec.ID, &exec.FirstName, &exec.LastName, &exec.Email, &exec.Username, &exec.Password, &exec.PasswordChangedAt, &exec.UserCreatedAt, &exec.PasswordResetToken, &exec.InactiveStatus, &exec.Role)
+	err = row.Scan(scanTargets(&exec, columns)...)
 	if err == sql.ErrNoRows {
-		return models.Exec{}, utility.ErrorHandler(err, "exec not found")
+		return models.Exec{}, utility.ErrorHandlerContext(ctx, err, "exec not found")
 	}
 	if err != nil {
-		return models.Exec{}, utility.ErrorHandler(err, "unable to retrieve exec")
+		return models.Exec{}, utility.ErrorHandlerContext(ctx, err, "unable to retrieve exec")
 	}
 	return exec, nil
 }
 
-func GetExecByUsername(username string) (models.Exec, error) {
-	row := Db.QueryRow("SELECT id, first_name, last_name, email, username, password, password_changed_at, user_created_at, password_reset_token, inactive_status, role FROM execs WHERE username = ?", username)
+// getExecForUpdate reads an exec inside the transaction of ctx and locks its row until the
+// transaction ends, so that concurrent updates of the exec wait for each other
+func getExecForUpdate(ctx context.Context, id int) (models.Exec, error) {
+	row := conn(ctx).QueryRowContext(ctx, fmt.Sprintf("SELECT %s FROM execs WHERE id = ? FOR UPDATE", strings.Join(execColumns, ", ")), id)
+	var exec models.Exec
+	err := row.Scan(scanTargets(&exec, execColumns)...)
+	if err == sql.ErrNoRows {
+		return models.Exec{}, utility.ErrorHandlerContext(ctx, err, "exec not found")
+	}
+	if err != nil {
+		return models.Exec{}, utility.ErrorHandlerContext(ctx, err, "unable to retrieve exec")
+	}
+	return exec, nil
+}
+
+// GetExecSessionState returns what decides whether the session tokens of an exec are still
+// valid: when the password was last changed, zero if never, and whether the exec is inactive
+func GetExecSessionState(ctx context.Context, id int) (time.Time, bool, error) {
+	var passwordChangedAt sql.NullTime
+	var inactive bool
+	err := conn(ctx).QueryRowContext(ctx, "SELECT password_changed_at, inactive_status FROM execs WHERE id = ?", id).Scan(&passwordChangedAt, &inactive)
+	if err == sql.ErrNoRows {
+		return time.Time{}, false, utility.ErrorHandlerContext(ctx, err, "exec not found")
+	}
+	if err != nil {
+		return time.Time{}, false, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	// The zero time when the password was never changed
+	return passwordChangedAt.Time, inactive, nil
+}
+
+func GetExecByUsername(ctx context.Context, username string) (models.Exec, error) {
+	row := conn(ctx).QueryRowContext(ctx, "SELECT id, first_name, last_name, email, username, password, password_changed_at, user_created_at, password_reset_token, inactive_status, role FROM execs WHERE username = ?", username)
 	var exec models.Exec
 	err := row.Scan(&exec.ID, &exec.FirstName, &exec.LastName, &exec.Email, &exec.Username, &exec.Password, &exec.PasswordChangedAt, &exec.UserCreatedAt, &exec.PasswordResetToken, &exec.InactiveStatus, &exec.Role)
 	if err == sql.ErrNoRows {
-		return models.Exec{}, utility.ErrorHandler(err, "exec not found")
+		return models.Exec{}, utility.ErrorHandlerContext(ctx, err, "exec not found")
 	}
 	if err != nil {
-		return models.Exec{}, utility.ErrorHandler(err, "unable to retrieve exec")
+		return models.Exec{}, utility.ErrorHandlerContext(ctx, err, "unable to retrieve exec")
 	}
 	return exec, nil
 }
 
-func GetExecByEmail(email string) (models.Exec, error) {
-	row := Db.QueryRow("SELECT id, first_name, last_name, email, username, password, password_changed_at, user_created_at, password_reset_token, inactive_status, role FROM execs WHERE email = ?", email)
+func GetExecByEmail(ctx context.Context, email string) (models.Exec, error) {
+	row := conn(ctx).QueryRowContext(ctx, "SELECT id, first_name, last_name, email, username, password, password_changed_at, user_created_at, password_reset_token, inactive_status, role FROM execs WHERE email = ?", email)
 	var exec models.Exec
 	err := row.Scan(&exec.ID, &exec.FirstName, &exec.LastName, &exec.Email, &exec.Username, &exec.Password, &exec.PasswordChangedAt, &exec.UserCreatedAt, &exec.PasswordResetToken, &exec.InactiveStatus, &exec.Role)
 	if err == sql.ErrNoRows {
-		return models.Exec{}, utility.ErrorHandler(err, "exec not found")
+		return models.Exec{}, utility.ErrorHandlerContext(ctx, err, "exec not found")
 	}
 
 	if err != nil {
-		return models.Exec{}, utility.ErrorHandler(err, "unable to retrieve exec")
+		return models.Exec{}, utility.ErrorHandlerContext(ctx, err, "unable to retrieve exec")
 	}
 	return exec, nil
 }
 
-func GetExecByPasswordResetToken(token string) (models.Exec, error) {
+func GetExecByPasswordResetToken(ctx context.Context, token string) (models.Exec, error) {
 	expiresCompare := time.Now().Format("2006-01-02 15:04:05")
-	row := Db.QueryRow("SELECT id, first_name, last_name, email, username, password, password_changed_at, user_created_at, password_reset_token, password_token_expires, inactive_status, role FROM execs WHERE password_reset_token = ? AND password_token_expires > ?", token, expiresCompare)
+	row := conn(ctx).QueryRowContext(ctx, "SELECT id, first_name, last_name, email, username, password, password_changed_at, user_created_at, password_reset_token, password_token_expires, inactive_status, role FROM execs WHERE password_reset_token = ? AND password_token_expires > ?", token, expiresCompare)
 	var exec models.Exec
 	err := row.Scan(&exec.ID, &exec.FirstName, &exec.LastName, &exec.Email, &exec.Username, &exec.Password, &exec.PasswordChangedAt, &exec.UserCreatedAt, &exec.PasswordResetToken, &exec.PasswordTokenExpires, &exec.InactiveStatus, &exec.Role)
 	if err == sql.ErrNoRows {
-		return models.Exec{}, utility.ErrorHandler(err, "exec not found")
+		return models.Exec{}, utility.ErrorHandlerContext(ctx, err, "exec not found")
 	}
 	if err != nil {
-		return models.Exec{}, utility.ErrorHandler(err, "unable to retrieve exec")
+		return models.Exec{}, utility.ErrorHandlerContext(ctx, err, "unable to retrieve exec")
 	}
 	return exec, nil
 }
@@ -107,7 +159,12 @@ func GetExecByPasswordResetToken(token string) (models.Exec, error) {
 // GetExecs retrieves execs with optional filters and sorting
 // filters: map of field name to filter value (e.g., map[string]string{"email": "test@example.com"})
 // sortParams: slice of strings in the format "field:asc" or "field:desc"
-func GetExecs(filters map[string]string, sortParams []string) ([]models.Exec, error) {
+// fields: columns to select (all columns when empty)
+func GetExecs(ctx context.Context, filters map[string]string, sortParams []string, fields []string) ([]models.Exec, error) {
+	columns, err := resolveExecColumns(fields)
+	if err != nil {
+		return nil, err
+	}
 	var query string
 	var orderByClauses []string
 	var whereClauses []string
@@ -149,7 +206,7 @@ func GetExecs(filters map[string]string, sortParams []string) ([]models.Exec, er
 	}
 
 	// Build query with WHERE and ORDER BY clauses
-	query = "SELECT id, first_name, last_name, email, username, password, password_changed_at, user_created_at, password_reset_token, inactive_status, role FROM execs"
+	query = fmt.Sprintf("SELECT %s FROM execs", strings.Join(columns, ", "))
 	if len(whereClauses) > 0 {
 		query += " WHERE " + strings.Join(whereClauses, " AND ")
 	}
@@ -159,24 +216,23 @@ func GetExecs(filters map[string]string, sortParams []string) ([]models.Exec, er
 
 	execsList := make([]models.Exec, 0)
 	var rows *sql.Rows
-	var err error
 
 	// Execute query with parameterized values
 	if len(filterValues) > 0 {
-		rows, err = Db.Query(query, filterValues...)
+		rows, err = conn(ctx).QueryContext(ctx, query, filterValues...)
 	} else {
-		rows, err = Db.Query(query)
+		rows, err = conn(ctx).QueryContext(ctx, query)
 	}
 	if err != nil {
-		return nil, utility.ErrorHandler(err, "unable to retrieve execs")
+		return nil, utility.ErrorHandlerContext(ctx, err, "unable to retrieve execs")
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		var exec models.Exec
-		err = rows.Scan(&exec.ID, &exec.FirstName, &exec.LastName, &exec.Email, &exec.Username, &exec.Password, &exec.PasswordChangedAt, &exec.UserCreatedAt, &exec.PasswordResetToken, &exec.InactiveStatus, &exec.Role)
+		err = rows.Scan(scanTargets(&exec, columns)...)
 		if err != nil {
-			return nil, utility.ErrorHandler(err, "unable to process exec data")
+			return nil, utility.ErrorHandlerContext(ctx, err, "unable to process exec data")
 		}
 		execsList = append(execsList, exec)
 	}
@@ -184,11 +240,22 @@ func GetExecs(filters map[string]string, sortParams []string) ([]models.Exec, er
 	return execsList, nil
 }
 
-func AddExecs(execs []models.Exec) ([]models.Exec, error) {
+func AddExecs(ctx context.Context, execs []models.Exec) ([]models.Exec, error) {
 	query := utility.GenerateInsertQuery(execs[0], "execs")
-	stmt, err := Db.Prepare(query)
+	tx, err := begin(ctx)
 	if err != nil {
-		return nil, utility.ErrorHandler(err, "database error")
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rollbackNeeded := true
+	defer func() {
+		if rollbackNeeded {
+			tx.Rollback()
+		}
+	}()
+
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
 	defer stmt.Close()
 
@@ -198,21 +265,31 @@ func AddExecs(execs []models.Exec) ([]models.Exec, error) {
 		if err != nil {
 			if strings.Contains(err.Error(), "Duplicate entry") {
 				if strings.Contains(err.Error(), "email") {
-					return nil, utility.ErrorHandler(err, "email already exists")
+					return nil, utility.ErrorHandlerContext(ctx, err, "email already exists")
 				}
 				if strings.Contains(err.Error(), "username") {
-					return nil, utility.ErrorHandler(err, "username already exists")
+					return nil, utility.ErrorHandlerContext(ctx, err, "username already exists")
 				}
 			}
-			return nil, utility.ErrorHandler(err, "database error")
+			return nil, utility.ErrorHandlerContext(ctx, err, "database error")
 		}
 		lastID, err := res.LastInsertId()
 		if err != nil {
-			return nil, utility.ErrorHandler(err, "database error")
+			return nil, utility.ErrorHandlerContext(ctx, err, "database error")
 		}
 		addedExecs[i] = exec
 		addedExecs[i].ID = int(lastID)
+		err = writeOutboxEvent(ctx, tx, "exec", "created", addedExecs[i].ID, execEventData(addedExecs[i]), nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
+	rollbackNeeded = false
 
 	return addedExecs, nil
 }
@@ -220,13 +297,10 @@ func AddExecs(execs []models.Exec) ([]models.Exec, error) {
 func PatchExecFields(exec *models.Exec, updatedFields map[string]any) {
 	execVal := reflect.ValueOf(exec).Elem()
 	execType := execVal.Type()
+	patchable := exec.PatchableFields()
 	for key, value := range updatedFields {
-		// Skip id field - it shouldn't be updated via PATCH
-		if key == "id" {
-			continue
-		}
-		// Skip user_created_at - it shouldn't be updated
-		if key == "user_created_at" {
+		// Fields outside the patchable ones, such as the id, are never updated via PATCH
+		if !slices.Contains(patchable, key) {
 			continue
 		}
 		for i := 0; i < execVal.NumField(); i++ {
@@ -235,45 +309,72 @@ func PatchExecFields(exec *models.Exec, updatedFields map[string]any) {
 			// Extract the field name from the JSON tag (remove ",omitempty" if present)
 			jsonFieldName := strings.Split(jsonTag, ",")[0]
 			if jsonFieldName == key && execVal.Field(i).CanSet() {
-				execVal.Field(i).Set(reflect.ValueOf(value).Convert(execVal.Field(i).Type()))
+				// Values of the wrong type are left out, ValidatePartial reports them
+				if converted, ok := utility.ConvertJSONValue(value, field.Type); ok {
+					execVal.Field(i).Set(converted)
+				}
 				break
 			}
 		}
 	}
 }
 
-func PatchExec(id int, updateFields map[string]any) (models.Exec, error) {
-	exec, err := GetExecById(id)
+func PatchExec(ctx context.Context, id int, updateFields map[string]any) (models.Exec, error) {
+	tx, err := begin(ctx)
+	if err != nil {
+		return models.Exec{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rollbackNeeded := true
+	defer func() {
+		if rollbackNeeded {
+			tx.Rollback()
+		}
+	}()
+
+	// Read the exec with its row locked, so that a concurrent patch is not lost
+	exec, err := getExecForUpdate(WithTx(ctx, tx.Tx), id)
 	if err != nil {
 		return models.Exec{}, err
 	}
 	if exec == (models.Exec{}) {
-		return models.Exec{}, utility.ErrorHandler(errors.New("exec not found"), "exec not found")
+		return models.Exec{}, utility.ErrorHandlerContext(ctx, errors.New("exec not found"), "exec not found")
 	}
 
 	// Apply patch updates to exec
+	previous := exec
 	PatchExecFields(&exec, updateFields)
+	// The violations are returned as they are, for the handler to list them with a 400
 	err = exec.Validate()
 	if err != nil {
-		return models.Exec{}, utility.ErrorHandler(err, "invalid fields")
+		return models.Exec{}, err
 	}
 
 	// Update database
-	stmt, err := Db.Prepare("UPDATE execs SET first_name = ?, last_name = ?, email = ?, username = ?, password = ?, password_changed_at = ?, password_reset_token = ?, inactive_status = ?, role = ? WHERE id = ?")
+	stmt, err := tx.PrepareContext(ctx, "UPDATE execs SET first_name = ?, last_name = ?, email = ?, username = ?, password = ?, password_changed_at = ?, password_reset_token = ?, inactive_status = ?, role = ? WHERE id = ?")
 	if err != nil {
-		return models.Exec{}, utility.ErrorHandler(err, "database error")
+		return models.Exec{}, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
 	defer stmt.Close()
 	_, err = stmt.Exec(exec.FirstName, exec.LastName, exec.Email, exec.Username, exec.Password, exec.PasswordChangedAt, exec.PasswordResetToken, exec.InactiveStatus, exec.Role, exec.ID)
 	if err != nil {
-		return models.Exec{}, utility.ErrorHandler(err, "database error")
+		return models.Exec{}, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
+	err = writeOutboxEvent(ctx, tx, "exec", "updated", exec.ID, execEventData(exec), execEventData(previous))
+	if err != nil {
+		return models.Exec{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return models.Exec{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rollbackNeeded = false
 	return exec, nil
 }
 
-func UpdateExec(id int, updatedExec models.Exec) (models.Exec, error) {
+func UpdateExec(ctx context.Context, id int, updatedExec models.Exec) (models.Exec, error) {
 	// Verify exec exists before updating
-	_, err := GetExecById(id)
+	previous, err := GetExecById(ctx, id)
 	if err != nil {
 		return models.Exec{}, err
 	}
@@ -281,25 +382,124 @@ func UpdateExec(id int, updatedExec models.Exec) (models.Exec, error) {
 	// Set the ID from the parameter
 	updatedExec.ID = id
 
+	tx, err := begin(ctx)
+	if err != nil {
+		return models.Exec{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rollbackNeeded := true
+	defer func() {
+		if rollbackNeeded {
+			tx.Rollback()
+		}
+	}()
+
 	// Update database
-	stmt, err := Db.Prepare("UPDATE execs SET first_name = ?, last_name = ?, email = ?, username = ?, password = ?, password_changed_at = ?, password_reset_token = ?, password_token_expires = ?, inactive_status = ?, role = ? WHERE id = ?")
+	stmt, err := tx.PrepareContext(ctx, "UPDATE execs SET first_name = ?, last_name = ?, email = ?, username = ?, password = ?, password_changed_at = ?, password_reset_token = ?, password_token_expires = ?, inactive_status = ?, role = ? WHERE id = ?")
 	if err != nil {
-		return models.Exec{}, utility.ErrorHandler(err, "database error")
+		return models.Exec{}, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
 	defer stmt.Close()
 
 	_, err = stmt.Exec(updatedExec.FirstName, updatedExec.LastName, updatedExec.Email, updatedExec.Username, updatedExec.Password, updatedExec.PasswordChangedAt, updatedExec.PasswordResetToken, updatedExec.PasswordTokenExpires, updatedExec.InactiveStatus, updatedExec.Role, id)
 	if err != nil {
-		return models.Exec{}, utility.ErrorHandler(err, "database error")
+		return models.Exec{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+
+	err = writeOutboxEvent(ctx, tx, "exec", "updated", id, execEventData(updatedExec), execEventData(previous))
+	if err != nil {
+		return models.Exec{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return models.Exec{}, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
+	rollbackNeeded = false
 
 	return updatedExec, nil
 }
 
-func PatchExecs(updates []map[string]any) ([]models.Exec, error) {
-	tx, err := Db.Begin()
+// UpdateExecs replaces the given execs, identified by their ID, in a single transaction
+func UpdateExecs(ctx context.Context, execs []models.Exec) ([]models.Exec, error) {
+	tx, err := begin(ctx)
+	if err != nil {
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rollbackNeeded := true
+	defer func() {
+		if rollbackNeeded {
+			tx.Rollback()
+		}
+	}()
+
+	stmt, err := tx.PrepareContext(ctx, "UPDATE execs SET first_name = ?, last_name = ?, email = ?, username = ?, password = ?, password_changed_at = ?, password_reset_token = ?, password_token_expires = ?, inactive_status = ?, role = ? WHERE id = ?")
+	if err != nil {
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	defer stmt.Close()
+
+	for _, e := range execs {
+		previous, err := GetExecById(WithTx(ctx, tx.Tx), e.ID)
+		if err != nil {
+			return nil, err
+		}
+		_, err = stmt.Exec(e.FirstName, e.LastName, e.Email, e.Username, e.Password, e.PasswordChangedAt, e.PasswordResetToken, e.PasswordTokenExpires, e.InactiveStatus, e.Role, e.ID)
+		if err != nil {
+			return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+		}
+		err = writeOutboxEvent(ctx, tx, "exec", "updated", e.ID, execEventData(e), execEventData(previous))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Commit the transaction if all updates succeeded
+	err = tx.Commit()
+	if err != nil {
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rollbackNeeded = false
+
+	return execs, nil
+}
+
+// PatchExecDocuments applies patch, which returns the patched documents, to the execs
+// with the given ids and saves the result in a single transaction. The execs are read with
+// their rows locked until the update, so that the test operations of a JSON patch hold and
+// concurrent patches apply one after the other.
+func PatchExecDocuments(ctx context.Context, ids []int, patch func([]models.Exec) ([]models.Exec, error)) ([]models.Exec, error) {
+	tx, err := begin(ctx)
 	if err != nil {
-		return nil, utility.ErrorHandler(err, "database error")
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	defer tx.Rollback()
+	ctx = WithTx(ctx, tx.Tx)
+
+	current := make([]models.Exec, len(ids))
+	for _, i := range lockOrder(ids) {
+		current[i], err = getExecForUpdate(ctx, ids[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	patched, err := patch(current)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := UpdateExecs(ctx, patched)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	return updated, nil
+}
+
+func PatchExecs(ctx context.Context, updates []map[string]any) ([]models.Exec, error) {
+	tx, err := begin(ctx)
+	if err != nil {
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
 	rollbackNeeded := true
 	defer func() {
@@ -309,12 +509,12 @@ func PatchExecs(updates []map[string]any) ([]models.Exec, error) {
 	}()
 
 	updatedExecs := make([]models.Exec, 0, len(updates))
-	for _, update := range updates {
+	for i, update := range updates {
 		// Extract and validate ID
 		idVal, ok := update["id"]
 		if !ok {
 			rollbackNeeded = true
-			return nil, utility.ErrorHandler(errors.New("id is required"), "id is required")
+			return nil, utility.ErrorHandlerContext(ctx, errors.New("id is required"), "id is required")
 		}
 
 		var id int
@@ -324,7 +524,7 @@ func PatchExecs(updates []map[string]any) ([]models.Exec, error) {
 			id, err = strconv.Atoi(v)
 			if err != nil {
 				rollbackNeeded = true
-				return nil, utility.ErrorHandler(err, "invalid id")
+				return nil, utility.ErrorHandlerContext(ctx, err, "invalid id")
 			}
 		case float64:
 			id = int(v)
@@ -332,35 +532,46 @@ func PatchExecs(updates []map[string]any) ([]models.Exec, error) {
 			id = v
 		default:
 			rollbackNeeded = true
-			return nil, utility.ErrorHandler(errors.New("invalid id type"), "invalid id type")
+			return nil, utility.ErrorHandlerContext(ctx, errors.New("invalid id type"), "invalid id type")
 		}
 
 		if id == 0 {
 			rollbackNeeded = true
-			return nil, utility.ErrorHandler(errors.New("no id"), "no id")
+			return nil, utility.ErrorHandlerContext(ctx, errors.New("no id"), "no id")
 		}
 
 		// Get existing exec
-		existingExec, err := GetExecById(id)
+		existingExec, err := getExecForUpdate(WithTx(ctx, tx.Tx), id)
 		if err != nil {
 			rollbackNeeded = true
 			return nil, err
 		}
 
 		// Apply patch updates to exec
+		previous := existingExec
 		PatchExecFields(&existingExec, update)
+		err = existingExec.Validate()
+		if err != nil {
+			rollbackNeeded = true
+			return nil, atIndex(err, i)
+		}
 
 		// Update database within transaction
-		stmt, err := tx.Prepare("UPDATE execs SET first_name = ?, last_name = ?, email = ?, username = ?, password = ?, password_changed_at = ?, password_reset_token = ?, inactive_status = ?, role = ? WHERE id = ?")
+		stmt, err := tx.PrepareContext(ctx, "UPDATE execs SET first_name = ?, last_name = ?, email = ?, username = ?, password = ?, password_changed_at = ?, password_reset_token = ?, inactive_status = ?, role = ? WHERE id = ?")
 		if err != nil {
 			rollbackNeeded = true
-			return nil, utility.ErrorHandler(err, "database error")
+			return nil, utility.ErrorHandlerContext(ctx, err, "database error")
 		}
 		_, err = stmt.Exec(existingExec.FirstName, existingExec.LastName, existingExec.Email, existingExec.Username, existingExec.Password, existingExec.PasswordChangedAt, existingExec.PasswordResetToken, existingExec.InactiveStatus, existingExec.Role, id)
 		stmt.Close()
 		if err != nil {
 			rollbackNeeded = true
-			return nil, utility.ErrorHandler(err, "database error")
+			return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+		}
+		err = writeOutboxEvent(ctx, tx, "exec", "updated", id, execEventData(existingExec), execEventData(previous))
+		if err != nil {
+			rollbackNeeded = true
+			return nil, err
 		}
 		updatedExecs = append(updatedExecs, existingExec)
 	}
@@ -369,46 +580,68 @@ func PatchExecs(updates []map[string]any) ([]models.Exec, error) {
 	err = tx.Commit()
 	if err != nil {
 		rollbackNeeded = true
-		return nil, utility.ErrorHandler(err, "database error")
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
 	rollbackNeeded = false
 
 	return updatedExecs, nil
 }
 
-func DeleteExec(id int) (models.Exec, error) {
+func DeleteExec(ctx context.Context, id int) (models.Exec, error) {
 	// Get exec before deleting to return it
-	exec, err := GetExecById(id)
+	exec, err := GetExecById(ctx, id)
 	if err != nil {
 		return models.Exec{}, err
 	}
 
-	stmt, err := Db.Prepare("DELETE FROM execs WHERE id = ?")
+	tx, err := begin(ctx)
 	if err != nil {
-		return models.Exec{}, utility.ErrorHandler(err, "database error")
+		return models.Exec{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rollbackNeeded := true
+	defer func() {
+		if rollbackNeeded {
+			tx.Rollback()
+		}
+	}()
+
+	stmt, err := tx.PrepareContext(ctx, "DELETE FROM execs WHERE id = ?")
+	if err != nil {
+		return models.Exec{}, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
 	defer stmt.Close()
 
 	result, err := stmt.Exec(id)
 	if err != nil {
-		return models.Exec{}, utility.ErrorHandler(err, "database error")
+		return models.Exec{}, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return models.Exec{}, utility.ErrorHandler(err, "database error")
+		return models.Exec{}, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
 	if rowsAffected == 0 {
-		return models.Exec{}, utility.ErrorHandler(errors.New("exec not found"), "exec not found")
+		return models.Exec{}, utility.ErrorHandlerContext(ctx, errors.New("exec not found"), "exec not found")
+	}
+
+	err = writeOutboxEvent(ctx, tx, "exec", "deleted", id, execEventData(exec), nil)
+	if err != nil {
+		return models.Exec{}, err
 	}
 
+	err = tx.Commit()
+	if err != nil {
+		return models.Exec{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rollbackNeeded = false
+
 	return exec, nil
 }
 
-func DeleteExecs(ids []int) ([]models.Exec, error) {
-	tx, err := Db.Begin()
+func DeleteExecs(ctx context.Context, ids []int) ([]models.Exec, error) {
+	tx, err := begin(ctx)
 	if err != nil {
-		return nil, utility.ErrorHandler(err, "database error")
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
 	rollbackNeeded := true
 	defer func() {
@@ -420,34 +653,39 @@ func DeleteExecs(ids []int) ([]models.Exec, error) {
 	deletedExecs := make([]models.Exec, 0, len(ids))
 	for _, id := range ids {
 		// Get exec before deleting to return it
-		exec, err := GetExecById(id)
+		exec, err := GetExecById(ctx, id)
 		if err != nil {
 			rollbackNeeded = true
 			return nil, err
 		}
 
-		stmt, err := tx.Prepare("DELETE FROM execs WHERE id = ?")
+		stmt, err := tx.PrepareContext(ctx, "DELETE FROM execs WHERE id = ?")
 		if err != nil {
 			rollbackNeeded = true
-			return nil, utility.ErrorHandler(err, "database error")
+			return nil, utility.ErrorHandlerContext(ctx, err, "database error")
 		}
 		result, err := stmt.Exec(id)
 		stmt.Close()
 		if err != nil {
 			rollbackNeeded = true
-			return nil, utility.ErrorHandler(err, "database error")
+			return nil, utility.ErrorHandlerContext(ctx, err, "database error")
 		}
 
 		rowsAffected, err := result.RowsAffected()
 		if err != nil {
 			rollbackNeeded = true
-			return nil, utility.ErrorHandler(err, "database error")
+			return nil, utility.ErrorHandlerContext(ctx, err, "database error")
 		}
 		if rowsAffected == 0 {
 			rollbackNeeded = true
-			return nil, utility.ErrorHandler(errors.New("exec not found"), "exec not found")
+			return nil, utility.ErrorHandlerContext(ctx, errors.New("exec not found"), "exec not found")
 		}
 
+		err = writeOutboxEvent(ctx, tx, "exec", "deleted", id, execEventData(exec), nil)
+		if err != nil {
+			rollbackNeeded = true
+			return nil, err
+		}
 		deletedExecs = append(deletedExecs, exec)
 	}
 
@@ -455,42 +693,133 @@ func DeleteExecs(ids []int) ([]models.Exec, error) {
 	err = tx.Commit()
 	if err != nil {
 		rollbackNeeded = true
-		return nil, utility.ErrorHandler(err, "database error")
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
 	rollbackNeeded = false
 
 	return deletedExecs, nil
 }
 
-func UpdateExecPassword(id int, oldPassword, newPassword string) (models.Exec, error) {
-	exec, err := GetExecById(id)
+func UpdateExecPassword(ctx context.Context, id int, oldPassword, newPassword string) (models.Exec, error) {
+	exec, err := GetExecById(ctx, id)
 	if err != nil {
 		return models.Exec{}, err
 	}
 	if exec == (models.Exec{}) {
-		return models.Exec{}, utility.ErrorHandler(errors.New("exec not found"), "exec not found")
+		return models.Exec{}, utility.ErrorHandlerContext(ctx, errors.New("exec not found"), "exec not found")
 	}
 	valid, err := utility.ComparePassword(exec.Password, oldPassword)
 	if err != nil {
-		return models.Exec{}, utility.ErrorHandler(err, "invalid old password")
+		return models.Exec{}, utility.ErrorHandlerContext(ctx, err, "invalid old password")
 	}
 	if !valid {
-		return models.Exec{}, utility.ErrorHandler(errors.New("invalid old password"), "invalid old password")
+		return models.Exec{}, utility.ErrorHandlerContext(ctx, errors.New("invalid old password"), "invalid old password")
 	}
+	return setExecPassword(ctx, exec, newPassword)
+}
+
+// ResetExecPassword sets the password of the exec a reset token was sent to, hashed as
+// hashedToken. The token is consumed with the change, so it can't be used twice.
+func ResetExecPassword(ctx context.Context, hashedToken string, newPassword string) (models.Exec, error) {
+	tx, err := begin(ctx)
+	if err != nil {
+		return models.Exec{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rollbackNeeded := true
+	defer func() {
+		if rollbackNeeded {
+			tx.Rollback()
+		}
+	}()
+
+	exec, err := GetExecByPasswordResetToken(WithTx(ctx, tx.Tx), hashedToken)
+	if err != nil {
+		return models.Exec{}, err
+	}
+	// Only one of concurrent resets with the same token clears it
+	result, err := tx.ExecContext(ctx, "UPDATE execs SET password_reset_token = NULL, password_token_expires = NULL WHERE id = ? AND password_reset_token = ?", exec.ID, hashedToken)
+	if err != nil {
+		return models.Exec{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	if rows, err := result.RowsAffected(); err != nil || rows == 0 {
+		return models.Exec{}, utility.ErrorHandlerContext(ctx, errors.New("reset token already used"), "exec not found")
+	}
+	exec.PasswordResetToken = utility.NullString{}
+	exec.PasswordTokenExpires = utility.NullString{}
+	exec, err = setExecPassword(WithTx(ctx, tx.Tx), exec, newPassword)
+	if err != nil {
+		return models.Exec{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return models.Exec{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rollbackNeeded = false
+	return exec, nil
+}
+
+// SetExecPassword replaces the password of an exec without asking for the current one, as
+// done by administrators
+func SetExecPassword(ctx context.Context, id int, newPassword string) (models.Exec, error) {
+	exec, err := GetExecById(ctx, id)
+	if err != nil {
+		return models.Exec{}, err
+	}
+	return setExecPassword(ctx, exec, newPassword)
+}
+
+func setExecPassword(ctx context.Context, exec models.Exec, newPassword string) (models.Exec, error) {
 	hashedPassword, err := utility.HashPassword(newPassword)
 	if err != nil {
-		return models.Exec{}, utility.ErrorHandler(err, "error hashing password")
+		return models.Exec{}, utility.ErrorHandlerContext(ctx, err, "error hashing password")
 	}
 	exec.Password = hashedPassword
-	exec.PasswordChangedAt = utility.NullString{NullString: sql.NullString{String: time.Now().Format(time.RFC3339), Valid: true}}
-	stmt, err := Db.Prepare("UPDATE execs SET password = ?, password_changed_at = ? WHERE id = ?")
+	// In whole seconds, as the issue times of tokens: MySQL would round a fraction up to the
+	// next second, refusing the token issued with the new password within that second
+	exec.PasswordChangedAt = utility.NewNullTime(time.Now().Truncate(time.Second))
+	tx, err := begin(ctx)
+	if err != nil {
+		return models.Exec{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rollbackNeeded := true
+	defer func() {
+		if rollbackNeeded {
+			tx.Rollback()
+		}
+	}()
+
+	stmt, err := tx.PrepareContext(ctx, "UPDATE execs SET password = ?, password_changed_at = ? WHERE id = ?")
 	if err != nil {
-		return models.Exec{}, utility.ErrorHandler(err, "database error")
+		return models.Exec{}, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
 	defer stmt.Close()
-	_, err = stmt.Exec(exec.Password, exec.PasswordChangedAt, id)
+	_, err = stmt.Exec(exec.Password, exec.PasswordChangedAt, exec.ID)
+	if err != nil {
+		return models.Exec{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	err = writeOutboxEvent(ctx, tx, "exec", "password_changed", exec.ID, execEventData(exec), nil)
 	if err != nil {
-		return models.Exec{}, utility.ErrorHandler(err, "database error")
+		return models.Exec{}, err
 	}
+	// The sessions started with the old password end; the access tokens predating the change
+	// are refused by their issue time
+	if err := RevokeExecRefreshTokens(WithTx(ctx, tx.Tx), exec.ID); err != nil {
+		return models.Exec{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return models.Exec{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rollbackNeeded = false
 	return exec, nil
 }
+
+// execEventData strips the credentials from an exec before it is published in an event
+func execEventData(exec models.Exec) models.Exec {
+	exec.Password = ""
+	exec.PasswordResetToken = utility.NullString{}
+	exec.PasswordTokenExpires = utility.NullString{}
+	return exec
+}
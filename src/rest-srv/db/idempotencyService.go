@@ -0,0 +1,66 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"rest-srv/models"
+	"rest-srv/utility"
+)
+
+// ReserveIdempotencyKey stores a new in-progress record for id. It returns false if a
+// record with the same id already exists.
+func ReserveIdempotencyKey(ctx context.Context, id string, requestHash string, expiresAt time.Time) (bool, error) {
+	_, err := conn(ctx).ExecContext(ctx, "INSERT INTO idempotency_keys (id, request_hash, status, expires_at) VALUES (?, ?, ?, ?)", id, requestHash, models.IdempotencyInProgress, expiresAt)
+	if err != nil {
+		if strings.Contains(err.Error(), "Duplicate entry") {
+			return false, nil
+		}
+		return false, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	return true, nil
+}
+
+func GetIdempotencyRecord(ctx context.Context, id string) (models.IdempotencyRecord, error) {
+	row := conn(ctx).QueryRowContext(ctx, "SELECT id, request_hash, status, response_code, response_content_type, response_body, expires_at FROM idempotency_keys WHERE id = ?", id)
+	var record models.IdempotencyRecord
+	var responseCode sql.NullInt64
+	var contentType sql.NullString
+	err := row.Scan(&record.ID, &record.RequestHash, &record.Status, &responseCode, &contentType, &record.ResponseBody, &record.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return models.IdempotencyRecord{}, utility.ErrorHandlerContext(ctx, err, "idempotency key not found")
+	}
+	if err != nil {
+		return models.IdempotencyRecord{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	record.ResponseCode = int(responseCode.Int64)
+	record.ResponseContentType = contentType.String
+	return record, nil
+}
+
+// CompleteIdempotencyKey stores the response that will be replayed for later requests with the same key
+func CompleteIdempotencyKey(ctx context.Context, id string, responseCode int, contentType string, body []byte) error {
+	_, err := conn(ctx).ExecContext(ctx, "UPDATE idempotency_keys SET status = ?, response_code = ?, response_content_type = ?, response_body = ? WHERE id = ?", models.IdempotencyCompleted, responseCode, contentType, body, id)
+	if err != nil {
+		return utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	return nil
+}
+
+func DeleteIdempotencyKey(ctx context.Context, id string) error {
+	_, err := conn(ctx).ExecContext(ctx, "DELETE FROM idempotency_keys WHERE id = ?", id)
+	if err != nil {
+		return utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	return nil
+}
+
+func DeleteExpiredIdempotencyKeys(ctx context.Context) (int64, error) {
+	result, err := conn(ctx).ExecContext(ctx, "DELETE FROM idempotency_keys WHERE expires_at < ?", time.Now())
+	if err != nil {
+		return 0, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,167 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"rest-srv/models"
+	"rest-srv/utility"
+)
+
+// GetExecMFA returns the second factor of an exec, enabled or still being enrolled
+func GetExecMFA(ctx context.Context, execID int) (models.ExecMFA, error) {
+	var mfa models.ExecMFA
+	var confirmedAt sql.NullTime
+	err := conn(ctx).QueryRowContext(ctx, "SELECT exec_id, secret, created_at, confirmed_at, last_step FROM exec_mfa WHERE exec_id = ?", execID).
+		Scan(&mfa.ExecID, &mfa.Secret, &mfa.CreatedAt, &confirmedAt, &mfa.LastStep)
+	if err == sql.ErrNoRows {
+		return models.ExecMFA{}, utility.ErrorHandlerContext(ctx, err, "mfa not found")
+	}
+	if err != nil {
+		return models.ExecMFA{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	if confirmedAt.Valid {
+		mfa.ConfirmedAt = &confirmedAt.Time
+	}
+	return mfa, nil
+}
+
+// StartMFAEnrollment keeps secret as the pending second factor of an exec, replacing an
+// enrollment that was not confirmed. It returns false when the second factor is enabled.
+func StartMFAEnrollment(ctx context.Context, execID int, secret string) (bool, error) {
+	result, err := conn(ctx).ExecContext(ctx, "INSERT INTO exec_mfa (exec_id, secret) VALUES (?, ?) ON DUPLICATE KEY UPDATE secret = IF(confirmed_at IS NULL, VALUES(secret), secret)", execID, secret)
+	if err != nil {
+		return false, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	// MySQL counts 1 for an insert, 2 for an update and 0 when the row is left as it was
+	return n > 0, nil
+}
+
+// ConfirmMFA enables the pending second factor of an exec, confirmed with the code of step,
+// and replaces the recovery codes. It returns false when there is no pending enrollment.
+func ConfirmMFA(ctx context.Context, execID int, step int64, recoveryCodeHashes []string) (bool, error) {
+	tx, err := begin(ctx)
+	if err != nil {
+		return false, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "UPDATE exec_mfa SET confirmed_at = ?, last_step = ? WHERE exec_id = ? AND confirmed_at IS NULL", time.Now(), step, execID)
+	if err != nil {
+		return false, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	if err := ReplaceRecoveryCodes(WithTx(ctx, tx.Tx), execID, recoveryCodeHashes); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	return true, nil
+}
+
+// UseTOTPStep records that the code of step was accepted for an exec. It returns false when
+// a code of this step or a later one was already accepted, so that a code is used once.
+func UseTOTPStep(ctx context.Context, execID int, step int64) (bool, error) {
+	result, err := conn(ctx).ExecContext(ctx, "UPDATE exec_mfa SET last_step = ? WHERE exec_id = ? AND confirmed_at IS NOT NULL AND last_step < ?", step, execID, step)
+	if err != nil {
+		return false, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	return n == 1, nil
+}
+
+// UseRecoveryCode marks the recovery code of an exec with hash as used. It returns false
+// when there is no such code or it was used already.
+func UseRecoveryCode(ctx context.Context, execID int, hash string) (bool, error) {
+	result, err := conn(ctx).ExecContext(ctx, "UPDATE mfa_recovery_codes SET used_at = ? WHERE exec_id = ? AND code_hash = ? AND used_at IS NULL", time.Now(), execID, hash)
+	if err != nil {
+		return false, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	return n == 1, nil
+}
+
+// CountMFAAttempt counts a code tried at login for an exec before it is verified, and returns
+// how many were tried since the last one accepted. Attempts older than window no longer count.
+func CountMFAAttempt(ctx context.Context, execID int, window time.Duration) (int, error) {
+	now := time.Now()
+	// LAST_INSERT_ID(expr) hands the count back in the result of the update itself, so that
+	// concurrent attempts each get their own count
+	result, err := conn(ctx).ExecContext(ctx, "UPDATE exec_mfa SET failed_attempts = LAST_INSERT_ID(IF(failed_at > ?, failed_attempts + 1, 1)), failed_at = ? WHERE exec_id = ?", now.Add(-window), now, execID)
+	if err != nil {
+		return 0, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return 0, err
+	}
+	attempts, err := result.LastInsertId()
+	if err != nil {
+		return 0, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	return int(attempts), nil
+}
+
+// ResetMFAAttempts clears the count of codes tried at login once one is accepted
+func ResetMFAAttempts(ctx context.Context, execID int) error {
+	_, err := conn(ctx).ExecContext(ctx, "UPDATE exec_mfa SET failed_attempts = 0, failed_at = NULL WHERE exec_id = ?", execID)
+	if err != nil {
+		return utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	return nil
+}
+
+// ReplaceRecoveryCodes replaces the recovery codes of an exec, used or not, with hashes
+func ReplaceRecoveryCodes(ctx context.Context, execID int, hashes []string) error {
+	tx, err := begin(ctx)
+	if err != nil {
+		return utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM mfa_recovery_codes WHERE exec_id = ?", execID); err != nil {
+		return utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	for _, hash := range hashes {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO mfa_recovery_codes (exec_id, code_hash) VALUES (?, ?)", execID, hash); err != nil {
+			return utility.ErrorHandlerContext(ctx, err, "database error")
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	return nil
+}
+
+// DeleteExecMFA removes the second factor of an exec and its recovery codes
+func DeleteExecMFA(ctx context.Context, execID int) error {
+	tx, err := begin(ctx)
+	if err != nil {
+		return utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM mfa_recovery_codes WHERE exec_id = ?", execID); err != nil {
+		return utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM exec_mfa WHERE exec_id = ?", execID); err != nil {
+		return utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	if err := tx.Commit(); err != nil {
+		return utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"rest-srv/utility"
+	"strings"
+	"time"
+)
+
+// Migration is a .sql file of schema changes. Migrations are applied once, in the order of
+// their names, and recorded in the schema_migrations table.
+type Migration struct {
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+const createMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations(
+  name varchar(255) primary key,
+  applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+)`
+
+// Migrations lists the migrations of fsys with the time each was applied, nil when pending
+func Migrations(ctx context.Context, fsys fs.FS) ([]Migration, error) {
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn(ctx).ExecContext(ctx, createMigrationsTable); err != nil {
+		return nil, utility.ErrorHandlerContext(ctx, err, "unable to create the schema_migrations table")
+	}
+	rows, err := conn(ctx).QueryContext(ctx, "SELECT name, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, utility.ErrorHandlerContext(ctx, err, "unable to retrieve the applied migrations")
+	}
+	defer rows.Close()
+	applied := make(map[string]time.Time)
+	for rows.Next() {
+		var name string
+		var appliedAt sql.NullTime
+		if err := rows.Scan(&name, &appliedAt); err != nil {
+			return nil, utility.ErrorHandlerContext(ctx, err, "unable to retrieve the applied migrations")
+		}
+		applied[name] = appliedAt.Time
+	}
+	if err := rows.Err(); err != nil {
+		return nil, utility.ErrorHandlerContext(ctx, err, "unable to retrieve the applied migrations")
+	}
+
+	// fs.Glob returns the names sorted
+	migrations := make([]Migration, len(names))
+	for i, name := range names {
+		migrations[i].Name = name
+		if appliedAt, ok := applied[name]; ok {
+			migrations[i].AppliedAt = &appliedAt
+		}
+	}
+	return migrations, nil
+}
+
+// Migrate runs the statements of the migration name of fsys one by one and records it. MySQL
+// commits schema changes as they run, so a failing migration is not undone: migrations create
+// tables IF NOT EXISTS, so that they can run again once fixed.
+func Migrate(ctx context.Context, fsys fs.FS, name string) error {
+	script, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return err
+	}
+	for _, statement := range splitStatements(string(script)) {
+		if _, err := conn(ctx).ExecContext(ctx, statement); err != nil {
+			return utility.ErrorHandlerContext(ctx, err, fmt.Sprintf("migration %s failed: %v", name, err))
+		}
+	}
+	if _, err := conn(ctx).ExecContext(ctx, "INSERT INTO schema_migrations (name) VALUES (?)", name); err != nil {
+		return utility.ErrorHandlerContext(ctx, err, "unable to record migration "+name)
+	}
+	return nil
+}
+
+// splitStatements splits a script at the semicolons ending its lines, as the driver runs one
+// statement at a time. USE statements are dropped: the connection already uses the configured
+// database, whatever the scripts were written against.
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+		if !strings.HasSuffix(trimmed, ";") {
+			continue
+		}
+		statement := strings.TrimSuffix(strings.TrimSpace(current.String()), ";")
+		current.Reset()
+		if !strings.HasPrefix(strings.ToLower(statement), "use ") {
+			statements = append(statements, statement)
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
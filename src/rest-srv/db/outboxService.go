@@ -0,0 +1,267 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"rest-srv/models"
+	"rest-srv/utility"
+)
+
+// writeOutboxEvent records a change event. q must be the transaction making the change so
+// the event is committed or rolled back together with it.
+func writeOutboxEvent(ctx context.Context, q queryer, entity string, action string, entityID int, data any, previous any) error {
+	payload := map[string]any{
+		"event":     entity + "." + action,
+		"entity":    entity,
+		"entity_id": entityID,
+		"data":      data,
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+	}
+	if previous != nil {
+		payload["previous"] = previous
+	}
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	_, err = q.ExecContext(ctx, "INSERT INTO outbox (event_type, entity, entity_id, payload) VALUES (?, ?, ?, ?)", entity+"."+action, entity, entityID, payloadBytes)
+	if err != nil {
+		return utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	return nil
+}
+
+// FanOutOutboxEvents creates a delivery for every active subscription matching each
+// undispatched event and marks the events dispatched. It returns the number of events handled.
+func FanOutOutboxEvents(ctx context.Context, limit int) (int, error) {
+	tx, err := begin(ctx)
+	if err != nil {
+		return 0, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rollbackNeeded := true
+	defer func() {
+		if rollbackNeeded {
+			tx.Rollback()
+		}
+	}()
+
+	rows, err := tx.QueryContext(ctx, "SELECT id, event_type FROM outbox WHERE dispatched_at IS NULL ORDER BY id LIMIT ? FOR UPDATE SKIP LOCKED", limit)
+	if err != nil {
+		return 0, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	var events []models.OutboxEvent
+	for rows.Next() {
+		var event models.OutboxEvent
+		if err := rows.Scan(&event.ID, &event.EventType); err != nil {
+			rows.Close()
+			return 0, utility.ErrorHandlerContext(ctx, err, "database error")
+		}
+		events = append(events, event)
+	}
+	rows.Close()
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	subscriptions, err := GetWebhookSubscriptions(WithTx(ctx, tx.Tx), true)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	for _, event := range events {
+		for _, subscription := range subscriptions {
+			if !subscription.Matches(event.EventType) {
+				continue
+			}
+			_, err = tx.ExecContext(ctx, "INSERT IGNORE INTO webhook_deliveries (subscription_id, event_id, status, next_attempt_at) VALUES (?, ?, ?, ?)", subscription.ID, event.ID, models.DeliveryPending, now)
+			if err != nil {
+				return 0, utility.ErrorHandlerContext(ctx, err, "database error")
+			}
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE outbox SET dispatched_at = ? WHERE id = ?", now, event.ID)
+		if err != nil {
+			return 0, utility.ErrorHandlerContext(ctx, err, "database error")
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rollbackNeeded = false
+	return len(events), nil
+}
+
+// ClaimDueWebhookDeliveries returns pending deliveries whose next attempt is due and pushes
+// their next attempt back by lease, so a delivery is not picked up twice while it is being sent
+func ClaimDueWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.PendingDelivery, error) {
+	tx, err := begin(ctx)
+	if err != nil {
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rollbackNeeded := true
+	defer func() {
+		if rollbackNeeded {
+			tx.Rollback()
+		}
+	}()
+
+	now := time.Now()
+	rows, err := tx.QueryContext(ctx, `SELECT d.id, d.subscription_id, d.event_id, d.status, d.attempts, d.next_attempt_at,
+		s.url, s.secret, o.event_type, o.entity, o.entity_id, o.payload, o.created_at
+		FROM webhook_deliveries d
+		JOIN webhook_subscriptions s ON s.id = d.subscription_id
+		JOIN outbox o ON o.id = d.event_id
+		WHERE d.status = ? AND d.next_attempt_at <= ? AND s.active = true
+		ORDER BY d.next_attempt_at LIMIT ? FOR UPDATE SKIP LOCKED`, models.DeliveryPending, now, limit)
+	if err != nil {
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	var pending []models.PendingDelivery
+	for rows.Next() {
+		var p models.PendingDelivery
+		err := rows.Scan(&p.Delivery.ID, &p.Delivery.SubscriptionID, &p.Delivery.EventID, &p.Delivery.Status, &p.Delivery.Attempts, &p.Delivery.NextAttemptAt,
+			&p.Subscription.URL, &p.Subscription.Secret, &p.Event.EventType, &p.Event.Entity, &p.Event.EntityID, &p.Event.Payload, &p.Event.CreatedAt)
+		if err != nil {
+			rows.Close()
+			return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+		}
+		p.Subscription.ID = p.Delivery.SubscriptionID
+		p.Event.ID = p.Delivery.EventID
+		pending = append(pending, p)
+	}
+	rows.Close()
+
+	for _, p := range pending {
+		_, err = tx.ExecContext(ctx, "UPDATE webhook_deliveries SET next_attempt_at = ? WHERE id = ?", now.Add(lease), p.Delivery.ID)
+		if err != nil {
+			return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rollbackNeeded = false
+	return pending, nil
+}
+
+// RecordWebhookDeliveryAttempt logs one attempt and moves the delivery to its new status.
+// nextAttemptAt is only used when the delivery stays pending.
+func RecordWebhookDeliveryAttempt(ctx context.Context, deliveryID int64, statusCode int, attemptErr error, duration time.Duration, status string, nextAttemptAt time.Time) error {
+	tx, err := begin(ctx)
+	if err != nil {
+		return utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rollbackNeeded := true
+	defer func() {
+		if rollbackNeeded {
+			tx.Rollback()
+		}
+	}()
+
+	var statusCodeValue sql.NullInt64
+	if statusCode != 0 {
+		statusCodeValue = sql.NullInt64{Int64: int64(statusCode), Valid: true}
+	}
+	var errorValue sql.NullString
+	if attemptErr != nil {
+		errorValue = sql.NullString{String: attemptErr.Error(), Valid: true}
+	}
+
+	_, err = tx.ExecContext(ctx, "INSERT INTO webhook_delivery_attempts (delivery_id, status_code, error, duration_ms) VALUES (?, ?, ?, ?)", deliveryID, statusCodeValue, errorValue, duration.Milliseconds())
+	if err != nil {
+		return utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE webhook_deliveries SET status = ?, attempts = attempts + 1, next_attempt_at = ?, last_status_code = ?, last_error = ? WHERE id = ?", status, nextAttemptAt, statusCodeValue, errorValue, deliveryID)
+	if err != nil {
+		return utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rollbackNeeded = false
+	return nil
+}
+
+// RetryWebhookDelivery puts a dead-lettered delivery of a subscription back in the queue
+func RetryWebhookDelivery(ctx context.Context, subscriptionID int, deliveryID int64) error {
+	result, err := conn(ctx).ExecContext(ctx, "UPDATE webhook_deliveries SET status = ?, attempts = 0, next_attempt_at = ? WHERE id = ? AND subscription_id = ? AND status = ?", models.DeliveryPending, time.Now(), deliveryID, subscriptionID, models.DeliveryDead)
+	if err != nil {
+		return utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	if rowsAffected == 0 {
+		return utility.ErrorHandlerContext(ctx, fmt.Errorf("delivery %d is not dead-lettered", deliveryID), "delivery not found")
+	}
+	return nil
+}
+
+// GetOutboxEventsAfter returns up to limit events with an id above afterID, oldest first
+func GetOutboxEventsAfter(ctx context.Context, afterID int64, limit int) ([]models.OutboxEvent, error) {
+	rows, err := conn(ctx).QueryContext(ctx, "SELECT id, event_type, entity, entity_id, payload, created_at FROM outbox WHERE id > ? ORDER BY id LIMIT ?", afterID, limit)
+	if err != nil {
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	defer rows.Close()
+
+	events := make([]models.OutboxEvent, 0)
+	for rows.Next() {
+		var event models.OutboxEvent
+		err = rows.Scan(&event.ID, &event.EventType, &event.Entity, &event.EntityID, &event.Payload, &event.CreatedAt)
+		if err != nil {
+			return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// GetOutboxEventsByIds returns the events among ids that exist, oldest first
+func GetOutboxEventsByIds(ctx context.Context, ids []int64) ([]models.OutboxEvent, error) {
+	events := make([]models.OutboxEvent, 0)
+	if len(ids) == 0 {
+		return events, nil
+	}
+	args := make([]any, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	query := fmt.Sprintf("SELECT id, event_type, entity, entity_id, payload, created_at FROM outbox WHERE id IN (%s) ORDER BY id", inPlaceholders(len(ids)))
+	rows, err := conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event models.OutboxEvent
+		err = rows.Scan(&event.ID, &event.EventType, &event.Entity, &event.EntityID, &event.Payload, &event.CreatedAt)
+		if err != nil {
+			return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// GetLatestOutboxEventId returns the id of the newest event, 0 when the outbox is empty
+func GetLatestOutboxEventId(ctx context.Context) (int64, error) {
+	var id int64
+	err := conn(ctx).QueryRowContext(ctx, "SELECT COALESCE(MAX(id), 0) FROM outbox").Scan(&id)
+	if err != nil {
+		return 0, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	return id, nil
+}
@@ -0,0 +1,92 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"rest-srv/models"
+	"rest-srv/utility"
+)
+
+func AddRefreshToken(ctx context.Context, token models.RefreshToken) error {
+	_, err := conn(ctx).ExecContext(ctx, "INSERT INTO refresh_tokens (token_hash, family_id, exec_id, expires_at) VALUES (?, ?, ?, ?)", token.TokenHash, token.FamilyID, token.ExecID, token.ExpiresAt)
+	if err != nil {
+		return utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	return nil
+}
+
+func GetRefreshTokenByHash(ctx context.Context, hash string) (models.RefreshToken, error) {
+	row := conn(ctx).QueryRowContext(ctx, "SELECT id, token_hash, family_id, exec_id, expires_at, used_at, revoked_at FROM refresh_tokens WHERE token_hash = ?", hash)
+	var token models.RefreshToken
+	var usedAt, revokedAt sql.NullTime
+	err := row.Scan(&token.ID, &token.TokenHash, &token.FamilyID, &token.ExecID, &token.ExpiresAt, &usedAt, &revokedAt)
+	if err == sql.ErrNoRows {
+		return models.RefreshToken{}, utility.ErrorHandlerContext(ctx, err, "refresh token not found")
+	}
+	if err != nil {
+		return models.RefreshToken{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	if usedAt.Valid {
+		token.UsedAt = &usedAt.Time
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+	return token, nil
+}
+
+// RotateRefreshToken marks used as used and stores next in its place. It returns false,
+// storing nothing, when used was already used or revoked, e.g. by a concurrent request
+// presenting the same token.
+func RotateRefreshToken(ctx context.Context, used models.RefreshToken, next models.RefreshToken) (bool, error) {
+	tx, err := begin(ctx)
+	if err != nil {
+		return false, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "UPDATE refresh_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL AND revoked_at IS NULL", time.Now(), used.ID)
+	if err != nil {
+		return false, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	if err := AddRefreshToken(WithTx(ctx, tx.Tx), next); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	return true, nil
+}
+
+// RevokeRefreshTokenFamily revokes every token rotated from the same login as familyID
+func RevokeRefreshTokenFamily(ctx context.Context, familyID string) error {
+	_, err := conn(ctx).ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL", time.Now(), familyID)
+	if err != nil {
+		return utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	return nil
+}
+
+// RevokeExecRefreshTokens revokes every refresh token of an exec, ending all the sessions
+func RevokeExecRefreshTokens(ctx context.Context, execID int) error {
+	_, err := conn(ctx).ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at = ? WHERE exec_id = ? AND revoked_at IS NULL", time.Now(), execID)
+	if err != nil {
+		return utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	return nil
+}
+
+// DeleteExpiredRefreshTokens removes the expired tokens of an exec. Used tokens are kept
+// until then, so that their reuse is detected; an expired token is refused anyway.
+func DeleteExpiredRefreshTokens(ctx context.Context, execID int) (int64, error) {
+	result, err := conn(ctx).ExecContext(ctx, "DELETE FROM refresh_tokens WHERE exec_id = ? AND expires_at < ?", execID, time.Now())
+	if err != nil {
+		return 0, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	return result.RowsAffected()
+}
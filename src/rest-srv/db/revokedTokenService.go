@@ -0,0 +1,40 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"rest-srv/utility"
+)
+
+// AddRevokedToken records that the tokens of key issued until revokedAt are revoked. The
+// record is kept until expiresAt, when those tokens have expired anyway.
+func AddRevokedToken(ctx context.Context, key string, revokedAt, expiresAt time.Time) error {
+	_, err := conn(ctx).ExecContext(ctx, "INSERT INTO revoked_tokens (id, revoked_at, expires_at) VALUES (?, ?, ?) ON DUPLICATE KEY UPDATE revoked_at = VALUES(revoked_at), expires_at = GREATEST(expires_at, VALUES(expires_at))", key, revokedAt, expiresAt)
+	if err != nil {
+		return utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	return nil
+}
+
+// GetTokenRevokedAt returns when the tokens of key were revoked, the zero time when they are not
+func GetTokenRevokedAt(ctx context.Context, key string) (time.Time, error) {
+	var revokedAt time.Time
+	err := conn(ctx).QueryRowContext(ctx, "SELECT revoked_at FROM revoked_tokens WHERE id = ? AND expires_at > ?", key, time.Now()).Scan(&revokedAt)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	return revokedAt, nil
+}
+
+func DeleteExpiredRevokedTokens(ctx context.Context) (int64, error) {
+	result, err := conn(ctx).ExecContext(ctx, "DELETE FROM revoked_tokens WHERE expires_at < ?", time.Now())
+	if err != nil {
+		return 0, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	return result.RowsAffected()
+}
@@ -1,8 +1,10 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"log/slog"
 
 	_ "github.com/go-sql-driver/mysql"
 )
@@ -18,6 +20,11 @@ func ConnectDb(user string, password, host string, port int, dbname string) erro
 		return err
 	}
 	Db = db
-	fmt.Println("Connected to db")
+	slog.Info("connected to db", "host", host, "port", port, "database", dbname)
 	return nil
 }
+
+// Ping checks that the database can be reached
+func Ping(ctx context.Context) error {
+	return Db.PingContext(ctx)
+}
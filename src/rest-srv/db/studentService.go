@@ -1,12 +1,14 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"reflect"
 	"rest-srv/models"
 	"rest-srv/utility"
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -42,15 +44,41 @@ func getStudentStructValues(model any) []any {
 	return values
 }
 
-func GetStudentById(id int) (models.Student, error) {
-	row := Db.QueryRow("SELECT * FROM students WHERE id = ?", id)
+var studentColumns = modelColumns(models.Student{})
+
+func GetStudentById(ctx context.Context, id int) (models.Student, error) {
+	return GetStudentByIdFields(ctx, id, nil)
+}
+
+// GetStudentByIdFields retrieves a student selecting only the given fields (all fields when empty)
+func GetStudentByIdFields(ctx context.Context, id int, fields []string) (models.Student, error) {
+	columns, err := resolveColumns(studentColumns, fields)
+	if err != nil {
+		return models.Student{}, err
+	}
+	row := conn(ctx).QueryRowContext(ctx, fmt.Sprintf("SELECT %s FROM students WHERE id = ?", strings.Join(columns, ", ")), id)
 	var student models.Student
-	err := row.Scan(&student.ID, &student.FirstName, &student.LastName, &student.Email, &student.Class)
+	err = row.Scan(scanTargets(&student, columns)...)
 	if err == sql.ErrNoRows {
-		return models.Student{}, utility.ErrorHandler(err, "student not found")
+		return models.Student{}, utility.ErrorHandlerContext(ctx, err, "student not found")
 	}
 	if err != nil {
-		return models.Student{}, utility.ErrorHandler(err, "unable to retrieve student")
+		return models.Student{}, utility.ErrorHandlerContext(ctx, err, "unable to retrieve student")
+	}
+	return student, nil
+}
+
+// getStudentForUpdate reads a student inside the transaction of ctx and locks its row until the
+// transaction ends, so that concurrent updates of the student wait for each other
+func getStudentForUpdate(ctx context.Context, id int) (models.Student, error) {
+	row := conn(ctx).QueryRowContext(ctx, fmt.Sprintf("SELECT %s FROM students WHERE id = ? FOR UPDATE", strings.Join(studentColumns, ", ")), id)
+	var student models.Student
+	err := row.Scan(scanTargets(&student, studentColumns)...)
+	if err == sql.ErrNoRows {
+		return models.Student{}, utility.ErrorHandlerContext(ctx, err, "student not found")
+	}
+	if err != nil {
+		return models.Student{}, utility.ErrorHandlerContext(ctx, err, "unable to retrieve student")
 	}
 	return student, nil
 }
@@ -58,7 +86,12 @@ func GetStudentById(id int) (models.Student, error) {
 // GetStudents retrieves students with optional filters and sorting
 // filters: map of field name to filter value (e.g., map[string]string{"email": "test@example.com"})
 // sortParams: slice of strings in the format "field:asc" or "field:desc"
-func GetStudents(filters map[string]string, sortParams []string, limit int, page int) ([]models.Student, int, error) {
+// fields: columns to select (all columns when empty)
+func GetStudents(ctx context.Context, filters map[string]string, sortParams []string, limit int, page int, fields []string) ([]models.Student, int, error) {
+	columns, err := resolveColumns(studentColumns, fields)
+	if err != nil {
+		return nil, 0, err
+	}
 	var query string
 	var orderByClauses []string
 	var whereClauses []string
@@ -103,7 +136,7 @@ func GetStudents(filters map[string]string, sortParams []string, limit int, page
 	}
 
 	// Build query with WHERE and ORDER BY clauses
-	query = "SELECT * FROM students"
+	query = fmt.Sprintf("SELECT %s FROM students", strings.Join(columns, ", "))
 	if len(whereClauses) > 0 {
 		query += " WHERE " + strings.Join(whereClauses, " AND ")
 	}
@@ -116,29 +149,28 @@ func GetStudents(filters map[string]string, sortParams []string, limit int, page
 	}
 	studentsList := make([]models.Student, 0)
 	var rows *sql.Rows
-	var err error
 
 	// Execute query with parameterized values
 	if len(filterValues) > 0 {
-		rows, err = Db.Query(query, filterValues...)
+		rows, err = conn(ctx).QueryContext(ctx, query, filterValues...)
 	} else {
-		rows, err = Db.Query(query)
+		rows, err = conn(ctx).QueryContext(ctx, query)
 	}
 	if err != nil {
-		return nil, 0, utility.ErrorHandler(err, "unable to retrieve students")
+		return nil, 0, utility.ErrorHandlerContext(ctx, err, "unable to retrieve students")
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		var student models.Student
-		err = rows.Scan(&student.ID, &student.FirstName, &student.LastName, &student.Email, &student.Class)
+		err = rows.Scan(scanTargets(&student, columns)...)
 		if err != nil {
-			return nil, 0, utility.ErrorHandler(err, "unable to process student data")
+			return nil, 0, utility.ErrorHandlerContext(ctx, err, "unable to process student data")
 		}
 		studentsList = append(studentsList, student)
 	}
 	totalCount := 0
-	row := Db.QueryRow("SELECT COUNT(*) FROM students")
+	row := conn(ctx).QueryRowContext(ctx, "SELECT COUNT(*) FROM students")
 	err = row.Scan(&totalCount)
 	if err != nil {
 		totalCount = 0
@@ -147,11 +179,79 @@ func GetStudents(filters map[string]string, sortParams []string, limit int, page
 	return studentsList, totalCount, nil
 }
 
-func AddStudents(students []models.Student) ([]models.Student, error) {
+// GetStudentsByClasses loads the students of several classes in one query, grouped by class
+func GetStudentsByClasses(ctx context.Context, classes []string) (map[string][]models.Student, error) {
+	studentsByClass := make(map[string][]models.Student)
+	if len(classes) == 0 {
+		return studentsByClass, nil
+	}
+	args := make([]any, len(classes))
+	for i, class := range classes {
+		args[i] = class
+	}
+	query := fmt.Sprintf("SELECT %s FROM students WHERE class IN (%s) ORDER BY id", strings.Join(studentColumns, ", "), inPlaceholders(len(classes)))
+	rows, err := conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, utility.ErrorHandlerContext(ctx, err, "unable to retrieve students")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var student models.Student
+		err = rows.Scan(scanTargets(&student, studentColumns)...)
+		if err != nil {
+			return nil, utility.ErrorHandlerContext(ctx, err, "unable to process student data")
+		}
+		studentsByClass[student.Class] = append(studentsByClass[student.Class], student)
+	}
+	return studentsByClass, nil
+}
+
+// CountStudentsByClasses counts the students of several classes in one query
+func CountStudentsByClasses(ctx context.Context, classes []string) (map[string]int, error) {
+	counts := make(map[string]int)
+	if len(classes) == 0 {
+		return counts, nil
+	}
+	args := make([]any, len(classes))
+	for i, class := range classes {
+		args[i] = class
+	}
+	query := fmt.Sprintf("SELECT class, COUNT(*) FROM students WHERE class IN (%s) GROUP BY class", inPlaceholders(len(classes)))
+	rows, err := conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var class string
+		var count int
+		err = rows.Scan(&class, &count)
+		if err != nil {
+			return nil, utility.ErrorHandlerContext(ctx, err, "unable to process student data")
+		}
+		counts[class] = count
+	}
+	return counts, nil
+}
+
+func AddStudents(ctx context.Context, students []models.Student) ([]models.Student, error) {
 	query := utility.GenerateInsertQuery(students[0], "students")
-	stmt, err := Db.Prepare(query)
+	tx, err := begin(ctx)
+	if err != nil {
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rollbackNeeded := true
+	defer func() {
+		if rollbackNeeded {
+			tx.Rollback()
+		}
+	}()
+
+	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
-		return nil, utility.ErrorHandler(err, "database error")
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
 	defer stmt.Close()
 
@@ -160,27 +260,38 @@ func AddStudents(students []models.Student) ([]models.Student, error) {
 		res, err := stmt.Exec(getStudentStructValues(student)...)
 		if err != nil {
 			if strings.Contains(err.Error(), "Error 1452 (23000): Cannot add or update a child row: a foreign key constraint fails (`classes`.`students`, CONSTRAINT `1` FOREIGN KEY (`class`) REFERENCES `teachers` (`class`))") {
-				return nil, utility.ErrorHandler(err, "class not found")
+				return nil, utility.ErrorHandlerContext(ctx, err, "class not found")
 			}
-			return nil, utility.ErrorHandler(err, "database error")
+			return nil, utility.ErrorHandlerContext(ctx, err, "database error")
 		}
 		lastID, err := res.LastInsertId()
 		if err != nil {
-			return nil, utility.ErrorHandler(err, "database error")
+			return nil, utility.ErrorHandlerContext(ctx, err, "database error")
 		}
 		addedStudents[i] = student
 		addedStudents[i].ID = int(lastID)
+		err = writeOutboxEvent(ctx, tx, "student", "created", addedStudents[i].ID, addedStudents[i], nil)
+		if err != nil {
+			return nil, err
+		}
 	}
 
+	err = tx.Commit()
+	if err != nil {
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rollbackNeeded = false
+
 	return addedStudents, nil
 }
 
 func PatchStudentFields(student *models.Student, updatedFields map[string]any) {
 	studentVal := reflect.ValueOf(student).Elem()
 	studentType := studentVal.Type()
+	patchable := student.PatchableFields()
 	for key, value := range updatedFields {
-		// Skip id field - it shouldn't be updated via PATCH
-		if key == "id" {
+		// Fields outside the patchable ones, such as the id, are never updated via PATCH
+		if !slices.Contains(patchable, key) {
 			continue
 		}
 		for i := 0; i < studentVal.NumField(); i++ {
@@ -189,45 +300,72 @@ func PatchStudentFields(student *models.Student, updatedFields map[string]any) {
 			// Extract the field name from the JSON tag (remove ",omitempty" if present)
 			jsonFieldName := strings.Split(jsonTag, ",")[0]
 			if jsonFieldName == key && studentVal.Field(i).CanSet() {
-				studentVal.Field(i).Set(reflect.ValueOf(value).Convert(studentVal.Field(i).Type()))
+				// Values of the wrong type are left out, ValidatePartial reports them
+				if converted, ok := utility.ConvertJSONValue(value, field.Type); ok {
+					studentVal.Field(i).Set(converted)
+				}
 				break
 			}
 		}
 	}
 }
 
-func PatchStudent(id int, updateFields map[string]any) (models.Student, error) {
-	student, err := GetStudentById(id)
+func PatchStudent(ctx context.Context, id int, updateFields map[string]any) (models.Student, error) {
+	tx, err := begin(ctx)
+	if err != nil {
+		return models.Student{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rollbackNeeded := true
+	defer func() {
+		if rollbackNeeded {
+			tx.Rollback()
+		}
+	}()
+
+	// Read the student with its row locked, so that a concurrent patch is not lost
+	student, err := getStudentForUpdate(WithTx(ctx, tx.Tx), id)
 	if err != nil {
 		return models.Student{}, err
 	}
 	if student == (models.Student{}) {
-		return models.Student{}, utility.ErrorHandler(errors.New("student not found"), "student not found")
+		return models.Student{}, utility.ErrorHandlerContext(ctx, errors.New("student not found"), "student not found")
 	}
 
 	// Apply patch updates to student
+	previous := student
 	PatchStudentFields(&student, updateFields)
+	// The violations are returned as they are, for the handler to list them with a 400
 	err = student.Validate()
 	if err != nil {
-		return models.Student{}, utility.ErrorHandler(err, "invalid fields")
+		return models.Student{}, err
 	}
 
 	// Update database
-	stmt, err := Db.Prepare("UPDATE students SET first_name = ?, last_name = ?, email = ?, class = ? WHERE id = ?")
+	stmt, err := tx.PrepareContext(ctx, "UPDATE students SET first_name = ?, last_name = ?, email = ?, class = ? WHERE id = ?")
 	if err != nil {
-		return models.Student{}, utility.ErrorHandler(err, "database error")
+		return models.Student{}, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
 	defer stmt.Close()
 	_, err = stmt.Exec(student.FirstName, student.LastName, student.Email, student.Class, student.ID)
 	if err != nil {
-		return models.Student{}, utility.ErrorHandler(err, "database error")
+		return models.Student{}, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
+	err = writeOutboxEvent(ctx, tx, "student", "updated", student.ID, student, previous)
+	if err != nil {
+		return models.Student{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return models.Student{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rollbackNeeded = false
 	return student, nil
 }
 
-func UpdateStudent(id int, updatedStudent models.Student) (models.Student, error) {
+func UpdateStudent(ctx context.Context, id int, updatedStudent models.Student) (models.Student, error) {
 	// Verify student exists before updating
-	_, err := GetStudentById(id)
+	previous, err := GetStudentById(ctx, id)
 	if err != nil {
 		return models.Student{}, err
 	}
@@ -235,25 +373,124 @@ func UpdateStudent(id int, updatedStudent models.Student) (models.Student, error
 	// Set the ID from the parameter
 	updatedStudent.ID = id
 
+	tx, err := begin(ctx)
+	if err != nil {
+		return models.Student{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rollbackNeeded := true
+	defer func() {
+		if rollbackNeeded {
+			tx.Rollback()
+		}
+	}()
+
 	// Update database
-	stmt, err := Db.Prepare("UPDATE students SET first_name = ?, last_name = ?, email = ?, class = ? WHERE id = ?")
+	stmt, err := tx.PrepareContext(ctx, "UPDATE students SET first_name = ?, last_name = ?, email = ?, class = ? WHERE id = ?")
 	if err != nil {
-		return models.Student{}, utility.ErrorHandler(err, "database error")
+		return models.Student{}, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
 	defer stmt.Close()
 
 	_, err = stmt.Exec(updatedStudent.FirstName, updatedStudent.LastName, updatedStudent.Email, updatedStudent.Class, id)
 	if err != nil {
-		return models.Student{}, utility.ErrorHandler(err, "database error")
+		return models.Student{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+
+	err = writeOutboxEvent(ctx, tx, "student", "updated", id, updatedStudent, previous)
+	if err != nil {
+		return models.Student{}, err
 	}
 
+	err = tx.Commit()
+	if err != nil {
+		return models.Student{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rollbackNeeded = false
+
 	return updatedStudent, nil
 }
 
-func PatchStudents(updates []map[string]any) ([]models.Student, error) {
-	tx, err := Db.Begin()
+// UpdateStudents replaces the given students, identified by their ID, in a single transaction
+func UpdateStudents(ctx context.Context, students []models.Student) ([]models.Student, error) {
+	tx, err := begin(ctx)
+	if err != nil {
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rollbackNeeded := true
+	defer func() {
+		if rollbackNeeded {
+			tx.Rollback()
+		}
+	}()
+
+	stmt, err := tx.PrepareContext(ctx, "UPDATE students SET first_name = ?, last_name = ?, email = ?, class = ? WHERE id = ?")
+	if err != nil {
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	defer stmt.Close()
+
+	for _, s := range students {
+		previous, err := GetStudentById(WithTx(ctx, tx.Tx), s.ID)
+		if err != nil {
+			return nil, err
+		}
+		_, err = stmt.Exec(s.FirstName, s.LastName, s.Email, s.Class, s.ID)
+		if err != nil {
+			return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+		}
+		err = writeOutboxEvent(ctx, tx, "student", "updated", s.ID, s, previous)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Commit the transaction if all updates succeeded
+	err = tx.Commit()
+	if err != nil {
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rollbackNeeded = false
+
+	return students, nil
+}
+
+// PatchStudentDocuments applies patch, which returns the patched documents, to the students
+// with the given ids and saves the result in a single transaction. The students are read with
+// their rows locked until the update, so that the test operations of a JSON patch hold and
+// concurrent patches apply one after the other.
+func PatchStudentDocuments(ctx context.Context, ids []int, patch func([]models.Student) ([]models.Student, error)) ([]models.Student, error) {
+	tx, err := begin(ctx)
+	if err != nil {
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	defer tx.Rollback()
+	ctx = WithTx(ctx, tx.Tx)
+
+	current := make([]models.Student, len(ids))
+	for _, i := range lockOrder(ids) {
+		current[i], err = getStudentForUpdate(ctx, ids[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	patched, err := patch(current)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := UpdateStudents(ctx, patched)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	return updated, nil
+}
+
+func PatchStudents(ctx context.Context, updates []map[string]any) ([]models.Student, error) {
+	tx, err := begin(ctx)
 	if err != nil {
-		return nil, utility.ErrorHandler(err, "database error")
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
 	rollbackNeeded := true
 	defer func() {
@@ -263,12 +500,12 @@ func PatchStudents(updates []map[string]any) ([]models.Student, error) {
 	}()
 
 	updatedStudents := make([]models.Student, 0, len(updates))
-	for _, update := range updates {
+	for i, update := range updates {
 		// Extract and validate ID
 		idVal, ok := update["id"]
 		if !ok {
 			rollbackNeeded = true
-			return nil, utility.ErrorHandler(errors.New("id is required"), "id is required")
+			return nil, utility.ErrorHandlerContext(ctx, errors.New("id is required"), "id is required")
 		}
 
 		var id int
@@ -278,7 +515,7 @@ func PatchStudents(updates []map[string]any) ([]models.Student, error) {
 			id, err = strconv.Atoi(v)
 			if err != nil {
 				rollbackNeeded = true
-				return nil, utility.ErrorHandler(err, "invalid id")
+				return nil, utility.ErrorHandlerContext(ctx, err, "invalid id")
 			}
 		case float64:
 			id = int(v)
@@ -286,35 +523,46 @@ func PatchStudents(updates []map[string]any) ([]models.Student, error) {
 			id = v
 		default:
 			rollbackNeeded = true
-			return nil, utility.ErrorHandler(errors.New("invalid id type"), "invalid id type")
+			return nil, utility.ErrorHandlerContext(ctx, errors.New("invalid id type"), "invalid id type")
 		}
 
 		if id == 0 {
 			rollbackNeeded = true
-			return nil, utility.ErrorHandler(errors.New("no id"), "no id")
+			return nil, utility.ErrorHandlerContext(ctx, errors.New("no id"), "no id")
 		}
 
 		// Get existing student
-		existingStudent, err := GetStudentById(id)
+		existingStudent, err := getStudentForUpdate(WithTx(ctx, tx.Tx), id)
 		if err != nil {
 			rollbackNeeded = true
 			return nil, err
 		}
 
 		// Apply patch updates to student
+		previous := existingStudent
 		PatchStudentFields(&existingStudent, update)
+		err = existingStudent.Validate()
+		if err != nil {
+			rollbackNeeded = true
+			return nil, atIndex(err, i)
+		}
 
 		// Update database within transaction
-		stmt, err := tx.Prepare("UPDATE students SET first_name = ?, last_name = ?, email = ?, class = ? WHERE id = ?")
+		stmt, err := tx.PrepareContext(ctx, "UPDATE students SET first_name = ?, last_name = ?, email = ?, class = ? WHERE id = ?")
 		if err != nil {
 			rollbackNeeded = true
-			return nil, utility.ErrorHandler(err, "database error")
+			return nil, utility.ErrorHandlerContext(ctx, err, "database error")
 		}
 		_, err = stmt.Exec(existingStudent.FirstName, existingStudent.LastName, existingStudent.Email, existingStudent.Class, id)
 		stmt.Close()
 		if err != nil {
 			rollbackNeeded = true
-			return nil, utility.ErrorHandler(err, "database error")
+			return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+		}
+		err = writeOutboxEvent(ctx, tx, "student", "updated", id, existingStudent, previous)
+		if err != nil {
+			rollbackNeeded = true
+			return nil, err
 		}
 		updatedStudents = append(updatedStudents, existingStudent)
 	}
@@ -323,46 +571,68 @@ func PatchStudents(updates []map[string]any) ([]models.Student, error) {
 	err = tx.Commit()
 	if err != nil {
 		rollbackNeeded = true
-		return nil, utility.ErrorHandler(err, "database error")
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
 	rollbackNeeded = false
 
 	return updatedStudents, nil
 }
 
-func DeleteStudent(id int) (models.Student, error) {
+func DeleteStudent(ctx context.Context, id int) (models.Student, error) {
 	// Get student before deleting to return it
-	student, err := GetStudentById(id)
+	student, err := GetStudentById(ctx, id)
 	if err != nil {
 		return models.Student{}, err
 	}
 
-	stmt, err := Db.Prepare("DELETE FROM students WHERE id = ?")
+	tx, err := begin(ctx)
+	if err != nil {
+		return models.Student{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rollbackNeeded := true
+	defer func() {
+		if rollbackNeeded {
+			tx.Rollback()
+		}
+	}()
+
+	stmt, err := tx.PrepareContext(ctx, "DELETE FROM students WHERE id = ?")
 	if err != nil {
-		return models.Student{}, utility.ErrorHandler(err, "database error")
+		return models.Student{}, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
 	defer stmt.Close()
 
 	result, err := stmt.Exec(id)
 	if err != nil {
-		return models.Student{}, utility.ErrorHandler(err, "database error")
+		return models.Student{}, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return models.Student{}, utility.ErrorHandler(err, "database error")
+		return models.Student{}, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
 	if rowsAffected == 0 {
-		return models.Student{}, utility.ErrorHandler(errors.New("student not found"), "student not found")
+		return models.Student{}, utility.ErrorHandlerContext(ctx, errors.New("student not found"), "student not found")
 	}
 
+	err = writeOutboxEvent(ctx, tx, "student", "deleted", id, student, nil)
+	if err != nil {
+		return models.Student{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return models.Student{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rollbackNeeded = false
+
 	return student, nil
 }
 
-func DeleteStudents(ids []int) ([]models.Student, error) {
-	tx, err := Db.Begin()
+func DeleteStudents(ctx context.Context, ids []int) ([]models.Student, error) {
+	tx, err := begin(ctx)
 	if err != nil {
-		return nil, utility.ErrorHandler(err, "database error")
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
 	rollbackNeeded := true
 	defer func() {
@@ -374,34 +644,39 @@ func DeleteStudents(ids []int) ([]models.Student, error) {
 	deletedStudents := make([]models.Student, 0, len(ids))
 	for _, id := range ids {
 		// Get student before deleting to return it
-		student, err := GetStudentById(id)
+		student, err := GetStudentById(ctx, id)
 		if err != nil {
 			rollbackNeeded = true
 			return nil, err
 		}
 
-		stmt, err := tx.Prepare("DELETE FROM students WHERE id = ?")
+		stmt, err := tx.PrepareContext(ctx, "DELETE FROM students WHERE id = ?")
 		if err != nil {
 			rollbackNeeded = true
-			return nil, utility.ErrorHandler(err, "database error")
+			return nil, utility.ErrorHandlerContext(ctx, err, "database error")
 		}
 		result, err := stmt.Exec(id)
 		stmt.Close()
 		if err != nil {
 			rollbackNeeded = true
-			return nil, utility.ErrorHandler(err, "database error")
+			return nil, utility.ErrorHandlerContext(ctx, err, "database error")
 		}
 
 		rowsAffected, err := result.RowsAffected()
 		if err != nil {
 			rollbackNeeded = true
-			return nil, utility.ErrorHandler(err, "database error")
+			return nil, utility.ErrorHandlerContext(ctx, err, "database error")
 		}
 		if rowsAffected == 0 {
 			rollbackNeeded = true
-			return nil, utility.ErrorHandler(errors.New("student not found"), "student not found")
+			return nil, utility.ErrorHandlerContext(ctx, errors.New("student not found"), "student not found")
 		}
 
+		err = writeOutboxEvent(ctx, tx, "student", "deleted", id, student, nil)
+		if err != nil {
+			rollbackNeeded = true
+			return nil, err
+		}
 		deletedStudents = append(deletedStudents, student)
 	}
 
@@ -409,7 +684,7 @@ func DeleteStudents(ids []int) ([]models.Student, error) {
 	err = tx.Commit()
 	if err != nil {
 		rollbackNeeded = true
-		return nil, utility.ErrorHandler(err, "database error")
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
 	rollbackNeeded = false
 
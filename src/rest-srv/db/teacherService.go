@@ -1,12 +1,14 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"reflect"
 	"rest-srv/models"
 	"rest-srv/utility"
+	"slices"
 	"strconv"
 	"strings"
 )
@@ -43,15 +45,42 @@ func getStructValues(model any) []any {
 	return values
 }
 
-func GetTeacherById(id int) (models.Teacher, error) {
-	row := Db.QueryRow("SELECT * FROM teachers WHERE id = ?", id)
+var teacherColumns = modelColumns(models.Teacher{})
+
+func GetTeacherById(ctx context.Context, id int) (models.Teacher, error) {
+	return GetTeacherByIdFields(ctx, id, nil)
+}
+
+// GetTeacherByIdFields retrieves a teacher selecting only the given fields (all fields when empty).
+// The class column is always selected so related students can be loaded.
+func GetTeacherByIdFields(ctx context.Context, id int, fields []string) (models.Teacher, error) {
+	columns, err := resolveColumns(teacherColumns, fields, "class")
+	if err != nil {
+		return models.Teacher{}, err
+	}
+	row := conn(ctx).QueryRowContext(ctx, fmt.Sprintf("SELECT %s FROM teachers WHERE id = ?", strings.Join(columns, ", ")), id)
+	var teacher models.Teacher
+	err = row.Scan(scanTargets(&teacher, columns)...)
+	if err == sql.ErrNoRows {
+		return models.Teacher{}, utility.ErrorHandlerContext(ctx, err, "teacher not found")
+	}
+	if err != nil {
+		return models.Teacher{}, utility.ErrorHandlerContext(ctx, err, "unable to retrieve teacher")
+	}
+	return teacher, nil
+}
+
+// getTeacherForUpdate reads a teacher inside the transaction of ctx and locks its row until the
+// transaction ends, so that concurrent updates of the teacher wait for each other
+func getTeacherForUpdate(ctx context.Context, id int) (models.Teacher, error) {
+	row := conn(ctx).QueryRowContext(ctx, fmt.Sprintf("SELECT %s FROM teachers WHERE id = ? FOR UPDATE", strings.Join(teacherColumns, ", ")), id)
 	var teacher models.Teacher
-	err := row.Scan(&teacher.ID, &teacher.FirstName, &teacher.LastName, &teacher.Email, &teacher.Class, &teacher.Subject)
+	err := row.Scan(scanTargets(&teacher, teacherColumns)...)
 	if err == sql.ErrNoRows {
-		return models.Teacher{}, utility.ErrorHandler(err, "teacher not found")
+		return models.Teacher{}, utility.ErrorHandlerContext(ctx, err, "teacher not found")
 	}
 	if err != nil {
-		return models.Teacher{}, utility.ErrorHandler(err, "unable to retrieve teacher")
+		return models.Teacher{}, utility.ErrorHandlerContext(ctx, err, "unable to retrieve teacher")
 	}
 	return teacher, nil
 }
@@ -59,7 +88,12 @@ func GetTeacherById(id int) (models.Teacher, error) {
 // GetTeachers retrieves teachers with optional filters and sorting
 // filters: map of field name to filter value (e.g., map[string]string{"email": "test@example.com"})
 // sortParams: slice of strings in the format "field:asc" or "field:desc"
-func GetTeachers(filters map[string]string, sortParams []string) ([]models.Teacher, error) {
+// fields: columns to select (all columns when empty, class is always selected)
+func GetTeachers(ctx context.Context, filters map[string]string, sortParams []string, fields []string) ([]models.Teacher, error) {
+	columns, err := resolveColumns(teacherColumns, fields, "class")
+	if err != nil {
+		return nil, err
+	}
 	var query string
 	var orderByClauses []string
 	var whereClauses []string
@@ -101,7 +135,7 @@ func GetTeachers(filters map[string]string, sortParams []string) ([]models.Teach
 	}
 
 	// Build query with WHERE and ORDER BY clauses
-	query = "SELECT * FROM teachers"
+	query = fmt.Sprintf("SELECT %s FROM teachers", strings.Join(columns, ", "))
 	if len(whereClauses) > 0 {
 		query += " WHERE " + strings.Join(whereClauses, " AND ")
 	}
@@ -111,24 +145,23 @@ func GetTeachers(filters map[string]string, sortParams []string) ([]models.Teach
 
 	teachersList := make([]models.Teacher, 0)
 	var rows *sql.Rows
-	var err error
 
 	// Execute query with parameterized values
 	if len(filterValues) > 0 {
-		rows, err = Db.Query(query, filterValues...)
+		rows, err = conn(ctx).QueryContext(ctx, query, filterValues...)
 	} else {
-		rows, err = Db.Query(query)
+		rows, err = conn(ctx).QueryContext(ctx, query)
 	}
 	if err != nil {
-		return nil, utility.ErrorHandler(err, "unable to retrieve teachers")
+		return nil, utility.ErrorHandlerContext(ctx, err, "unable to retrieve teachers")
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		var teacher models.Teacher
-		err = rows.Scan(&teacher.ID, &teacher.FirstName, &teacher.LastName, &teacher.Email, &teacher.Class, &teacher.Subject)
+		err = rows.Scan(scanTargets(&teacher, columns)...)
 		if err != nil {
-			return nil, utility.ErrorHandler(err, "unable to process teacher data")
+			return nil, utility.ErrorHandlerContext(ctx, err, "unable to process teacher data")
 		}
 		teachersList = append(teachersList, teacher)
 	}
@@ -136,11 +169,50 @@ func GetTeachers(filters map[string]string, sortParams []string) ([]models.Teach
 	return teachersList, nil
 }
 
-func AddTeachers(teachers []models.Teacher) ([]models.Teacher, error) {
+// GetTeachersByClasses loads the teachers of several classes in one query, keyed by class
+func GetTeachersByClasses(ctx context.Context, classes []string) (map[string]models.Teacher, error) {
+	teachersByClass := make(map[string]models.Teacher)
+	if len(classes) == 0 {
+		return teachersByClass, nil
+	}
+	args := make([]any, len(classes))
+	for i, class := range classes {
+		args[i] = class
+	}
+	query := fmt.Sprintf("SELECT %s FROM teachers WHERE class IN (%s)", strings.Join(teacherColumns, ", "), inPlaceholders(len(classes)))
+	rows, err := conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, utility.ErrorHandlerContext(ctx, err, "unable to retrieve teachers")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var teacher models.Teacher
+		err = rows.Scan(scanTargets(&teacher, teacherColumns)...)
+		if err != nil {
+			return nil, utility.ErrorHandlerContext(ctx, err, "unable to process teacher data")
+		}
+		teachersByClass[teacher.Class] = teacher
+	}
+	return teachersByClass, nil
+}
+
+func AddTeachers(ctx context.Context, teachers []models.Teacher) ([]models.Teacher, error) {
 	query := utility.GenerateInsertQuery(teachers[0], "teachers")
-	stmt, err := Db.Prepare(query)
+	tx, err := begin(ctx)
+	if err != nil {
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rollbackNeeded := true
+	defer func() {
+		if rollbackNeeded {
+			tx.Rollback()
+		}
+	}()
+
+	stmt, err := tx.PrepareContext(ctx, query)
 	if err != nil {
-		return nil, utility.ErrorHandler(err, "database error")
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
 	defer stmt.Close()
 
@@ -148,15 +220,25 @@ func AddTeachers(teachers []models.Teacher) ([]models.Teacher, error) {
 	for i, teacher := range teachers {
 		res, err := stmt.Exec(getStructValues(teacher)...)
 		if err != nil {
-			return nil, utility.ErrorHandler(err, "database error")
+			return nil, utility.ErrorHandlerContext(ctx, err, "database error")
 		}
 		lastID, err := res.LastInsertId()
 		if err != nil {
-			return nil, utility.ErrorHandler(err, "database error")
+			return nil, utility.ErrorHandlerContext(ctx, err, "database error")
 		}
 		addedTeachers[i] = teacher
 		addedTeachers[i].ID = int(lastID)
+		err = writeOutboxEvent(ctx, tx, "teacher", "created", addedTeachers[i].ID, addedTeachers[i], nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
+	rollbackNeeded = false
 
 	return addedTeachers, nil
 }
@@ -164,9 +246,10 @@ func AddTeachers(teachers []models.Teacher) ([]models.Teacher, error) {
 func PatchTeacherFields(teacher *models.Teacher, updatedFields map[string]any) {
 	teacherVal := reflect.ValueOf(teacher).Elem()
 	teacherType := teacherVal.Type()
+	patchable := teacher.PatchableFields()
 	for key, value := range updatedFields {
-		// Skip id field - it shouldn't be updated via PATCH
-		if key == "id" {
+		// Fields outside the patchable ones, such as the id, are never updated via PATCH
+		if !slices.Contains(patchable, key) {
 			continue
 		}
 		for i := 0; i < teacherVal.NumField(); i++ {
@@ -175,45 +258,72 @@ func PatchTeacherFields(teacher *models.Teacher, updatedFields map[string]any) {
 			// Extract the field name from the JSON tag (remove ",omitempty" if present)
 			jsonFieldName := strings.Split(jsonTag, ",")[0]
 			if jsonFieldName == key && teacherVal.Field(i).CanSet() {
-				teacherVal.Field(i).Set(reflect.ValueOf(value).Convert(teacherVal.Field(i).Type()))
+				// Values of the wrong type are left out, ValidatePartial reports them
+				if converted, ok := utility.ConvertJSONValue(value, field.Type); ok {
+					teacherVal.Field(i).Set(converted)
+				}
 				break
 			}
 		}
 	}
 }
 
-func PatchTeacher(id int, updateFields map[string]any) (models.Teacher, error) {
-	teacher, err := GetTeacherById(id)
+func PatchTeacher(ctx context.Context, id int, updateFields map[string]any) (models.Teacher, error) {
+	tx, err := begin(ctx)
+	if err != nil {
+		return models.Teacher{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rollbackNeeded := true
+	defer func() {
+		if rollbackNeeded {
+			tx.Rollback()
+		}
+	}()
+
+	// Read the teacher with its row locked, so that a concurrent patch is not lost
+	teacher, err := getTeacherForUpdate(WithTx(ctx, tx.Tx), id)
 	if err != nil {
 		return models.Teacher{}, err
 	}
 	if teacher == (models.Teacher{}) {
-		return models.Teacher{}, utility.ErrorHandler(errors.New("teacher not found"), "teacher not found")
+		return models.Teacher{}, utility.ErrorHandlerContext(ctx, errors.New("teacher not found"), "teacher not found")
 	}
 
 	// Apply patch updates to teacher
+	previous := teacher
 	PatchTeacherFields(&teacher, updateFields)
+	// The violations are returned as they are, for the handler to list them with a 400
 	err = teacher.Validate()
 	if err != nil {
-		return models.Teacher{}, utility.ErrorHandler(err, "invalid fields")
+		return models.Teacher{}, err
 	}
 
 	// Update database
-	stmt, err := Db.Prepare("UPDATE teachers SET first_name = ?, last_name = ?, email = ?, class = ?, subject = ? WHERE id = ?")
+	stmt, err := tx.PrepareContext(ctx, "UPDATE teachers SET first_name = ?, last_name = ?, email = ?, class = ?, subject = ? WHERE id = ?")
 	if err != nil {
-		return models.Teacher{}, utility.ErrorHandler(err, "database error")
+		return models.Teacher{}, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
 	defer stmt.Close()
 	_, err = stmt.Exec(teacher.FirstName, teacher.LastName, teacher.Email, teacher.Class, teacher.Subject, teacher.ID)
 	if err != nil {
-		return models.Teacher{}, utility.ErrorHandler(err, "database error")
+		return models.Teacher{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	err = writeOutboxEvent(ctx, tx, "teacher", "updated", teacher.ID, teacher, previous)
+	if err != nil {
+		return models.Teacher{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return models.Teacher{}, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
+	rollbackNeeded = false
 	return teacher, nil
 }
 
-func UpdateTeacher(id int, updatedTeacher models.Teacher) (models.Teacher, error) {
+func UpdateTeacher(ctx context.Context, id int, updatedTeacher models.Teacher) (models.Teacher, error) {
 	// Verify teacher exists before updating
-	_, err := GetTeacherById(id)
+	previous, err := GetTeacherById(ctx, id)
 	if err != nil {
 		return models.Teacher{}, err
 	}
@@ -221,24 +331,124 @@ func UpdateTeacher(id int, updatedTeacher models.Teacher) (models.Teacher, error
 	// Set the ID from the parameter
 	updatedTeacher.ID = id
 
+	tx, err := begin(ctx)
+	if err != nil {
+		return models.Teacher{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rollbackNeeded := true
+	defer func() {
+		if rollbackNeeded {
+			tx.Rollback()
+		}
+	}()
+
 	// Update database
-	stmt, err := Db.Prepare("UPDATE teachers SET first_name = ?, last_name = ?, email = ?, class = ?, subject = ? WHERE id = ?")
+	stmt, err := tx.PrepareContext(ctx, "UPDATE teachers SET first_name = ?, last_name = ?, email = ?, class = ?, subject = ? WHERE id = ?")
 	if err != nil {
-		return models.Teacher{}, utility.ErrorHandler(err, "database error")
+		return models.Teacher{}, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
 	defer stmt.Close()
 
 	_, err = stmt.Exec(updatedTeacher.FirstName, updatedTeacher.LastName, updatedTeacher.Email, updatedTeacher.Class, updatedTeacher.Subject, id)
 	if err != nil {
-		return models.Teacher{}, utility.ErrorHandler(err, "database error")
+		return models.Teacher{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+
+	err = writeOutboxEvent(ctx, tx, "teacher", "updated", id, updatedTeacher, previous)
+	if err != nil {
+		return models.Teacher{}, err
 	}
 
+	err = tx.Commit()
+	if err != nil {
+		return models.Teacher{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rollbackNeeded = false
+
 	return updatedTeacher, nil
 }
-func PatchTeachers(updates []map[string]any) ([]models.Teacher, error) {
-	tx, err := Db.Begin()
+
+// UpdateTeachers replaces the given teachers, identified by their ID, in a single transaction
+func UpdateTeachers(ctx context.Context, teachers []models.Teacher) ([]models.Teacher, error) {
+	tx, err := begin(ctx)
 	if err != nil {
-		return nil, utility.ErrorHandler(err, "database error")
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rollbackNeeded := true
+	defer func() {
+		if rollbackNeeded {
+			tx.Rollback()
+		}
+	}()
+
+	stmt, err := tx.PrepareContext(ctx, "UPDATE teachers SET first_name = ?, last_name = ?, email = ?, class = ?, subject = ? WHERE id = ?")
+	if err != nil {
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	defer stmt.Close()
+
+	for _, t := range teachers {
+		previous, err := GetTeacherById(WithTx(ctx, tx.Tx), t.ID)
+		if err != nil {
+			return nil, err
+		}
+		_, err = stmt.Exec(t.FirstName, t.LastName, t.Email, t.Class, t.Subject, t.ID)
+		if err != nil {
+			return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+		}
+		err = writeOutboxEvent(ctx, tx, "teacher", "updated", t.ID, t, previous)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Commit the transaction if all updates succeeded
+	err = tx.Commit()
+	if err != nil {
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rollbackNeeded = false
+
+	return teachers, nil
+}
+
+// PatchTeacherDocuments applies patch, which returns the patched documents, to the teachers
+// with the given ids and saves the result in a single transaction. The teachers are read with
+// their rows locked until the update, so that the test operations of a JSON patch hold and
+// concurrent patches apply one after the other.
+func PatchTeacherDocuments(ctx context.Context, ids []int, patch func([]models.Teacher) ([]models.Teacher, error)) ([]models.Teacher, error) {
+	tx, err := begin(ctx)
+	if err != nil {
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	defer tx.Rollback()
+	ctx = WithTx(ctx, tx.Tx)
+
+	current := make([]models.Teacher, len(ids))
+	for _, i := range lockOrder(ids) {
+		current[i], err = getTeacherForUpdate(ctx, ids[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+	patched, err := patch(current)
+	if err != nil {
+		return nil, err
+	}
+	updated, err := UpdateTeachers(ctx, patched)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	return updated, nil
+}
+
+func PatchTeachers(ctx context.Context, updates []map[string]any) ([]models.Teacher, error) {
+	tx, err := begin(ctx)
+	if err != nil {
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
 	rollbackNeeded := true
 	defer func() {
@@ -248,12 +458,12 @@ func PatchTeachers(updates []map[string]any) ([]models.Teacher, error) {
 	}()
 
 	updatedTeachers := make([]models.Teacher, 0, len(updates))
-	for _, update := range updates {
+	for i, update := range updates {
 		// Extract and validate ID
 		idVal, ok := update["id"]
 		if !ok {
 			rollbackNeeded = true
-			return nil, utility.ErrorHandler(errors.New("id is required"), "id is required")
+			return nil, utility.ErrorHandlerContext(ctx, errors.New("id is required"), "id is required")
 		}
 
 		var id int
@@ -263,7 +473,7 @@ func PatchTeachers(updates []map[string]any) ([]models.Teacher, error) {
 			id, err = strconv.Atoi(v)
 			if err != nil {
 				rollbackNeeded = true
-				return nil, utility.ErrorHandler(err, "invalid id")
+				return nil, utility.ErrorHandlerContext(ctx, err, "invalid id")
 			}
 		case float64:
 			id = int(v)
@@ -271,35 +481,46 @@ func PatchTeachers(updates []map[string]any) ([]models.Teacher, error) {
 			id = v
 		default:
 			rollbackNeeded = true
-			return nil, utility.ErrorHandler(errors.New("invalid id type"), "invalid id type")
+			return nil, utility.ErrorHandlerContext(ctx, errors.New("invalid id type"), "invalid id type")
 		}
 
 		if id == 0 {
 			rollbackNeeded = true
-			return nil, utility.ErrorHandler(errors.New("no id"), "no id")
+			return nil, utility.ErrorHandlerContext(ctx, errors.New("no id"), "no id")
 		}
 
 		// Get existing teacher
-		existingTeacher, err := GetTeacherById(id)
+		existingTeacher, err := getTeacherForUpdate(WithTx(ctx, tx.Tx), id)
 		if err != nil {
 			rollbackNeeded = true
 			return nil, err
 		}
 
 		// Apply patch updates to teacher
+		previous := existingTeacher
 		PatchTeacherFields(&existingTeacher, update)
+		err = existingTeacher.Validate()
+		if err != nil {
+			rollbackNeeded = true
+			return nil, atIndex(err, i)
+		}
 
 		// Update database within transaction
-		stmt, err := tx.Prepare("UPDATE teachers SET first_name = ?, last_name = ?, email = ?, class = ?, subject = ? WHERE id = ?")
+		stmt, err := tx.PrepareContext(ctx, "UPDATE teachers SET first_name = ?, last_name = ?, email = ?, class = ?, subject = ? WHERE id = ?")
 		if err != nil {
 			rollbackNeeded = true
-			return nil, utility.ErrorHandler(err, "database error")
+			return nil, utility.ErrorHandlerContext(ctx, err, "database error")
 		}
 		_, err = stmt.Exec(existingTeacher.FirstName, existingTeacher.LastName, existingTeacher.Email, existingTeacher.Class, existingTeacher.Subject, id)
 		stmt.Close()
 		if err != nil {
 			rollbackNeeded = true
-			return nil, utility.ErrorHandler(err, "database error")
+			return nil, utility.ErrorHandlerContext(ctx, err, "database error")
+		}
+		err = writeOutboxEvent(ctx, tx, "teacher", "updated", id, existingTeacher, previous)
+		if err != nil {
+			rollbackNeeded = true
+			return nil, err
 		}
 		updatedTeachers = append(updatedTeachers, existingTeacher)
 	}
@@ -308,46 +529,68 @@ func PatchTeachers(updates []map[string]any) ([]models.Teacher, error) {
 	err = tx.Commit()
 	if err != nil {
 		rollbackNeeded = true
-		return nil, utility.ErrorHandler(err, "database error")
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
 	rollbackNeeded = false
 
 	return updatedTeachers, nil
 }
 
-func DeleteTeacher(id int) (models.Teacher, error) {
+func DeleteTeacher(ctx context.Context, id int) (models.Teacher, error) {
 	// Get teacher before deleting to return it
-	teacher, err := GetTeacherById(id)
+	teacher, err := GetTeacherById(ctx, id)
 	if err != nil {
 		return models.Teacher{}, err
 	}
 
-	stmt, err := Db.Prepare("DELETE FROM teachers WHERE id = ?")
+	tx, err := begin(ctx)
 	if err != nil {
-		return models.Teacher{}, utility.ErrorHandler(err, "database error")
+		return models.Teacher{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rollbackNeeded := true
+	defer func() {
+		if rollbackNeeded {
+			tx.Rollback()
+		}
+	}()
+
+	stmt, err := tx.PrepareContext(ctx, "DELETE FROM teachers WHERE id = ?")
+	if err != nil {
+		return models.Teacher{}, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
 	defer stmt.Close()
 
 	result, err := stmt.Exec(id)
 	if err != nil {
-		return models.Teacher{}, utility.ErrorHandler(err, "database error")
+		return models.Teacher{}, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return models.Teacher{}, utility.ErrorHandler(err, "database error")
+		return models.Teacher{}, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
 	if rowsAffected == 0 {
-		return models.Teacher{}, utility.ErrorHandler(errors.New("teacher not found"), "teacher not found")
+		return models.Teacher{}, utility.ErrorHandlerContext(ctx, errors.New("teacher not found"), "teacher not found")
+	}
+
+	err = writeOutboxEvent(ctx, tx, "teacher", "deleted", id, teacher, nil)
+	if err != nil {
+		return models.Teacher{}, err
 	}
 
+	err = tx.Commit()
+	if err != nil {
+		return models.Teacher{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rollbackNeeded = false
+
 	return teacher, nil
 }
 
-func DeleteTeachers(ids []int) ([]models.Teacher, error) {
-	tx, err := Db.Begin()
+func DeleteTeachers(ctx context.Context, ids []int) ([]models.Teacher, error) {
+	tx, err := begin(ctx)
 	if err != nil {
-		return nil, utility.ErrorHandler(err, "database error")
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
 	rollbackNeeded := true
 	defer func() {
@@ -359,34 +602,39 @@ func DeleteTeachers(ids []int) ([]models.Teacher, error) {
 	deletedTeachers := make([]models.Teacher, 0, len(ids))
 	for _, id := range ids {
 		// Get teacher before deleting to return it
-		teacher, err := GetTeacherById(id)
+		teacher, err := GetTeacherById(ctx, id)
 		if err != nil {
 			rollbackNeeded = true
 			return nil, err
 		}
 
-		stmt, err := tx.Prepare("DELETE FROM teachers WHERE id = ?")
+		stmt, err := tx.PrepareContext(ctx, "DELETE FROM teachers WHERE id = ?")
 		if err != nil {
 			rollbackNeeded = true
-			return nil, utility.ErrorHandler(err, "database error")
+			return nil, utility.ErrorHandlerContext(ctx, err, "database error")
 		}
 		result, err := stmt.Exec(id)
 		stmt.Close()
 		if err != nil {
 			rollbackNeeded = true
-			return nil, utility.ErrorHandler(err, "database error")
+			return nil, utility.ErrorHandlerContext(ctx, err, "database error")
 		}
 
 		rowsAffected, err := result.RowsAffected()
 		if err != nil {
 			rollbackNeeded = true
-			return nil, utility.ErrorHandler(err, "database error")
+			return nil, utility.ErrorHandlerContext(ctx, err, "database error")
 		}
 		if rowsAffected == 0 {
 			rollbackNeeded = true
-			return nil, utility.ErrorHandler(errors.New("teacher not found"), "teacher not found")
+			return nil, utility.ErrorHandlerContext(ctx, errors.New("teacher not found"), "teacher not found")
 		}
 
+		err = writeOutboxEvent(ctx, tx, "teacher", "deleted", id, teacher, nil)
+		if err != nil {
+			rollbackNeeded = true
+			return nil, err
+		}
 		deletedTeachers = append(deletedTeachers, teacher)
 	}
 
@@ -394,26 +642,31 @@ func DeleteTeachers(ids []int) ([]models.Teacher, error) {
 	err = tx.Commit()
 	if err != nil {
 		rollbackNeeded = true
-		return nil, utility.ErrorHandler(err, "database error")
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
 	rollbackNeeded = false
 
 	return deletedTeachers, nil
 }
 
-func GetTeacherStudents(id int) ([]models.Student, error) {
-	rows, err := Db.Query("SELECT * FROM students WHERE class = (SELECT class FROM teachers WHERE id = ?)", id)
+// GetTeacherStudents retrieves the students of a teacher's class selecting only the given fields (all fields when empty)
+func GetTeacherStudents(ctx context.Context, id int, fields []string) ([]models.Student, error) {
+	columns, err := resolveColumns(studentColumns, fields)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := conn(ctx).QueryContext(ctx, fmt.Sprintf("SELECT %s FROM students WHERE class = (SELECT class FROM teachers WHERE id = ?)", strings.Join(columns, ", ")), id)
 	if err != nil {
-		return nil, utility.ErrorHandler(err, "database error")
+		return nil, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
 	defer rows.Close()
 
 	students := make([]models.Student, 0)
 	for rows.Next() {
 		var student models.Student
-		err = rows.Scan(&student.ID, &student.FirstName, &student.LastName, &student.Email, &student.Class)
+		err = rows.Scan(scanTargets(&student, columns)...)
 		if err != nil {
-			return nil, utility.ErrorHandler(err, "unable to process student data")
+			return nil, utility.ErrorHandlerContext(ctx, err, "unable to process student data")
 		}
 		students = append(students, student)
 	}
@@ -421,10 +674,10 @@ func GetTeacherStudents(id int) ([]models.Student, error) {
 	return students, nil
 }
 
-func GetTeacherStudentsCount(id int) (int, error) {
-	rows, err := Db.Query("SELECT COUNT(*) FROM students WHERE class = (SELECT class FROM teachers WHERE id = ?)", id)
+func GetTeacherStudentsCount(ctx context.Context, id int) (int, error) {
+	rows, err := conn(ctx).QueryContext(ctx, "SELECT COUNT(*) FROM students WHERE class = (SELECT class FROM teachers WHERE id = ?)", id)
 	if err != nil {
-		return 0, utility.ErrorHandler(err, "database error")
+		return 0, utility.ErrorHandlerContext(ctx, err, "database error")
 	}
 	defer rows.Close()
 
@@ -432,7 +685,7 @@ func GetTeacherStudentsCount(id int) (int, error) {
 		var count int
 		err = rows.Scan(&count)
 		if err != nil {
-			return 0, utility.ErrorHandler(err, "unable to process student data")
+			return 0, utility.ErrorHandlerContext(ctx, err, "unable to process student data")
 		}
 		return count, nil
 	}
@@ -0,0 +1,211 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"rest-srv/tracing"
+	"rest-srv/utility"
+	"strings"
+	"time"
+)
+
+type txContextKey struct{}
+
+// sqlQueryer is implemented by both *sql.DB and *sql.Tx
+type sqlQueryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// queryer runs statements that are logged and traced, prepared ones included
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	PrepareContext(ctx context.Context, query string) (*tracedStmt, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// WithTx returns a context that makes every db call made with it run inside tx
+func WithTx(ctx context.Context, tx *sql.Tx) context.Context {
+	return context.WithValue(ctx, txContextKey{}, tx)
+}
+
+func txFromContext(ctx context.Context) *sql.Tx {
+	tx, _ := ctx.Value(txContextKey{}).(*sql.Tx)
+	return tx
+}
+
+// conn returns the transaction carried by ctx, or the connection pool
+func conn(ctx context.Context) queryer {
+	if tx := txFromContext(ctx); tx != nil {
+		return loggedQueryer{tx}
+	}
+	return loggedQueryer{Db}
+}
+
+// loggedQueryer logs every statement at debug level with the logger of the request, and
+// traces it in a span. Only the statement is logged: its arguments may hold passwords and tokens.
+type loggedQueryer struct {
+	sqlQueryer
+}
+
+func (q loggedQueryer) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	ctx, span := startQuery(ctx, "", query)
+	defer logQuery(ctx, span, query, time.Now())
+	result, err := q.sqlQueryer.ExecContext(ctx, query, args...)
+	span.RecordError(err)
+	return result, err
+}
+
+// PrepareContext prepares a statement whose executions are logged and traced in turn
+func (q loggedQueryer) PrepareContext(ctx context.Context, query string) (*tracedStmt, error) {
+	spanCtx, span := startQuery(ctx, "PREPARE ", query)
+	defer logQuery(spanCtx, span, query, time.Now())
+	stmt, err := q.sqlQueryer.PrepareContext(spanCtx, query)
+	span.RecordError(err)
+	if err != nil {
+		return nil, err
+	}
+	return &tracedStmt{Stmt: stmt, ctx: ctx, query: query}, nil
+}
+
+func (q loggedQueryer) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	ctx, span := startQuery(ctx, "", query)
+	defer logQuery(ctx, span, query, time.Now())
+	rows, err := q.sqlQueryer.QueryContext(ctx, query, args...)
+	span.RecordError(err)
+	return rows, err
+}
+
+func (q loggedQueryer) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	ctx, span := startQuery(ctx, "", query)
+	defer logQuery(ctx, span, query, time.Now())
+	return q.sqlQueryer.QueryRowContext(ctx, query, args...)
+}
+
+// tracedStmt is a prepared statement whose executions are logged and traced like the other
+// statements. Exec runs in the context the statement was prepared with.
+type tracedStmt struct {
+	*sql.Stmt
+	ctx   context.Context
+	query string
+}
+
+func (s *tracedStmt) ExecContext(ctx context.Context, args ...any) (sql.Result, error) {
+	ctx, span := startQuery(ctx, "", s.query)
+	defer logQuery(ctx, span, s.query, time.Now())
+	result, err := s.Stmt.ExecContext(ctx, args...)
+	span.RecordError(err)
+	return result, err
+}
+
+func (s *tracedStmt) Exec(args ...any) (sql.Result, error) {
+	return s.ExecContext(s.ctx, args...)
+}
+
+func (s *tracedStmt) QueryContext(ctx context.Context, args ...any) (*sql.Rows, error) {
+	ctx, span := startQuery(ctx, "", s.query)
+	defer logQuery(ctx, span, s.query, time.Now())
+	rows, err := s.Stmt.QueryContext(ctx, args...)
+	span.RecordError(err)
+	return rows, err
+}
+
+func (s *tracedStmt) Query(args ...any) (*sql.Rows, error) {
+	return s.QueryContext(s.ctx, args...)
+}
+
+func (s *tracedStmt) QueryRowContext(ctx context.Context, args ...any) *sql.Row {
+	ctx, span := startQuery(ctx, "", s.query)
+	defer logQuery(ctx, span, s.query, time.Now())
+	return s.Stmt.QueryRowContext(ctx, args...)
+}
+
+func (s *tracedStmt) QueryRow(args ...any) *sql.Row {
+	return s.QueryRowContext(s.ctx, args...)
+}
+
+// startQuery starts the span of a statement, named after its operation with prefix
+func startQuery(ctx context.Context, prefix string, query string) (context.Context, *tracing.Span) {
+	statement := sanitizeQuery(query)
+	operation, _, _ := strings.Cut(statement, " ")
+	return tracing.Start(ctx, prefix+strings.ToUpper(operation), tracing.KindClient,
+		tracing.String("db.system", "mysql"),
+		tracing.String("db.operation", strings.ToUpper(operation)),
+		tracing.String("db.statement", statement),
+	)
+}
+
+func logQuery(ctx context.Context, span *tracing.Span, query string, start time.Time) {
+	span.End()
+	utility.Logger(ctx).DebugContext(ctx, "db query",
+		"query", strings.Join(strings.Fields(query), " "),
+		"duration_ms", float64(time.Since(start).Microseconds())/1000,
+	)
+}
+
+// Literals written into a statement rather than passed as arguments
+var (
+	quotedLiteral  = regexp.MustCompile(`'(?:[^'\\]|\\.|'')*'|"(?:[^"\\]|\\.|"")*"`)
+	numericLiteral = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+)
+
+// sanitizeQuery collapses the whitespace of query and replaces its literals with
+// placeholders, so no value ends up in a trace
+func sanitizeQuery(query string) string {
+	query = quotedLiteral.ReplaceAllString(query, "?")
+	query = numericLiteral.ReplaceAllString(query, "?")
+	return strings.Join(strings.Fields(query), " ")
+}
+
+// txn is a transaction that may be joined from an outer one. Commit and Rollback
+// are left to the owner, so a joined txn only runs its statements.
+type txn struct {
+	*sql.Tx
+	owned bool
+}
+
+func (t *txn) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return loggedQueryer{t.Tx}.ExecContext(ctx, query, args...)
+}
+
+func (t *txn) PrepareContext(ctx context.Context, query string) (*tracedStmt, error) {
+	return loggedQueryer{t.Tx}.PrepareContext(ctx, query)
+}
+
+func (t *txn) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return loggedQueryer{t.Tx}.QueryContext(ctx, query, args...)
+}
+
+func (t *txn) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return loggedQueryer{t.Tx}.QueryRowContext(ctx, query, args...)
+}
+
+func (t *txn) Commit() error {
+	if !t.owned {
+		return nil
+	}
+	return t.Tx.Commit()
+}
+
+func (t *txn) Rollback() error {
+	if !t.owned {
+		return nil
+	}
+	return t.Tx.Rollback()
+}
+
+// begin starts a transaction, or joins the one carried by ctx
+func begin(ctx context.Context) (*txn, error) {
+	if tx := txFromContext(ctx); tx != nil {
+		return &txn{Tx: tx}, nil
+	}
+	tx, err := Db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &txn{Tx: tx, owned: true}, nil
+}
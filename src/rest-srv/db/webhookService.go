@@ -0,0 +1,140 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"rest-srv/models"
+	"rest-srv/utility"
+)
+
+const webhookSubscriptionColumns = "id, url, secret, event_types, active, created_at"
+
+func scanWebhookSubscription(scanner interface{ Scan(...any) error }) (models.WebhookSubscription, error) {
+	var subscription models.WebhookSubscription
+	err := scanner.Scan(&subscription.ID, &subscription.URL, &subscription.Secret, &subscription.EventTypes, &subscription.Active, &subscription.CreatedAt)
+	return subscription, err
+}
+
+// GetWebhookSubscriptions lists subscriptions, only the active ones if activeOnly is set
+func GetWebhookSubscriptions(ctx context.Context, activeOnly bool) ([]models.WebhookSubscription, error) {
+	query := "SELECT " + webhookSubscriptionColumns + " FROM webhook_subscriptions"
+	if activeOnly {
+		query += " WHERE active = true"
+	}
+	rows, err := conn(ctx).QueryContext(ctx, query+" ORDER BY id")
+	if err != nil {
+		return nil, utility.ErrorHandlerContext(ctx, err, "unable to retrieve webhooks")
+	}
+	defer rows.Close()
+
+	subscriptions := make([]models.WebhookSubscription, 0)
+	for rows.Next() {
+		subscription, err := scanWebhookSubscription(rows)
+		if err != nil {
+			return nil, utility.ErrorHandlerContext(ctx, err, "unable to process webhook data")
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	return subscriptions, nil
+}
+
+func GetWebhookSubscriptionById(ctx context.Context, id int) (models.WebhookSubscription, error) {
+	row := conn(ctx).QueryRowContext(ctx, "SELECT "+webhookSubscriptionColumns+" FROM webhook_subscriptions WHERE id = ?", id)
+	subscription, err := scanWebhookSubscription(row)
+	if err == sql.ErrNoRows {
+		return models.WebhookSubscription{}, utility.ErrorHandlerContext(ctx, err, "webhook not found")
+	}
+	if err != nil {
+		return models.WebhookSubscription{}, utility.ErrorHandlerContext(ctx, err, "unable to retrieve webhook")
+	}
+	return subscription, nil
+}
+
+func AddWebhookSubscription(ctx context.Context, subscription models.WebhookSubscription) (models.WebhookSubscription, error) {
+	res, err := conn(ctx).ExecContext(ctx, "INSERT INTO webhook_subscriptions (url, secret, event_types, active) VALUES (?, ?, ?, ?)", subscription.URL, subscription.Secret, subscription.EventTypes, subscription.Active)
+	if err != nil {
+		return models.WebhookSubscription{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	lastID, err := res.LastInsertId()
+	if err != nil {
+		return models.WebhookSubscription{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	subscription.ID = int(lastID)
+	return subscription, nil
+}
+
+func UpdateWebhookSubscription(ctx context.Context, id int, subscription models.WebhookSubscription) (models.WebhookSubscription, error) {
+	_, err := GetWebhookSubscriptionById(ctx, id)
+	if err != nil {
+		return models.WebhookSubscription{}, err
+	}
+	subscription.ID = id
+	_, err = conn(ctx).ExecContext(ctx, "UPDATE webhook_subscriptions SET url = ?, secret = ?, event_types = ?, active = ? WHERE id = ?", subscription.URL, subscription.Secret, subscription.EventTypes, subscription.Active, id)
+	if err != nil {
+		return models.WebhookSubscription{}, utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	return subscription, nil
+}
+
+func DeleteWebhookSubscription(ctx context.Context, id int) error {
+	result, err := conn(ctx).ExecContext(ctx, "DELETE FROM webhook_subscriptions WHERE id = ?", id)
+	if err != nil {
+		return utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return utility.ErrorHandlerContext(ctx, err, "database error")
+	}
+	if rowsAffected == 0 {
+		return utility.ErrorHandlerContext(ctx, errors.New("webhook not found"), "webhook not found")
+	}
+	return nil
+}
+
+// GetWebhookDeliveries lists the deliveries of a subscription, newest first
+func GetWebhookDeliveries(ctx context.Context, subscriptionID int, limit int) ([]models.WebhookDelivery, error) {
+	rows, err := conn(ctx).QueryContext(ctx, "SELECT id, subscription_id, event_id, status, attempts, next_attempt_at, last_status_code, last_error FROM webhook_deliveries WHERE subscription_id = ? ORDER BY id DESC LIMIT ?", subscriptionID, limit)
+	if err != nil {
+		return nil, utility.ErrorHandlerContext(ctx, err, "unable to retrieve deliveries")
+	}
+	defer rows.Close()
+
+	deliveries := make([]models.WebhookDelivery, 0)
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		var lastStatusCode sql.NullInt64
+		err = rows.Scan(&delivery.ID, &delivery.SubscriptionID, &delivery.EventID, &delivery.Status, &delivery.Attempts, &delivery.NextAttemptAt, &lastStatusCode, &delivery.LastError)
+		if err != nil {
+			return nil, utility.ErrorHandlerContext(ctx, err, "unable to process delivery data")
+		}
+		delivery.LastStatusCode = int(lastStatusCode.Int64)
+		deliveries = append(deliveries, delivery)
+	}
+	return deliveries, nil
+}
+
+// GetWebhookDeliveryAttempts returns the delivery log of a single delivery of a subscription
+func GetWebhookDeliveryAttempts(ctx context.Context, subscriptionID int, deliveryID int64) ([]models.WebhookDeliveryAttempt, error) {
+	rows, err := conn(ctx).QueryContext(ctx, `SELECT a.id, a.delivery_id, a.attempted_at, a.status_code, a.error, a.duration_ms
+		FROM webhook_delivery_attempts a JOIN webhook_deliveries d ON d.id = a.delivery_id
+		WHERE d.subscription_id = ? AND a.delivery_id = ? ORDER BY a.id`, subscriptionID, deliveryID)
+	if err != nil {
+		return nil, utility.ErrorHandlerContext(ctx, err, "unable to retrieve delivery attempts")
+	}
+	defer rows.Close()
+
+	attempts := make([]models.WebhookDeliveryAttempt, 0)
+	for rows.Next() {
+		var attempt models.WebhookDeliveryAttempt
+		var statusCode sql.NullInt64
+		err = rows.Scan(&attempt.ID, &attempt.DeliveryID, &attempt.AttemptedAt, &statusCode, &attempt.Error, &attempt.DurationMs)
+		if err != nil {
+			return nil, utility.ErrorHandlerContext(ctx, err, "unable to process delivery data")
+		}
+		attempt.StatusCode = int(statusCode.Int64)
+		attempts = append(attempts, attempt)
+	}
+	return attempts, nil
+}
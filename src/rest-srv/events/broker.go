@@ -0,0 +1,259 @@
+package events
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"slices"
+	"sync"
+	"time"
+
+	"rest-srv/db"
+	"rest-srv/models"
+)
+
+const (
+	pollBatchSize    = 500
+	subscriberBuffer = 64
+	// gapGracePeriod is how long an id skipped by the tail is looked for again. InnoDB hands
+	// out auto-increment ids before transactions commit, so an event may be committed after
+	// events with higher ids; an id still missing after this long was rolled back.
+	gapGracePeriod = time.Minute
+	// maxGaps bounds the ids looked for again after a single jump of the ids
+	maxGaps = pollBatchSize
+)
+
+// Event is an outbox event as pushed to stream subscribers
+type Event struct {
+	ID       int64
+	Type     string
+	Entity   string
+	EntityID int
+	// Classes holds the class of the entity before and after the change, if it has one
+	Classes []string
+	Payload json.RawMessage
+}
+
+// Matches reports whether the event passes the entity and class filters of a subscriber.
+// An empty filter matches everything.
+func (e Event) Matches(entities []string, classes []string) bool {
+	if len(entities) > 0 && !slices.Contains(entities, e.Entity) {
+		return false
+	}
+	if len(classes) == 0 {
+		return true
+	}
+	for _, class := range e.Classes {
+		if slices.Contains(classes, class) {
+			return true
+		}
+	}
+	return false
+}
+
+// Broker tails the outbox and fans new events out to stream subscribers. It keeps the
+// latest events in a bounded buffer so reconnecting clients can resume from Last-Event-ID.
+// An event committed after events with higher ids is pushed when it shows up, out of id order.
+type Broker struct {
+	mu           sync.Mutex
+	pollInterval time.Duration
+	bufferSize   int
+	buffer       []Event
+	lastID       int64
+	// gaps holds the ids below lastID that were not committed yet when the tail passed them,
+	// with the time they were found missing
+	gaps map[int64]time.Time
+	// evictedID is the newest event that is no longer in the buffer
+	evictedID   int64
+	subscribers map[chan Event]struct{}
+	stopped     bool
+	stop        chan struct{}
+	done        chan struct{}
+}
+
+func NewBroker(bufferSize int, pollInterval time.Duration) *Broker {
+	b := &Broker{
+		pollInterval: pollInterval,
+		bufferSize:   bufferSize,
+		gaps:         make(map[int64]time.Time),
+		subscribers:  make(map[chan Event]struct{}),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	// Start just far enough back to fill the replay buffer
+	latestID, _ := db.GetLatestOutboxEventId(context.Background())
+	b.lastID = max(latestID-int64(bufferSize), 0)
+	b.evictedID = b.lastID
+	go b.run()
+	return b
+}
+
+func (b *Broker) run() {
+	defer close(b.done)
+	for {
+		b.poll(context.Background())
+		select {
+		case <-b.stop:
+			return
+		case <-time.After(b.pollInterval):
+		}
+	}
+}
+
+// Stop stops tailing the outbox and closes every subscriber channel, which ends the event
+// streams so the server can shut down without waiting for them. It waits for the poll in
+// progress until ctx is done.
+func (b *Broker) Stop(ctx context.Context) error {
+	close(b.stop)
+	b.mu.Lock()
+	b.stopped = true
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+	b.mu.Unlock()
+
+	select {
+	case <-b.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *Broker) poll(ctx context.Context) {
+	b.pollGaps(ctx)
+	for {
+		outboxEvents, err := db.GetOutboxEventsAfter(ctx, b.lastID, pollBatchSize)
+		if err != nil || len(outboxEvents) == 0 {
+			return
+		}
+		for _, outboxEvent := range outboxEvents {
+			b.publish(newEvent(outboxEvent))
+		}
+		if len(outboxEvents) < pollBatchSize {
+			return
+		}
+	}
+}
+
+// pollGaps looks again for the events the tail skipped, and publishes those committed since
+func (b *Broker) pollGaps(ctx context.Context) {
+	b.mu.Lock()
+	ids := make([]int64, 0, len(b.gaps))
+	for id, missingSince := range b.gaps {
+		if time.Since(missingSince) > gapGracePeriod {
+			delete(b.gaps, id)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	b.mu.Unlock()
+	if len(ids) == 0 {
+		return
+	}
+
+	outboxEvents, err := db.GetOutboxEventsByIds(ctx, ids)
+	if err != nil {
+		return
+	}
+	for _, outboxEvent := range outboxEvents {
+		b.publish(newEvent(outboxEvent))
+	}
+}
+
+func newEvent(outboxEvent models.OutboxEvent) Event {
+	event := Event{
+		ID:       outboxEvent.ID,
+		Type:     outboxEvent.EventType,
+		Entity:   outboxEvent.Entity,
+		EntityID: outboxEvent.EntityID,
+		Payload:  outboxEvent.Payload,
+	}
+	// SSE data lines can't contain newlines
+	var compact bytes.Buffer
+	if json.Compact(&compact, outboxEvent.Payload) == nil {
+		event.Payload = compact.Bytes()
+	}
+
+	var payload struct {
+		Data     struct{ Class string } `json:"data"`
+		Previous struct{ Class string } `json:"previous"`
+	}
+	json.Unmarshal(outboxEvent.Payload, &payload)
+	for _, class := range []string{payload.Data.Class, payload.Previous.Class} {
+		if class != "" && !slices.Contains(event.Classes, class) {
+			event.Classes = append(event.Classes, class)
+		}
+	}
+	return event
+}
+
+func (b *Broker) publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if event.ID > b.lastID {
+		for id := max(b.lastID+1, event.ID-maxGaps); id < event.ID; id++ {
+			b.gaps[id] = time.Now()
+		}
+		b.lastID = event.ID
+	} else if _, ok := b.gaps[event.ID]; ok {
+		delete(b.gaps, event.ID)
+	} else {
+		// Published already
+		return
+	}
+
+	// The buffer stays in id order for the replay, whatever order the events were committed in
+	index, _ := slices.BinarySearchFunc(b.buffer, event.ID, func(e Event, id int64) int { return cmp.Compare(e.ID, id) })
+	b.buffer = slices.Insert(b.buffer, index, event)
+	if len(b.buffer) > b.bufferSize {
+		b.evictedID = b.buffer[0].ID
+		b.buffer = slices.Delete(b.buffer, 0, 1)
+	}
+
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// A subscriber that can't keep up is dropped; it can resume with Last-Event-ID
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe registers a subscriber and returns the buffered events after lastEventID.
+// complete is false when events after lastEventID were already evicted from the buffer.
+// The channel is closed if the subscriber falls behind or the broker stops; unsubscribe must
+// always be called.
+func (b *Broker) Subscribe(lastEventID int64) (ch <-chan Event, replay []Event, complete bool, unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, event := range b.buffer {
+		if event.ID > lastEventID {
+			replay = append(replay, event)
+		}
+	}
+	complete = lastEventID >= b.evictedID
+
+	subscriber := make(chan Event, subscriberBuffer)
+	if b.stopped {
+		// The stream ends right after the replay
+		close(subscriber)
+		return subscriber, replay, complete, func() {}
+	}
+	b.subscribers[subscriber] = struct{}{}
+	unsubscribe = func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[subscriber]; ok {
+			delete(b.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+	return subscriber, replay, complete, unsubscribe
+}
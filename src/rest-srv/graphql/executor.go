@@ -0,0 +1,477 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+
+	"rest-srv/utility"
+)
+
+// Schema is an executable GraphQL schema
+type Schema struct {
+	types    map[string]*namedType
+	query    *namedType
+	mutation *namedType
+}
+
+type Request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+type Response struct {
+	// Data is absent when the request failed before execution and null when execution failed
+	Data   json.RawMessage `json:"data,omitempty"`
+	Errors []Error         `json:"errors,omitempty"`
+}
+
+type Error struct {
+	Message    string         `json:"message"`
+	Path       []string       `json:"path,omitempty"`
+	Extensions map[string]any `json:"extensions,omitempty"`
+}
+
+// userError is a resolver error that is reported to the client with an error code
+type userError struct {
+	message string
+	code    string
+}
+
+func (e userError) Error() string {
+	return e.message
+}
+
+func newUserError(code string, format string, args ...any) error {
+	return userError{message: fmt.Sprintf(format, args...), code: code}
+}
+
+// Execute runs the operation of a request. Request errors (syntax, validation, variables)
+// are returned without data, matching the GraphQL over HTTP convention of a 400 response.
+func (s *Schema) Execute(ctx context.Context, req Request) (Response, bool) {
+	doc, err := parse(req.Query)
+	if err != nil {
+		return requestError("Syntax Error: " + err.Error()), false
+	}
+	op, err := selectOperation(doc, req.OperationName)
+	if err != nil {
+		return requestError(err.Error()), false
+	}
+	root := s.query
+	if op.kind == "mutation" {
+		if s.mutation == nil {
+			return requestError("schema does not support mutations"), false
+		}
+		root = s.mutation
+	}
+	if err := s.validate(doc, op, root); err != nil {
+		return requestError(err.Error()), false
+	}
+	variables, err := s.coerceVariables(op, req.Variables)
+	if err != nil {
+		return requestError(err.Error()), false
+	}
+
+	e := &executor{schema: s, fragments: doc.fragments, variables: variables}
+	results := e.executeSelectionSet(ctx, root, []any{nil}, op.selections, nil)
+	var response Response
+	data, err := json.Marshal(results[0])
+	if err != nil {
+		return requestError("unable to encode response"), false
+	}
+	response.Data = data
+	response.Errors = e.errors
+	return response, true
+}
+
+func requestError(message string) Response {
+	return Response{Errors: []Error{{Message: message}}}
+}
+
+func selectOperation(doc *document, name string) (*operation, error) {
+	if name == "" {
+		if len(doc.operations) > 1 {
+			return nil, fmt.Errorf("operationName is required when the document has several operations")
+		}
+		return doc.operations[0], nil
+	}
+	for _, op := range doc.operations {
+		if op.name == name {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operation %q", name)
+}
+
+func (s *Schema) coerceVariables(op *operation, values map[string]any) (map[string]any, error) {
+	variables := make(map[string]any)
+	for _, definition := range op.variables {
+		value, present := values[definition.name]
+		if !present {
+			if definition.defaultValue != nil {
+				defaultValue, err := literalValue(definition.defaultValue, nil)
+				if err != nil {
+					return nil, err
+				}
+				variables[definition.name], err = s.coerceInput(definition.typ, defaultValue, "$"+definition.name)
+				if err != nil {
+					return nil, err
+				}
+			} else if definition.typ.nonNull {
+				return nil, fmt.Errorf("variable $%s of type %s is required", definition.name, definition.typ)
+			}
+			continue
+		}
+		coerced, err := s.coerceInput(definition.typ, value, "$"+definition.name)
+		if err != nil {
+			return nil, err
+		}
+		variables[definition.name] = coerced
+	}
+	return variables, nil
+}
+
+// literalValue converts a document value to its Go form, substituting variables. String
+// literals are sanitized here because the document itself bypasses the XSS middleware.
+func literalValue(node *valueNode, variables map[string]any) (any, error) {
+	switch node.kind {
+	case valueVariable:
+		return variables[node.raw], nil
+	case valueInt:
+		value, err := strconv.Atoi(node.raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Int %s", node.raw)
+		}
+		return value, nil
+	case valueFloat:
+		return strconv.ParseFloat(node.raw, 64)
+	case valueString:
+		return utility.SanitizeString(node.raw), nil
+	case valueBoolean:
+		return node.raw == "true", nil
+	case valueEnum:
+		return enumLiteral(node.raw), nil
+	case valueList:
+		list := make([]any, len(node.list))
+		for i, item := range node.list {
+			value, err := literalValue(item, variables)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = value
+		}
+		return list, nil
+	case valueObject:
+		object := make(map[string]any)
+		for name, fieldNode := range node.fields {
+			// an object field set to an undefined variable is treated as absent
+			if fieldNode.kind == valueVariable {
+				if _, defined := variables[fieldNode.raw]; !defined {
+					continue
+				}
+			}
+			value, err := literalValue(fieldNode, variables)
+			if err != nil {
+				return nil, err
+			}
+			object[name] = value
+		}
+		return object, nil
+	}
+	return nil, nil
+}
+
+type executor struct {
+	schema    *Schema
+	fragments map[string]*fragment
+	variables map[string]any
+	errors    []Error
+}
+
+func (e *executor) addError(err error, path []string) {
+	graphqlError := Error{Message: err.Error(), Path: path}
+	var validationErrors utility.ValidationErrors
+	var resolverError userError
+	switch {
+	case errors.As(err, &validationErrors):
+		graphqlError.Message = "validation failed"
+		graphqlError.Extensions = map[string]any{"code": "BAD_USER_INPUT", "errors": validationErrors}
+	case errors.As(err, &resolverError):
+		graphqlError.Extensions = map[string]any{"code": resolverError.code}
+	}
+	e.errors = append(e.errors, graphqlError)
+}
+
+// fieldGroup is every selection of the same response key, merged
+type fieldGroup struct {
+	key        string
+	selections []*selection
+}
+
+// collectFields flattens fragments and applies @skip and @include, grouping fields by response key
+func (e *executor) collectFields(t *namedType, selections []*selection, groups []*fieldGroup) []*fieldGroup {
+	for _, s := range selections {
+		if !e.included(s.directives) {
+			continue
+		}
+		switch {
+		case s.fragmentName != "":
+			fragment := e.fragments[s.fragmentName]
+			if fragment.typeCondition == t.name {
+				groups = e.collectFields(t, fragment.selections, groups)
+			}
+		case s.inline:
+			if s.typeCondition == "" || s.typeCondition == t.name {
+				groups = e.collectFields(t, s.selections, groups)
+			}
+		default:
+			key := s.responseKey()
+			index := -1
+			for i, group := range groups {
+				if group.key == key {
+					index = i
+				}
+			}
+			if index < 0 {
+				groups = append(groups, &fieldGroup{key: key})
+				index = len(groups) - 1
+			}
+			groups[index].selections = append(groups[index].selections, s)
+		}
+	}
+	return groups
+}
+
+func (e *executor) included(directives []directive) bool {
+	for _, d := range directives {
+		if d.name != "skip" && d.name != "include" {
+			continue
+		}
+		value, _ := literalValue(d.arguments["if"], e.variables)
+		condition, _ := value.(bool)
+		if d.name == "skip" && condition || d.name == "include" && !condition {
+			return false
+		}
+	}
+	return true
+}
+
+// executeSelectionSet resolves selections on every parent of type t. Each field is resolved
+// once for all parents. A parent whose non-null field failed is returned as nil.
+func (e *executor) executeSelectionSet(ctx context.Context, t *namedType, parents []any, selections []*selection, path []string) []*orderedObject {
+	results := make([]*orderedObject, len(parents))
+	for i := range results {
+		results[i] = &orderedObject{values: make(map[string]any)}
+	}
+	failed := make([]bool, len(parents))
+
+	for _, group := range e.collectFields(t, selections, nil) {
+		fieldPath := append(slices.Clone(path), group.key)
+		first := group.selections[0]
+		if first.name == "__typename" {
+			for _, result := range results {
+				result.set(group.key, t.name)
+			}
+			continue
+		}
+
+		f := t.field(first.name)
+		var values []any
+		var invalid []bool
+		args, err := e.coerceArguments(f.args, first.arguments)
+		if err == nil {
+			resolve := f.resolve
+			if resolve == nil {
+				resolve = propertyResolver(f.name)
+			}
+			values, err = resolve(ctx, parents, args)
+		}
+		if err != nil {
+			e.addError(err, fieldPath)
+			values = make([]any, len(parents))
+			invalid = make([]bool, len(parents))
+			for i := range invalid {
+				invalid[i] = f.typ.nonNull
+			}
+		} else {
+			var subSelections []*selection
+			for _, s := range group.selections {
+				subSelections = append(subSelections, s.selections...)
+			}
+			values, invalid = e.completeValues(ctx, f.typ, values, subSelections, fieldPath)
+		}
+
+		for i, result := range results {
+			result.set(group.key, values[i])
+			failed[i] = failed[i] || invalid[i]
+		}
+	}
+
+	for i := range results {
+		if failed[i] {
+			results[i] = nil
+		}
+	}
+	return results
+}
+
+// completeValues shapes resolved values to their field type, resolving the sub-selections of
+// object values together. invalid marks values that are null where the type forbids it.
+func (e *executor) completeValues(ctx context.Context, t *typeRef, values []any, selections []*selection, path []string) ([]any, []bool) {
+	invalid := make([]bool, len(values))
+	if t.nonNull {
+		completed, innerInvalid := e.completeValues(ctx, t.ofType, values, selections, path)
+		for i, value := range completed {
+			if value == nil {
+				if !innerInvalid[i] && values[i] == nil {
+					e.addError(fmt.Errorf("cannot return null for non-nullable field"), path)
+				}
+				invalid[i] = true
+			}
+		}
+		return completed, invalid
+	}
+
+	completed := make([]any, len(values))
+	if t.isList() {
+		// Flatten the lists of every parent so the items are completed in one batch
+		var items []any
+		var owners []int
+		for i, value := range values {
+			list := reflect.ValueOf(value)
+			if value == nil || (list.Kind() == reflect.Slice && list.IsNil()) {
+				continue
+			}
+			if list.Kind() != reflect.Slice {
+				e.addError(fmt.Errorf("expected a list"), path)
+				continue
+			}
+			for j := 0; j < list.Len(); j++ {
+				items = append(items, list.Index(j).Interface())
+				owners = append(owners, i)
+			}
+			completed[i] = make([]any, 0, list.Len())
+		}
+		completedItems, invalidItems := e.completeValues(ctx, t.ofType, items, selections, path)
+		brokenLists := make([]bool, len(values))
+		for j, item := range completedItems {
+			owner := owners[j]
+			brokenLists[owner] = brokenLists[owner] || invalidItems[j]
+			completed[owner] = append(completed[owner].([]any), item)
+		}
+		for i := range completed {
+			if brokenLists[i] {
+				completed[i] = nil
+			}
+		}
+		return completed, invalid
+	}
+
+	named := e.schema.types[t.name]
+	if named.isLeaf() {
+		for i, value := range values {
+			if value == nil {
+				continue
+			}
+			serialized, err := serializeScalar(t.name, value)
+			if err != nil {
+				e.addError(err, path)
+				continue
+			}
+			completed[i] = serialized
+		}
+		return completed, invalid
+	}
+
+	var children []any
+	var owners []int
+	for i, value := range values {
+		if value == nil || isNilPointer(value) {
+			continue
+		}
+		children = append(children, value)
+		owners = append(owners, i)
+	}
+	if len(children) == 0 {
+		return completed, invalid
+	}
+	objects := e.executeSelectionSet(ctx, named, children, selections, path)
+	for j, object := range objects {
+		if object != nil {
+			completed[owners[j]] = object
+		}
+	}
+	return completed, invalid
+}
+
+func (e *executor) coerceArguments(definitions []*argument, nodes map[string]*valueNode) (map[string]any, error) {
+	args := make(map[string]any)
+	for _, definition := range definitions {
+		node, present := nodes[definition.name]
+		if present && node.kind == valueVariable {
+			_, present = e.variables[node.raw]
+		}
+		if !present {
+			if definition.defaultValue != nil {
+				args[definition.name] = definition.defaultValue
+			} else if definition.typ.nonNull {
+				return nil, newUserError("BAD_USER_INPUT", "argument %s of type %s is required", definition.name, definition.typ)
+			}
+			continue
+		}
+		value, err := literalValue(node, e.variables)
+		if err != nil {
+			return nil, newUserError("BAD_USER_INPUT", "argument %s: %s", definition.name, err)
+		}
+		coerced, err := e.schema.coerceInput(definition.typ, value, definition.name)
+		if err != nil {
+			return nil, newUserError("BAD_USER_INPUT", "argument %s", err)
+		}
+		args[definition.name] = coerced
+	}
+	return args, nil
+}
+
+func isNilPointer(value any) bool {
+	v := reflect.ValueOf(value)
+	return v.Kind() == reflect.Pointer && v.IsNil()
+}
+
+// orderedObject is a result object that keeps its fields in selection order
+type orderedObject struct {
+	keys   []string
+	values map[string]any
+}
+
+func (o *orderedObject) set(key string, value any) {
+	if _, exists := o.values[key]; !exists {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+func (o *orderedObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		keyJSON, _ := json.Marshal(key)
+		buf.Write(keyJSON)
+		buf.WriteByte(':')
+		valueJSON, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(valueJSON)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,407 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type testStudent struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Class string `json:"class"`
+}
+
+var testStudents = []testStudent{
+	{ID: 1, Name: "Ada", Class: "9A"},
+	{ID: 2, Name: "Grace", Class: "9A"},
+	{ID: 3, Name: "Linus", Class: "9B"},
+}
+
+// testSchema serves testStudents from memory and counts the calls of the classmates
+// resolver in classmatesCalls
+func testSchema(classmatesCalls *int) *Schema {
+	s := &Schema{types: make(map[string]*namedType)}
+	for _, scalar := range builtinScalars {
+		s.add(scalar)
+	}
+	s.add(&namedType{kind: kindObject, name: "Student", fields: []*field{
+		{name: "id", typ: typeOf("ID!")},
+		{name: "name", typ: typeOf("String!")},
+		{name: "class", typ: typeOf("String!")},
+		{name: "classmates", typ: typeOf("[Student!]!"), resolve: func(ctx context.Context, parents []any, args map[string]any) ([]any, error) {
+			*classmatesCalls++
+			values := make([]any, len(parents))
+			for i, parent := range parents {
+				student := parent.(testStudent)
+				var classmates []testStudent
+				for _, other := range testStudents {
+					if other.Class == student.Class && other.ID != student.ID {
+						classmates = append(classmates, other)
+					}
+				}
+				values[i] = classmates
+			}
+			return values, nil
+		}},
+		{name: "friend", typ: typeOf("Student"), resolve: func(ctx context.Context, parents []any, args map[string]any) ([]any, error) {
+			values := make([]any, len(parents))
+			for i, parent := range parents {
+				values[i] = testStudents[parent.(testStudent).ID%len(testStudents)]
+			}
+			return values, nil
+		}},
+		{name: "nickname", typ: typeOf("String!"), resolve: func(ctx context.Context, parents []any, args map[string]any) ([]any, error) {
+			return make([]any, len(parents)), nil
+		}},
+		{name: "secret", typ: typeOf("String"), resolve: func(ctx context.Context, parents []any, args map[string]any) ([]any, error) {
+			return nil, newUserError("FORBIDDEN", "no secrets")
+		}},
+	}})
+	s.query = &namedType{kind: kindObject, name: "Query", fields: []*field{
+		{name: "student", typ: typeOf("Student"), args: []*argument{{name: "id", typ: typeOf("ID!")}}, resolve: root(func(ctx context.Context, args map[string]any) (any, error) {
+			id, _ := strconv.Atoi(args["id"].(string))
+			for _, student := range testStudents {
+				if student.ID == id {
+					return student, nil
+				}
+			}
+			return nil, nil
+		})},
+		{name: "students", typ: typeOf("[Student!]!"), args: []*argument{{name: "class", typ: typeOf("String")}, {name: "limit", typ: typeOf("Int"), defaultValue: 10}}, resolve: root(func(ctx context.Context, args map[string]any) (any, error) {
+			var students []testStudent
+			for _, student := range testStudents {
+				if class, ok := args["class"].(string); !ok || student.Class == class {
+					students = append(students, student)
+				}
+			}
+			return students[:min(len(students), args["limit"].(int))], nil
+		})},
+		{name: "failing", typ: typeOf("Student!"), resolve: root(func(ctx context.Context, args map[string]any) (any, error) {
+			return nil, errors.New("database is down")
+		})},
+	}}
+	s.add(s.query)
+	s.mutation = &namedType{kind: kindObject, name: "Mutation", fields: []*field{
+		{name: "rename", typ: typeOf("Student!"), args: []*argument{{name: "id", typ: typeOf("ID!")}, {name: "name", typ: typeOf("String!")}}, resolve: root(func(ctx context.Context, args map[string]any) (any, error) {
+			id, _ := strconv.Atoi(args["id"].(string))
+			return testStudent{ID: id, Name: args["name"].(string), Class: "9A"}, nil
+		})},
+	}}
+	s.add(s.mutation)
+	s.addIntrospection()
+	return s
+}
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		name      string
+		req       Request
+		data      string
+		errors    []string
+		errorPath []string
+	}{
+		{
+			name: "fields in selection order",
+			req:  Request{Query: `{ student(id: 1) { name id } }`},
+			data: `{"student":{"name":"Ada","id":"1"}}`,
+		},
+		{
+			name: "missing object is null",
+			req:  Request{Query: `{ student(id: 9) { name } }`},
+			data: `{"student":null}`,
+		},
+		{
+			name: "aliases and __typename",
+			req:  Request{Query: `{ a: student(id: 1) { __typename n: name } b: student(id: 3) { n: name } }`},
+			data: `{"a":{"__typename":"Student","n":"Ada"},"b":{"n":"Linus"}}`,
+		},
+		{
+			name: "fragments and merged fields",
+			req:  Request{Query: `{ student(id: 2) { ...f ... on Student { id } name } } fragment f on Student { name class }`},
+			data: `{"student":{"name":"Grace","class":"9A","id":"2"}}`,
+		},
+		{
+			name: "variables, defaults and directives",
+			req: Request{
+				Query:     `query ($class: String = "9A", $withClass: Boolean!) { students(class: $class) { name class @include(if: $withClass) id @skip(if: true) } }`,
+				Variables: map[string]any{"withClass": false},
+			},
+			data: `{"students":[{"name":"Ada"},{"name":"Grace"}]}`,
+		},
+		{
+			name: "nested lists",
+			req:  Request{Query: `{ students(limit: 2) { name classmates { name } } }`},
+			data: `{"students":[{"name":"Ada","classmates":[{"name":"Grace"}]},{"name":"Grace","classmates":[{"name":"Ada"}]}]}`,
+		},
+		{
+			name: "operation by name",
+			req:  Request{Query: `query A { student(id: 1) { name } } query B { student(id: 3) { name } }`, OperationName: "B"},
+			data: `{"student":{"name":"Linus"}}`,
+		},
+		{
+			name: "mutation",
+			req:  Request{Query: `mutation ($name: String!) { rename(id: 2, name: $name) { id name } }`, Variables: map[string]any{"name": "Hopper"}},
+			data: `{"rename":{"id":"2","name":"Hopper"}}`,
+		},
+		{
+			name:      "resolver error on a nullable field",
+			req:       Request{Query: `{ student(id: 1) { name secret } }`},
+			data:      `{"student":{"name":"Ada","secret":null}}`,
+			errors:    []string{"no secrets"},
+			errorPath: []string{"student", "secret"},
+		},
+		{
+			name:      "null of a non-null field nulls the parent",
+			req:       Request{Query: `{ student(id: 1) { name nickname } }`},
+			data:      `{"student":null}`,
+			errors:    []string{"cannot return null for non-nullable field"},
+			errorPath: []string{"student", "nickname"},
+		},
+		{
+			name:      "error of a non-null root field nulls the data",
+			req:       Request{Query: `{ failing { name } }`},
+			data:      `null`,
+			errors:    []string{"database is down"},
+			errorPath: []string{"failing"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			response, executed := testSchema(&calls).Execute(context.Background(), tt.req)
+			if !executed {
+				t.Fatalf("Execute failed: %v", response.Errors)
+			}
+			if string(response.Data) != tt.data {
+				t.Errorf("data = %s, want %s", response.Data, tt.data)
+			}
+			var messages []string
+			for _, e := range response.Errors {
+				messages = append(messages, e.Message)
+			}
+			if !slices.Equal(messages, tt.errors) {
+				t.Errorf("errors = %q, want %q", messages, tt.errors)
+			}
+			if tt.errorPath != nil && !slices.Equal(response.Errors[0].Path, tt.errorPath) {
+				t.Errorf("error path = %v, want %v", response.Errors[0].Path, tt.errorPath)
+			}
+		})
+	}
+}
+
+func TestExecuteBatchesLevels(t *testing.T) {
+	var calls int
+	schema := testSchema(&calls)
+	response, _ := schema.Execute(context.Background(), Request{Query: `{ students(limit: 3) { classmates { classmates { id } } } }`})
+	if len(response.Errors) > 0 {
+		t.Fatalf("errors: %v", response.Errors)
+	}
+	// One call for the classmates of every student, one for the classmates of every classmate
+	if calls != 2 {
+		t.Errorf("classmates resolved in %d calls, want 2", calls)
+	}
+}
+
+func TestExecuteRequestErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		req  Request
+		want string
+	}{
+		{"syntax", Request{Query: `{ student(id: 1) { name }`}, "Syntax Error: unexpected end of document"},
+		{"unknown field", Request{Query: `{ student(id: 1) { age } }`}, `cannot query field "age" on type "Student"`},
+		{"unknown argument", Request{Query: `{ student(id: 1, name: "x") { id } }`}, `unknown argument "name"`},
+		{"missing argument", Request{Query: `{ student { id } }`}, "requires argument id of type ID!"},
+		{"leaf with a selection", Request{Query: `{ student(id: 1) { name { x } } }`}, "must not have a selection"},
+		{"object without a selection", Request{Query: `{ student(id: 1) }`}, "must have a selection of subfields"},
+		{"unknown fragment", Request{Query: `{ student(id: 1) { ...f } }`}, "unknown fragment f"},
+		{"fragment cycle", Request{Query: `{ student(id: 1) { ...f } } fragment f on Student { classmates { ...f } }`}, "fragment f spreads itself"},
+		{"fragment on another type", Request{Query: `{ student(id: 1) { ... on Query { id } } }`}, "can't be spread on Student"},
+		{"unknown directive", Request{Query: `{ student(id: 1) { id @deprecated } }`}, "unknown directive @deprecated"},
+		{"undefined variable", Request{Query: `{ student(id: $id) { id } }`}, "variable $id is not defined"},
+		{"missing variable", Request{Query: `query ($id: ID!) { student(id: $id) { id } }`}, "variable $id of type ID! is required"},
+		{"variable of the wrong type", Request{Query: `query ($n: Int) { students(limit: $n) { id } }`, Variables: map[string]any{"n": "ten"}}, "$n must be of type Int"},
+		{"several operations", Request{Query: `query A { students { id } } query B { students { id } }`}, "operationName is required"},
+		{"unknown operation", Request{Query: `query A { students { id } }`, OperationName: "B"}, `unknown operation "B"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			response, executed := testSchema(&calls).Execute(context.Background(), tt.req)
+			if executed || response.Data != nil {
+				t.Fatalf("Execute ran the request: %s", response.Data)
+			}
+			if len(response.Errors) != 1 || !strings.Contains(response.Errors[0].Message, tt.want) {
+				t.Errorf("errors = %v, want one containing %q", response.Errors, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecuteLimits(t *testing.T) {
+	nested := func(depth int) string {
+		return "{ student(id: 1) " + strings.Repeat("{ friend ", depth-2) + "{ id }" + strings.Repeat(" }", depth-2) + " }"
+	}
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"deepest allowed", nested(maxDepth), ""},
+		{"too deep", nested(maxDepth + 1), "nested deeper than 15 fields"},
+		{"within the cost", `{ students { id classmates { id name } } }`, ""},
+		{"lists multiply the cost", `{ students { classmates { classmates { classmates { id } } } } }`, "exceeds the maximum cost of 1000"},
+		{"limit arguments set the list size", `{ students(limit: 1000) { id } }`, "exceeds the maximum cost"},
+		{"aliases add up", "{ " + strings.Repeat("s: students(limit: 100) { id } ", 10) + "}", "exceeds the maximum cost"},
+		{
+			"fragments spread over and over",
+			`{ students(limit: 1) { ...a } }
+			fragment a on Student { ...b ...b ...b ...b }
+			fragment b on Student { ...c ...c ...c ...c }
+			fragment c on Student { ...d ...d ...d ...d }
+			fragment d on Student { ...e ...e ...e ...e }
+			fragment e on Student { ...f ...f ...f ...f }
+			fragment f on Student { id name class }`,
+			"exceeds the maximum cost",
+		},
+		{"introspection", introspectionQuery, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			response, executed := testSchema(&calls).Execute(context.Background(), Request{Query: tt.query})
+			if tt.want == "" {
+				if !executed {
+					t.Errorf("Execute refused the request: %v", response.Errors)
+				}
+				return
+			}
+			if executed || len(response.Errors) != 1 || !strings.Contains(response.Errors[0].Message, tt.want) {
+				t.Errorf("Execute = %v, want a request error containing %q", response.Errors, tt.want)
+			}
+		})
+	}
+}
+
+// introspectionQuery is the query GraphiQL introspects schemas with
+const introspectionQuery = `
+query IntrospectionQuery {
+  __schema {
+    queryType { name }
+    mutationType { name }
+    subscriptionType { name }
+    types { ...FullType }
+    directives { name description locations args { ...InputValue } }
+  }
+}
+fragment FullType on __Type {
+  kind name description
+  fields(includeDeprecated: true) { name description args { ...InputValue } type { ...TypeRef } isDeprecated deprecationReason }
+  inputFields { ...InputValue }
+  interfaces { ...TypeRef }
+  enumValues(includeDeprecated: true) { name description isDeprecated deprecationReason }
+  possibleTypes { ...TypeRef }
+}
+fragment InputValue on __InputValue { name description type { ...TypeRef } defaultValue }
+fragment TypeRef on __Type {
+  kind name
+  ofType { kind name ofType { kind name ofType { kind name ofType { kind name ofType { kind name ofType { kind name ofType { kind name } } } } } } }
+}`
+
+func TestIntrospection(t *testing.T) {
+	response, executed := NewSchema().Execute(context.Background(), Request{Query: introspectionQuery})
+	if !executed || len(response.Errors) > 0 {
+		t.Fatalf("introspection failed: %v", response.Errors)
+	}
+	var result struct {
+		Schema struct {
+			QueryType struct{ Name string } `json:"queryType"`
+			Types     []struct {
+				Name        string
+				Fields      []struct{ Name string }
+				InputFields []struct{ Name string } `json:"inputFields"`
+			}
+		} `json:"__schema"`
+	}
+	if err := json.Unmarshal(response.Data, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Schema.QueryType.Name != "Query" {
+		t.Errorf("queryType = %q", result.Schema.QueryType.Name)
+	}
+
+	fields := map[string][]string{}
+	for _, typ := range result.Schema.Types {
+		for _, f := range typ.Fields {
+			fields[typ.Name] = append(fields[typ.Name], f.Name)
+		}
+		for _, f := range typ.InputFields {
+			fields[typ.Name] = append(fields[typ.Name], f.Name)
+		}
+	}
+	if len(fields["Exec"]) == 0 {
+		t.Fatal("the schema has no Exec type")
+	}
+	// Execs can be given a password when they are added, but no secret of theirs can be read
+	// or patched
+	for typeName, secrets := range map[string][]string{
+		"Exec":       {"password", "password_reset_token", "password_token_expires"},
+		"ExecPatch":  {"password", "password_reset_token", "password_token_expires", "password_changed_at"},
+		"ExecFilter": {"password", "password_reset_token", "password_token_expires"},
+		"ExecInput":  {"password_reset_token", "password_token_expires", "password_changed_at"},
+	} {
+		for _, secret := range secrets {
+			if slices.Contains(fields[typeName], secret) {
+				t.Errorf("%s has the field %s", typeName, secret)
+			}
+		}
+	}
+}
+
+func TestExecSecretsUnreachable(t *testing.T) {
+	for _, query := range []string{
+		`{ execs { password } }`,
+		`{ exec(id: 1) { password_reset_token } }`,
+		`{ exec(id: 1) { password_token_expires } }`,
+	} {
+		response, executed := NewSchema().Execute(context.Background(), Request{Query: query})
+		if executed || len(response.Errors) != 1 || !strings.Contains(response.Errors[0].Message, "cannot query field") {
+			t.Errorf("%s was not refused: %v", query, response.Errors)
+		}
+	}
+	// Arguments are checked against their input type as the field is resolved
+	for _, query := range []string{
+		`{ execs(filter: {password_reset_token: "x"}) { id } }`,
+		`mutation { patchExec(id: 1, input: {password: "x"}) { id } }`,
+		`mutation { patchExec(id: 1, input: {password_changed_at: "2020-01-01T00:00:00Z"}) { id } }`,
+	} {
+		response, _ := NewSchema().Execute(context.Background(), Request{Query: query})
+		if string(response.Data) != "null" || len(response.Errors) != 1 || !strings.Contains(response.Errors[0].Message, "is not a field of") {
+			t.Errorf("%s was not refused: %s %v", query, response.Data, response.Errors)
+		}
+	}
+}
+
+func TestExecuteForbidden(t *testing.T) {
+	// Without a principal, every root field is refused before the database is used
+	response, executed := NewSchema().Execute(context.Background(), Request{Query: `{ students { id } exec(id: 1) { id } }`})
+	if !executed {
+		t.Fatalf("Execute refused the request: %v", response.Errors)
+	}
+	if string(response.Data) != `null` {
+		t.Errorf("data = %s, want null", response.Data)
+	}
+	for _, e := range response.Errors {
+		if e.Extensions["code"] != "FORBIDDEN" {
+			t.Errorf("error %q has code %v, want FORBIDDEN", e.Message, e.Extensions["code"])
+		}
+	}
+	if len(response.Errors) != 2 {
+		t.Errorf("errors = %v, want one per field", response.Errors)
+	}
+}
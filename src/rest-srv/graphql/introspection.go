@@ -0,0 +1,215 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+)
+
+// each builds a resolver that maps every parent of type T on its own
+func each[T any](fn func(parent T, args map[string]any) any) resolver {
+	return func(ctx context.Context, parents []any, args map[string]any) ([]any, error) {
+		values := make([]any, len(parents))
+		for i, parent := range parents {
+			// root fields have no parent, so the assertion may fail for a nil parent
+			typed, _ := parent.(T)
+			values[i] = fn(typed, args)
+		}
+		return values, nil
+	}
+}
+
+// constant builds a resolver that returns value for every parent
+func constant(value any) resolver {
+	return func(ctx context.Context, parents []any, args map[string]any) ([]any, error) {
+		values := make([]any, len(parents))
+		for i := range values {
+			values[i] = value
+		}
+		return values, nil
+	}
+}
+
+type directiveDefinition struct {
+	name        string
+	description string
+	locations   []string
+	args        []*argument
+}
+
+var builtinDirectives = []*directiveDefinition{
+	{
+		name:        "include",
+		description: "Include this field or fragment only when the argument is true",
+		locations:   []string{"FIELD", "FRAGMENT_SPREAD", "INLINE_FRAGMENT"},
+		args:        []*argument{{name: "if", typ: typeOf("Boolean!")}},
+	},
+	{
+		name:        "skip",
+		description: "Skip this field or fragment when the argument is true",
+		locations:   []string{"FIELD", "FRAGMENT_SPREAD", "INLINE_FRAGMENT"},
+		args:        []*argument{{name: "if", typ: typeOf("Boolean!")}},
+	},
+}
+
+// addIntrospection adds the __schema and __type root fields and the types they return
+func (s *Schema) addIntrospection() {
+	s.add(&namedType{kind: kindEnum, name: "__TypeKind", enumValues: []string{"SCALAR", "OBJECT", "INTERFACE", "UNION", "ENUM", "INPUT_OBJECT", "LIST", "NON_NULL"}})
+	s.add(&namedType{kind: kindEnum, name: "__DirectiveLocation", enumValues: []string{"QUERY", "MUTATION", "SUBSCRIPTION", "FIELD", "FRAGMENT_DEFINITION", "FRAGMENT_SPREAD", "INLINE_FRAGMENT", "VARIABLE_DEFINITION"}})
+
+	includeDeprecated := []*argument{{name: "includeDeprecated", typ: typeOf("Boolean"), defaultValue: false}}
+
+	s.add(&namedType{kind: kindObject, name: "__Schema", fields: []*field{
+		{name: "description", typ: typeOf("String"), resolve: constant(nil)},
+		{name: "types", typ: typeOf("[__Type!]!"), resolve: each(func(schema *Schema, _ map[string]any) any {
+			names := make([]string, 0, len(schema.types))
+			for name := range schema.types {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+			types := make([]*typeRef, len(names))
+			for i, name := range names {
+				types[i] = &typeRef{name: name}
+			}
+			return types
+		})},
+		{name: "queryType", typ: typeOf("__Type!"), resolve: each(func(schema *Schema, _ map[string]any) any {
+			return &typeRef{name: schema.query.name}
+		})},
+		{name: "mutationType", typ: typeOf("__Type"), resolve: each(func(schema *Schema, _ map[string]any) any {
+			if schema.mutation == nil {
+				return nil
+			}
+			return &typeRef{name: schema.mutation.name}
+		})},
+		{name: "subscriptionType", typ: typeOf("__Type"), resolve: constant(nil)},
+		{name: "directives", typ: typeOf("[__Directive!]!"), resolve: constant(builtinDirectives)},
+	}})
+
+	s.add(&namedType{kind: kindObject, name: "__Type", fields: []*field{
+		{name: "kind", typ: typeOf("__TypeKind!"), resolve: each(func(t *typeRef, _ map[string]any) any {
+			switch {
+			case t.nonNull:
+				return "NON_NULL"
+			case t.isList():
+				return "LIST"
+			}
+			return string(s.types[t.name].kind)
+		})},
+		{name: "name", typ: typeOf("String"), resolve: each(func(t *typeRef, _ map[string]any) any {
+			if t.name == "" {
+				return nil
+			}
+			return t.name
+		})},
+		{name: "description", typ: typeOf("String"), resolve: each(func(t *typeRef, _ map[string]any) any {
+			if t.name == "" || s.types[t.name].description == "" {
+				return nil
+			}
+			return s.types[t.name].description
+		})},
+		{name: "specifiedByURL", typ: typeOf("String"), resolve: constant(nil)},
+		{name: "fields", typ: typeOf("[__Field!]"), args: includeDeprecated, resolve: each(func(t *typeRef, _ map[string]any) any {
+			if t.name == "" || s.types[t.name].kind != kindObject {
+				return nil
+			}
+			return slices.DeleteFunc(slices.Clone(s.types[t.name].fields), func(f *field) bool {
+				return strings.HasPrefix(f.name, "__")
+			})
+		})},
+		{name: "interfaces", typ: typeOf("[__Type!]"), resolve: each(func(t *typeRef, _ map[string]any) any {
+			if t.name == "" || s.types[t.name].kind != kindObject {
+				return nil
+			}
+			return []*typeRef{}
+		})},
+		{name: "possibleTypes", typ: typeOf("[__Type!]"), resolve: constant(nil)},
+		{name: "enumValues", typ: typeOf("[__EnumValue!]"), args: includeDeprecated, resolve: each(func(t *typeRef, _ map[string]any) any {
+			if t.name == "" || s.types[t.name].kind != kindEnum {
+				return nil
+			}
+			return s.types[t.name].enumValues
+		})},
+		{name: "inputFields", typ: typeOf("[__InputValue!]"), args: includeDeprecated, resolve: each(func(t *typeRef, _ map[string]any) any {
+			if t.name == "" || s.types[t.name].kind != kindInputObject {
+				return nil
+			}
+			return s.types[t.name].inputFields
+		})},
+		{name: "ofType", typ: typeOf("__Type"), resolve: each(func(t *typeRef, _ map[string]any) any {
+			if t.ofType == nil {
+				return nil
+			}
+			return t.ofType
+		})},
+		{name: "isOneOf", typ: typeOf("Boolean"), resolve: each(func(t *typeRef, _ map[string]any) any {
+			if t.name == "" || s.types[t.name].kind != kindInputObject {
+				return nil
+			}
+			return false
+		})},
+	}})
+
+	s.add(&namedType{kind: kindObject, name: "__Field", fields: []*field{
+		{name: "name", typ: typeOf("String!"), resolve: each(func(f *field, _ map[string]any) any { return f.name })},
+		{name: "description", typ: typeOf("String"), resolve: each(func(f *field, _ map[string]any) any { return optional(f.description) })},
+		{name: "args", typ: typeOf("[__InputValue!]!"), args: includeDeprecated, resolve: each(func(f *field, _ map[string]any) any {
+			if f.args == nil {
+				return []*argument{}
+			}
+			return f.args
+		})},
+		{name: "type", typ: typeOf("__Type!"), resolve: each(func(f *field, _ map[string]any) any { return f.typ })},
+		{name: "isDeprecated", typ: typeOf("Boolean!"), resolve: constant(false)},
+		{name: "deprecationReason", typ: typeOf("String"), resolve: constant(nil)},
+	}})
+
+	s.add(&namedType{kind: kindObject, name: "__InputValue", fields: []*field{
+		{name: "name", typ: typeOf("String!"), resolve: each(func(a *argument, _ map[string]any) any { return a.name })},
+		{name: "description", typ: typeOf("String"), resolve: each(func(a *argument, _ map[string]any) any { return optional(a.description) })},
+		{name: "type", typ: typeOf("__Type!"), resolve: each(func(a *argument, _ map[string]any) any { return a.typ })},
+		{name: "defaultValue", typ: typeOf("String"), resolve: each(func(a *argument, _ map[string]any) any {
+			if a.defaultValue == nil {
+				return nil
+			}
+			// Scalar defaults print the same in JSON and GraphQL
+			value, _ := json.Marshal(a.defaultValue)
+			return string(value)
+		})},
+		{name: "isDeprecated", typ: typeOf("Boolean!"), resolve: constant(false)},
+		{name: "deprecationReason", typ: typeOf("String"), resolve: constant(nil)},
+	}})
+
+	s.add(&namedType{kind: kindObject, name: "__EnumValue", fields: []*field{
+		{name: "name", typ: typeOf("String!"), resolve: each(func(value string, _ map[string]any) any { return value })},
+		{name: "description", typ: typeOf("String"), resolve: constant(nil)},
+		{name: "isDeprecated", typ: typeOf("Boolean!"), resolve: constant(false)},
+		{name: "deprecationReason", typ: typeOf("String"), resolve: constant(nil)},
+	}})
+
+	s.add(&namedType{kind: kindObject, name: "__Directive", fields: []*field{
+		{name: "name", typ: typeOf("String!"), resolve: each(func(d *directiveDefinition, _ map[string]any) any { return d.name })},
+		{name: "description", typ: typeOf("String"), resolve: each(func(d *directiveDefinition, _ map[string]any) any { return optional(d.description) })},
+		{name: "locations", typ: typeOf("[__DirectiveLocation!]!"), resolve: each(func(d *directiveDefinition, _ map[string]any) any { return d.locations })},
+		{name: "args", typ: typeOf("[__InputValue!]!"), args: includeDeprecated, resolve: each(func(d *directiveDefinition, _ map[string]any) any { return d.args })},
+		{name: "isRepeatable", typ: typeOf("Boolean!"), resolve: constant(false)},
+	}})
+
+	s.query.fields = append(s.query.fields,
+		&field{name: "__schema", typ: typeOf("__Schema!"), resolve: each(func(any, map[string]any) any { return s })},
+		&field{name: "__type", typ: typeOf("__Type"), args: []*argument{{name: "name", typ: typeOf("String!")}}, resolve: each(func(_ any, args map[string]any) any {
+			if _, ok := s.types[args["name"].(string)]; !ok {
+				return nil
+			}
+			return &typeRef{name: args["name"].(string)}
+		})},
+	)
+}
+
+func optional(description string) any {
+	if description == "" {
+		return nil
+	}
+	return description
+}
@@ -0,0 +1,518 @@
+package graphql
+
+import (
+	"fmt"
+)
+
+type document struct {
+	operations []*operation
+	fragments  map[string]*fragment
+}
+
+type operation struct {
+	kind       string // query or mutation
+	name       string
+	variables  []variableDefinition
+	selections []*selection
+}
+
+type variableDefinition struct {
+	name         string
+	typ          *typeRef
+	defaultValue *valueNode
+}
+
+type fragment struct {
+	name          string
+	typeCondition string
+	selections    []*selection
+}
+
+// selection is a field, a fragment spread (fragmentName set) or an inline fragment (inline set)
+type selection struct {
+	alias        string
+	name         string
+	arguments    map[string]*valueNode
+	directives   []directive
+	selections   []*selection
+	fragmentName string
+	inline       bool
+	// typeCondition of an inline fragment, empty when it has none
+	typeCondition string
+}
+
+// responseKey is the name a field is returned under
+func (s *selection) responseKey() string {
+	if s.alias != "" {
+		return s.alias
+	}
+	return s.name
+}
+
+type directive struct {
+	name      string
+	arguments map[string]*valueNode
+}
+
+type valueKind int
+
+const (
+	valueVariable valueKind = iota
+	valueInt
+	valueFloat
+	valueString
+	valueBoolean
+	valueNull
+	valueEnum
+	valueList
+	valueObject
+)
+
+type valueNode struct {
+	kind   valueKind
+	raw    string
+	list   []*valueNode
+	fields map[string]*valueNode
+}
+
+// maxNesting bounds how deeply selection sets, list values, object values and list types
+// nest in a document, so a hostile document cannot make the parser recurse without end
+const maxNesting = 64
+
+// parser is a recursive descent parser for executable GraphQL documents
+type parser struct {
+	lexer lexer
+	token token
+	// nesting is how many selection sets, lists and objects enclose the current token
+	nesting int
+}
+
+func parse(src string) (*document, error) {
+	p := &parser{lexer: lexer{src: src}}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	doc := &document{fragments: make(map[string]*fragment)}
+	for p.token.kind != tokenEOF {
+		switch {
+		case p.peek(tokenPunctuator, "{"):
+			selections, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, &operation{kind: "query", selections: selections})
+		case p.peek(tokenName, "query"), p.peek(tokenName, "mutation"):
+			op, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, op)
+		case p.peek(tokenName, "fragment"):
+			frag, err := p.fragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, exists := doc.fragments[frag.name]; exists {
+				return nil, fmt.Errorf("fragment %s is defined more than once", frag.name)
+			}
+			doc.fragments[frag.name] = frag
+		default:
+			return nil, p.unexpected()
+		}
+	}
+	if len(doc.operations) == 0 {
+		return nil, fmt.Errorf("document has no operation")
+	}
+	return doc, nil
+}
+
+func (p *parser) advance() error {
+	token, err := p.lexer.next()
+	if err != nil {
+		return err
+	}
+	p.token = token
+	return nil
+}
+
+func (p *parser) peek(kind tokenKind, value string) bool {
+	return p.token.kind == kind && p.token.value == value
+}
+
+func (p *parser) unexpected() error {
+	if p.token.kind == tokenEOF {
+		return fmt.Errorf("unexpected end of document")
+	}
+	return fmt.Errorf("unexpected %q at position %d", p.token.value, p.token.pos)
+}
+
+// enter counts a level of nesting, failing beyond maxNesting; leave undoes it
+func (p *parser) enter() error {
+	p.nesting++
+	if p.nesting > maxNesting {
+		return fmt.Errorf("document is nested deeper than %d levels at position %d", maxNesting, p.token.pos)
+	}
+	return nil
+}
+
+func (p *parser) leave() {
+	p.nesting--
+}
+
+// skip consumes the punctuator value if it is next and reports whether it did
+func (p *parser) skip(value string) (bool, error) {
+	if !p.peek(tokenPunctuator, value) {
+		return false, nil
+	}
+	return true, p.advance()
+}
+
+func (p *parser) expect(value string) error {
+	if !p.peek(tokenPunctuator, value) {
+		return p.unexpected()
+	}
+	return p.advance()
+}
+
+func (p *parser) expectKeyword(value string) error {
+	if !p.peek(tokenName, value) {
+		return p.unexpected()
+	}
+	return p.advance()
+}
+
+func (p *parser) name() (string, error) {
+	if p.token.kind != tokenName {
+		return "", p.unexpected()
+	}
+	name := p.token.value
+	return name, p.advance()
+}
+
+func (p *parser) operation() (*operation, error) {
+	op := &operation{kind: p.token.value}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if p.token.kind == tokenName {
+		op.name = p.token.value
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	if ok, err := p.skip("("); err != nil {
+		return nil, err
+	} else if ok {
+		for !p.peek(tokenPunctuator, ")") {
+			definition, err := p.variableDefinition()
+			if err != nil {
+				return nil, err
+			}
+			op.variables = append(op.variables, definition)
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := p.directives(); err != nil {
+		return nil, err
+	}
+	selections, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	op.selections = selections
+	return op, nil
+}
+
+func (p *parser) variableDefinition() (variableDefinition, error) {
+	var definition variableDefinition
+	if err := p.expect("$"); err != nil {
+		return definition, err
+	}
+	name, err := p.name()
+	if err != nil {
+		return definition, err
+	}
+	definition.name = name
+	if err := p.expect(":"); err != nil {
+		return definition, err
+	}
+	if definition.typ, err = p.typeRef(); err != nil {
+		return definition, err
+	}
+	if ok, err := p.skip("="); err != nil {
+		return definition, err
+	} else if ok {
+		if definition.defaultValue, err = p.value(true); err != nil {
+			return definition, err
+		}
+	}
+	_, err = p.directives()
+	return definition, err
+}
+
+func (p *parser) typeRef() (*typeRef, error) {
+	var t *typeRef
+	if ok, err := p.skip("["); err != nil {
+		return nil, err
+	} else if ok {
+		if err := p.enter(); err != nil {
+			return nil, err
+		}
+		defer p.leave()
+		ofType, err := p.typeRef()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		t = &typeRef{ofType: ofType}
+	} else {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		t = &typeRef{name: name}
+	}
+	if ok, err := p.skip("!"); err != nil {
+		return nil, err
+	} else if ok {
+		t = &typeRef{ofType: t, nonNull: true}
+	}
+	return t, nil
+}
+
+func (p *parser) fragment() (*fragment, error) {
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if name == "on" {
+		return nil, fmt.Errorf("fragment can't be named on")
+	}
+	if err := p.expectKeyword("on"); err != nil {
+		return nil, err
+	}
+	typeCondition, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.directives(); err != nil {
+		return nil, err
+	}
+	selections, err := p.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	return &fragment{name: name, typeCondition: typeCondition, selections: selections}, nil
+}
+
+func (p *parser) selectionSet() ([]*selection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+	var selections []*selection
+	for !p.peek(tokenPunctuator, "}") {
+		s, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, s)
+	}
+	if len(selections) == 0 {
+		return nil, fmt.Errorf("empty selection set at position %d", p.token.pos)
+	}
+	return selections, p.advance()
+}
+
+func (p *parser) selection() (*selection, error) {
+	if ok, err := p.skip("..."); err != nil {
+		return nil, err
+	} else if ok {
+		return p.fragmentSelection()
+	}
+
+	s := &selection{}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if ok, err := p.skip(":"); err != nil {
+		return nil, err
+	} else if ok {
+		s.alias = name
+		if name, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	s.name = name
+	if s.arguments, err = p.arguments(); err != nil {
+		return nil, err
+	}
+	if s.directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if p.peek(tokenPunctuator, "{") {
+		if s.selections, err = p.selectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// fragmentSelection parses what follows "...": a fragment spread or an inline fragment
+func (p *parser) fragmentSelection() (*selection, error) {
+	s := &selection{}
+	var err error
+	if p.token.kind == tokenName && p.token.value != "on" {
+		s.fragmentName = p.token.value
+		if err = p.advance(); err != nil {
+			return nil, err
+		}
+		s.directives, err = p.directives()
+		return s, err
+	}
+
+	s.inline = true
+	if p.peek(tokenName, "on") {
+		if err = p.advance(); err != nil {
+			return nil, err
+		}
+		if s.typeCondition, err = p.name(); err != nil {
+			return nil, err
+		}
+	}
+	if s.directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	s.selections, err = p.selectionSet()
+	return s, err
+}
+
+func (p *parser) arguments() (map[string]*valueNode, error) {
+	ok, err := p.skip("(")
+	if err != nil || !ok {
+		return nil, err
+	}
+	arguments := make(map[string]*valueNode)
+	for !p.peek(tokenPunctuator, ")") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := arguments[name]; exists {
+			return nil, fmt.Errorf("argument %s is given more than once", name)
+		}
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		if arguments[name], err = p.value(false); err != nil {
+			return nil, err
+		}
+	}
+	return arguments, p.advance()
+}
+
+func (p *parser) directives() ([]directive, error) {
+	var directives []directive
+	for p.peek(tokenPunctuator, "@") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		arguments, err := p.arguments()
+		if err != nil {
+			return nil, err
+		}
+		directives = append(directives, directive{name: name, arguments: arguments})
+	}
+	return directives, nil
+}
+
+// value parses an input value; variables are not allowed in constant contexts such as defaults
+func (p *parser) value(constant bool) (*valueNode, error) {
+	t := p.token
+	switch t.kind {
+	case tokenInt:
+		return &valueNode{kind: valueInt, raw: t.value}, p.advance()
+	case tokenFloat:
+		return &valueNode{kind: valueFloat, raw: t.value}, p.advance()
+	case tokenString:
+		return &valueNode{kind: valueString, raw: t.value}, p.advance()
+	case tokenName:
+		switch t.value {
+		case "true", "false":
+			return &valueNode{kind: valueBoolean, raw: t.value}, p.advance()
+		case "null":
+			return &valueNode{kind: valueNull}, p.advance()
+		}
+		return &valueNode{kind: valueEnum, raw: t.value}, p.advance()
+	case tokenPunctuator:
+		switch t.value {
+		case "$":
+			if constant {
+				return nil, p.unexpected()
+			}
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			return &valueNode{kind: valueVariable, raw: name}, nil
+		case "[":
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if err := p.enter(); err != nil {
+				return nil, err
+			}
+			defer p.leave()
+			list := &valueNode{kind: valueList}
+			for !p.peek(tokenPunctuator, "]") {
+				item, err := p.value(constant)
+				if err != nil {
+					return nil, err
+				}
+				list.list = append(list.list, item)
+			}
+			return list, p.advance()
+		case "{":
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if err := p.enter(); err != nil {
+				return nil, err
+			}
+			defer p.leave()
+			object := &valueNode{kind: valueObject, fields: make(map[string]*valueNode)}
+			for !p.peek(tokenPunctuator, "}") {
+				name, err := p.name()
+				if err != nil {
+					return nil, err
+				}
+				if err := p.expect(":"); err != nil {
+					return nil, err
+				}
+				if object.fields[name], err = p.value(constant); err != nil {
+					return nil, err
+				}
+			}
+			return object, p.advance()
+		}
+	}
+	return nil, p.unexpected()
+}
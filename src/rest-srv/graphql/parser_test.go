@@ -0,0 +1,138 @@
+package graphql
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	doc, err := parse(`
+		# the first operation
+		query Students($class: String = "9A", $limit: Int!) @cached {
+			list: students(filter: {class: $class}, limit: $limit, sortBy: ["last_name:asc"]) {
+				...names
+				... on Student @include(if: true) { email }
+			}
+		}
+		mutation { deleteStudent(id: 7) { id } }
+		fragment names on Student { first_name, last_name }
+	`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(doc.operations) != 2 || len(doc.fragments) != 1 {
+		t.Fatalf("parsed %d operations and %d fragments, want 2 and 1", len(doc.operations), len(doc.fragments))
+	}
+
+	query := doc.operations[0]
+	if query.kind != "query" || query.name != "Students" || len(query.variables) != 2 {
+		t.Errorf("query = %s %s with %d variables", query.kind, query.name, len(query.variables))
+	}
+	if class := query.variables[0]; class.typ.String() != "String" || class.defaultValue.raw != "9A" {
+		t.Errorf("$class = %s = %q", class.typ, class.defaultValue.raw)
+	}
+	if limit := query.variables[1]; limit.typ.String() != "Int!" || limit.defaultValue != nil {
+		t.Errorf("$limit = %s", limit.typ)
+	}
+
+	list := query.selections[0]
+	if list.alias != "list" || list.name != "students" || list.responseKey() != "list" {
+		t.Errorf("field = %s: %s", list.alias, list.name)
+	}
+	if filter := list.arguments["filter"]; filter.kind != valueObject || filter.fields["class"].kind != valueVariable {
+		t.Errorf("filter argument = %+v", filter)
+	}
+	if sortBy := list.arguments["sortBy"]; sortBy.kind != valueList || sortBy.list[0].raw != "last_name:asc" {
+		t.Errorf("sortBy argument = %+v", sortBy)
+	}
+	if spread := list.selections[0]; spread.fragmentName != "names" {
+		t.Errorf("first selection = %+v, want the spread of names", spread)
+	}
+	inline := list.selections[1]
+	if !inline.inline || inline.typeCondition != "Student" || inline.directives[0].name != "include" || inline.selections[0].name != "email" {
+		t.Errorf("second selection = %+v, want an inline fragment", inline)
+	}
+
+	mutation := doc.operations[1]
+	if mutation.kind != "mutation" || mutation.name != "" || mutation.selections[0].arguments["id"].kind != valueInt {
+		t.Errorf("mutation = %+v", mutation)
+	}
+	if names := doc.fragments["names"]; names.typeCondition != "Student" || len(names.selections) != 2 {
+		t.Errorf("fragment = %+v", names)
+	}
+}
+
+func TestParseValues(t *testing.T) {
+	tests := []struct {
+		value string
+		kind  valueKind
+		raw   string
+	}{
+		{`42`, valueInt, "42"},
+		{`-7`, valueInt, "-7"},
+		{`1.5e3`, valueFloat, "1.5e3"},
+		{`"a\"bé"`, valueString, `a"bé`},
+		{"\"\"\"\n    block\n      indented\n    \"\"\"", valueString, "block\n  indented"},
+		{`"""a \""" b"""`, valueString, `a """ b`},
+		{`true`, valueBoolean, "true"},
+		{`null`, valueNull, ""},
+		{`ADMIN`, valueEnum, "ADMIN"},
+		{`$id`, valueVariable, "id"},
+	}
+	for _, tt := range tests {
+		doc, err := parse(`{ f(a: ` + tt.value + `) }`)
+		if err != nil {
+			t.Errorf("parse %s: %v", tt.value, err)
+			continue
+		}
+		got := doc.operations[0].selections[0].arguments["a"]
+		if got.kind != tt.kind || got.raw != tt.raw {
+			t.Errorf("value %s = %d %q, want %d %q", tt.value, got.kind, got.raw, tt.kind, tt.raw)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"empty document", ``, "document has no operation"},
+		{"only a fragment", `fragment f on Student { id }`, "document has no operation"},
+		{"empty selection set", `{ }`, "empty selection set"},
+		{"unclosed selection set", `{ students { id }`, "unexpected end of document"},
+		{"unterminated string", `{ f(a: "abc) }`, "unterminated string"},
+		{"string over lines", "{ f(a: \"a\nb\") }", "unterminated string"},
+		{"invalid escape", `{ f(a: "\x") }`, "invalid string"},
+		{"invalid number", `{ f(a: 1.) }`, "invalid number"},
+		{"unexpected character", `{ f(a: %) }`, "unexpected character"},
+		{"repeated argument", `{ f(a: 1, a: 2) }`, "argument a is given more than once"},
+		{"repeated fragment", `{ id } fragment f on T { id } fragment f on T { id }`, "fragment f is defined more than once"},
+		{"fragment named on", `{ id } fragment on on T { id }`, "fragment can't be named on"},
+		{"variable in a default", `query ($a: Int = $b) { id }`, `unexpected "$"`},
+		{"subscription", `subscription { id }`, `unexpected "subscription"`},
+		{"selection sets nested too deeply", strings.Repeat("{ a ", maxNesting+1) + strings.Repeat("}", maxNesting+1), "nested deeper than"},
+		{"lists nested too deeply", `{ f(a: ` + strings.Repeat("[", maxNesting+1) + strings.Repeat("]", maxNesting+1) + `) }`, "nested deeper than"},
+		{"list types nested too deeply", `query ($a: ` + strings.Repeat("[", maxNesting+1) + "Int" + strings.Repeat("]", maxNesting+1) + `) { id }`, "nested deeper than"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parse(tt.query)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("parse(%q) = %v, want an error containing %q", tt.query, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTypeOf(t *testing.T) {
+	for _, s := range []string{"Int", "Int!", "[Student!]!", "[[ID]]"} {
+		if got := typeOf(s).String(); got != s {
+			t.Errorf("typeOf(%q) = %s", s, got)
+		}
+	}
+	if got := typeOf("[Student!]!").namedType(); got != "Student" {
+		t.Errorf("namedType = %s, want Student", got)
+	}
+}
@@ -0,0 +1,358 @@
+package graphql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"rest-srv/authz"
+	"rest-srv/db"
+	"rest-srv/models"
+	"rest-srv/utility"
+)
+
+// NewSchema builds the schema over students, teachers and execs. Object fields use the json
+// names of the models. The password and reset token of execs are never part of it, but for
+// the password given to addExecs.
+func NewSchema() *Schema {
+	s := &Schema{types: make(map[string]*namedType)}
+	for _, scalar := range builtinScalars {
+		s.add(scalar)
+	}
+
+	s.add(&namedType{kind: kindObject, name: "Student", fields: []*field{
+		{name: "id", typ: typeOf("ID!")},
+		{name: "first_name", typ: typeOf("String!")},
+		{name: "last_name", typ: typeOf("String!")},
+		{name: "email", typ: typeOf("String!")},
+		{name: "class", typ: typeOf("String!")},
+		{name: "teacher", description: "The teacher of the student's class", typ: typeOf("Teacher"), resolve: studentTeacher},
+	}})
+	s.add(&namedType{kind: kindObject, name: "Teacher", fields: []*field{
+		{name: "id", typ: typeOf("ID!")},
+		{name: "first_name", typ: typeOf("String!")},
+		{name: "last_name", typ: typeOf("String!")},
+		{name: "email", typ: typeOf("String!")},
+		{name: "class", typ: typeOf("String!")},
+		{name: "subject", typ: typeOf("String!")},
+		{name: "students", description: "The students of the teacher's class", typ: typeOf("[Student!]!"), resolve: teacherStudents},
+		{name: "student_count", description: "The number of students in the teacher's class", typ: typeOf("Int"), resolve: teacherStudentCount},
+	}})
+	s.add(&namedType{kind: kindObject, name: "Exec", fields: []*field{
+		{name: "id", typ: typeOf("ID!")},
+		{name: "first_name", typ: typeOf("String!")},
+		{name: "last_name", typ: typeOf("String!")},
+		{name: "email", typ: typeOf("String!")},
+		{name: "username", typ: typeOf("String!")},
+		{name: "user_created_at", typ: typeOf("String")},
+		{name: "password_changed_at", typ: typeOf("String")},
+		{name: "inactive_status", typ: typeOf("Boolean!")},
+		{name: "role", typ: typeOf("String!")},
+	}})
+
+	s.add(inputType("StudentFilter", "ID", "id", "first_name", "last_name", "email", "class"))
+	s.add(inputType("TeacherFilter", "ID", "id", "first_name", "last_name", "email", "class", "subject"))
+	s.add(inputType("ExecFilter", "ID", "id", "first_name", "last_name", "email", "username", "role"))
+	s.add(inputType("StudentInput", "String!", "first_name", "last_name", "email", "class"))
+	s.add(inputType("TeacherInput", "String!", "first_name", "last_name", "email", "class", "subject"))
+	s.add(inputType("ExecInput", "String!", "first_name", "last_name", "email", "username", "password", "role"))
+	s.add(inputType("StudentPatch", "String", "first_name", "last_name", "email", "class"))
+	s.add(inputType("TeacherPatch", "String", "first_name", "last_name", "email", "class", "subject"))
+	execPatch := inputType("ExecPatch", "String", "first_name", "last_name", "email", "username", "role")
+	execPatch.inputFields = append(execPatch.inputFields, &argument{name: "inactive_status", typ: typeOf("Boolean")})
+	s.add(execPatch)
+
+	sortBy := &argument{name: "sortBy", description: `Sort order as "field:asc" or "field:desc"`, typ: typeOf("[String!]")}
+	id := []*argument{{name: "id", typ: typeOf("ID!")}}
+	s.query = &namedType{kind: kindObject, name: "Query", fields: []*field{
+		{name: "student", typ: typeOf("Student"), args: id, resolve: root(allowed("students", authz.Read, func(ctx context.Context, args map[string]any) (any, error) {
+			return nullIfNotFound(getById(ctx, args, db.GetStudentById))
+		}))},
+		{name: "students", typ: typeOf("[Student!]!"), args: []*argument{
+			{name: "filter", typ: typeOf("StudentFilter")},
+			sortBy,
+			{name: "limit", typ: typeOf("Int")},
+			{name: "page", typ: typeOf("Int")},
+		}, resolve: root(allowed("students", authz.Read, func(ctx context.Context, args map[string]any) (any, error) {
+			limit, _ := args["limit"].(int)
+			page, _ := args["page"].(int)
+			students, _, err := db.GetStudents(ctx, filters(args), sortParams(args), limit, page, nil)
+			return students, err
+		}))},
+		{name: "teacher", typ: typeOf("Teacher"), args: id, resolve: root(allowed("teachers", authz.Read, func(ctx context.Context, args map[string]any) (any, error) {
+			return nullIfNotFound(getById(ctx, args, db.GetTeacherById))
+		}))},
+		{name: "teachers", typ: typeOf("[Teacher!]!"), args: []*argument{{name: "filter", typ: typeOf("TeacherFilter")}, sortBy}, resolve: root(allowed("teachers", authz.Read, func(ctx context.Context, args map[string]any) (any, error) {
+			return db.GetTeachers(ctx, filters(args), sortParams(args), nil)
+		}))},
+		{name: "exec", typ: typeOf("Exec"), args: id, resolve: root(allowed("execs", authz.Read, func(ctx context.Context, args map[string]any) (any, error) {
+			return nullIfNotFound(getById(ctx, args, db.GetExecById))
+		}))},
+		{name: "execs", typ: typeOf("[Exec!]!"), args: []*argument{{name: "filter", typ: typeOf("ExecFilter")}, sortBy}, resolve: root(allowed("execs", authz.Read, func(ctx context.Context, args map[string]any) (any, error) {
+			return db.GetExecs(ctx, filters(args), sortParams(args), nil)
+		}))},
+	}}
+	s.add(s.query)
+
+	s.mutation = &namedType{kind: kindObject, name: "Mutation", fields: []*field{
+		{name: "addStudents", typ: typeOf("[Student!]!"), args: []*argument{{name: "input", typ: typeOf("[StudentInput!]!")}}, resolve: root(allowed("students", authz.Create, func(ctx context.Context, args map[string]any) (any, error) {
+			students, err := decodeInputs[models.Student](args["input"], func(student *models.Student) error { return student.Validate() })
+			if err != nil {
+				return nil, err
+			}
+			return db.AddStudents(ctx, students)
+		}))},
+		{name: "patchStudent", typ: typeOf("Student!"), args: patchArgs("StudentPatch!"), resolve: root(allowed("students", authz.Update, func(ctx context.Context, args map[string]any) (any, error) {
+			return patchById(ctx, args, models.Student{}, db.PatchStudent)
+		}))},
+		{name: "deleteStudent", typ: typeOf("Student!"), args: id, resolve: root(allowed("students", authz.Delete, func(ctx context.Context, args map[string]any) (any, error) {
+			return errIfNotFound(getById(ctx, args, db.DeleteStudent))
+		}))},
+		{name: "addTeachers", typ: typeOf("[Teacher!]!"), args: []*argument{{name: "input", typ: typeOf("[TeacherInput!]!")}}, resolve: root(allowed("teachers", authz.Create, func(ctx context.Context, args map[string]any) (any, error) {
+			teachers, err := decodeInputs[models.Teacher](args["input"], func(teacher *models.Teacher) error { return teacher.Validate() })
+			if err != nil {
+				return nil, err
+			}
+			return db.AddTeachers(ctx, teachers)
+		}))},
+		{name: "patchTeacher", typ: typeOf("Teacher!"), args: patchArgs("TeacherPatch!"), resolve: root(allowed("teachers", authz.Update, func(ctx context.Context, args map[string]any) (any, error) {
+			return patchById(ctx, args, models.Teacher{}, db.PatchTeacher)
+		}))},
+		{name: "deleteTeacher", typ: typeOf("Teacher!"), args: id, resolve: root(allowed("teachers", authz.Delete, func(ctx context.Context, args map[string]any) (any, error) {
+			return errIfNotFound(getById(ctx, args, db.DeleteTeacher))
+		}))},
+		{name: "addExecs", typ: typeOf("[Exec!]!"), args: []*argument{{name: "input", typ: typeOf("[ExecInput!]!")}}, resolve: root(allowed("execs", authz.Create, addExecs))},
+		{name: "patchExec", typ: typeOf("Exec!"), args: patchArgs("ExecPatch!"), resolve: root(allowed("execs", authz.Update, func(ctx context.Context, args map[string]any) (any, error) {
+			return patchById(ctx, args, models.Exec{}, db.PatchExec)
+		}))},
+		{name: "deleteExec", typ: typeOf("Exec!"), args: id, resolve: root(allowed("execs", authz.Delete, func(ctx context.Context, args map[string]any) (any, error) {
+			return errIfNotFound(getById(ctx, args, db.DeleteExec))
+		}))},
+	}}
+	s.add(s.mutation)
+
+	s.addIntrospection()
+	return s
+}
+
+func (s *Schema) add(t *namedType) {
+	s.types[t.name] = t
+}
+
+// inputType builds an input object whose fields all have the same type
+func inputType(name string, fieldType string, fields ...string) *namedType {
+	t := &namedType{kind: kindInputObject, name: name}
+	for _, f := range fields {
+		t.inputFields = append(t.inputFields, &argument{name: f, typ: typeOf(fieldType)})
+	}
+	return t
+}
+
+func patchArgs(patchType string) []*argument {
+	return []*argument{{name: "id", typ: typeOf("ID!")}, {name: "input", typ: typeOf(patchType)}}
+}
+
+// root adapts a resolver of a Query or Mutation field, which has a single nil parent
+func root(fn func(ctx context.Context, args map[string]any) (any, error)) resolver {
+	return func(ctx context.Context, parents []any, args map[string]any) ([]any, error) {
+		value, err := fn(ctx, args)
+		if err != nil {
+			return nil, err
+		}
+		return []any{value}, nil
+	}
+}
+
+func idArgument(args map[string]any) (int, error) {
+	id, err := strconv.Atoi(args["id"].(string))
+	if err != nil || id <= 0 {
+		return 0, newUserError("BAD_USER_INPUT", "invalid id")
+	}
+	return id, nil
+}
+
+func getById[T any](ctx context.Context, args map[string]any, get func(context.Context, int) (T, error)) (any, error) {
+	id, err := idArgument(args)
+	if err != nil {
+		return nil, err
+	}
+	return get(ctx, id)
+}
+
+// nullIfNotFound turns the db layer's "... not found" errors into a null result
+func nullIfNotFound(value any, err error) (any, error) {
+	if err != nil && strings.HasSuffix(err.Error(), "not found") {
+		return nil, nil
+	}
+	return value, err
+}
+
+// errIfNotFound reports the db layer's "... not found" errors with the NOT_FOUND code
+func errIfNotFound(value any, err error) (any, error) {
+	if err != nil && strings.HasSuffix(err.Error(), "not found") {
+		return nil, newUserError("NOT_FOUND", "%s", err.Error())
+	}
+	return value, err
+}
+
+func patchById[T utility.Patchable](ctx context.Context, args map[string]any, model T, patch func(context.Context, int, map[string]any) (T, error)) (any, error) {
+	id, err := idArgument(args)
+	if err != nil {
+		return nil, err
+	}
+	fields := args["input"].(map[string]any)
+	err = utility.ValidatePartial(model, fields)
+	if err != nil {
+		return nil, err
+	}
+	return errIfNotFound(patch(ctx, id, fields))
+}
+
+// decodeInputs converts a list of input objects to models and validates every one of them
+func decodeInputs[T any](input any, validate func(*T) error) ([]T, error) {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+	var items []T
+	err = json.Unmarshal(data, &items)
+	if err != nil {
+		return nil, newUserError("BAD_USER_INPUT", "invalid input")
+	}
+	var violations utility.ValidationErrors
+	for i := range items {
+		err = validate(&items[i])
+		if validationErrors, ok := err.(utility.ValidationErrors); ok {
+			violations = append(violations, validationErrors.AtIndex(i)...)
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if len(violations) > 0 {
+		return nil, violations
+	}
+	return items, nil
+}
+
+func addExecs(ctx context.Context, args map[string]any) (any, error) {
+	execs, err := decodeInputs[models.Exec](args["input"], func(exec *models.Exec) error { return exec.Validate() })
+	if err != nil {
+		return nil, err
+	}
+	currentTime := time.Now().Format("2006-01-02 15:04:05")
+	for i := range execs {
+		execs[i].UserCreatedAt = utility.NullString{NullString: sql.NullString{String: currentTime, Valid: true}}
+		execs[i].Password, err = utility.HashPassword(execs[i].Password)
+		if err != nil {
+			return nil, utility.ErrorHandlerContext(ctx, err, "error adding exec")
+		}
+	}
+	return db.AddExecs(ctx, execs)
+}
+
+func filters(args map[string]any) map[string]string {
+	result := make(map[string]string)
+	filter, _ := args["filter"].(map[string]any)
+	for key, value := range filter {
+		if value != nil {
+			result[key] = value.(string)
+		}
+	}
+	return result
+}
+
+func sortParams(args map[string]any) []string {
+	list, _ := args["sortBy"].([]any)
+	params := make([]string, len(list))
+	for i, item := range list {
+		params[i] = item.(string)
+	}
+	return params
+}
+
+// classesOf returns the distinct classes of a batch of students or teachers
+func classesOf(parents []any, class func(any) string) []string {
+	var classes []string
+	for _, parent := range parents {
+		if c := class(parent); !slices.Contains(classes, c) {
+			classes = append(classes, c)
+		}
+	}
+	return classes
+}
+
+func studentTeacher(ctx context.Context, parents []any, args map[string]any) ([]any, error) {
+	if err := authorize(ctx, "teachers", authz.Read); err != nil {
+		return nil, err
+	}
+	teachers, err := db.GetTeachersByClasses(ctx, classesOf(parents, func(p any) string { return p.(models.Student).Class }))
+	if err != nil {
+		return nil, err
+	}
+	values := make([]any, len(parents))
+	for i, parent := range parents {
+		if teacher, ok := teachers[parent.(models.Student).Class]; ok {
+			values[i] = teacher
+		}
+	}
+	return values, nil
+}
+
+func teacherStudents(ctx context.Context, parents []any, args map[string]any) ([]any, error) {
+	if err := authorize(ctx, "students", authz.Read); err != nil {
+		return nil, err
+	}
+	students, err := db.GetStudentsByClasses(ctx, classesOf(parents, func(p any) string { return p.(models.Teacher).Class }))
+	if err != nil {
+		return nil, err
+	}
+	values := make([]any, len(parents))
+	for i, parent := range parents {
+		classStudents := students[parent.(models.Teacher).Class]
+		if classStudents == nil {
+			classStudents = []models.Student{}
+		}
+		values[i] = classStudents
+	}
+	return values, nil
+}
+
+// teacherStudentCount has the same permission as GET /teachers/{id}/studentsCount
+func teacherStudentCount(ctx context.Context, parents []any, args map[string]any) ([]any, error) {
+	if err := authorize(ctx, "teachers", authz.Read); err != nil {
+		return nil, err
+	}
+	counts, err := db.CountStudentsByClasses(ctx, classesOf(parents, func(p any) string { return p.(models.Teacher).Class }))
+	if err != nil {
+		return nil, err
+	}
+	values := make([]any, len(parents))
+	for i, parent := range parents {
+		values[i] = counts[parent.(models.Teacher).Class]
+	}
+	return values, nil
+}
+
+// authorize fails with a FORBIDDEN error unless the principal may take action on resource,
+// by the same permission matrix as the routes
+func authorize(ctx context.Context, resource string, action authz.Action) error {
+	if !authz.AllowedContext(ctx, resource, action) {
+		return newUserError("FORBIDDEN", "your role may not %s %s", action, resource)
+	}
+	return nil
+}
+
+// allowed adapts a Query or Mutation field to resolve only for the principals who may take
+// action on resource
+func allowed(resource string, action authz.Action, fn func(ctx context.Context, args map[string]any) (any, error)) func(ctx context.Context, args map[string]any) (any, error) {
+	return func(ctx context.Context, args map[string]any) (any, error) {
+		if err := authorize(ctx, resource, action); err != nil {
+			return nil, err
+		}
+		return fn(ctx, args)
+	}
+}
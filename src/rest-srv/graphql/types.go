@@ -0,0 +1,305 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// typeRef is a reference to a type: a named type, a list (ofType set) or a non-null wrapper
+type typeRef struct {
+	name    string
+	ofType  *typeRef
+	nonNull bool
+}
+
+func (t *typeRef) isList() bool {
+	return t.name == "" && !t.nonNull
+}
+
+func (t *typeRef) namedType() string {
+	for t.name == "" {
+		t = t.ofType
+	}
+	return t.name
+}
+
+func (t *typeRef) String() string {
+	switch {
+	case t.nonNull:
+		return t.ofType.String() + "!"
+	case t.isList():
+		return "[" + t.ofType.String() + "]"
+	}
+	return t.name
+}
+
+// typeOf parses a type reference such as "[Student!]!"
+func typeOf(s string) *typeRef {
+	p := &parser{lexer: lexer{src: s}}
+	if err := p.advance(); err != nil {
+		panic(err)
+	}
+	t, err := p.typeRef()
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// resolver resolves a field for a batch of parent values at once and returns one value per
+// parent. Resolving whole levels of the result together is what avoids N+1 queries.
+type resolver func(ctx context.Context, parents []any, args map[string]any) ([]any, error)
+
+type field struct {
+	name        string
+	description string
+	typ         *typeRef
+	args        []*argument
+	// resolve defaults to reading the struct field with the same json name from the parent
+	resolve resolver
+}
+
+type argument struct {
+	name         string
+	description  string
+	typ          *typeRef
+	defaultValue any
+}
+
+type typeKind string
+
+const (
+	kindScalar      typeKind = "SCALAR"
+	kindObject      typeKind = "OBJECT"
+	kindInputObject typeKind = "INPUT_OBJECT"
+	kindEnum        typeKind = "ENUM"
+)
+
+// namedType is a scalar, enum, object or input object type of the schema
+type namedType struct {
+	kind        typeKind
+	name        string
+	description string
+	fields      []*field    // objects
+	inputFields []*argument // input objects
+	enumValues  []string    // enums
+}
+
+func (t *namedType) field(name string) *field {
+	for _, f := range t.fields {
+		if f.name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+func (t *namedType) isLeaf() bool {
+	return t.kind == kindScalar || t.kind == kindEnum
+}
+
+var builtinScalars = []*namedType{
+	{kind: kindScalar, name: "Int", description: "A signed 32-bit integer"},
+	{kind: kindScalar, name: "Float", description: "A double-precision floating point number"},
+	{kind: kindScalar, name: "String", description: "A UTF-8 character sequence"},
+	{kind: kindScalar, name: "Boolean", description: "true or false"},
+	{kind: kindScalar, name: "ID", description: "A unique identifier, serialized as a string"},
+}
+
+// propertyResolver reads the struct field tagged with json name from every parent
+func propertyResolver(name string) resolver {
+	return func(ctx context.Context, parents []any, args map[string]any) ([]any, error) {
+		values := make([]any, len(parents))
+		for i, parent := range parents {
+			values[i] = property(parent, name)
+		}
+		return values, nil
+	}
+}
+
+func property(parent any, name string) any {
+	if object, ok := parent.(map[string]any); ok {
+		return object[name]
+	}
+	v := reflect.ValueOf(parent)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	for i := 0; i < v.NumField(); i++ {
+		if strings.Split(v.Type().Field(i).Tag.Get("json"), ",")[0] == name {
+			return v.Field(i).Interface()
+		}
+	}
+	return nil
+}
+
+// serializeScalar converts a resolved value to the JSON form of a scalar or enum type
+func serializeScalar(typeName string, value any) (any, error) {
+	// Values such as utility.NullString know their JSON form
+	if marshaler, ok := value.(json.Marshaler); ok {
+		data, err := marshaler.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		value = nil
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil, err
+		}
+		if value == nil {
+			return nil, nil
+		}
+	}
+
+	v := reflect.ValueOf(value)
+	switch typeName {
+	case "Int":
+		switch {
+		case v.CanInt() && v.Int() >= math.MinInt32 && v.Int() <= math.MaxInt32:
+			return v.Int(), nil
+		case v.CanFloat() && v.Float() == math.Trunc(v.Float()) && math.Abs(v.Float()) <= math.MaxInt32:
+			return int64(v.Float()), nil
+		}
+	case "Float":
+		switch {
+		case v.CanInt():
+			return float64(v.Int()), nil
+		case v.CanFloat():
+			return v.Float(), nil
+		}
+	case "Boolean":
+		if v.Kind() == reflect.Bool {
+			return v.Bool(), nil
+		}
+	case "ID":
+		switch {
+		case v.CanInt():
+			return strconv.FormatInt(v.Int(), 10), nil
+		case v.Kind() == reflect.String:
+			return v.String(), nil
+		}
+	default:
+		if v.Kind() == reflect.String {
+			return v.String(), nil
+		}
+	}
+	return nil, fmt.Errorf("%s cannot represent value %v", typeName, value)
+}
+
+// coerceInput checks value against an input type and converts it to the Go form resolvers
+// receive: int, float64, string, bool, []any and map[string]any
+func (s *Schema) coerceInput(t *typeRef, value any, path string) (any, error) {
+	if t.nonNull {
+		if value == nil {
+			return nil, fmt.Errorf("%s must not be null", path)
+		}
+		return s.coerceInput(t.ofType, value, path)
+	}
+	if value == nil {
+		return nil, nil
+	}
+	if t.isList() {
+		items, ok := value.([]any)
+		if !ok {
+			// A single value is accepted as a list of one
+			items = []any{value}
+		}
+		coerced := make([]any, len(items))
+		for i, item := range items {
+			var err error
+			if coerced[i], err = s.coerceInput(t.ofType, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return nil, err
+			}
+		}
+		return coerced, nil
+	}
+
+	named := s.types[t.name]
+	if named.kind == kindInputObject {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s must be an object of type %s", path, t.name)
+		}
+		for key := range object {
+			if !slices.ContainsFunc(named.inputFields, func(a *argument) bool { return a.name == key }) {
+				return nil, fmt.Errorf("%s.%s is not a field of %s", path, key, t.name)
+			}
+		}
+		coerced := make(map[string]any)
+		for _, inputField := range named.inputFields {
+			fieldValue, present := object[inputField.name]
+			if !present {
+				if inputField.defaultValue != nil {
+					coerced[inputField.name] = inputField.defaultValue
+				} else if inputField.typ.nonNull {
+					return nil, fmt.Errorf("%s.%s is required", path, inputField.name)
+				}
+				continue
+			}
+			var err error
+			if coerced[inputField.name], err = s.coerceInput(inputField.typ, fieldValue, path+"."+inputField.name); err != nil {
+				return nil, err
+			}
+		}
+		return coerced, nil
+	}
+
+	if coerced, ok := coerceScalarInput(named, value); ok {
+		return coerced, nil
+	}
+	return nil, fmt.Errorf("%s must be of type %s", path, t.name)
+}
+
+func coerceScalarInput(t *namedType, value any) (any, bool) {
+	switch t.name {
+	case "Int":
+		switch v := value.(type) {
+		case int:
+			return v, v >= math.MinInt32 && v <= math.MaxInt32
+		case float64:
+			return int(v), v == math.Trunc(v) && math.Abs(v) <= math.MaxInt32
+		}
+	case "Float":
+		switch v := value.(type) {
+		case int:
+			return float64(v), true
+		case float64:
+			return v, true
+		}
+	case "Boolean":
+		v, ok := value.(bool)
+		return v, ok
+	case "ID":
+		switch v := value.(type) {
+		case string:
+			return v, true
+		case int:
+			return strconv.Itoa(v), true
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), v == math.Trunc(v)
+		}
+	default:
+		switch v := value.(type) {
+		case string:
+			// variables carry enum values as strings
+			return v, t.kind == kindScalar || slices.Contains(t.enumValues, v)
+		case enumLiteral:
+			return string(v), t.kind == kindEnum && slices.Contains(t.enumValues, string(v))
+		}
+	}
+	return nil, false
+}
+
+// enumLiteral is an unquoted enum value from a document, kept apart from strings
+type enumLiteral string
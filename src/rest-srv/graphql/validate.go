@@ -0,0 +1,199 @@
+package graphql
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Limits on what a single operation may ask for. The depth counts the fields enclosing a
+// field. The cost counts a field once for every item it is resolved on: a list is assumed
+// to hold listCost items, or as many as its limit argument when it has a literal one.
+// Introspection lists are not multiplied, so clients can still fetch the whole schema.
+const (
+	maxDepth = 15
+	maxCost  = 1000
+	listCost = 10
+)
+
+// validate checks the operation against the schema before anything is executed
+func (s *Schema) validate(doc *document, op *operation, root *namedType) error {
+	v := &validator{schema: s, doc: doc, defined: make(map[string]bool)}
+	for _, definition := range op.variables {
+		if v.defined[definition.name] {
+			return fmt.Errorf("variable $%s is defined more than once", definition.name)
+		}
+		named := s.types[definition.typ.namedType()]
+		if named == nil || named.kind == kindObject {
+			return fmt.Errorf("variable $%s has unknown input type %s", definition.name, definition.typ)
+		}
+		v.defined[definition.name] = true
+	}
+	return v.selectionSet(root, op.selections, nil, 1, 1)
+}
+
+type validator struct {
+	schema  *Schema
+	doc     *document
+	defined map[string]bool
+	// cost is the cost of the fields validated so far
+	cost int
+}
+
+// selectionSet validates selections on t, at depth and resolved on multiplier items
+func (v *validator) selectionSet(t *namedType, selections []*selection, fragmentStack []string, depth, multiplier int) error {
+	for _, s := range selections {
+		if err := v.directives(s.directives); err != nil {
+			return err
+		}
+		switch {
+		case s.fragmentName != "":
+			fragment, ok := v.doc.fragments[s.fragmentName]
+			if !ok {
+				return fmt.Errorf("unknown fragment %s", s.fragmentName)
+			}
+			if slices.Contains(fragmentStack, s.fragmentName) {
+				return fmt.Errorf("fragment %s spreads itself", s.fragmentName)
+			}
+			if err := v.typeCondition(t, fragment.typeCondition); err != nil {
+				return err
+			}
+			if err := v.selectionSet(t, fragment.selections, append(fragmentStack, s.fragmentName), depth, multiplier); err != nil {
+				return err
+			}
+		case s.inline:
+			if s.typeCondition != "" {
+				if err := v.typeCondition(t, s.typeCondition); err != nil {
+					return err
+				}
+			}
+			if err := v.selectionSet(t, s.selections, fragmentStack, depth, multiplier); err != nil {
+				return err
+			}
+		default:
+			if err := v.field(t, s, fragmentStack, depth, multiplier); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (v *validator) typeCondition(t *namedType, condition string) error {
+	if _, ok := v.schema.types[condition]; !ok {
+		return fmt.Errorf("unknown type %s", condition)
+	}
+	if condition != t.name {
+		return fmt.Errorf("fragment on %s can't be spread on %s", condition, t.name)
+	}
+	return nil
+}
+
+func (v *validator) field(t *namedType, s *selection, fragmentStack []string, depth, multiplier int) error {
+	if depth > maxDepth {
+		return fmt.Errorf("operation is nested deeper than %d fields", maxDepth)
+	}
+	// Counting as the fields are visited stops fragments spread over and over early
+	v.cost += multiplier
+	if v.cost > maxCost {
+		return fmt.Errorf("operation exceeds the maximum cost of %d", maxCost)
+	}
+
+	if s.name == "__typename" {
+		if len(s.selections) > 0 {
+			return fmt.Errorf("field __typename must not have a selection")
+		}
+		return nil
+	}
+	f := t.field(s.name)
+	if f == nil {
+		return fmt.Errorf("cannot query field %q on type %q", s.name, t.name)
+	}
+
+	for name, value := range s.arguments {
+		if !slices.ContainsFunc(f.args, func(a *argument) bool { return a.name == name }) {
+			return fmt.Errorf("unknown argument %q on field %s.%s", name, t.name, f.name)
+		}
+		if err := v.value(value); err != nil {
+			return err
+		}
+	}
+	for _, arg := range f.args {
+		if _, given := s.arguments[arg.name]; !given && arg.typ.nonNull && arg.defaultValue == nil {
+			return fmt.Errorf("field %s.%s requires argument %s of type %s", t.name, f.name, arg.name, arg.typ)
+		}
+	}
+
+	named := v.schema.types[f.typ.namedType()]
+	if named.isLeaf() {
+		if len(s.selections) > 0 {
+			return fmt.Errorf("field %s of type %s must not have a selection", f.name, f.typ)
+		}
+		return nil
+	}
+	if len(s.selections) == 0 {
+		return fmt.Errorf("field %s of type %s must have a selection of subfields", f.name, f.typ)
+	}
+	return v.selectionSet(named, s.selections, fragmentStack, depth+1, multiplier*listSize(f, s, named))
+}
+
+// listSize is how many items the selection s of f is assumed to resolve its subfields on
+func listSize(f *field, s *selection, named *namedType) int {
+	t := f.typ
+	if t.nonNull {
+		t = t.ofType
+	}
+	if !t.isList() || strings.HasPrefix(named.name, "__") {
+		return 1
+	}
+	if limit, ok := s.arguments["limit"]; ok && limit.kind == valueInt {
+		if n, err := strconv.Atoi(limit.raw); err == nil && n > 0 {
+			// Any more items than maxCost exceed it anyway
+			return min(n, maxCost)
+		}
+	}
+	return listCost
+}
+
+func (v *validator) directives(directives []directive) error {
+	for _, d := range directives {
+		if d.name != "skip" && d.name != "include" {
+			return fmt.Errorf("unknown directive @%s", d.name)
+		}
+		condition, ok := d.arguments["if"]
+		if !ok || len(d.arguments) != 1 {
+			return fmt.Errorf("directive @%s takes a single argument if", d.name)
+		}
+		if condition.kind != valueBoolean && condition.kind != valueVariable {
+			return fmt.Errorf("argument if of @%s must be a Boolean", d.name)
+		}
+		if err := v.value(condition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// value checks that every variable used in a value is defined by the operation
+func (v *validator) value(node *valueNode) error {
+	switch node.kind {
+	case valueVariable:
+		if !v.defined[node.raw] {
+			return fmt.Errorf("variable $%s is not defined", node.raw)
+		}
+	case valueList:
+		for _, item := range node.list {
+			if err := v.value(item); err != nil {
+				return err
+			}
+		}
+	case valueObject:
+		for _, fieldNode := range node.fields {
+			if err := v.value(fieldNode); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
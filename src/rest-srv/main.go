@@ -1,143 +1,83 @@
 package main
 
 import (
-	"crypto/tls"
+	"errors"
+	"flag"
 	"fmt"
-	"net/http"
 	"os"
-	"rest-srv/api/middlewares"
-	"rest-srv/api/router"
-	"rest-srv/db"
 	"rest-srv/utility"
-	"strconv"
-	"time"
-
-	"golang.org/x/net/http2"
+	"strings"
 )
 
-func main() {
-
-	serverPort := 3000 // default port
-	if portStr := os.Getenv("SERVER_PORT"); portStr != "" {
-		if port, err := strconv.Atoi(portStr); err == nil {
-			serverPort = port
-		}
-	}
-
-	// Database connection parameters from environment - all required
-	dbHost := os.Getenv("DB_HOST")
-	if dbHost == "" {
-		fmt.Println("Error: DB_HOST environment variable is required")
-		os.Exit(1)
-	}
-
-	dbPortStr := os.Getenv("DB_PORT")
-	if dbPortStr == "" {
-		fmt.Println("Error: DB_PORT environment variable is required")
-		os.Exit(1)
-	}
-	dbPort, err := strconv.Atoi(dbPortStr)
-	if err != nil {
-		fmt.Printf("Error: DB_PORT must be a valid integer: %v\n", err)
-		os.Exit(1)
-	}
-
-	dbUser := os.Getenv("DB_USER")
-	if dbUser == "" {
-		fmt.Println("Error: DB_USER environment variable is required")
-		os.Exit(1)
-	}
-
-	dbPassword := os.Getenv("DB_PASSWORD")
-	if dbPassword == "" {
-		fmt.Println("Error: DB_PASSWORD environment variable is required")
-		os.Exit(1)
-	}
-
-	dbName := os.Getenv("DB_NAME")
-	if dbName == "" {
-		fmt.Println("Error: DB_NAME environment variable is required")
-		os.Exit(1)
-	}
+const usage = `Usage: rest-srv [command] [flags]
 
-	// Connect to database
-	if err := db.ConnectDb(dbUser, dbPassword, dbHost, dbPort, dbName); err != nil {
-		fmt.Printf("Error connecting to database: %v\n", err)
-		os.Exit(1)
-	}
-	defer db.Db.Close()
+Commands:
+  serve                 run the API server, the default command
+  migrate               apply the pending migrations of the sql directory
+  exec create           create an exec, e.g. the first admin
+  exec reset-password   set a new password for an exec
+  exec deactivate       stop an exec from logging in
+  exec reset-mfa        remove the second factor of an exec who lost it
+  seed                  fill an empty database with sample teachers and students
+  token issue           issue a session token for an exec
 
-	// Test database connection
-	if err := db.Db.Ping(); err != nil {
-		fmt.Printf("Error pinging database: %v\n", err)
-		os.Exit(1)
-	}
-	fmt.Println("Database connection established successfully")
+Run rest-srv <command> -h for the flags of a command. Every command reads the configuration
+as the server does: from the file of -config or CONFIG_FILE, and the environment.
+`
 
-	// SSL certificate and key (required)
-	certFile := os.Getenv("CERT_FILE")
-	if certFile == "" {
-		fmt.Println("Error: CERT_FILE environment variable is required")
-		os.Exit(1)
-	}
-	keyFile := os.Getenv("KEY_FILE")
-	if keyFile == "" {
-		fmt.Println("Error: KEY_FILE environment variable is required")
-		os.Exit(1)
-	}
-	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
-	if err != nil {
-		fmt.Println("Error loading SSL certificate and key: ", err)
+func main() {
+	// Until the configuration is loaded, the logger runs at its default level
+	if err := utility.SetupLogger(os.Stdout, "info"); err != nil {
+		fmt.Println("Error:", err)
 		os.Exit(1)
 	}
-	tlsConfig := &tls.Config{
-		MinVersion:   tls.VersionTLS12,
-		Certificates: []tls.Certificate{cert},
-	}
-
-	rl := middlewares.NewRateLimiter(10, 2*time.Second)
-	hpp := middlewares.HPPOptions{
-		CheckQuery:                  true,
-		CheckBody:                   true,
-		CheckBodyOnlyForContentType: "application/x-www-form-urlencoded",
-		WhiteList:                   []string{"name", "age", "address", "sortBy", "sortOrder", "id", "first_name", "last_name", "email", "class", "subject", "limit", "page"},
-	}
-
-	excludeRoutes := []string{
-		"/execs/login",
-		"/execs/register",
-		"/execs/forgot-password",
-		"/execs/reset-password",
-		"/execs/verify-email",
-		"/execs/resend-verification-email",
-		"/execs/logout",
-	}
 
-	router := router.MainRouter()
-	middlewares := []utility.Middleware{
-		middlewares.XSSMiddleware,
-		middlewares.Hpp(hpp),
-		middlewares.CompressionMiddleware,
-		middlewares.SecurityHeaders,
-		middlewares.ResponseTimMiddleware,
-		rl.RateLimiterMiddleware,
-		middlewares.Cors,
-		middlewares.ExcludeRoutes(middlewares.JwtMiddleware, excludeRoutes...),
-	}
-	secureMux := utility.ApplyMiddlewares(router, middlewares...)
-
-	server := &http.Server{
-		Addr:      fmt.Sprintf(":%d", serverPort),
-		TLSConfig: tlsConfig,
-		Handler:   secureMux,
-	}
-
-	http2.ConfigureServer(server, &http2.Server{})
-	fmt.Println("Starting TLS server on port ", serverPort)
-	err = server.ListenAndServeTLS("", "")
-	if err != nil {
-		fmt.Println("Error starting TLS server: ", err)
+	args := os.Args[1:]
+	// Without a command the server runs, so "rest-srv -config rest-srv.yaml" still does
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		serve(args)
+		return
+	}
+	command, args := args[0], args[1:]
+	if (command == "exec" || command == "token") && len(args) > 0 {
+		command, args = command+" "+args[0], args[1:]
+	}
+
+	var run func(args []string) error
+	switch command {
+	case "serve":
+		serve(args)
+		return
+	case "migrate":
+		run = migrateCommand
+	case "exec create":
+		run = execCreateCommand
+	case "exec reset-password":
+		run = execResetPasswordCommand
+	case "exec deactivate":
+		run = execDeactivateCommand
+	case "exec reset-mfa":
+		run = execResetMFACommand
+	case "seed":
+		run = seedCommand
+	case "token issue":
+		run = tokenIssueCommand
+	case "help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+
+	err := run(args)
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		os.Exit(0)
+	case errors.Is(err, errUsage):
+		os.Exit(2)
+	case err != nil:
+		fmt.Fprintln(os.Stderr, "Error:", err)
 		os.Exit(1)
 	}
-
 }
@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+)
+
+// Default holds the metrics of the server
+var Default = NewRegistry()
+
+var (
+	HTTPRequests = Default.NewCounterVec("http_requests_total",
+		"HTTP requests by route pattern, method and status class", "route", "method", "status")
+	HTTPRequestDuration = Default.NewHistogramVec("http_request_duration_seconds",
+		"Time to serve HTTP requests by route pattern and method", DefaultBuckets, "route", "method")
+	RateLimitRejections = Default.NewCounterVec("rate_limit_rejections_total",
+		"Requests rejected by the rate limiter")
+	AuthFailures = Default.NewCounterVec("auth_failures_total",
+		"Failed authentications by reason", "reason")
+	EmailsSent = Default.NewCounterVec("emails_sent_total",
+		"Emails handed to the mail server by outcome", "outcome")
+)
+
+// StatusClass groups a status code as 2xx, 4xx, ... to keep the number of series small
+func StatusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// RegisterDBStats exposes the connection pool statistics of db
+func RegisterDBStats(db *sql.DB) {
+	gauge := func(name, help string, value func(sql.DBStats) float64) {
+		Default.NewGaugeFunc(name, help, func() float64 { return value(db.Stats()) })
+	}
+	counter := func(name, help string, value func(sql.DBStats) float64) {
+		Default.NewCounterFunc(name, help, func() float64 { return value(db.Stats()) })
+	}
+	gauge("db_max_open_connections", "Maximum number of open connections to the database",
+		func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) })
+	gauge("db_open_connections", "Established connections, both in use and idle",
+		func(s sql.DBStats) float64 { return float64(s.OpenConnections) })
+	gauge("db_in_use_connections", "Connections currently in use",
+		func(s sql.DBStats) float64 { return float64(s.InUse) })
+	gauge("db_idle_connections", "Idle connections",
+		func(s sql.DBStats) float64 { return float64(s.Idle) })
+	counter("db_wait_count_total", "Connections waited for",
+		func(s sql.DBStats) float64 { return float64(s.WaitCount) })
+	counter("db_wait_duration_seconds_total", "Time blocked waiting for a new connection",
+		func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() })
+	counter("db_max_idle_closed_total", "Connections closed due to SetMaxIdleConns",
+		func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) })
+	counter("db_max_idle_time_closed_total", "Connections closed due to SetConnMaxIdleTime",
+		func(s sql.DBStats) float64 { return float64(s.MaxIdleTimeClosed) })
+	counter("db_max_lifetime_closed_total", "Connections closed due to SetConnMaxLifetime",
+		func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) })
+}
+
+// Handler serves the metrics of Default in the Prometheus text format
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Default.WriteText(w)
+	})
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"rest-srv/utility"
+)
+
+// APIKey lets a machine client act as an exec, limited to its scopes such as "students:read".
+// Only the SHA-256 hash of the key is stored, found by the prefix the key starts with.
+type APIKey struct {
+	ID         int        `json:"id"`
+	ExecID     int        `json:"exec_id"`
+	Name       string     `json:"name" validate:"required,max=255"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+func (k *APIKey) Validate() error {
+	return utility.ValidateStruct(k)
+}
+
+// Active reports whether the key is neither revoked nor expired
+func (k *APIKey) Active() bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || time.Now().Before(*k.ExpiresAt))
+}
@@ -8,17 +8,17 @@ import (
 
 type Exec struct {
 	ID                   int                `json:"id,omitempty" db:"id,primary_key,auto_increment"`
-	FirstName            string             `json:"first_name,omitempty" db:"first_name,not_null"`
-	LastName             string             `json:"last_name,omitempty" db:"last_name,not_null"`
-	Email                string             `json:"email,omitempty" db:"email,not_null,unique"`
-	Username             string             `json:"username,omitempty" db:"username,not_null,unique"`
-	Password             string             `json:"password,omitempty" db:"password,not_null"`
-	PasswordChangedAt    utility.NullString `json:"password_changed_at,omitempty" db:"password_changed_at"`
+	FirstName            string             `json:"first_name,omitempty" db:"first_name,not_null" validate:"max=255"`
+	LastName             string             `json:"last_name,omitempty" db:"last_name,not_null" validate:"max=255"`
+	Email                string             `json:"email,omitempty" db:"email,not_null,unique" validate:"email,max=255"`
+	Username             string             `json:"username,omitempty" db:"username,not_null,unique" validate:"min=3,max=255"`
+	Password             string             `json:"password,omitempty" db:"password,not_null" validate:"max=255"`
+	PasswordChangedAt    utility.NullTime   `json:"password_changed_at,omitempty" db:"password_changed_at"`
 	UserCreatedAt        utility.NullString `json:"user_created_at,omitempty" db:"user_created_at"`
 	PasswordResetToken   utility.NullString `json:"password_reset_token,omitempty" db:"password_reset_token"`
 	PasswordTokenExpires utility.NullString `json:"password_token_expires,omitempty" db:"password_token_expires"`
 	InactiveStatus       bool               `json:"inactive_status,omitempty" db:"inactive_status,not_null"`
-	Role                 string             `json:"role,omitempty" db:"role,not_null"`
+	Role                 string             `json:"role,omitempty" db:"role,not_null" validate:"oneof=admin manager exec"`
 }
 
 func (e Exec) MarshalJSON() ([]byte, error) {
@@ -33,5 +33,11 @@ func (e Exec) MarshalJSON() ([]byte, error) {
 }
 
 func (e *Exec) Validate() error {
-	return utility.ValidateBlank(e)
+	return utility.ValidateStruct(e)
+}
+
+// PatchableFields lists the fields a PATCH may set. The password and the reset token are
+// changed through their own routes, password_changed_at and user_created_at by the server.
+func (e Exec) PatchableFields() []string {
+	return []string{"first_name", "last_name", "email", "username", "inactive_status", "role"}
 }
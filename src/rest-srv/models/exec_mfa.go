@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// ExecMFA is the TOTP second factor of an exec. It is enabled once confirmed with a code of
+// the authenticator app. LastStep is the time step of the last code accepted, so that no code
+// is accepted twice.
+type ExecMFA struct {
+	ExecID      int        `json:"exec_id"`
+	Secret      string     `json:"-"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ConfirmedAt *time.Time `json:"confirmed_at,omitempty"`
+	LastStep    int64      `json:"-"`
+}
+
+// Enabled reports whether the exec logs in with a TOTP code
+func (m *ExecMFA) Enabled() bool {
+	return m.ConfirmedAt != nil
+}
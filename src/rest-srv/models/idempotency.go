@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+const (
+	IdempotencyInProgress = "in_progress"
+	IdempotencyCompleted  = "completed"
+)
+
+// IdempotencyRecord is the stored outcome of a request sent with an Idempotency-Key header
+type IdempotencyRecord struct {
+	ID                  string    `json:"id" db:"id,primary_key"`
+	RequestHash         string    `json:"request_hash" db:"request_hash,not_null"`
+	Status              string    `json:"status" db:"status,not_null"`
+	ResponseCode        int       `json:"response_code" db:"response_code"`
+	ResponseContentType string    `json:"response_content_type" db:"response_content_type"`
+	ResponseBody        []byte    `json:"response_body" db:"response_body"`
+	ExpiresAt           time.Time `json:"expires_at" db:"expires_at,not_null"`
+}
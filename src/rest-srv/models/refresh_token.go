@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// RefreshToken is a stored refresh token, of which only the SHA-256 hash is kept. Each token
+// is used once, to get an access token and the next refresh token of its family; the tokens
+// rotated from one login form a family.
+type RefreshToken struct {
+	ID        int64      `json:"id" db:"id,primary_key"`
+	TokenHash string     `json:"-" db:"token_hash,not_null"`
+	FamilyID  string     `json:"family_id" db:"family_id,not_null"`
+	ExecID    int        `json:"exec_id" db:"exec_id,not_null"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at,not_null"`
+	UsedAt    *time.Time `json:"used_at,omitempty" db:"used_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
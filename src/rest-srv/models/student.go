@@ -4,12 +4,17 @@ import "rest-srv/utility"
 
 type Student struct {
 	ID        int    `json:"id,omitempty" db:"id,primary_key,auto_increment"`
-	FirstName string `json:"first_name,omitempty" db:"first_name,not_null"`
-	LastName  string `json:"last_name,omitempty" db:"last_name,not_null"`
-	Email     string `json:"email,omitempty" db:"email,not_null,unique"`
-	Class     string `json:"class,omitempty" db:"class,not_null"`
+	FirstName string `json:"first_name,omitempty" db:"first_name,not_null" validate:"max=255"`
+	LastName  string `json:"last_name,omitempty" db:"last_name,not_null" validate:"max=255"`
+	Email     string `json:"email,omitempty" db:"email,not_null,unique" validate:"email,max=255"`
+	Class     string `json:"class,omitempty" db:"class,not_null" validate:"max=255"`
 }
 
 func (s *Student) Validate() error {
-	return utility.ValidateBlank(s)
+	return utility.ValidateStruct(s)
+}
+
+// PatchableFields lists the fields a PATCH may set
+func (s Student) PatchableFields() []string {
+	return []string{"first_name", "last_name", "email", "class"}
 }
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"rest-srv/utility"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// OutboxEvent is a change to an entity, written in the same transaction as the change itself
+type OutboxEvent struct {
+	ID        int64           `json:"id"`
+	EventType string          `json:"event_type"`
+	Entity    string          `json:"entity"`
+	EntityID  int             `json:"entity_id"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type WebhookSubscription struct {
+	ID         int                `json:"id,omitempty" db:"id,primary_key,auto_increment"`
+	URL        string             `json:"url,omitempty" db:"url,not_null" validate:"url,max=2048"`
+	Secret     string             `json:"secret,omitempty" db:"secret" validate:"max=255"`
+	EventTypes string             `json:"event_types,omitempty" db:"event_types,not_null" validate:"max=1024"`
+	Active     bool               `json:"active" db:"active"`
+	CreatedAt  utility.NullString `json:"created_at,omitempty" db:"created_at"`
+}
+
+func (s *WebhookSubscription) Validate() error {
+	return utility.ValidateStruct(s)
+}
+
+// WebhookDelivery tracks delivering one event to one subscription
+type WebhookDelivery struct {
+	ID             int64              `json:"id"`
+	SubscriptionID int                `json:"subscription_id"`
+	EventID        int64              `json:"event_id"`
+	Status         string             `json:"status"`
+	Attempts       int                `json:"attempts"`
+	NextAttemptAt  time.Time          `json:"next_attempt_at"`
+	LastStatusCode int                `json:"last_status_code,omitempty"`
+	LastError      utility.NullString `json:"last_error"`
+}
+
+// WebhookDeliveryAttempt is one entry of the delivery log
+type WebhookDeliveryAttempt struct {
+	ID          int64              `json:"id"`
+	DeliveryID  int64              `json:"delivery_id"`
+	AttemptedAt time.Time          `json:"attempted_at"`
+	StatusCode  int                `json:"status_code,omitempty"`
+	Error       utility.NullString `json:"error"`
+	DurationMs  int                `json:"duration_ms"`
+}
+
+// Matches reports whether the subscription wants events of eventType. EventTypes is a
+// comma separated list of exact types ("student.created"), entity wildcards ("student.*") or "*".
+func (s WebhookSubscription) Matches(eventType string) bool {
+	entity, _, _ := strings.Cut(eventType, ".")
+	for _, pattern := range strings.Split(s.EventTypes, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "*" || pattern == eventType || pattern == entity+".*" {
+			return true
+		}
+	}
+	return false
+}
+
+// PendingDelivery is a delivery that is due, together with what is needed to send it
+type PendingDelivery struct {
+	Delivery     WebhookDelivery
+	Subscription WebhookSubscription
+	Event        OutboxEvent
+}
@@ -0,0 +1,13 @@
+package openapi
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed docs
+var docsFiles embed.FS
+
+// Docs is the interactive documentation page. It renders /openapi.json in the browser and
+// can send requests with the session cookie, so it needs no third-party assets.
+var Docs, _ = fs.Sub(docsFiles, "docs")
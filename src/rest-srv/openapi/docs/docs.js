@@ -0,0 +1,208 @@
+"use strict";
+
+// Renders the OpenAPI document served at ../openapi.json and lets operations be tried out
+// with the session cookie of the page.
+
+let spec;
+
+function element(tag, attributes, ...children) {
+	const node = document.createElement(tag);
+	for (const [name, value] of Object.entries(attributes || {})) {
+		node.setAttribute(name, value);
+	}
+	for (const child of children) {
+		node.append(child);
+	}
+	return node;
+}
+
+function resolve(schema) {
+	while (schema && schema.$ref) {
+		schema = spec.components.schemas[schema.$ref.split("/").pop()];
+	}
+	return schema || {};
+}
+
+// example builds a sample value for a schema, used to prefill request bodies
+function example(schema, depth = 0) {
+	schema = resolve(schema);
+	if (depth > 5) {
+		return null;
+	}
+	if (schema.enum) {
+		return schema.enum[0];
+	}
+	if (schema.oneOf) {
+		return example(schema.oneOf[0], depth + 1);
+	}
+	const type = Array.isArray(schema.type) ? schema.type[0] : schema.type;
+	switch (type) {
+	case "object": {
+		const value = {};
+		for (const [name, property] of Object.entries(schema.properties || {})) {
+			if (!resolve(property).readOnly) {
+				value[name] = example(property, depth + 1);
+			}
+		}
+		return value;
+	}
+	case "array":
+		return [example(schema.items, depth + 1)];
+	case "integer":
+	case "number":
+		return 0;
+	case "boolean":
+		return false;
+	case "string":
+		return schema.format === "email" ? "user@example.com" : "";
+	}
+	return null;
+}
+
+function describe(schema, depth = 0) {
+	schema = resolve(schema);
+	if (depth > 5) {
+		return "…";
+	}
+	if (schema.oneOf) {
+		return schema.oneOf.map((s) => describe(s, depth + 1)).join(" | ");
+	}
+	const type = Array.isArray(schema.type) ? schema.type.join(" | ") : schema.type;
+	if (type === "array") {
+		return "[" + describe(schema.items, depth + 1) + "]";
+	}
+	if (type === "object" && schema.properties) {
+		const fields = Object.entries(schema.properties).map(([name, property]) => {
+			const required = (schema.required || []).includes(name) ? "" : "?";
+			return "  ".repeat(depth + 1) + name + required + ": " + describe(property, depth + 1);
+		});
+		return "{\n" + fields.join("\n") + "\n" + "  ".repeat(depth) + "}";
+	}
+	return (type || "any") + (schema.format ? " (" + schema.format + ")" : "");
+}
+
+function parametersTable(parameters) {
+	const table = element("table", {}, element("tr", {}, element("th", {}, "Name"), element("th", {}, "In"), element("th", {}, "Description"), element("th", {}, "Value")));
+	const inputs = [];
+	for (const parameter of parameters) {
+		const input = element("input", { placeholder: describe(parameter.schema) });
+		inputs.push({ parameter, input });
+		table.append(element("tr", {},
+			element("td", {}, parameter.name + (parameter.required ? " *" : "")),
+			element("td", {}, parameter.in),
+			element("td", {}, parameter.description || ""),
+			element("td", {}, input)));
+	}
+	return { table, inputs };
+}
+
+function operationView(method, path, operation) {
+	const body = element("div", { class: "body" });
+	if (operation.description) {
+		body.append(element("p", {}, operation.description));
+	}
+
+	const { table, inputs } = parametersTable(operation.parameters || []);
+	if (inputs.length > 0) {
+		body.append(element("h4", {}, "Parameters"), table);
+	}
+
+	let contentType;
+	let bodyInput;
+	if (operation.requestBody) {
+		contentType = Object.keys(operation.requestBody.content)[0];
+		const schema = operation.requestBody.content[contentType].schema;
+		bodyInput = element("textarea", {});
+		bodyInput.value = JSON.stringify(example(schema), null, 2);
+		body.append(element("h4", {}, "Request body (" + contentType + ")"), element("pre", {}, describe(schema)), bodyInput);
+	}
+
+	body.append(element("h4", {}, "Responses"));
+	for (const [status, response] of Object.entries(operation.responses)) {
+		const content = response.content && Object.values(response.content)[0];
+		body.append(element("p", {}, element("strong", {}, status), " " + response.description));
+		if (content && content.schema) {
+			body.append(element("pre", {}, describe(content.schema)));
+		}
+	}
+
+	const output = element("pre", {});
+	const send = element("button", {}, "Send request");
+	send.addEventListener("click", async () => {
+		let url = path;
+		const query = new URLSearchParams();
+		for (const { parameter, input } of inputs) {
+			if (input.value === "") {
+				continue;
+			}
+			if (parameter.in === "path") {
+				url = url.replace("{" + parameter.name + "}", encodeURIComponent(input.value));
+			} else if (parameter.in === "query") {
+				query.append(parameter.name, input.value);
+			}
+		}
+		if (query.toString() !== "") {
+			url += "?" + query;
+		}
+		const headers = { "Content-Type": contentType || "application/json", Accept: "application/json" };
+		for (const { parameter, input } of inputs) {
+			if (parameter.in === "header" && input.value !== "") {
+				headers[parameter.name] = input.value;
+			}
+		}
+		output.textContent = "…";
+		try {
+			const response = await fetch(url, { method: method.toUpperCase(), headers, credentials: "same-origin", body: bodyInput ? bodyInput.value : undefined });
+			let text = await response.text();
+			try {
+				text = JSON.stringify(JSON.parse(text), null, 2);
+			} catch {
+				// not JSON, shown as is
+			}
+			output.textContent = response.status + " " + response.statusText + "\n\n" + text;
+		} catch (error) {
+			output.textContent = String(error);
+		}
+	});
+	body.append(send, output);
+
+	const isPublic = operation.security && operation.security.length === 1 && Object.keys(operation.security[0]).length === 0;
+	const summary = element("summary", {},
+		element("span", { class: "method " + method }, method),
+		element("span", { class: "path" }, path),
+		element("span", { class: "summary" }, operation.summary || ""));
+	if (isPublic) {
+		summary.append(element("span", { class: "public" }, "public"));
+	}
+	return element("details", {}, summary, body);
+}
+
+async function render() {
+	const container = document.getElementById("operations");
+	try {
+		const response = await fetch("../openapi.json", { headers: { Accept: "application/json" } });
+		spec = await response.json();
+	} catch (error) {
+		container.textContent = "Unable to load the OpenAPI document: " + error;
+		return;
+	}
+	document.getElementById("title").textContent = spec.info.title + " " + spec.info.version;
+	document.getElementById("description").textContent = spec.info.description || "";
+
+	const groups = new Map();
+	for (const path of Object.keys(spec.paths).sort()) {
+		for (const [method, operation] of Object.entries(spec.paths[path])) {
+			const tag = (operation.tags || ["other"])[0];
+			if (!groups.has(tag)) {
+				groups.set(tag, []);
+			}
+			groups.get(tag).push(operationView(method, path, operation));
+		}
+	}
+	container.replaceChildren();
+	for (const [tag, views] of groups) {
+		container.append(element("h2", {}, tag), ...views);
+	}
+}
+
+render();
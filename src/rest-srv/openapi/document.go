@@ -0,0 +1,180 @@
+package openapi
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Document is an OpenAPI 3.1 document
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+	Security   []Requirement        `json:"security,omitempty"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem maps a lowercase HTTP method to its operation
+type PathItem map[string]*Operation
+
+type Operation struct {
+	Tags        []string             `json:"tags,omitempty"`
+	Summary     string               `json:"summary,omitempty"`
+	Description string               `json:"description,omitempty"`
+	OperationID string               `json:"operationId,omitempty"`
+	Parameters  []*Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+	Deprecated  bool                 `json:"deprecated,omitempty"`
+	// Security overrides the document default; an empty list marks a public operation
+	Security []Requirement `json:"security,omitempty"`
+	Public   bool          `json:"-"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Explode     *bool   `json:"explode,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Description string                `json:"description,omitempty"`
+	Required    bool                  `json:"required,omitempty"`
+	Content     map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string                `json:"description"`
+	Headers     map[string]*Header    `json:"headers,omitempty"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme,omitempty"`
+	In          string `json:"in,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Requirement names the security schemes an operation accepts, with their scopes
+type Requirement map[string][]string
+
+// New creates an empty document
+func New(title, version, description string) *Document {
+	return &Document{
+		OpenAPI: "3.1.0",
+		Info:    Info{Title: title, Version: version, Description: description},
+		Paths:   make(map[string]*PathItem),
+		Components: Components{
+			Schemas:         make(map[string]*Schema),
+			SecuritySchemes: make(map[string]*SecurityScheme),
+		},
+	}
+}
+
+var pathWildcard = regexp.MustCompile(`\{([^}.]+)(\.\.\.)?\}`)
+
+// Add documents the route registered with the ServeMux pattern "METHOD /path". Path
+// parameters that op doesn't declare are added as required strings.
+func (d *Document) Add(pattern string, op *Operation) {
+	method, path, ok := strings.Cut(pattern, " ")
+	if !ok {
+		panic(fmt.Sprintf("openapi: pattern %q has no method", pattern))
+	}
+	for _, match := range pathWildcard.FindAllStringSubmatch(path, -1) {
+		declared := slices.ContainsFunc(op.Parameters, func(p *Parameter) bool {
+			return p.In == "path" && p.Name == match[1]
+		})
+		if !declared {
+			op.Parameters = append(op.Parameters, &Parameter{Name: match[1], In: "path", Required: true, Schema: &Schema{Type: "string"}})
+		}
+	}
+	if op.Public {
+		op.Security = []Requirement{{}}
+	}
+
+	path = pathWildcard.ReplaceAllString(path, "{$1}")
+	item, ok := d.Paths[path]
+	if !ok {
+		item = &PathItem{}
+		d.Paths[path] = item
+	}
+	(*item)[strings.ToLower(method)] = op
+}
+
+// Mount documents the operations of api again under prefix, as served by a version of the
+// API. The operation ids get suffix so they stay unique across versions.
+func (d *Document) Mount(prefix string, api *Document, suffix string, deprecated bool) {
+	for path, item := range api.Paths {
+		mounted := make(PathItem, len(*item))
+		for method, op := range *item {
+			copied := *op
+			copied.OperationID += suffix
+			copied.Deprecated = deprecated
+			mounted[method] = &copied
+		}
+		d.Paths[prefix+path] = &mounted
+	}
+}
+
+// Component registers the schema of v under name and returns a reference to it
+func (d *Document) Component(name string, v any) *Schema {
+	if _, ok := d.Components.Schemas[name]; !ok {
+		d.Components.Schemas[name] = SchemaOf(reflect.TypeOf(v))
+	}
+	return Ref(name)
+}
+
+// Has reports whether the route registered with pattern is documented. A pattern ending in
+// a slash is covered by the same route without it, since those are registered as aliases.
+func (d *Document) Has(pattern string) bool {
+	method, path, _ := strings.Cut(pattern, " ")
+	path = pathWildcard.ReplaceAllString(path, "{$1}")
+	for _, candidate := range []string{path, strings.TrimSuffix(path, "/")} {
+		if item, ok := d.Paths[candidate]; ok && (*item)[strings.ToLower(method)] != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns an error listing every registered route that has no entry in the document
+func (d *Document) Check(patterns []string) error {
+	var missing []string
+	for _, pattern := range patterns {
+		if !d.Has(pattern) {
+			missing = append(missing, pattern)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("routes without an OpenAPI entry: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+// Package revocation revokes session tokens before they expire, on logout and when an exec
+// logs out everywhere. The revocations are kept in a Store until the tokens they concern
+// have expired: in the database, shared by every instance of the server, or in memory.
+package revocation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"rest-srv/utility"
+)
+
+// Store records revocations by key until they expire
+type Store interface {
+	// Revoke records that the tokens of key issued until at are revoked, until expiresAt
+	Revoke(ctx context.Context, key string, at, expiresAt time.Time) error
+	// RevokedAt returns when the tokens of key were revoked, the zero time when they are not
+	RevokedAt(ctx context.Context, key string) (time.Time, error)
+	// Stop ends the purging of the expired revocations, waiting for it until ctx is done
+	Stop(ctx context.Context) error
+}
+
+// store is set from the configuration at startup
+var store Store
+
+// SetStore sets the store of the revocations
+func SetStore(s Store) {
+	store = s
+}
+
+// Open returns the store of kind, "sql" or "memory"
+func Open(kind string) (Store, error) {
+	switch kind {
+	case "sql":
+		return NewSQLStore(), nil
+	case "memory":
+		return NewMemoryStore(), nil
+	}
+	return nil, fmt.Errorf("unknown revocation store %q", kind)
+}
+
+func tokenKey(id string) string {
+	return "token:" + id
+}
+
+func execKey(execID string) string {
+	return "exec:" + execID
+}
+
+// RevokeToken revokes the session token id until it expires at expiresAt
+func RevokeToken(ctx context.Context, id string, expiresAt time.Time) error {
+	if store == nil {
+		return errors.New("revocation store is not set")
+	}
+	return store.Revoke(ctx, tokenKey(id), time.Now(), expiresAt)
+}
+
+// RevokeSessions revokes every session token of the exec issued until now, including those
+// issued within the current second, as token issue times are in seconds. The revocation is
+// recorded in whole seconds too: a database would round a fraction up to the next second,
+// revoking the tokens of a new session started within it.
+func RevokeSessions(ctx context.Context, execID string) error {
+	if store == nil {
+		return errors.New("revocation store is not set")
+	}
+	now := time.Now().Truncate(time.Second)
+	return store.Revoke(ctx, execKey(execID), now, now.Add(utility.TokenExpiresIn()))
+}
+
+// Revoked reports whether the session token id of the exec, issued at issuedAt, was revoked
+func Revoked(ctx context.Context, id string, execID string, issuedAt time.Time) (bool, error) {
+	if store == nil {
+		return false, errors.New("revocation store is not set")
+	}
+	revokedAt, err := store.RevokedAt(ctx, tokenKey(id))
+	if err != nil {
+		return false, err
+	}
+	if !revokedAt.IsZero() {
+		return true, nil
+	}
+	revokedAt, err = store.RevokedAt(ctx, execKey(execID))
+	if err != nil {
+		return false, err
+	}
+	return !revokedAt.IsZero() && issuedAt.Unix() <= revokedAt.Unix(), nil
+}
@@ -0,0 +1,79 @@
+package revocation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"rest-srv/utility"
+)
+
+// datetimeStore keeps the revocations as a DATETIME column does, rounded to the second
+type datetimeStore struct {
+	*MemoryStore
+}
+
+func (s datetimeStore) Revoke(ctx context.Context, key string, at, expiresAt time.Time) error {
+	return s.MemoryStore.Revoke(ctx, key, at.Round(time.Second), expiresAt)
+}
+
+func TestRevokeSessions(t *testing.T) {
+	utility.SetJWTSettings("test-secret", 15*time.Minute)
+	memory := NewMemoryStore()
+	defer memory.Stop(context.Background())
+	SetStore(datetimeStore{memory})
+	defer SetStore(nil)
+
+	// Past the middle of the second, a revocation stored with its fraction is rounded up to the next
+	now := time.Now()
+	if now.Nanosecond() < int(600*time.Millisecond) {
+		time.Sleep(now.Truncate(time.Second).Add(600 * time.Millisecond).Sub(now))
+	}
+	ctx := context.Background()
+	if err := RevokeSessions(ctx, "7"); err != nil {
+		t.Fatal(err)
+	}
+	second := time.Now().Truncate(time.Second)
+
+	tests := []struct {
+		name     string
+		execID   string
+		issuedAt time.Time
+		want     bool
+	}{
+		{"issued before", "7", second.Add(-time.Minute), true},
+		{"issued in the same second", "7", second, true},
+		{"issued in the next second", "7", second.Add(time.Second), false},
+		{"of another exec", "8", second, false},
+	}
+	for _, tt := range tests {
+		revoked, err := Revoked(ctx, "jti", tt.execID, tt.issuedAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if revoked != tt.want {
+			t.Errorf("%s: revoked = %t, want %t", tt.name, revoked, tt.want)
+		}
+	}
+}
+
+func TestRevokeToken(t *testing.T) {
+	memory := NewMemoryStore()
+	defer memory.Stop(context.Background())
+	SetStore(memory)
+	defer SetStore(nil)
+
+	ctx := context.Background()
+	if err := RevokeToken(ctx, "jti", time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	for id, want := range map[string]bool{"jti": true, "other": false} {
+		revoked, err := Revoked(ctx, id, "7", time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if revoked != want {
+			t.Errorf("token %s revoked = %t, want %t", id, revoked, want)
+		}
+	}
+}
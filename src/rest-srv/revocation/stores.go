@@ -0,0 +1,111 @@
+package revocation
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"rest-srv/db"
+)
+
+// purger runs purge every interval until stopped
+type purger struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+func startPurger(interval time.Duration, purge func()) *purger {
+	p := &purger{stop: make(chan struct{}), done: make(chan struct{})}
+	go func() {
+		defer close(p.done)
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-time.After(interval):
+			}
+			purge()
+		}
+	}()
+	return p
+}
+
+func (p *purger) Stop(ctx context.Context) error {
+	close(p.stop)
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SQLStore keeps the revocations in the revoked_tokens table, so that every instance of the
+// server sees them and they survive restarts
+type SQLStore struct {
+	*purger
+}
+
+func NewSQLStore() *SQLStore {
+	return &SQLStore{purger: startPurger(time.Hour, func() {
+		db.DeleteExpiredRevokedTokens(context.Background())
+	})}
+}
+
+func (s *SQLStore) Revoke(ctx context.Context, key string, at, expiresAt time.Time) error {
+	return db.AddRevokedToken(ctx, key, at, expiresAt)
+}
+
+func (s *SQLStore) RevokedAt(ctx context.Context, key string) (time.Time, error) {
+	return db.GetTokenRevokedAt(ctx, key)
+}
+
+// MemoryStore keeps the revocations in memory, for a single instance: they are lost when it
+// restarts
+type MemoryStore struct {
+	*purger
+	mu      sync.Mutex
+	revoked map[string]revoked
+}
+
+type revoked struct {
+	at        time.Time
+	expiresAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{revoked: make(map[string]revoked)}
+	s.purger = startPurger(time.Minute, s.purge)
+	return s
+}
+
+func (s *MemoryStore) Revoke(ctx context.Context, key string, at, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if previous, ok := s.revoked[key]; ok && previous.expiresAt.After(expiresAt) {
+		expiresAt = previous.expiresAt
+	}
+	s.revoked[key] = revoked{at: at, expiresAt: expiresAt}
+	return nil
+}
+
+func (s *MemoryStore) RevokedAt(ctx context.Context, key string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.revoked[key]
+	if !ok || time.Now().After(r.expiresAt) {
+		return time.Time{}, nil
+	}
+	return r.at, nil
+}
+
+func (s *MemoryStore) purge() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for key, r := range s.revoked {
+		if now.After(r.expiresAt) {
+			delete(s.revoked, key)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"rest-srv/api/handlers"
+	"rest-srv/api/middlewares"
+	"rest-srv/api/router"
+	"rest-srv/certs"
+	"rest-srv/config"
+	"rest-srv/db"
+	"rest-srv/events"
+	"rest-srv/metrics"
+	"rest-srv/revocation"
+	"rest-srv/tracing"
+	"rest-srv/utility"
+	"rest-srv/webhooks"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// serve runs the API server until it is asked to stop by SIGINT or SIGTERM. args are the
+// configuration flags.
+func serve(args []string) {
+	cfg, err := config.Load(args)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		slog.Error("invalid configuration", "error", err)
+		os.Exit(2)
+	}
+	utility.SetLogLevel(cfg.Log.Level)
+	utility.SetJWTSettings(cfg.Auth.JWTSecret, cfg.Auth.JWTExpiresIn)
+	utility.SetMailSettings(cfg.Mail.Host, cfg.Mail.Port, cfg.Mail.Username, cfg.Mail.Password, cfg.Mail.From)
+	handlers.SetRefreshTokenSettings(cfg.Auth.RefreshTokenExpiresIn)
+	handlers.SetPasswordResetSettings(cfg.Auth.ResetTokenExpiresIn, cfg.Server.ExposePort)
+	handlers.SetMFASettings(cfg.Auth.MFARequiredRoles, cfg.Auth.MFAIssuer, cfg.Auth.MFAChallengeExpiresIn)
+	middlewares.SetAllowedOrigins(cfg.CORS.AllowedOrigins)
+
+	if err := tracing.Setup(cfg.Tracing.Exporter, cfg.Tracing.Endpoint, cfg.Tracing.ServiceName); err != nil {
+		slog.Error("unable to set up tracing", "error", err)
+		os.Exit(1)
+	}
+
+	// Connect to database
+	if err := db.ConnectDb(cfg.Database.User, cfg.Database.Password, cfg.Database.Host, cfg.Database.Port, cfg.Database.Name); err != nil {
+		slog.Error("unable to connect to database", "error", err)
+		os.Exit(1)
+	}
+
+	// Test database connection
+	if err := db.Db.Ping(); err != nil {
+		slog.Error("unable to ping database", "error", err)
+		os.Exit(1)
+	}
+	slog.Info("database connection established")
+
+	if cfg.Server.SelfSigned {
+		created, err := certs.EnsureSelfSigned(cfg.Server.CertFile, cfg.Server.KeyFile, []string{"localhost", "127.0.0.1", "::1"})
+		if err != nil {
+			slog.Error("unable to generate a self-signed certificate", "error", err)
+			os.Exit(1)
+		}
+		if created {
+			slog.Warn("generated a self-signed certificate for development", "cert_file", cfg.Server.CertFile)
+		}
+	}
+	// The certificate is reloaded when its files change, so it can be rotated without a restart
+	certReloader, err := certs.NewReloader(cfg.Server.CertFile, cfg.Server.KeyFile, cfg.Server.CertReloadInterval)
+	if err != nil {
+		slog.Error("unable to load SSL certificate and key", "error", err)
+		os.Exit(1)
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certReloader.GetCertificate,
+	}
+	// With a client CA bundle, services may present a certificate instead of logging in.
+	// Browsers and other clients without one are still let through to the JWT check.
+	if cfg.MTLS.ClientCAFile != "" {
+		clientCAs, err := certs.LoadClientCAs(cfg.MTLS.ClientCAFile)
+		if err != nil {
+			slog.Error("unable to load client CA bundle", "error", err)
+			os.Exit(1)
+		}
+		services, err := certs.ParseServiceMap(cfg.MTLS.Services)
+		if err != nil {
+			slog.Error("invalid mtls.services", "error", err)
+			os.Exit(1)
+		}
+		tlsConfig.ClientCAs = clientCAs
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		middlewares.SetServiceAccounts(services)
+		slog.Info("mutual TLS enabled", "services", len(services))
+	}
+
+	revocations, err := revocation.Open(cfg.Auth.RevocationStore)
+	if err != nil {
+		slog.Error("invalid auth.revocation_store", "error", err)
+		os.Exit(1)
+	}
+	revocation.SetStore(revocations)
+
+	idempotency := middlewares.NewIdempotency(cfg.Idempotency.TTL)
+	dispatcher := webhooks.NewDispatcher(cfg.Webhooks.PollInterval, cfg.Webhooks.MaxAttempts)
+	eventBroker := events.NewBroker(cfg.Events.BufferSize, cfg.Events.PollInterval)
+
+	rl := middlewares.NewRateLimiter(cfg.RateLimit.Requests, cfg.RateLimit.Window)
+	authRL := middlewares.NewRateLimiter(cfg.RateLimit.AuthRequests, cfg.RateLimit.AuthWindow)
+	hpp := middlewares.HPPOptions{
+		CheckQuery:                  true,
+		CheckBody:                   true,
+		CheckBodyOnlyForContentType: "application/x-www-form-urlencoded",
+		WhiteList:                   cfg.HPP.Whitelist,
+	}
+
+	// Metrics are served on a separate plain HTTP listener, on the main server to holders of
+	// the token, or both
+	metricsAddr := cfg.Metrics.Addr
+	metricsToken := cfg.Metrics.Token
+	metrics.RegisterDBStats(db.Db)
+	var metricsServer *http.Server
+	if metricsAddr != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("GET /metrics", metrics.Handler())
+		metricsServer = &http.Server{Addr: metricsAddr, Handler: metricsMux}
+		go func() {
+			slog.Info("starting metrics server", "addr", metricsAddr)
+			if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("metrics server stopped", "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
+	readiness := &handlers.Readiness{}
+	routes, err := router.MainRouter(eventBroker, metricsToken, readiness, authRL.RateLimiterMiddleware, sanitizer(hpp))
+	if err != nil {
+		slog.Error("unable to register routes", "error", err)
+		os.Exit(1)
+	}
+	secureMux := secureHandler(routes, idempotency.IdempotencyMiddleware, rl.RateLimiterMiddleware, hpp)
+
+	server := &http.Server{
+		Addr:      fmt.Sprintf(":%d", cfg.Server.Port),
+		TLSConfig: tlsConfig,
+		Handler:   secureMux,
+		ErrorLog:  slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+
+	http2.ConfigureServer(server, &http2.Server{})
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("starting TLS server", "port", cfg.Server.Port)
+		serverErr <- server.ListenAndServeTLS("", "")
+	}()
+
+	// Plain HTTP clients are redirected to the HTTPS port they can reach
+	var redirectServer *http.Server
+	if cfg.Server.RedirectPort != 0 {
+		redirectServer = &http.Server{
+			Addr:              fmt.Sprintf(":%d", cfg.Server.RedirectPort),
+			Handler:           certs.RedirectHandler(cfg.Server.ExposePort),
+			ReadHeaderTimeout: 5 * time.Second,
+		}
+		go func() {
+			slog.Info("starting HTTP redirect server", "port", cfg.Server.RedirectPort)
+			if err := redirectServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				serverErr <- err
+			}
+		}()
+	}
+
+	// SIGHUP reloads the settings that can change while the server runs
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	go func(current *config.Config) {
+		for range hangups {
+			current = reload(args, current, rl, authRL)
+		}
+	}(cfg)
+
+	signals, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stopSignals()
+	select {
+	case err := <-serverErr:
+		slog.Error("server stopped", "error", err)
+		os.Exit(1)
+	case <-signals.Done():
+		// A second signal kills the process right away
+		stopSignals()
+	}
+
+	signal.Stop(hangups)
+	slog.Info("shutting down", "timeout", cfg.Server.ShutdownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	shutdownErr := shutdown(ctx, []shutdownStep{
+		// Probes fail first, so load balancers stop sending requests
+		{"readiness", func(context.Context) error { readiness.Drain(); return nil }},
+		// Event streams never end on their own and would hold the server until the timeout
+		{"event broker", eventBroker.Stop},
+		{"TLS server", server.Shutdown},
+		{"HTTP redirect server", shutdownServer(redirectServer)},
+		{"metrics server", shutdownServer(metricsServer)},
+		{"certificate reloader", certReloader.Stop},
+		{"webhook dispatcher", dispatcher.Stop},
+		{"idempotency purger", idempotency.Stop},
+		{"revocation purger", revocations.Stop},
+		{"rate limiter", rl.Stop},
+		{"auth rate limiter", authRL.Stop},
+		{"tracing", tracing.Shutdown},
+		{"database", func(context.Context) error { return db.Db.Close() }},
+	})
+	if shutdownErr != nil {
+		os.Exit(1)
+	}
+	slog.Info("shutdown complete")
+}
+
+// secureHandler wraps the routes in the middlewares every request goes through, the last
+// one outermost
+func secureHandler(routes *router.Router, idempotency, rateLimiter utility.Middleware, hpp middlewares.HPPOptions) http.Handler {
+	return utility.ApplyMiddlewares(routes,
+		sanitizer(hpp),
+		middlewares.Traced("IdempotencyMiddleware", middlewares.ExcludeRoutes(idempotency, routes.Excludes(router.ExcludeIdempotency))),
+		middlewares.Traced("CompressionMiddleware", middlewares.CompressionMiddleware),
+		middlewares.Traced("SecurityHeaders", middlewares.SecurityHeaders),
+		middlewares.Traced("ResponseTimMiddleware", middlewares.ResponseTimMiddleware),
+		middlewares.Traced("RateLimiterMiddleware", middlewares.ExcludeRoutes(rateLimiter, routes.Excludes(router.ExcludeRateLimit))),
+		middlewares.Traced("Cors", middlewares.ExcludeRoutes(middlewares.Cors, routes.Excludes(router.ExcludeCORS))),
+		middlewares.Traced("JwtMiddleware", middlewares.ExcludeRoutes(middlewares.JwtMiddleware, routes.Excludes(router.ExcludeAuth))),
+		middlewares.Traced("MetricsMiddleware", middlewares.MetricsMiddleware(routes.ServeMux)),
+		middlewares.TracingMiddleware(routes.ServeMux),
+		middlewares.RequestIDMiddleware,
+	)
+}
+
+// sanitizer returns the middlewares cleaning up requests, which the operations of a batch go
+// through as well
+func sanitizer(hpp middlewares.HPPOptions) utility.Middleware {
+	return func(next http.Handler) http.Handler {
+		return utility.ApplyMiddlewares(next,
+			middlewares.Traced("XSSMiddleware", middlewares.XSSMiddleware),
+			middlewares.Traced("Hpp", middlewares.Hpp(hpp)),
+		)
+	}
+}
+
+// reload loads the configuration again and applies its reloadable settings: the log level,
+// the CORS origins and the rate limits. Changes to the other settings are logged as needing a
+// restart. An invalid configuration is rejected and the current one kept.
+func reload(args []string, current *config.Config, rl, authRL interface{ SetLimit(int, time.Duration) }) *config.Config {
+	next, err := config.Load(args)
+	if err != nil {
+		slog.Error("configuration not reloaded", "error", err)
+		return current
+	}
+	reloaded, needRestart := current.Reload(next)
+	utility.SetLogLevel(reloaded.Log.Level)
+	middlewares.SetAllowedOrigins(reloaded.CORS.AllowedOrigins)
+	rl.SetLimit(reloaded.RateLimit.Requests, reloaded.RateLimit.Window)
+	authRL.SetLimit(reloaded.RateLimit.AuthRequests, reloaded.RateLimit.AuthWindow)
+	if len(needRestart) > 0 {
+		slog.Warn("configuration changes need a restart", "settings", needRestart)
+	}
+	slog.Info("configuration reloaded")
+	return reloaded
+}
+
+// shutdownServer returns the step shutting down s, which is nil when it isn't enabled
+func shutdownServer(s *http.Server) func(context.Context) error {
+	return func(ctx context.Context) error {
+		if s == nil {
+			return nil
+		}
+		return s.Shutdown(ctx)
+	}
+}
+
+type shutdownStep struct {
+	name string
+	stop func(context.Context) error
+}
+
+// shutdown runs the steps in order. A step that fails or runs out of time is logged and the
+// next ones still run, so the database is closed whatever happened before.
+func shutdown(ctx context.Context, steps []shutdownStep) error {
+	var failed error
+	for _, step := range steps {
+		if err := step.stop(ctx); err != nil {
+			slog.Error("shutdown step failed", "step", step.name, "error", err)
+			failed = err
+		}
+	}
+	return failed
+}
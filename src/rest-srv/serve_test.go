@@ -0,0 +1,558 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"rest-srv/api/handlers"
+	"rest-srv/api/middlewares"
+	"rest-srv/api/router"
+	"rest-srv/certs"
+	"rest-srv/client"
+	"rest-srv/config"
+	"rest-srv/db"
+	"rest-srv/events"
+	"rest-srv/models"
+	"rest-srv/revocation"
+	"rest-srv/utility"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+const testOrigin = "https://app.example.com"
+
+// testHandler serves the routes through the middlewares of the server, as serve does, with
+// the database mocked
+func testHandler(t *testing.T) (http.Handler, sqlmock.Sqlmock) {
+	t.Helper()
+	conn, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := db.Db
+	db.Db = conn
+	t.Cleanup(func() {
+		db.Db = previous
+		conn.Close()
+	})
+
+	middlewares.SetAllowedOrigins([]string{testOrigin})
+	utility.SetJWTSettings("test-secret", 15*time.Minute)
+	revocations := revocation.NewMemoryStore()
+	revocation.SetStore(revocations)
+	idempotency := middlewares.NewIdempotency(time.Hour)
+	rl := middlewares.NewRateLimiter(1000, time.Minute)
+	authRL := middlewares.NewRateLimiter(1000, time.Minute)
+	t.Cleanup(func() {
+		for _, stop := range []func(context.Context) error{revocations.Stop, idempotency.Stop, rl.Stop, authRL.Stop} {
+			stop(context.Background())
+		}
+	})
+
+	hpp := middlewares.HPPOptions{CheckQuery: true, CheckBody: true, CheckBodyOnlyForContentType: "application/x-www-form-urlencoded", WhiteList: config.Default().HPP.Whitelist}
+	routes, err := router.MainRouter((*events.Broker)(nil), "", &handlers.Readiness{}, authRL.RateLimiterMiddleware, sanitizer(hpp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return secureHandler(routes, idempotency.IdempotencyMiddleware, rl.RateLimiterMiddleware, hpp), mock
+}
+
+var apiKeyColumns = []string{"id", "exec_id", "name", "prefix", "key_hash", "scopes", "created_at", "expires_at", "last_used_at", "revoked_at", "username", "role", "inactive_status"}
+
+// expectAPIKey expects the lookup of a new key of an admin with scopes, and returns the key
+func expectAPIKey(mock sqlmock.Sqlmock, scopes string) string {
+	key, prefix, hash := utility.NewAPIKey()
+	mock.ExpectQuery("FROM api_keys k JOIN execs e").WithArgs(prefix).WillReturnRows(
+		sqlmock.NewRows(apiKeyColumns).AddRow(1, 7, "ci", prefix, hash, scopes, time.Now(), nil, nil, nil, "ci", "admin", false))
+	mock.ExpectExec("UPDATE api_keys SET last_used_at").WillReturnResult(sqlmock.NewResult(0, 1))
+	return key
+}
+
+// TestAPIKeyWithoutOrigin calls the API with an API key as machine clients do, without an
+// Origin, through every middleware of the server
+func TestAPIKeyWithoutOrigin(t *testing.T) {
+	handler, mock := testHandler(t)
+	key := expectAPIKey(mock, "settings:read")
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/admin/log-level", nil)
+	req.Header.Set("X-API-Key", key)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"level"`) {
+		t.Errorf("GET /v1/admin/log-level = %d %q, want the level", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Access-Control-Allow-Origin = %q without an Origin", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCorsOrigins(t *testing.T) {
+	handler, _ := testHandler(t)
+
+	tests := []struct {
+		origin string
+		status int
+		allow  string
+	}{
+		{testOrigin, http.StatusOK, testOrigin},
+		{"https://evil.example.com", http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodOptions, "/v1/students", nil)
+			req.Header.Set("Origin", tt.origin)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.allow {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.allow)
+			}
+		})
+	}
+}
+
+// newClientCertificate issues a client certificate for the service at uri, and returns it
+// with the pool of the CA that issued it
+func newClientCertificate(t *testing.T, uri string) (tls.Certificate, *x509.CertPool) {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ = x509.ParseCertificate(caDER)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service, _ := url.Parse(uri)
+	leaf := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "reporting"},
+		URIs:         []*url.URL{service},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, leaf, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pool
+}
+
+// TestServiceCertificate calls the API as a service presenting a client certificate, through
+// the TLS handshake and every middleware of the server
+func TestServiceCertificate(t *testing.T) {
+	handler, mock := testHandler(t)
+	const service = "spiffe://example.com/reporting"
+	cert, clientCAs := newClientCertificate(t, service)
+	middlewares.SetServiceAccounts(certs.ServiceMap{service: "admin"})
+	t.Cleanup(func() { middlewares.SetServiceAccounts(nil) })
+
+	server := httptest.NewUnstartedServer(handler)
+	server.TLS = &tls.Config{ClientCAs: clientCAs, ClientAuth: tls.VerifyClientCertIfGiven}
+	server.StartTLS()
+	defer server.Close()
+	transport := server.Client().Transport.(*http.Transport).Clone()
+	transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	client := &http.Client{Transport: transport}
+
+	res, err := client.Get(server.URL + "/v1/admin/log-level")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK || !strings.Contains(string(body), `"level"`) {
+		t.Errorf("GET /v1/admin/log-level = %d %q, want the level", res.StatusCode, body)
+	}
+
+	// Without its certificate, the service is asked to log in
+	res, err = server.Client().Get(server.URL + "/v1/admin/log-level")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("GET /v1/admin/log-level without a certificate = %d, want %d", res.StatusCode, http.StatusUnauthorized)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestClientRoundTrip calls the API with the Go client, which sends no Origin, through every
+// middleware of the server
+func TestClientRoundTrip(t *testing.T) {
+	handler, mock := testHandler(t)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	key := expectAPIKey(mock, "students:read")
+	mock.ExpectQuery("FROM students WHERE id").WithArgs(3).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "first_name", "last_name", "email", "class"}).AddRow(3, "Ada", "Lovelace", "ada@example.com", "9A"))
+
+	c, err := client.New(server.URL, client.WithAPIKey(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	student, err := c.Students.Get(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("Students.Get: %v", err)
+	}
+	if want := (models.Student{ID: 3, FirstName: "Ada", LastName: "Lovelace", Email: "ada@example.com", Class: "9A"}); student != want {
+		t.Errorf("Students.Get = %+v, want %+v", student, want)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// storedTime matches a time argument and keeps it as a DATETIME column stores it, rounded
+// to the second
+type storedTime struct {
+	t *time.Time
+}
+
+func (s storedTime) Match(v driver.Value) bool {
+	t, ok := v.(time.Time)
+	if ok {
+		*s.t = t.Round(time.Second)
+	}
+	return ok
+}
+
+var execColumns = []string{"id", "first_name", "last_name", "email", "username", "password", "password_changed_at", "user_created_at", "password_reset_token", "password_token_expires", "inactive_status", "role"}
+
+func expectExec(mock sqlmock.Sqlmock, password string) {
+	mock.ExpectQuery("SELECT id, first_name, .* FROM execs WHERE id").WithArgs(7).WillReturnRows(
+		sqlmock.NewRows(execColumns).AddRow(7, "Ada", "Lovelace", "ada@example.com", "ada", password, nil, nil, nil, nil, false, "exec"))
+}
+
+// TestPasswordChangeKeepsSession changes a password and goes on with the token the change
+// returns, which is issued in the second the password was changed
+func TestPasswordChangeKeepsSession(t *testing.T) {
+	handler, mock := testHandler(t)
+	hash, err := utility.HashPassword("old-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := utility.SignToken("7", "ada", "exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Past the middle of the second, a change stored with its fraction is rounded up to the next
+	if now := time.Now(); now.Nanosecond() < int(600*time.Millisecond) {
+		time.Sleep(now.Truncate(time.Second).Add(600 * time.Millisecond).Sub(now))
+	}
+
+	var changedAt time.Time
+	mock.ExpectQuery("SELECT password_changed_at, inactive_status FROM execs").WithArgs(7).WillReturnRows(
+		sqlmock.NewRows([]string{"password_changed_at", "inactive_status"}).AddRow(nil, false))
+	expectExec(mock, hash)
+	mock.ExpectBegin()
+	mock.ExpectPrepare("UPDATE execs SET password = \\?, password_changed_at = \\?").ExpectExec().
+		WithArgs(sqlmock.AnyArg(), storedTime{&changedAt}, 7).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO outbox").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE refresh_tokens SET revoked_at").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec("DELETE FROM refresh_tokens").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO refresh_tokens").WillReturnResult(sqlmock.NewResult(1, 1))
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/execs/7/update-password", strings.NewReader(`{"oldpassword":"old-secret","newpassword":"new-secret"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(&http.Cookie{Name: "Bearer", Value: token})
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("POST /v1/execs/7/update-password = %d %q", w.Code, w.Body.String())
+	}
+	var renewed *http.Cookie
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == "Bearer" {
+			renewed = cookie
+		}
+	}
+	if renewed == nil {
+		t.Fatal("the password change returned no session token")
+	}
+
+	mock.ExpectQuery("SELECT password_changed_at, inactive_status FROM execs").WithArgs(7).WillReturnRows(
+		sqlmock.NewRows([]string{"password_changed_at", "inactive_status"}).AddRow(changedAt, false))
+	expectExec(mock, hash)
+
+	req = httptest.NewRequest(http.MethodGet, "/v1/execs/7", nil)
+	req.AddCookie(&http.Cookie{Name: "Bearer", Value: renewed.Value})
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("GET /v1/execs/7 with the new token = %d %q, want %d", w.Code, w.Body.String(), http.StatusOK)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestLoginNotReplayed logs in twice with the same Idempotency-Key: the tokens of the first
+// response are neither stored nor replayed to the second caller
+func TestLoginNotReplayed(t *testing.T) {
+	handler, mock := testHandler(t)
+	hash, err := utility.HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tokens []string
+	for range 2 {
+		mock.ExpectQuery("FROM execs WHERE username").WithArgs("ada").WillReturnRows(
+			sqlmock.NewRows([]string{"id", "first_name", "last_name", "email", "username", "password", "password_changed_at", "user_created_at", "password_reset_token", "inactive_status", "role"}).
+				AddRow(7, "Ada", "Lovelace", "ada@example.com", "ada", hash, nil, nil, nil, false, "exec"))
+		mock.ExpectQuery("FROM exec_mfa").WithArgs(7).WillReturnError(sql.ErrNoRows)
+		mock.ExpectExec("DELETE FROM refresh_tokens").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("INSERT INTO refresh_tokens").WillReturnResult(sqlmock.NewResult(1, 1))
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/execs/login", strings.NewReader(`{"username":"ada","password":"secret"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", "login-1")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusOK || w.Header().Get("Idempotent-Replayed") != "" {
+			t.Fatalf("POST /v1/execs/login = %d %q, replayed %q", w.Code, w.Body.String(), w.Header().Get("Idempotent-Replayed"))
+		}
+		var session struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		json.NewDecoder(w.Body).Decode(&session)
+		tokens = append(tokens, session.RefreshToken)
+	}
+	if tokens[0] == "" || tokens[0] == tokens[1] {
+		t.Errorf("refresh tokens %q, want a new one for each login", tokens)
+	}
+	// Any statement on idempotency_keys would have been unexpected
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestMFAAttemptsLimited tries a code on every route managing the second factor once the
+// exec has run out of attempts: none of them verifies it
+func TestMFAAttemptsLimited(t *testing.T) {
+	handler, mock := testHandler(t)
+	token, err := utility.SignToken("7", "ada", "exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path      string
+		confirmed bool
+	}{
+		{"/v1/execs/7/mfa/confirm", false},
+		{"/v1/execs/7/mfa/recovery-codes", true},
+		{"/v1/execs/7/mfa/disable", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			var confirmedAt any
+			if tt.confirmed {
+				confirmedAt = time.Now()
+			}
+			mock.ExpectQuery("SELECT password_changed_at, inactive_status FROM execs").WithArgs(7).WillReturnRows(
+				sqlmock.NewRows([]string{"password_changed_at", "inactive_status"}).AddRow(nil, false))
+			expectExec(mock, "hash")
+			mock.ExpectQuery("FROM exec_mfa").WithArgs(7).WillReturnRows(
+				sqlmock.NewRows([]string{"exec_id", "secret", "created_at", "confirmed_at", "last_step"}).AddRow(7, "JBSWY3DPEHPK3PXP", time.Now(), confirmedAt, 0))
+			// The attempt counted is one more than allowed
+			mock.ExpectExec("UPDATE exec_mfa SET failed_attempts").WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), 7).
+				WillReturnResult(sqlmock.NewResult(6, 1))
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(`{"code":"123456"}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.AddCookie(&http.Cookie{Name: "Bearer", Value: token})
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			if w.Code != http.StatusTooManyRequests {
+				t.Errorf("POST %s = %d %q, want %d", tt.path, w.Code, w.Body.String(), http.StatusTooManyRequests)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// postBatch runs operations as a batch with an API key, through every middleware of the server
+func postBatch(handler http.Handler, key string, operations string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/v1/batch", strings.NewReader(`{"operations":`+operations+`}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", key)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestBatchUnbatchable(t *testing.T) {
+	handler, mock := testHandler(t)
+
+	for _, op := range []string{
+		`{"method":"GET","path":"/v1/events/stream"}`,
+		`{"method":"POST","path":"/v1/graphql","body":{"query":"{ students { id } }"}}`,
+		`{"method":"POST","path":"/v1/batch","body":{"operations":[]}}`,
+		`{"method":"POST","path":"/v1/execs/login","body":{"username":"ada","password":"secret"}}`,
+		`{"method":"POST","path":"/v1/execs/7/api-keys","body":{"name":"ci"}}`,
+	} {
+		key := expectAPIKey(mock, "events:read,students:read,api_keys:create")
+		mock.ExpectBegin()
+		mock.ExpectRollback()
+		w := postBatch(handler, key, "["+op+"]")
+
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "cannot run in a batch") {
+			t.Errorf("batch of %s = %d %q, want %d", op, w.Code, w.Body.String(), http.StatusBadRequest)
+		}
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestBatchSanitized checks that an operation of a batch is sanitized as a request of its
+// own, and only once
+func TestBatchSanitized(t *testing.T) {
+	handler, mock := testHandler(t)
+	key := expectAPIKey(mock, "students:create")
+
+	mock.ExpectBegin()
+	mock.ExpectPrepare("INSERT INTO students").ExpectExec().
+		WithArgs("Ada &amp; Bob", "Lovelace", "ada@example.com", "9A").WillReturnResult(sqlmock.NewResult(3, 1))
+	mock.ExpectExec("INSERT INTO outbox").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	w := postBatch(handler, key, `[{"method":"POST","path":"/v1/students","body":[
+		{"first_name":"<script>alert(1)</script>Ada & Bob","last_name":"Lovelace","email":"ada@example.com","class":"9A"}
+	]}]`)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("batch = %d %q, want %d", w.Code, w.Body.String(), http.StatusOK)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestPatchInvalidStudent checks that a PATCH leaving a student invalid, here one stored
+// before emails were validated, answers 400 with the violations rather than a 500
+func TestPatchInvalidStudent(t *testing.T) {
+	handler, mock := testHandler(t)
+	key := expectAPIKey(mock, "students:update")
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("FROM students WHERE id = \\? FOR UPDATE").WithArgs(3).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "first_name", "last_name", "email", "class"}).AddRow(3, "Ada", "Lovelace", "ada", "9A"))
+	mock.ExpectRollback()
+	req := httptest.NewRequest(http.MethodPatch, "/v1/students/3", strings.NewReader(`{"first_name":"Grace"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", key)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `{"field":"email","message":"must be a valid email address"}`) {
+		t.Errorf("PATCH /v1/students/3 = %d %q, want the violations", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// passwordArg matches the hash of a password being stored
+type passwordArg string
+
+func (p passwordArg) Match(v driver.Value) bool {
+	hash, ok := v.(string)
+	if !ok {
+		return false
+	}
+	valid, err := utility.ComparePassword(hash, string(p))
+	return err == nil && valid
+}
+
+// TestPasswordReset sets the password sent with the token of a reset email, once
+func TestPasswordReset(t *testing.T) {
+	handler, mock := testHandler(t)
+	token := strings.Repeat("ab", 32)
+	tokenBytes, _ := hex.DecodeString(token)
+	hashed := sha256.Sum256(tokenBytes)
+	hashedToken := hex.EncodeToString(hashed[:])
+	reset := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/execs/reset-password/reset/"+token, strings.NewReader(`{"newpassword":"new-secret"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("FROM execs WHERE password_reset_token = \\?").WithArgs(hashedToken, sqlmock.AnyArg()).WillReturnRows(
+		sqlmock.NewRows(execColumns).AddRow(7, "Ada", "Lovelace", "ada@example.com", "ada", "old-hash", nil, nil, hashedToken, "2099-01-01T00:00:00Z", false, "exec"))
+	mock.ExpectExec("UPDATE execs SET password_reset_token = NULL").WithArgs(7, hashedToken).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectPrepare("UPDATE execs SET password = \\?, password_changed_at = \\?").ExpectExec().
+		WithArgs(passwordArg("new-secret"), sqlmock.AnyArg(), 7).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO outbox").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE refresh_tokens SET revoked_at").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if w := reset(); w.Code != http.StatusOK {
+		t.Fatalf("reset = %d %q, want %d", w.Code, w.Body.String(), http.StatusOK)
+	}
+
+	// The token was cleared with the change
+	mock.ExpectBegin()
+	mock.ExpectQuery("FROM execs WHERE password_reset_token = \\?").WithArgs(hashedToken, sqlmock.AnyArg()).WillReturnRows(sqlmock.NewRows(execColumns))
+	mock.ExpectRollback()
+	if w := reset(); w.Code != http.StatusNotFound {
+		t.Errorf("reset with a used token = %d %q, want %d", w.Code, w.Body.String(), http.StatusNotFound)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
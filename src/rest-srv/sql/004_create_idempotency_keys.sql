@@ -0,0 +1,12 @@
+use classes;
+CREATE TABLE IF NOT EXISTS idempotency_keys(
+  id char(64) primary key,
+  request_hash char(64) NOT NULL,
+  status varchar(20) NOT NULL DEFAULT 'in_progress',
+  response_code int,
+  response_content_type varchar(255),
+  response_body mediumblob,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  expires_at DATETIME NOT NULL,
+  INDEX idx_expires_at(expires_at)
+);
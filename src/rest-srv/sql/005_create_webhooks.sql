@@ -0,0 +1,47 @@
+use classes;
+CREATE TABLE IF NOT EXISTS outbox(
+  id bigint auto_increment primary key,
+  event_type varchar(100) NOT NULL,
+  entity varchar(50) NOT NULL,
+  entity_id int NOT NULL,
+  payload json NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  dispatched_at DATETIME,
+  INDEX idx_dispatched_at(dispatched_at)
+);
+
+CREATE TABLE IF NOT EXISTS webhook_subscriptions(
+  id int auto_increment primary key,
+  url varchar(2048) NOT NULL,
+  secret varchar(255) NOT NULL,
+  event_types varchar(1024) NOT NULL DEFAULT '*',
+  active boolean NOT NULL DEFAULT true,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+) auto_increment=100;
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries(
+  id bigint auto_increment primary key,
+  subscription_id int NOT NULL,
+  event_id bigint NOT NULL,
+  status varchar(20) NOT NULL DEFAULT 'pending',
+  attempts int NOT NULL DEFAULT 0,
+  next_attempt_at DATETIME NOT NULL,
+  last_status_code int,
+  last_error text,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  UNIQUE KEY uniq_subscription_event(subscription_id, event_id),
+  INDEX idx_status_next_attempt(status, next_attempt_at),
+  FOREIGN KEY (subscription_id) REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+  FOREIGN KEY (event_id) REFERENCES outbox(id)
+);
+
+CREATE TABLE IF NOT EXISTS webhook_delivery_attempts(
+  id bigint auto_increment primary key,
+  delivery_id bigint NOT NULL,
+  attempted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  status_code int,
+  error text,
+  duration_ms int NOT NULL,
+  INDEX idx_delivery(delivery_id),
+  FOREIGN KEY (delivery_id) REFERENCES webhook_deliveries(id) ON DELETE CASCADE
+);
@@ -0,0 +1,14 @@
+use classes;
+CREATE TABLE IF NOT EXISTS refresh_tokens(
+  id bigint auto_increment primary key,
+  token_hash char(64) NOT NULL UNIQUE,
+  family_id varchar(64) NOT NULL,
+  exec_id int NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  expires_at DATETIME NOT NULL,
+  used_at DATETIME,
+  revoked_at DATETIME,
+  INDEX idx_family_id(family_id),
+  INDEX idx_exec_expires_at(exec_id, expires_at),
+  FOREIGN KEY (exec_id) REFERENCES execs(id) ON DELETE CASCADE
+);
@@ -0,0 +1,7 @@
+use classes;
+CREATE TABLE IF NOT EXISTS revoked_tokens(
+  id varchar(255) primary key,
+  revoked_at DATETIME NOT NULL,
+  expires_at DATETIME NOT NULL,
+  INDEX idx_expires_at(expires_at)
+);
@@ -0,0 +1,15 @@
+use classes;
+CREATE TABLE IF NOT EXISTS api_keys(
+  id int auto_increment primary key,
+  exec_id int NOT NULL,
+  name varchar(255) NOT NULL,
+  prefix varchar(32) NOT NULL UNIQUE,
+  key_hash char(64) NOT NULL,
+  scopes varchar(1024) NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  expires_at DATETIME,
+  last_used_at DATETIME,
+  revoked_at DATETIME,
+  INDEX idx_exec_id(exec_id),
+  FOREIGN KEY (exec_id) REFERENCES execs(id) ON DELETE CASCADE
+);
@@ -0,0 +1,17 @@
+use classes;
+CREATE TABLE IF NOT EXISTS exec_mfa(
+  exec_id int primary key,
+  secret varchar(64) NOT NULL,
+  created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+  confirmed_at DATETIME,
+  last_step bigint NOT NULL DEFAULT 0,
+  FOREIGN KEY (exec_id) REFERENCES execs(id) ON DELETE CASCADE
+);
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes(
+  id int auto_increment primary key,
+  exec_id int NOT NULL,
+  code_hash char(64) NOT NULL,
+  used_at DATETIME,
+  UNIQUE KEY uq_exec_code(exec_id, code_hash),
+  FOREIGN KEY (exec_id) REFERENCES execs(id) ON DELETE CASCADE
+);
@@ -0,0 +1,10 @@
+use classes;
+-- password_changed_at decides which session tokens of an exec are still valid. It held the
+-- RFC 3339 strings written by the server, converted to UTC here; values that are not such a
+-- time, or are in the future, are cleared before the column becomes a DATETIME.
+UPDATE execs SET password_changed_at = DATE_FORMAT(CONVERT_TZ(STR_TO_DATE(LEFT(password_changed_at, 19), '%Y-%m-%dT%H:%i:%s'), IF(SUBSTRING(password_changed_at, 20) = 'Z', '+00:00', SUBSTRING(password_changed_at, 20)), '+00:00'), '%Y-%m-%d %H:%i:%s')
+  WHERE password_changed_at REGEXP '^[0-9]{4}-[0-9]{2}-[0-9]{2}T[0-9]{2}:[0-9]{2}:[0-9]{2}(Z|[+-][0-9]{2}:[0-9]{2})$';
+UPDATE execs SET password_changed_at = NULL
+  WHERE password_changed_at NOT REGEXP '^[0-9]{4}-[0-9]{2}-[0-9]{2} [0-9]{2}:[0-9]{2}:[0-9]{2}$'
+  OR password_changed_at > DATE_FORMAT(UTC_TIMESTAMP(), '%Y-%m-%d %H:%i:%s');
+ALTER TABLE execs MODIFY password_changed_at DATETIME;
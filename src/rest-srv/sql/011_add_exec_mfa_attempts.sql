@@ -0,0 +1,6 @@
+use classes;
+-- The codes tried at login since the last one accepted, limited within a window so that a
+-- second factor cannot be guessed by rotating challenges or addresses
+ALTER TABLE exec_mfa
+  ADD COLUMN failed_attempts int NOT NULL DEFAULT 0,
+  ADD COLUMN failed_at DATETIME;
@@ -0,0 +1,59 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+var provider atomic.Pointer[sdktrace.TracerProvider]
+
+// Setup starts exporting spans with exporter: otlp posts them to the collector at endpoint,
+// such as http://localhost:4318, console writes them to stderr, away from the logs on
+// stdout, and none turns tracing off. A remote parent that isn't sampled keeps the whole
+// trace unsampled.
+func Setup(exporter, endpoint, service string) error {
+	var spanExporter sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case "", "none":
+		return nil
+	case "console":
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stderr))
+	case "otlp":
+		spanExporter, err = otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(strings.TrimSuffix(endpoint, "/")+"/v1/traces"))
+	default:
+		return fmt.Errorf("unknown trace exporter %q", exporter)
+	}
+	if err != nil {
+		return err
+	}
+
+	tracerProvider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(resource.NewSchemaless(String("service.name", service))),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.AlwaysSample())),
+	)
+	otel.SetTracerProvider(tracerProvider)
+	if previous := provider.Swap(tracerProvider); previous != nil {
+		previous.Shutdown(context.Background())
+	}
+	return nil
+}
+
+// Shutdown stops tracing and exports the spans still queued, waiting until ctx is done
+func Shutdown(ctx context.Context) error {
+	tracerProvider := provider.Swap(nil)
+	if tracerProvider == nil {
+		return nil
+	}
+	return tracerProvider.Shutdown(ctx)
+}
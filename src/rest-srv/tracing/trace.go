@@ -0,0 +1,75 @@
+// Package tracing traces the server with the OpenTelemetry SDK. Spans are propagated with
+// W3C Trace Context headers and exported over OTLP/HTTP or, for development, to stderr.
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName names the tracer of the spans of this module
+const instrumentationName = "rest-srv/tracing"
+
+type SpanKind = trace.SpanKind
+
+const (
+	KindInternal = trace.SpanKindInternal
+	KindServer   = trace.SpanKindServer
+	KindClient   = trace.SpanKindClient
+)
+
+type StatusCode = codes.Code
+
+const (
+	StatusUnset = codes.Unset
+	StatusOK    = codes.Ok
+	StatusError = codes.Error
+)
+
+// Attribute is a key and a string, int64, float64 or bool value
+type Attribute = attribute.KeyValue
+
+func String(key, value string) Attribute    { return attribute.String(key, value) }
+func Int(key string, value int) Attribute   { return attribute.Int(key, value) }
+func Bool(key string, value bool) Attribute { return attribute.Bool(key, value) }
+
+// Span is an operation being traced. While tracing is off spans aren't recorded, but every
+// method can be called all the same.
+type Span struct {
+	trace.Span
+}
+
+// RecordError records err on the span and marks the span as failed, if err isn't nil
+func (s *Span) RecordError(err error) {
+	if err != nil {
+		s.Span.RecordError(err)
+		s.Span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// Start starts a span as a child of the span carried by ctx, or of the remote parent
+// extracted from an incoming request, and returns a context carrying it
+func Start(ctx context.Context, name string, kind SpanKind, attributes ...Attribute) (context.Context, *Span) {
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attributes...))
+	return ctx, &Span{Span: span}
+}
+
+var propagator = propagation.TraceContext{}
+
+// Extract returns a context carrying the remote parent in the traceparent header of h, if any
+func Extract(ctx context.Context, h http.Header) context.Context {
+	return propagator.Extract(ctx, propagation.HeaderCarrier(h))
+}
+
+// Inject sets the traceparent header of an outgoing request to the span carried by ctx.
+// Without one, a remote parent is passed on, so a trace that isn't recorded here still
+// links the services around this one.
+func Inject(ctx context.Context, h http.Header) {
+	propagator.Inject(ctx, propagation.HeaderCarrier(h))
+}
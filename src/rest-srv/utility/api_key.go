@@ -0,0 +1,36 @@
+package utility
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// apiKeyMarker starts every API key, telling them apart from other bearer tokens
+const apiKeyMarker = "rsk_"
+
+// NewAPIKey returns a new API key "rsk_<prefix>_<secret>", the prefix identifying it, which
+// may be shown, and the hash to store
+func NewAPIKey() (key, prefix, hash string) {
+	prefix = apiKeyMarker + strings.ToLower(rand.Text()[:8])
+	key = prefix + "_" + strings.ToLower(rand.Text())
+	return key, prefix, HashAPIKey(key)
+}
+
+// ParseAPIKey returns the prefix of key, false when key is not shaped like an API key
+func ParseAPIKey(key string) (string, bool) {
+	if !strings.HasPrefix(key, apiKeyMarker) {
+		return "", false
+	}
+	prefix, secret, ok := strings.Cut(key[len(apiKeyMarker):], "_")
+	if !ok || prefix == "" || secret == "" {
+		return "", false
+	}
+	return apiKeyMarker + prefix, true
+}
+
+func HashAPIKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
@@ -1,13 +1,35 @@
 package utility
 
 import (
+	"context"
 	"errors"
-	"log"
-	"os"
+	"log/slog"
+	"runtime"
+	"time"
 )
 
+// ErrorHandler logs err and returns a new error with message, which is safe to show to clients
 func ErrorHandler(err error, message string) error {
-	errorLogger := log.New(os.Stderr, "ERROR: ", log.Ldate|log.Ltime|log.Lshortfile)
-	errorLogger.Println(message, err)
+	logError(context.Background(), err, message)
 	return errors.New(message)
 }
+
+// ErrorHandlerContext is ErrorHandler logging with the logger carried by ctx, so the entry
+// has the id of the request that failed
+func ErrorHandlerContext(ctx context.Context, err error, message string) error {
+	logError(ctx, err, message)
+	return errors.New(message)
+}
+
+func logError(ctx context.Context, err error, message string) {
+	logger := Logger(ctx)
+	if !logger.Enabled(ctx, slog.LevelError) {
+		return
+	}
+	// Report the caller of the error handler as the source rather than this file
+	var pcs [1]uintptr
+	runtime.Callers(3, pcs[:])
+	record := slog.NewRecord(time.Now(), slog.LevelError, message, pcs[0])
+	record.AddAttrs(slog.Any("error", err))
+	logger.Handler().Handle(ctx, record)
+}
@@ -1,35 +1,48 @@
 package utility
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
 	"errors"
-	"fmt"
-	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func SignToken(userId, username, role string) (string, error) {
+// jwtSecret and jwtExpiresIn are set from the configuration at startup
+var (
+	jwtSecret    []byte
+	jwtExpiresIn time.Duration
+)
 
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		return "", ErrorHandler(errors.New("JWT_SECRET is not set"), "Internal server error")
-	}
-	expiresIn := os.Getenv("JWT_EXPIRES_IN")
-	if expiresIn == "" {
-		return "", ErrorHandler(errors.New("JWT_EXPIRES_IN is not set"), "Internal server error")
-	}
-	expiresInDuration, err := time.ParseDuration(expiresIn)
-	if err != nil {
-		return "", ErrorHandler(err, "Internal server error")
+// SetJWTSettings sets the key signing the session tokens and their lifetime
+func SetJWTSettings(secret string, expiresIn time.Duration) {
+	jwtSecret = []byte(secret)
+	jwtExpiresIn = expiresIn
+}
+
+// TokenExpiresIn returns the lifetime of the session tokens
+func TokenExpiresIn() time.Duration {
+	return jwtExpiresIn
+}
+
+// SignToken signs a session token for the user. Its jti claim identifies it, so it can be
+// revoked before it expires, and its iat claim tells whether it predates a password change.
+func SignToken(userId, username, role string) (string, error) {
+	if len(jwtSecret) == 0 {
+		return "", ErrorHandler(errors.New("JWT secret is not set"), "Internal server error")
 	}
+	now := time.Now()
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"uid":  userId,
 		"user": username,
 		"role": role,
-		"exp":  time.Now().Add(expiresInDuration).Unix(),
+		"jti":  rand.Text(),
+		"iat":  now.Unix(),
+		"exp":  now.Add(jwtExpiresIn).Unix(),
 	})
-	signedToken, err := token.SignedString([]byte(jwtSecret))
+	signedToken, err := token.SignedString(jwtSecret)
 	if err != nil {
 		return "", ErrorHandler(err, "Internal server error")
 	}
@@ -37,15 +50,14 @@ func SignToken(userId, username, role string) (string, error) {
 }
 
 func VerifyToken(token string) (jwt.MapClaims, error) {
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		return nil, ErrorHandler(errors.New("JWT_SECRET is not set"), "Internal server error")
+	if len(jwtSecret) == 0 {
+		return nil, ErrorHandler(errors.New("JWT secret is not set"), "Internal server error")
 	}
 	parsedToken, err := jwt.Parse(token, func(token *jwt.Token) (any, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, ErrorHandler(errors.New("invalid signing method"), "invalid signing method")
 		}
-		return []byte(jwtSecret), nil
+		return jwtSecret, nil
 	})
 	if err != nil {
 		return nil, ErrorHandler(err, "invalid token")
@@ -54,6 +66,50 @@ func VerifyToken(token string) (jwt.MapClaims, error) {
 	if !ok {
 		return nil, ErrorHandler(errors.New("invalid token claims"), "invalid token claims")
 	}
-	fmt.Println("claims: ", claims)
+	return claims, nil
+}
+
+// mfaChallengeKey signs the MFA challenge tokens. It is derived from the JWT secret rather
+// than being it, so that a challenge token never verifies as a session token.
+func mfaChallengeKey() []byte {
+	mac := hmac.New(sha256.New, jwtSecret)
+	mac.Write([]byte("mfa challenge"))
+	return mac.Sum(nil)
+}
+
+// SignMFAChallenge signs the token an exec who gave the right password exchanges, along with
+// a TOTP code, for a session. Its jti claim identifies it, so it can be used once.
+func SignMFAChallenge(userId string, expiresIn time.Duration) (string, error) {
+	if len(jwtSecret) == 0 {
+		return "", ErrorHandler(errors.New("JWT secret is not set"), "Internal server error")
+	}
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"uid": userId,
+		"jti": rand.Text(),
+		"iat": now.Unix(),
+		"exp": now.Add(expiresIn).Unix(),
+	})
+	signedToken, err := token.SignedString(mfaChallengeKey())
+	if err != nil {
+		return "", ErrorHandler(err, "Internal server error")
+	}
+	return signedToken, nil
+}
+
+func VerifyMFAChallenge(token string) (jwt.MapClaims, error) {
+	if len(jwtSecret) == 0 {
+		return nil, ErrorHandler(errors.New("JWT secret is not set"), "Internal server error")
+	}
+	parsedToken, err := jwt.Parse(token, func(token *jwt.Token) (any, error) {
+		return mfaChallengeKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, ErrorHandler(err, "invalid mfa token")
+	}
+	claims, ok := parsedToken.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrorHandler(errors.New("invalid token claims"), "invalid token claims")
+	}
 	return claims, nil
 }
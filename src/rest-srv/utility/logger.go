@@ -0,0 +1,91 @@
+package utility
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// logLevel is shared by every logger so the level can be changed while the server runs
+var logLevel = new(slog.LevelVar)
+
+// Attribute keys containing one of these are never logged
+var secretKeys = []string{"password", "secret", "token", "authorization", "cookie", "api_key", "apikey", "otp"}
+
+// JWTs and the hex reset tokens can end up inside error messages
+var secretValues = regexp.MustCompile(`eyJ[\w-]+\.[\w-]+\.[\w-]+|\b[0-9a-f]{64}\b`)
+
+type loggerContextKey struct{}
+
+// SetupLogger makes a JSON logger writing to w the default logger
+func SetupLogger(w io.Writer, level string) error {
+	if err := SetLogLevel(level); err != nil {
+		return err
+	}
+	slog.SetDefault(slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+		AddSource:   true,
+		Level:       logLevel,
+		ReplaceAttr: redact,
+	})))
+	return nil
+}
+
+// SetLogLevel changes the level of every logger: debug, info, warn or error
+func SetLogLevel(level string) error {
+	var parsed slog.Level
+	if err := parsed.UnmarshalText([]byte(level)); err != nil {
+		return err
+	}
+	logLevel.Set(parsed)
+	return nil
+}
+
+func LogLevel() slog.Level {
+	return logLevel.Level()
+}
+
+func redact(groups []string, attr slog.Attr) slog.Attr {
+	key := strings.ToLower(attr.Key)
+	for _, secretKey := range secretKeys {
+		if strings.Contains(key, secretKey) {
+			return slog.String(attr.Key, redacted)
+		}
+	}
+	if attr.Value.Kind() == slog.KindString {
+		return slog.String(attr.Key, secretValues.ReplaceAllString(attr.Value.String(), redacted))
+	}
+	if err, ok := attr.Value.Any().(error); ok {
+		return slog.String(attr.Key, secretValues.ReplaceAllString(err.Error(), redacted))
+	}
+	return attr
+}
+
+// WithLogger returns a context carrying logger
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, logger)
+}
+
+// Logger returns the logger carried by ctx, which is tagged with the request id, or the default logger
+func Logger(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerContextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+type requestIDContextKey struct{}
+
+// WithRequestID returns a context carrying the id of the request being served
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, requestID)
+}
+
+// RequestID returns the id of the request being served, or ""
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDContextKey{}).(string)
+	return requestID
+}
@@ -0,0 +1,39 @@
+package utility
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// NullTime is a wrapper around sql.NullTime that marshals to an RFC 3339 string or null in JSON
+type NullTime struct {
+	sql.NullTime
+}
+
+// NewNullTime returns a valid NullTime holding t
+func NewNullTime(t time.Time) NullTime {
+	return NullTime{NullTime: sql.NullTime{Time: t, Valid: true}}
+}
+
+func (nt NullTime) MarshalJSON() ([]byte, error) {
+	if nt.Valid {
+		return json.Marshal(nt.Time)
+	}
+	return json.Marshal(nil)
+}
+
+func (nt *NullTime) UnmarshalJSON(data []byte) error {
+	var t *time.Time
+	if err := json.Unmarshal(data, &t); err != nil {
+		return err
+	}
+	if t != nil {
+		nt.Valid = true
+		nt.Time = *t
+	} else {
+		nt.Valid = false
+		nt.Time = time.Time{}
+	}
+	return nil
+}
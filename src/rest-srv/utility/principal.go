@@ -0,0 +1,47 @@
+package utility
+
+import "context"
+
+// ContextKey is the type of the request context values set for the code reading them
+type ContextKey string
+
+type PrincipalKind string
+
+const (
+	// PrincipalUser is an exec authenticated by the JWT of their session
+	PrincipalUser PrincipalKind = "user"
+	// PrincipalService is an internal job authenticated by its client certificate
+	PrincipalService PrincipalKind = "service"
+	// PrincipalAPIKey is a machine client acting as an exec with one of their API keys
+	PrincipalAPIKey PrincipalKind = "api_key"
+)
+
+// Principal is who a request is made on behalf of, however they authenticated
+type Principal struct {
+	Kind PrincipalKind
+	// ID is the exec id for users and API keys, and "service:<name>" for services, so the
+	// two never collide
+	ID   string
+	Name string
+	Role string
+	// Scopes limit what an API key may do within the role of its exec
+	Scopes []string
+}
+
+type principalContextKey struct{}
+
+// WithPrincipal returns a context carrying the principal of the request. The role, username
+// and userId context keys are set as well for the code reading them.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	ctx = context.WithValue(ctx, principalContextKey{}, p)
+	ctx = context.WithValue(ctx, ContextKey("role"), p.Role)
+	ctx = context.WithValue(ctx, ContextKey("username"), p.Name)
+	ctx = context.WithValue(ctx, ContextKey("userId"), p.ID)
+	return ctx
+}
+
+// PrincipalFromContext returns the principal of the request, if it is authenticated
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalContextKey{}).(Principal)
+	return p, ok
+}
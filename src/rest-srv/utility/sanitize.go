@@ -0,0 +1,8 @@
+package utility
+
+import "github.com/microcosm-cc/bluemonday"
+
+// SanitizeString strips markup that could be used for XSS from user input
+func SanitizeString(data string) string {
+	return bluemonday.UGCPolicy().Sanitize(data)
+}
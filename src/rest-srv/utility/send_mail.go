@@ -1,19 +1,61 @@
 package utility
 
 import (
+	"context"
+	"net"
+	"rest-srv/metrics"
+	"rest-srv/tracing"
+	"strconv"
+
 	"gopkg.in/gomail.v2"
 )
 
-func SendMail(to string, subject string, body string) error {
+// The SMTP server is set from the configuration at startup
+var (
+	mailHost     string
+	mailPort     int
+	mailUsername string
+	mailPassword string
+	mailFrom     string
+)
+
+// SetMailSettings sets the SMTP server the emails are sent through and their sender
+func SetMailSettings(host string, port int, username, password, from string) {
+	mailHost, mailPort = host, port
+	mailUsername, mailPassword = username, password
+	mailFrom = from
+}
+
+func SendMail(ctx context.Context, to string, subject string, body string) error {
+	_, span := tracing.Start(ctx, "SendMail", tracing.KindClient,
+		tracing.String("messaging.system", "smtp"),
+		tracing.String("server.address", mailHost),
+		tracing.Int("server.port", mailPort),
+	)
+	defer span.End()
+
 	m := gomail.NewMessage()
-	m.SetHeader("From", "your-email@example.com")
+	m.SetHeader("From", mailFrom)
 	m.SetHeader("To", to)
 	m.SetHeader("Subject", subject)
 	m.SetBody("text/html", body)
 
-	d := gomail.NewDialer("mailhog", 1025, "", "")
+	d := gomail.NewDialer(mailHost, mailPort, mailUsername, mailPassword)
 	if err := d.DialAndSend(m); err != nil {
+		span.RecordError(err)
+		metrics.EmailsSent.Inc("failure")
 		return err
 	}
+	metrics.EmailsSent.Inc("success")
 	return nil
 }
+
+// CheckMailServer reports whether the SMTP server accepts connections
+func CheckMailServer(ctx context.Context) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(mailHost, strconv.Itoa(mailPort)))
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
@@ -0,0 +1,100 @@
+package utility
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 seed of RFC 6238 appendix B, the ASCII string "12345678901234567890"
+var rfc6238Secret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+// The SHA1 test vectors of RFC 6238 appendix B. The RFC gives eight digit codes, the last six
+// of which are the six digit codes.
+func TestTOTPCode(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		step := TOTPStep(time.Unix(tt.unix, 0))
+		got, err := TOTPCode(rfc6238Secret, step)
+		if err != nil {
+			t.Fatalf("TOTPCode at %d: %v", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("TOTPCode at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+
+	lower, err := TOTPCode(strings.ToLower(rfc6238Secret), 1)
+	if err != nil || lower != "287082" {
+		t.Errorf("TOTPCode with a lower case secret = %s, %v", lower, err)
+	}
+	if _, err := TOTPCode("not base32!", 1); err == nil {
+		t.Error("TOTPCode with an invalid secret succeeded")
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	at := time.Unix(1111111111, 0)
+	current := TOTPStep(at)
+	codeAt := func(step int64) string {
+		code, err := TOTPCode(rfc6238Secret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		name string
+		code string
+		step int64
+		ok   bool
+	}{
+		{"current step", codeAt(current), current, true},
+		{"previous step", codeAt(current - 1), current - 1, true},
+		{"next step", codeAt(current + 1), current + 1, true},
+		{"two steps behind", codeAt(current - 2), 0, false},
+		{"two steps ahead", codeAt(current + 2), 0, false},
+		{"eight digit code", "07081804", 0, false},
+		{"empty code", "", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := VerifyTOTP(rfc6238Secret, tt.code, at)
+			if ok != tt.ok || step != tt.step {
+				t.Errorf("VerifyTOTP(%q) = %d, %t, want %d, %t", tt.code, step, ok, tt.step, tt.ok)
+			}
+		})
+	}
+}
+
+func TestNewTOTPSecret(t *testing.T) {
+	secret := NewTOTPSecret()
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil || len(key) != 20 {
+		t.Fatalf("NewTOTPSecret = %q: %d bytes, %v", secret, len(key), err)
+	}
+	if NewTOTPSecret() == secret {
+		t.Error("NewTOTPSecret returned the same secret twice")
+	}
+
+	uri, err := url.Parse(TOTPURI("Rest Srv", "ada@example.com", secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := uri.Query()
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || query.Get("secret") != secret || query.Get("digits") != "6" || query.Get("period") != "30" {
+		t.Errorf("TOTPURI = %s", uri)
+	}
+}
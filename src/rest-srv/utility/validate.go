@@ -0,0 +1,305 @@
+package utility
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// FieldError describes a single rule violation. Field is a path such as
+// "email" or "[3].email" when the value came from a list.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors collects every violation found while validating a value
+type ValidationErrors []FieldError
+
+func (v ValidationErrors) Error() string {
+	parts := make([]string, len(v))
+	for i, fe := range v {
+		parts[i] = fmt.Sprintf("%s: %s", fe.Field, fe.Message)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// AtIndex prefixes every field path with the list index, e.g. "email" -> "[3].email"
+func (v ValidationErrors) AtIndex(index int) ValidationErrors {
+	prefixed := make(ValidationErrors, len(v))
+	for i, fe := range v {
+		prefixed[i] = FieldError{Field: fmt.Sprintf("[%d].%s", index, fe.Field), Message: fe.Message}
+	}
+	return prefixed
+}
+
+type rule struct {
+	name  string
+	param string
+}
+
+// parseRules splits a tag like `email,max=255,oneof=admin manager exec`
+func parseRules(tag string) []rule {
+	var rules []rule
+	for _, part := range strings.Split(tag, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, param, _ := strings.Cut(part, "=")
+		rules = append(rules, rule{name: name, param: param})
+	}
+	return rules
+}
+
+// fieldRules returns the json name of the field and the rules it must satisfy.
+// A `not_null` db tag is treated as `required`.
+func fieldRules(field reflect.StructField) (string, []rule) {
+	jsonName := strings.Split(field.Tag.Get("json"), ",")[0]
+	if jsonName == "" {
+		jsonName = field.Name
+	}
+	rules := parseRules(field.Tag.Get("validate"))
+	dbTag := field.Tag.Get("db")
+	columnName := strings.Split(dbTag, ",")[0]
+	// Skip required check for the id and for bool fields since false is a valid default value
+	if columnName != "id" && field.Type.Kind() != reflect.Bool && slices.Contains(strings.Split(dbTag, ","), "not_null") {
+		rules = append([]rule{{name: "required"}}, rules...)
+	}
+	return jsonName, rules
+}
+
+// ValidateStruct checks every field of a struct (or pointer to struct) against its
+// `validate` tag and `not_null` db tag and returns all violations at once.
+func ValidateStruct(value any) error {
+	val := reflect.Indirect(reflect.ValueOf(value))
+	valType := val.Type()
+	var errs ValidationErrors
+	for i := 0; i < val.NumField(); i++ {
+		name, rules := fieldRules(valType.Field(i))
+		for _, r := range rules {
+			if msg := checkRule(r, val.Field(i)); msg != "" {
+				errs = append(errs, FieldError{Field: name, Message: msg})
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Patchable is implemented by the models a PATCH may change. PatchableFields lists the json
+// names of the fields a client may set; the others, such as the password of an exec, are
+// only changed by dedicated routes or by the server itself.
+type Patchable interface {
+	PatchableFields() []string
+}
+
+// ValidatePartial validates a PATCH style map of json field names to values against
+// the rules declared on model. Unknown fields, fields that are not patchable, null for
+// fields that are not nullable and values of the wrong type are reported as violations
+// as well. The id key is ignored since it only identifies the record.
+func ValidatePartial(model Patchable, fields map[string]any) error {
+	patchable := model.PatchableFields()
+	modelType := reflect.Indirect(reflect.ValueOf(model)).Type()
+	byName := make(map[string]reflect.StructField)
+	for i := 0; i < modelType.NumField(); i++ {
+		name, _ := fieldRules(modelType.Field(i))
+		byName[name] = modelType.Field(i)
+	}
+
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	var errs ValidationErrors
+	for _, key := range keys {
+		if key == "id" {
+			continue
+		}
+		field, ok := byName[key]
+		if !ok {
+			errs = append(errs, FieldError{Field: key, Message: "unknown field"})
+			continue
+		}
+		if !slices.Contains(patchable, key) {
+			errs = append(errs, FieldError{Field: key, Message: "cannot be patched"})
+			continue
+		}
+		if fields[key] == nil && field.Type != reflect.TypeOf(NullString{}) {
+			errs = append(errs, FieldError{Field: key, Message: "cannot be null"})
+			continue
+		}
+		fieldVal, ok := ConvertJSONValue(fields[key], field.Type)
+		if !ok {
+			errs = append(errs, FieldError{Field: key, Message: fmt.Sprintf("must be of type %s", jsonTypeName(field.Type))})
+			continue
+		}
+		_, rules := fieldRules(field)
+		for _, r := range rules {
+			if msg := checkRule(r, fieldVal); msg != "" {
+				errs = append(errs, FieldError{Field: key, Message: msg})
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// CheckUnpatched reports the fields outside the patchable fields of before, other than the
+// id, whose JSON value differs in after, the result of applying a merge patch or JSON patch
+// to before
+func CheckUnpatched[T Patchable](before, after T) error {
+	patchable := before.PatchableFields()
+	beforeVal := reflect.Indirect(reflect.ValueOf(before))
+	afterVal := reflect.Indirect(reflect.ValueOf(after))
+	var errs ValidationErrors
+	for i := 0; i < beforeVal.NumField(); i++ {
+		name, _ := fieldRules(beforeVal.Type().Field(i))
+		if name == "id" || slices.Contains(patchable, name) {
+			continue
+		}
+		beforeJSON, err := json.Marshal(beforeVal.Field(i).Interface())
+		if err != nil {
+			return err
+		}
+		afterJSON, err := json.Marshal(afterVal.Field(i).Interface())
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(beforeJSON, afterJSON) {
+			errs = append(errs, FieldError{Field: name, Message: "cannot be patched"})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// ConvertJSONValue turns a value decoded from JSON into a value of the field type. It
+// reports false when the value has another type.
+func ConvertJSONValue(value any, fieldType reflect.Type) (reflect.Value, bool) {
+	target := reflect.New(fieldType).Elem()
+	if fieldType == reflect.TypeOf(NullString{}) {
+		switch v := value.(type) {
+		case nil:
+			return target, true
+		case string:
+			target.Set(reflect.ValueOf(NullString{NullString: sql.NullString{String: v, Valid: true}}))
+			return target, true
+		}
+		return target, false
+	}
+	switch fieldType.Kind() {
+	case reflect.String:
+		if s, ok := value.(string); ok {
+			target.SetString(s)
+			return target, true
+		}
+	case reflect.Bool:
+		if b, ok := value.(bool); ok {
+			target.SetBool(b)
+			return target, true
+		}
+	case reflect.Int, reflect.Int64, reflect.Int32:
+		if f, ok := value.(float64); ok && f == float64(int64(f)) {
+			target.SetInt(int64(f))
+			return target, true
+		}
+	}
+	return target, false
+}
+
+func jsonTypeName(t reflect.Type) string {
+	if t == reflect.TypeOf(NullString{}) {
+		return "string or null"
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int64, reflect.Int32:
+		return "integer"
+	default:
+		return "string"
+	}
+}
+
+// checkRule returns an error message if v violates r, or "" if it passes
+func checkRule(r rule, v reflect.Value) string {
+	if ns, ok := v.Interface().(NullString); ok {
+		if !ns.Valid {
+			if r.name == "required" {
+				return "is required"
+			}
+			return ""
+		}
+		v = reflect.ValueOf(ns.String)
+	}
+
+	switch r.name {
+	case "required":
+		if v.IsZero() {
+			return "is required"
+		}
+	case "email":
+		if v.Kind() != reflect.String || v.String() == "" {
+			return ""
+		}
+		addr, err := mail.ParseAddress(v.String())
+		if err != nil || addr.Address != v.String() {
+			return "must be a valid email address"
+		}
+	case "min", "max":
+		limit, err := strconv.Atoi(r.param)
+		if err != nil {
+			return fmt.Sprintf("invalid %s rule", r.name)
+		}
+		var size int
+		unit := ""
+		switch v.Kind() {
+		case reflect.String:
+			size = utf8.RuneCountInString(v.String())
+			unit = " characters"
+		case reflect.Int, reflect.Int64, reflect.Int32:
+			size = int(v.Int())
+		default:
+			return ""
+		}
+		if r.name == "min" && size < limit {
+			return fmt.Sprintf("must be at least %d%s", limit, unit)
+		}
+		if r.name == "max" && size > limit {
+			return fmt.Sprintf("must be at most %d%s", limit, unit)
+		}
+	case "url":
+		if v.Kind() != reflect.String || v.String() == "" {
+			return ""
+		}
+		parsed, err := url.Parse(v.String())
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return "must be a valid http(s) URL"
+		}
+	case "oneof":
+		if v.Kind() != reflect.String || v.String() == "" {
+			return ""
+		}
+		if !slices.Contains(strings.Fields(r.param), v.String()) {
+			return fmt.Sprintf("must be one of: %s", r.param)
+		}
+	}
+	return ""
+}
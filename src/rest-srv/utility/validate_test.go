@@ -0,0 +1,170 @@
+package utility
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+// person declares the rules of the models of the API
+type person struct {
+	ID       int        `json:"id,omitempty" db:"id,primary_key,auto_increment"`
+	Name     string     `json:"name,omitempty" db:"name,not_null" validate:"min=2,max=5"`
+	Email    string     `json:"email,omitempty" db:"email,not_null,unique" validate:"email,max=255"`
+	Role     string     `json:"role,omitempty" db:"role,not_null" validate:"oneof=admin manager exec"`
+	Site     string     `json:"site,omitempty" db:"site" validate:"url"`
+	Nickname NullString `json:"nickname,omitempty" db:"nickname" validate:"max=5"`
+	Secret   string     `json:"secret,omitempty" db:"secret"`
+	Inactive bool       `json:"inactive,omitempty" db:"inactive,not_null"`
+	Age      int        `json:"age,omitempty" db:"age" validate:"max=150"`
+}
+
+func (p person) PatchableFields() []string {
+	return []string{"name", "email", "role", "site", "nickname", "inactive", "age"}
+}
+
+func validPerson() person {
+	return person{Name: "Ada", Email: "ada@example.com", Role: "admin"}
+}
+
+func nullString(s string) NullString {
+	return NullString{NullString: sql.NullString{String: s, Valid: true}}
+}
+
+func assertViolations(t *testing.T, err error, want ValidationErrors) {
+	t.Helper()
+	if len(want) == 0 {
+		if err != nil {
+			t.Errorf("got %v, want no violation", err)
+		}
+		return
+	}
+	violations, ok := err.(ValidationErrors)
+	if !ok {
+		t.Fatalf("got %v, want %v", err, want)
+	}
+	if !reflect.DeepEqual(violations, want) {
+		t.Errorf("got %v, want %v", violations, want)
+	}
+}
+
+func TestValidateStruct(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(p *person)
+		want   ValidationErrors
+	}{
+		{name: "valid", modify: func(p *person) {}},
+		{name: "not_null is required", modify: func(p *person) { p.Name = "" }, want: ValidationErrors{
+			{Field: "name", Message: "is required"},
+			{Field: "name", Message: "must be at least 2 characters"},
+		}},
+		{name: "not_null bool may be false", modify: func(p *person) { p.Inactive = false }},
+		{name: "nullable may be empty", modify: func(p *person) { p.Site = "" }},
+		{name: "invalid email", modify: func(p *person) { p.Email = "ada" }, want: ValidationErrors{
+			{Field: "email", Message: "must be a valid email address"},
+		}},
+		{name: "email with a display name", modify: func(p *person) { p.Email = "Ada <ada@example.com>" }, want: ValidationErrors{
+			{Field: "email", Message: "must be a valid email address"},
+		}},
+		{name: "max length in characters", modify: func(p *person) { p.Name = "Adèle" }},
+		{name: "over max length", modify: func(p *person) { p.Name = "Adelaide" }, want: ValidationErrors{
+			{Field: "name", Message: "must be at most 5 characters"},
+		}},
+		{name: "over max integer", modify: func(p *person) { p.Age = 151 }, want: ValidationErrors{
+			{Field: "age", Message: "must be at most 150"},
+		}},
+		{name: "not one of", modify: func(p *person) { p.Role = "root" }, want: ValidationErrors{
+			{Field: "role", Message: "must be one of: admin manager exec"},
+		}},
+		{name: "invalid url", modify: func(p *person) { p.Site = "ftp://example.com" }, want: ValidationErrors{
+			{Field: "site", Message: "must be a valid http(s) URL"},
+		}},
+		{name: "null string is not checked", modify: func(p *person) { p.Nickname = NullString{} }},
+		{name: "null string over max length", modify: func(p *person) { p.Nickname = nullString("Ada Lovelace") }, want: ValidationErrors{
+			{Field: "nickname", Message: "must be at most 5 characters"},
+		}},
+		{name: "every violation", modify: func(p *person) { p.Email = ""; p.Role = "" }, want: ValidationErrors{
+			{Field: "email", Message: "is required"},
+			{Field: "role", Message: "is required"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := validPerson()
+			tt.modify(&p)
+			assertViolations(t, ValidateStruct(&p), tt.want)
+		})
+	}
+}
+
+func TestValidatePartial(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields map[string]any
+		want   ValidationErrors
+	}{
+		{name: "valid", fields: map[string]any{"id": 3, "name": "Ada", "age": float64(36), "inactive": true}},
+		{name: "unknown field", fields: map[string]any{"nmae": "Ada"}, want: ValidationErrors{
+			{Field: "nmae", Message: "unknown field"},
+		}},
+		{name: "not patchable", fields: map[string]any{"secret": "x"}, want: ValidationErrors{
+			{Field: "secret", Message: "cannot be patched"},
+		}},
+		{name: "null", fields: map[string]any{"name": nil}, want: ValidationErrors{
+			{Field: "name", Message: "cannot be null"},
+		}},
+		{name: "nullable null", fields: map[string]any{"nickname": nil}},
+		{name: "wrong type", fields: map[string]any{"name": float64(3), "age": 1.5, "inactive": "yes"}, want: ValidationErrors{
+			{Field: "age", Message: "must be of type integer"},
+			{Field: "inactive", Message: "must be of type boolean"},
+			{Field: "name", Message: "must be of type string"},
+		}},
+		{name: "not_null emptied", fields: map[string]any{"email": ""}, want: ValidationErrors{
+			{Field: "email", Message: "is required"},
+		}},
+		{name: "rules of the fields", fields: map[string]any{"email": "ada", "role": "root", "name": "Adelaide"}, want: ValidationErrors{
+			{Field: "email", Message: "must be a valid email address"},
+			{Field: "name", Message: "must be at most 5 characters"},
+			{Field: "role", Message: "must be one of: admin manager exec"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertViolations(t, ValidatePartial(person{}, tt.fields), tt.want)
+		})
+	}
+}
+
+func TestCheckUnpatched(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(p *person)
+		want   ValidationErrors
+	}{
+		{name: "unchanged", modify: func(p *person) {}},
+		{name: "patchable fields", modify: func(p *person) { p.Name = "Grace"; p.Nickname = nullString("G") }},
+		{name: "id is ignored", modify: func(p *person) { p.ID = 9 }},
+		{name: "not patchable", modify: func(p *person) { p.Secret = "x" }, want: ValidationErrors{
+			{Field: "secret", Message: "cannot be patched"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := validPerson()
+			after := before
+			tt.modify(&after)
+			assertViolations(t, CheckUnpatched(before, after), tt.want)
+		})
+	}
+}
+
+func TestValidationErrorsAtIndex(t *testing.T) {
+	errs := ValidationErrors{{Field: "email", Message: "is required"}}.AtIndex(3)
+	if got := errs.Error(); got != "[3].email: is required" {
+		t.Errorf("got %q", got)
+	}
+	if got := (ValidationErrors{{Field: "role", Message: "x"}, {Field: "age", Message: "y"}}).Error(); got != "role: x; age: y" {
+		t.Errorf("got %q", got)
+	}
+}
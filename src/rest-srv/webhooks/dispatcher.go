@@ -0,0 +1,190 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"rest-srv/db"
+	"rest-srv/models"
+	"rest-srv/tracing"
+)
+
+const (
+	batchSize      = 100
+	requestTimeout = 10 * time.Second
+	// deliveryLease keeps a claimed delivery from being picked up again while it is being sent
+	deliveryLease = 2 * requestTimeout
+	baseBackoff   = 30 * time.Second
+	maxBackoff    = 6 * time.Hour
+)
+
+type dispatcher struct {
+	pollInterval time.Duration
+	maxAttempts  int
+	client       *http.Client
+	// ctx is the context of every dispatch, canceled when Stop gives up waiting so the
+	// deliveries being sent are aborted
+	ctx    context.Context
+	cancel context.CancelFunc
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// NewDispatcher delivers outbox events to the webhook subscriptions every pollInterval.
+// A delivery that still fails after maxAttempts is dead-lettered.
+func NewDispatcher(pollInterval time.Duration, maxAttempts int) *dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &dispatcher{
+		ctx:          ctx,
+		cancel:       cancel,
+		pollInterval: pollInterval,
+		maxAttempts:  maxAttempts,
+		client:       &http.Client{Timeout: requestTimeout},
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+	}
+	go d.run()
+	return d
+}
+
+func (d *dispatcher) run() {
+	defer close(d.done)
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-time.After(d.pollInterval):
+		}
+		d.dispatch(d.ctx)
+	}
+}
+
+// Stop stops polling and waits until ctx is done for the deliveries being sent to finish,
+// then aborts those still in flight. Deliveries that were claimed but not sent are retried
+// once their lease expires.
+func (d *dispatcher) Stop(ctx context.Context) error {
+	defer d.cancel()
+	close(d.stop)
+	select {
+	case <-d.done:
+		return nil
+	case <-ctx.Done():
+		d.cancel()
+		<-d.done
+		return ctx.Err()
+	}
+}
+
+func (d *dispatcher) dispatch(ctx context.Context) {
+	for {
+		count, err := db.FanOutOutboxEvents(ctx, batchSize)
+		if err != nil || count < batchSize {
+			break
+		}
+	}
+
+	pending, err := db.ClaimDueWebhookDeliveries(ctx, batchSize, deliveryLease)
+	if err != nil {
+		return
+	}
+	var wg sync.WaitGroup
+	for _, p := range pending {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.deliver(ctx, p)
+		}()
+	}
+	wg.Wait()
+}
+
+func (d *dispatcher) deliver(ctx context.Context, p models.PendingDelivery) {
+	ctx, span := tracing.Start(ctx, "webhook delivery", tracing.KindClient,
+		tracing.String("webhook.event", p.Event.EventType),
+		tracing.Int("webhook.delivery_id", int(p.Delivery.ID)),
+		tracing.Int("webhook.attempt", p.Delivery.Attempts+1),
+		tracing.String("http.request.method", http.MethodPost),
+	)
+	defer span.End()
+
+	start := time.Now()
+	statusCode, err := d.send(ctx, p)
+	duration := time.Since(start)
+	span.SetAttributes(tracing.Int("http.response.status_code", statusCode))
+	span.RecordError(err)
+	if ctx.Err() != nil {
+		// Aborted by Stop, which does not count as an attempt: the lease expires and the
+		// delivery is sent again
+		return
+	}
+
+	status := models.DeliveryDelivered
+	nextAttemptAt := time.Now()
+	if err != nil {
+		attempts := p.Delivery.Attempts + 1
+		if attempts >= d.maxAttempts {
+			status = models.DeliveryDead
+		} else {
+			status = models.DeliveryPending
+			nextAttemptAt = nextAttemptAt.Add(backoff(attempts))
+		}
+	}
+	db.RecordWebhookDeliveryAttempt(ctx, p.Delivery.ID, statusCode, err, duration, status, nextAttemptAt)
+}
+
+// send posts the event to the subscription URL. Any 2xx response counts as delivered.
+func (d *dispatcher) send(ctx context.Context, p models.PendingDelivery) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.Subscription.URL, bytes.NewReader(p.Event.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Id", strconv.FormatInt(p.Delivery.ID, 10))
+	req.Header.Set("X-Webhook-Event", p.Event.EventType)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+Sign(p.Subscription.Secret, timestamp, p.Event.Payload))
+	tracing.Inject(ctx, req.Header)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign returns the hex HMAC-SHA256 of "timestamp.body" with the subscription secret.
+// Receivers recompute it from the X-Webhook-Timestamp header and the raw body.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// backoff returns the delay before the next attempt: 30s doubled per failed attempt,
+// capped at 6h, with up to 20% jitter so failed deliveries don't retry in lockstep
+func backoff(attempts int) time.Duration {
+	delay := maxBackoff
+	if attempts < 20 {
+		delay = min(baseBackoff<<(attempts-1), maxBackoff)
+	}
+	return delay + time.Duration(rand.Int64N(int64(delay)/5))
+}